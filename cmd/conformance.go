@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/router"
+)
+
+// fixture asserts how the gateway routes one request
+type fixture struct {
+	Name    string `json:"name"`
+	Request struct {
+		Method  string            `json:"method"` // default GET
+		Path    string            `json:"path"`
+		Headers map[string]string `json:"headers"`
+	} `json:"request"`
+	Expect struct {
+		Status   int               `json:"status"`   // default 200
+		Route    *string           `json:"route"`    // route id, e.g. "GET /users"
+		Version  *string           `json:"version"`  // pinned API version
+		Pool     *string           `json:"pool"`     // named pool
+		Policies map[string]string `json:"policies"` // "" asserts the policy is unset
+		Rewrites struct {
+			Path         *string           `json:"path"`
+			Headers      map[string]string `json:"headers"` // "" asserts the header is not set
+			Removed      []string          `json:"removed"`
+			UpstreamHost *string           `json:"upstream_host"`
+		} `json:"rewrites"`
+	} `json:"expect"`
+}
+
+// runConformance implements the conformance subcommand: it routes every
+// request of a fixtures file through the configuration and exits non-zero
+// when any expectation fails
+func runConformance(args []string) {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	cfgPath := fs.String("config", "configs/config.json", "Path to configuration file")
+	profile := fs.String("profile", "", "Configuration profile to apply, such as staging or production (default $GATEWAY_PROFILE)")
+	fixturesPath := fs.String("fixtures", "conformance.json", "Path to the fixtures file")
+	verbose := fs.Bool("v", false, "Report passing fixtures too")
+	fs.Parse(args)
+
+	if *profile != "" {
+		config.SelectProfile(*profile)
+	}
+	cfg, err := config.LoadConfig(*cfgPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	data, err := os.ReadFile(*fixturesPath)
+	if err != nil {
+		log.Fatalf("Failed to read fixtures: %v", err)
+	}
+	var fixtures []fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		log.Fatalf("Failed to parse fixtures: %v", err)
+	}
+
+	failed := 0
+	for i, f := range fixtures {
+		name := f.Name
+		if name == "" {
+			name = fmt.Sprintf("fixture %d", i+1)
+		}
+		problems := f.check(cfg)
+		if len(problems) == 0 {
+			if *verbose {
+				fmt.Printf("PASS %s\n", name)
+			}
+			continue
+		}
+		failed++
+		fmt.Printf("FAIL %s\n", name)
+		for _, p := range problems {
+			fmt.Printf("    %s\n", p)
+		}
+	}
+
+	fmt.Printf("%d of %d fixtures passed\n", len(fixtures)-failed, len(fixtures))
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// check routes the fixture's request and returns the unmet expectations
+func (f fixture) check(cfg *config.Config) []string {
+	method := f.Request.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	r := httptest.NewRequest(method, f.Request.Path, nil)
+	for key, value := range f.Request.Headers {
+		r.Header.Set(key, value)
+	}
+	got := router.Explain(cfg, r)
+
+	var problems []string
+	expect := func(what, want, have string) {
+		if want != have {
+			problems = append(problems, fmt.Sprintf("%s: want %q, got %q", what, want, have))
+		}
+	}
+
+	status := f.Expect.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if got.Status != status {
+		problems = append(problems, fmt.Sprintf("status: want %d, got %d", status, got.Status))
+	}
+	if f.Expect.Route != nil {
+		expect("route", *f.Expect.Route, got.Route)
+	}
+	if f.Expect.Version != nil {
+		expect("version", *f.Expect.Version, got.Version)
+	}
+	if f.Expect.Pool != nil {
+		expect("pool", *f.Expect.Pool, got.Pool)
+	}
+	for _, key := range sortedKeys(f.Expect.Policies) {
+		expect("policy "+key, f.Expect.Policies[key], got.Policies[key])
+	}
+
+	rewrites := f.Expect.Rewrites
+	if rewrites.Path != nil {
+		expect("upstream path", *rewrites.Path, got.Rewrites.Path)
+	}
+	for _, key := range sortedKeys(rewrites.Headers) {
+		expect("header "+key, rewrites.Headers[key], got.Rewrites.Headers[http.CanonicalHeaderKey(key)])
+	}
+	if rewrites.Removed != nil {
+		removed := make([]string, len(rewrites.Removed))
+		for i, key := range rewrites.Removed {
+			removed[i] = http.CanonicalHeaderKey(key)
+		}
+		slices.Sort(removed)
+		expect("removed headers", strings.Join(removed, ", "), strings.Join(got.Rewrites.Removed, ", "))
+	}
+	if rewrites.UpstreamHost != nil {
+		expect("upstream host", *rewrites.UpstreamHost, got.Rewrites.UpstreamHost)
+	}
+	return problems
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/kube"
+	"dynamic-gateway/internal/resolver"
+)
+
+// resolveEndpoints returns cfg with every kubernetes:/// backend replaced by
+// the ready endpoints of its service and every dns:/// and dns+srv:///
+// backend by the addresses its name resolves to, watching names cfg newly
+// declares
+func (t *routeTable) resolveEndpoints(cfg *config.Config) (*config.Config, error) {
+	var services, names []string
+	forEachBackends(cfg, func(backends *[]config.Backend, _, _ string) {
+		for _, b := range *backends {
+			switch {
+			case kube.IsTarget(b.Address) && !slices.Contains(services, b.Address):
+				services = append(services, b.Address)
+			case resolver.IsTarget(b.Address) && !slices.Contains(names, b.Address):
+				names = append(names, b.Address)
+			}
+		}
+	})
+
+	t.mu.Lock()
+	if t.endpoints == nil && len(services) > 0 {
+		endpoints, err := kube.NewEndpoints(t.rediscover)
+		if err != nil {
+			t.mu.Unlock()
+			return nil, err
+		}
+		t.endpoints = endpoints
+	}
+	if t.resolver == nil && len(names) > 0 {
+		t.resolver = resolver.New(t.rediscover)
+	}
+	endpoints, dns := t.endpoints, t.resolver
+	t.mu.Unlock()
+
+	if endpoints != nil {
+		if err := endpoints.Watch(services); err != nil {
+			return nil, err
+		}
+	}
+	if dns != nil {
+		var interval time.Duration
+		if cfg.DNS != nil {
+			interval, _ = time.ParseDuration(cfg.DNS.Interval)
+		}
+		if err := dns.Watch(names, interval); err != nil {
+			return nil, err
+		}
+	}
+	if len(services) == 0 && len(names) == 0 {
+		return cfg, nil
+	}
+
+	resolved := *cfg
+	resolved.HTTPRoutes = slices.Clone(cfg.HTTPRoutes)
+	resolved.GRPCServices = slices.Clone(cfg.GRPCServices)
+	if cfg.DefaultBackend != nil {
+		d := *cfg.DefaultBackend
+		resolved.DefaultBackend = &d
+	}
+	forEachBackends(&resolved, func(backends *[]config.Backend, scheme, upstreamHost string) {
+		var expanded []config.Backend
+		for _, b := range *backends {
+			var addresses []string
+			switch {
+			case kube.IsTarget(b.Address):
+				addresses = endpoints.Resolve(b.Address)
+			case resolver.IsTarget(b.Address):
+				addresses = dns.Resolve(b.Address)
+				// Backends reached by IP address still expect their name
+				if host := resolver.Host(b.Address); host != "" {
+					if b.Host == "" && upstreamHost == "" {
+						b.Host = host
+					}
+					if b.TLS && b.TLSServerName == "" {
+						b.TLSServerName = host
+					}
+				}
+			default:
+				expanded = append(expanded, b)
+				continue
+			}
+
+			prefix := ""
+			if scheme == "http" {
+				prefix = "http://"
+				if b.TLS {
+					prefix = "https://"
+				}
+			}
+			for _, address := range addresses {
+				endpoint := b
+				endpoint.Address = prefix + address
+				expanded = append(expanded, endpoint)
+			}
+		}
+		*backends = expanded
+	})
+	return &resolved, nil
+}
+
+// rediscover applies the configuration again once a watched service's
+// endpoints or a resolved name's addresses change
+func (t *routeTable) rediscover() {
+	t.mu.Lock()
+	if t.switcher == nil {
+		// Still being created with the current endpoints
+		t.mu.Unlock()
+		return
+	}
+	merged := t.merged(&t.base)
+	t.mu.Unlock()
+
+	if _, err := t.apply(merged, nil); err != nil {
+		log.Printf("Failed to apply discovered endpoints: %v", err)
+	}
+}
+
+// forEachBackends calls fn with every backend list of cfg, the scheme its
+// addresses take ("http" for HTTP backends, "" for gRPC and auto-detected
+// ones) and the route's upstream_host. Route and service slices are modified
+// in place, so callers changing lists must clone them first.
+func forEachBackends(cfg *config.Config, fn func(backends *[]config.Backend, scheme, upstreamHost string)) {
+	for i := range cfg.HTTPRoutes {
+		route := &cfg.HTTPRoutes[i]
+		scheme := ""
+		if route.TargetProtocol == "" || route.TargetProtocol == "http" {
+			scheme = "http"
+		}
+		fn(&route.Backends, scheme, route.UpstreamHost)
+		if len(route.Versions) > 0 {
+			versions := make(map[string]config.RouteVersion, len(route.Versions))
+			for name, version := range route.Versions {
+				fn(&version.Backends, scheme, route.UpstreamHost)
+				versions[name] = version
+			}
+			route.Versions = versions
+		}
+		if len(route.Pools) > 0 {
+			pools := make(map[string][]config.Backend, len(route.Pools))
+			for name, backends := range route.Pools {
+				fn(&backends, scheme, route.UpstreamHost)
+				pools[name] = backends
+			}
+			route.Pools = pools
+		}
+		if len(route.Schedules) > 0 {
+			route.Schedules = slices.Clone(route.Schedules)
+			for j := range route.Schedules {
+				fn(&route.Schedules[j].Backends, scheme, route.UpstreamHost)
+			}
+		}
+	}
+	for i := range cfg.GRPCServices {
+		svc := &cfg.GRPCServices[i]
+		scheme := "http"
+		if svc.IsGRPC {
+			scheme = ""
+		}
+		fn(&svc.Backends, scheme, "")
+		if len(svc.Pools) > 0 {
+			pools := make(map[string][]config.Backend, len(svc.Pools))
+			for name, backends := range svc.Pools {
+				fn(&backends, scheme, "")
+				pools[name] = backends
+			}
+			svc.Pools = pools
+		}
+	}
+	if cfg.DefaultBackend != nil {
+		fn(&cfg.DefaultBackend.Backends, "http", "")
+	}
+}
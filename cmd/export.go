@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/export"
+)
+
+// runExport implements the export subcommand
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cfgPath := fs.String("config", "configs/config.json", "Path to configuration file")
+	profile := fs.String("profile", "", "Configuration profile to apply, such as staging or production (default $GATEWAY_PROFILE)")
+	format := fs.String("format", "gateway-api", "Output format (gateway-api, envoy)")
+	namespace := fs.String("namespace", "", "Namespace of generated Gateway API routes")
+	gateway := fs.String("gateway", "dynamic-gateway", "Parent Gateway of generated routes")
+	out := fs.String("out", "-", "Output file, - for stdout")
+	fs.Parse(args)
+
+	if *profile != "" {
+		config.SelectProfile(*profile)
+	}
+	cfg, err := config.LoadConfig(*cfgPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		file, err := os.Create(*out)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", *out, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+
+	switch *format {
+	case "gateway-api":
+		for _, manifest := range export.GatewayAPI(cfg, export.Options{Namespace: *namespace, Gateway: *gateway}) {
+			if err := encoder.Encode(manifest); err != nil {
+				log.Fatalf("Failed to write manifest: %v", err)
+			}
+		}
+	case "envoy":
+		if err := encoder.Encode(export.Envoy(cfg)); err != nil {
+			log.Fatalf("Failed to write Envoy config: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown export format %q", *format)
+	}
+}
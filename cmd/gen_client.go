@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"dynamic-gateway/internal/clientgen"
+	"dynamic-gateway/internal/cluster"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/schema"
+	"dynamic-gateway/internal/storage"
+)
+
+// runGenClient implements the gen-client subcommand
+func runGenClient(args []string) {
+	fs := flag.NewFlagSet("gen-client", flag.ExitOnError)
+	cfgPath := fs.String("config", "configs/config.json", "Path to configuration file")
+	profile := fs.String("profile", "", "Configuration profile to apply, such as staging or production (default $GATEWAY_PROFILE)")
+	langs := fs.String("lang", "go", "Comma-separated client languages (go, ts)")
+	outDir := fs.String("out", "client", "Output directory")
+	pkg := fs.String("package", "gatewayclient", "Go package name")
+	fs.Parse(args)
+
+	if *profile != "" {
+		config.SelectProfile(*profile)
+	}
+	cfg, err := config.LoadConfig(*cfgPath)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Load descriptors for typed request/response structs
+	descriptors := schema.NewStore()
+	if cfg.SchemaRegistry != nil {
+		elector, err := cluster.New(nil)
+		if err != nil {
+			log.Fatalf("Failed to set up cluster mode: %v", err)
+		}
+		registry := schema.NewRegistry(cfg.SchemaRegistry, descriptors, elector, storage.NewMemoryStore())
+		if err := registry.Refresh(context.Background()); err != nil {
+			log.Printf("Failed to load schemas, generating untyped client: %v", err)
+		}
+	}
+	if err := schema.LoadDescriptorSets(descriptors, cfg); err != nil {
+		log.Fatalf("Failed to load descriptor sets: %v", err)
+	}
+	connectionPool := pool.NewConnectionPool(cfg.MaxCallRecvMsgSize)
+	defer connectionPool.CloseAll()
+	schema.NewReflector(descriptors, connectionPool, func() *config.Config { return cfg }).Refresh(context.Background())
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	for _, lang := range strings.Split(*langs, ",") {
+		var (
+			file string
+			src  []byte
+		)
+		switch strings.TrimSpace(lang) {
+		case "go":
+			file = "client.go"
+			src, err = clientgen.GenerateGo(cfg, descriptors, clientgen.Options{Package: *pkg})
+			if err != nil {
+				log.Fatalf("Failed to generate Go client: %v", err)
+			}
+		case "ts":
+			file = "client.ts"
+			src = clientgen.GenerateTypeScript(cfg, descriptors)
+		default:
+			log.Fatalf("Unknown client language %q", lang)
+		}
+
+		path := filepath.Join(*outDir, file)
+		if err := os.WriteFile(path, src, 0o644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		log.Printf("Generated %s", path)
+	}
+}
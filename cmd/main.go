@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,30 +15,101 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 
+	"dynamic-gateway/internal/accesslog"
+	"dynamic-gateway/internal/admin"
+	"dynamic-gateway/internal/apikey"
+	"dynamic-gateway/internal/buildinfo"
+	"dynamic-gateway/internal/catalog"
+	"dynamic-gateway/internal/cluster"
 	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/converter"
+	"dynamic-gateway/internal/docker"
+	"dynamic-gateway/internal/errorreport"
+	"dynamic-gateway/internal/gatewayapi"
+	"dynamic-gateway/internal/history"
+	"dynamic-gateway/internal/journal"
+	"dynamic-gateway/internal/metrics"
 	"dynamic-gateway/internal/middleware"
 	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/probe"
+	"dynamic-gateway/internal/redact"
 	"dynamic-gateway/internal/router"
+	"dynamic-gateway/internal/schema"
+	"dynamic-gateway/internal/storage"
+	"dynamic-gateway/internal/tracing"
+	"dynamic-gateway/internal/xds"
 )
 
 var (
-	configPath = flag.String("config", "configs/config.json", "Path to configuration file")
+	configPath = flag.String("config", "configs/config.json", "Path to configuration file, or etcd://host:port/prefix")
+	profile    = flag.String("profile", "", "Configuration profile to apply, such as staging or production (default $GATEWAY_PROFILE)")
+	devMode    = flag.Bool("dev", false, "Development mode: self-signed TLS certificate and relaxed validation")
+	version    = flag.Bool("version", false, "Print the gateway build and exit")
 )
 
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "gen-client":
+			runGenClient(os.Args[2:])
+			return
+		case "export":
+			runExport(os.Args[2:])
+			return
+		case "conformance":
+			runConformance(os.Args[2:])
+			return
+		}
+	}
+
 	flag.Parse()
 
+	if *version {
+		info := buildinfo.Get()
+		fmt.Printf("dynamic-gateway %s\n", info.Version)
+		if info.Commit != "" {
+			fmt.Printf("  commit:     %s\n", info.Commit)
+		}
+		if info.BuildTime != "" {
+			fmt.Printf("  built:      %s\n", info.BuildTime)
+		}
+		fmt.Printf("  go version: %s\n", info.GoVersion)
+		return
+	}
+	log.Printf("Starting dynamic-gateway %s", buildinfo.Get())
+
 	// Load configuration
-	cfg, err := config.LoadConfig(*configPath)
+	if *profile != "" {
+		config.SelectProfile(*profile)
+	}
+	if name := config.ActiveProfile(); name != config.DefaultProfile {
+		log.Printf("Using configuration profile %s", name)
+	}
+	if err := openConfigSource(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	cfg, err := loadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	if *devMode {
+		cfg.EnableDevMode()
+		log.Printf("Development mode enabled; do not use in production")
+	}
 
 	if err := cfg.Validate(); err != nil {
 		log.Fatalf("Invalid configuration: %v", err)
 	}
+	if err := converter.ValidateConfig(cfg); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := middleware.ValidateConfig(cfg); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
 
 	log.Printf("Configuration loaded successfully")
 	log.Printf("HTTP Server: %v (port %d)", cfg.RunHTTPServer, cfg.HTTPPort)
@@ -45,25 +117,215 @@ func main() {
 	log.Printf("gRPC Services: %d", len(cfg.GRPCServices))
 	log.Printf("HTTP Routes: %d", len(cfg.HTTPRoutes))
 
+	// Load the listener certificate
+	var serverTLS *tls.Config
+	if cfg.ServerTLS != nil {
+		serverTLS, err = serverTLSConfig(cfg)
+		if err != nil {
+			log.Fatalf("Failed to configure TLS: %v", err)
+		}
+	}
+
 	// Create connection pool
 	connectionPool := pool.NewConnectionPool(cfg.MaxCallRecvMsgSize)
+	connectionPool.SetDebug(cfg.Debug)
+	if fc := cfg.FlowControl; fc != nil {
+		connectionPool.SetFlowControl(pool.FlowControl{
+			StreamWindow: fc.Client.StreamWindow,
+			ConnWindow:   fc.Client.ConnWindow,
+			WriteBuffer:  fc.Client.WriteBuffer,
+			ReadBuffer:   fc.Client.ReadBuffer,
+		})
+	}
 	defer connectionPool.CloseAll()
 
+	// Install redaction rules before anything logs bodies
+	if cfg.Redaction != nil {
+		redactor, err := redact.New(cfg.Redaction.Fields, cfg.Redaction.Paths)
+		if err != nil {
+			log.Fatalf("Invalid redaction rules: %v", err)
+		}
+		redact.SetDefault(redactor)
+	}
+
+	// Report panics and server errors to the error tracker
+	if cfg.ErrorReporting != nil {
+		reporter, err := errorreport.New(cfg.ErrorReporting)
+		if err != nil {
+			log.Fatalf("Failed to set up error reporting: %v", err)
+		}
+		errorreport.SetDefault(reporter)
+		defer reporter.Close(5 * time.Second)
+	}
+
+	// Open shared state storage
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	defer store.Close()
+
+	// Join the cluster for singleton tasks
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	elector, err := cluster.New(cfg.Cluster)
+	if err != nil {
+		log.Fatalf("Failed to set up cluster mode: %v", err)
+	}
+	go elector.Run(backgroundCtx)
+
+	// Load proto descriptors
+	descriptors := schema.NewStore()
+	if cfg.SchemaRegistry != nil {
+		registry := schema.NewRegistry(cfg.SchemaRegistry, descriptors, elector, store)
+		if err := registry.Refresh(backgroundCtx); err != nil {
+			log.Fatalf("Failed to load descriptors from schema registry: %v", err)
+		}
+		registry.Start(backgroundCtx)
+		log.Printf("Schema registry: %d services loaded", len(descriptors.Services()))
+	}
+	if err := schema.LoadDescriptorSets(descriptors, cfg); err != nil {
+		log.Fatalf("Failed to load descriptor sets: %v", err)
+	}
+
+	// Open compliance journal
+	var requestJournal *journal.Journal
+	if cfg.Journal != nil {
+		requestJournal, err = journal.New(cfg.Journal)
+		if err != nil {
+			log.Fatalf("Failed to open journal: %v", err)
+		}
+		defer requestJournal.Close()
+	}
+
+	// Export request spans
+	var tracer *tracing.Tracer
+	if cfg.Tracing != nil {
+		tracer, err = tracing.New(cfg.Tracing)
+		if err != nil {
+			log.Fatalf("Failed to configure tracing: %v", err)
+		}
+		defer tracer.Close()
+		log.Printf("Exporting spans to %s", cfg.Tracing.Endpoint)
+	}
+
+	// Write structured access logs
+	if cfg.AccessLog != nil {
+		accessLog, err := accesslog.New(cfg.AccessLog)
+		if err != nil {
+			log.Fatalf("Failed to open access log: %v", err)
+		}
+		defer accessLog.Close()
+		middleware.UseAccessLog(accessLog)
+		log.Printf("Writing %s access log to %s", cfg.AccessLog.Format, cfg.AccessLog.Output)
+	}
+
+	// Keep the request history served by the admin API
+	var routeHistory, serviceHistory *history.History
+	if cfg.Admin != nil {
+		// Validated with the configuration
+		window, _ := time.ParseDuration(cfg.Admin.History.Window)
+		resolution, _ := time.ParseDuration(cfg.Admin.History.Resolution)
+		routeHistory, serviceHistory = history.New(window, resolution), history.New(window, resolution)
+		router.UseHistory(routeHistory, serviceHistory)
+	}
+
+	// Check API keys against the configured source
+	var apiKeys *apikey.Keys
+	if cfg.APIKeys != nil {
+		apiKeys, err = apikey.New(cfg.APIKeys, store)
+		if err != nil {
+			log.Fatalf("Failed to load API keys: %v", err)
+		}
+		defer apiKeys.Close()
+		log.Printf("Reading API keys from %s", cfg.APIKeys.Source)
+	}
+
 	// Create handlers
-	grpcHandler := router.NewGRPCHandler(cfg, connectionPool)
-	httpHandler := router.NewHTTPHandler(cfg, connectionPool)
+	routes, err := newRouteTable(cfg, connectionPool, descriptors, store, requestJournal, tracer, apiKeys)
+	if err != nil {
+		log.Fatalf("Failed to create route table: %v", err)
+	}
+
+	// Connect to the backends that were healthy before a restart, and drop
+	// those no configuration or discovery source names once they have had
+	// time to report
+	if ws := cfg.WarmState; ws != nil {
+		warmed, err := connectionPool.Warm(backgroundCtx, ws.File)
+		if err != nil {
+			log.Printf("Failed to warm backend connections: %v", err)
+		} else if len(warmed) > 0 {
+			log.Printf("Warming connections to %d previously healthy backends", len(warmed))
+			time.AfterFunc(time.Minute, func() {
+				known := backendAddresses(routes.Config())
+				for _, address := range warmed {
+					if !known[address] && !known["http://"+address] && !known["https://"+address] {
+						connectionPool.Evict(address)
+					}
+				}
+			})
+		}
+		interval, _ := time.ParseDuration(ws.Interval)
+		go connectionPool.PersistWarmState(backgroundCtx, ws.File, interval)
+	}
+
+	// Discover descriptors from backends serving gRPC reflection
+	reflector := schema.NewReflector(descriptors, connectionPool, routes.Config)
+	reflector.Refresh(backgroundCtx)
+	reflector.Start(backgroundCtx)
+	descriptors.OnMissing(reflector.MethodMissing)
+
+	// Receive routes and endpoints from an xDS control plane
+	if cfg.XDS != nil {
+		client := xds.NewClient(cfg.XDS, elector.Identity(), func(dynamic []config.HTTPRoute) {
+			if err := routes.update("xds", dynamic, nil); err != nil {
+				log.Printf("Failed to apply xDS routes: %v", err)
+				return
+			}
+			log.Printf("Applied %d routes from xDS", len(dynamic))
+		})
+		go client.Run(backgroundCtx)
+	}
+
+	// Reconcile HTTPRoute and GRPCRoute resources from the cluster
+	if cfg.GatewayAPI != nil {
+		controller, err := gatewayapi.NewController(cfg.GatewayAPI, func(dynamic []config.HTTPRoute, services []config.GRPCService) {
+			if err := routes.update("gateway-api", dynamic, services); err != nil {
+				log.Printf("Failed to apply Gateway API routes: %v", err)
+				return
+			}
+			log.Printf("Applied %d routes and %d services from Gateway API", len(dynamic), len(services))
+		})
+		if err != nil {
+			log.Fatalf("Failed to create Gateway API controller: %v", err)
+		}
+		go controller.Run(backgroundCtx)
+	}
+
+	// Register local containers as backends during development
+	if cfg.Docker != nil {
+		discovery, err := docker.NewDiscovery(cfg.Docker, func(dynamic []config.HTTPRoute, services []config.GRPCService) {
+			if err := routes.update("docker", dynamic, services); err != nil {
+				log.Printf("Failed to apply Docker routes: %v", err)
+				return
+			}
+			log.Printf("Applied %d routes and %d services from Docker", len(dynamic), len(services))
+		})
+		if err != nil {
+			log.Fatalf("Failed to create Docker discovery: %v", err)
+		}
+		go discovery.Run(backgroundCtx)
+	}
 
 	// Setup HTTP server
 	var httpServer *http.Server
 	if cfg.RunHTTPServer {
 		mux := http.NewServeMux()
 
-		// Add middleware
-		handler := middleware.Recovery(
-			middleware.Logging(
-				middleware.CORS(cfg)(httpHandler),
-			),
-		)
+		// Routes are served through the route table so new configurations
+		// can be applied behind a canary
+		handler := routes.Handler()
 
 		mux.Handle("/", handler)
 
@@ -73,6 +335,55 @@ func main() {
 			w.Write([]byte("OK"))
 		})
 
+		// Route catalog for the developer portal
+		mux.HandleFunc("/catalog", catalog.Handler(routes.Config))
+
+		// Cluster membership
+		mux.HandleFunc("/health/cluster", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"identity": elector.Identity(),
+				"leader":   elector.IsLeader(),
+			})
+		})
+
+		// Synthetic probes exercise the full route chain in-process, following
+		// the probes of reloaded configurations
+		prober := probe.New(routes.Config, handler)
+		go prober.Run(backgroundCtx)
+		mux.HandleFunc("/health/probes", prober.Handler)
+
+		// Route error budgets
+		mux.HandleFunc("/health/slo", func(w http.ResponseWriter, r *http.Request) {
+			routes.Router().SLOHandler(w, r)
+		})
+
+		// Requests that matched no route
+		mux.HandleFunc("/health/unmatched", func(w http.ResponseWriter, r *http.Request) {
+			routes.Router().UnmatchedHandler(w, r)
+		})
+
+		// Backend scores of latency-aware balancers, for tuning
+		mux.HandleFunc("/health/balancers", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"http": routes.Router().BalancerScores(),
+				"grpc": routes.GRPC().BalancerScores(),
+			})
+		})
+
+		// Backend circuit breakers
+		mux.HandleFunc("/health/breakers", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(routes.Breakers().Status())
+		})
+
+		// Backends ejected by outlier detection
+		mux.HandleFunc("/health/outliers", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(routes.Breakers().Outliers())
+		})
+
 		// Connection pool health
 		mux.HandleFunc("/health/connections", func(w http.ResponseWriter, r *http.Request) {
 			health := connectionPool.HealthCheck()
@@ -80,6 +391,23 @@ func main() {
 			json.NewEncoder(w).Encode(health)
 		})
 
+		// Connection setup timings per backend
+		mux.HandleFunc("/health/dial", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(connectionPool.DialStats())
+		})
+
+		// Health of the addresses backend hostnames resolve to
+		mux.HandleFunc("/health/addresses", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(connectionPool.AddressStats())
+		})
+
+		// Prometheus metrics
+		registerPoolMetrics(connectionPool)
+		registerStreamMetrics(router.Streams())
+		mux.Handle("/metrics", metrics.Handler())
+
 		httpServer = &http.Server{
 			Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.HTTPPort),
 			Handler:      mux,
@@ -89,8 +417,16 @@ func main() {
 		}
 
 		go func() {
-			log.Printf("Starting HTTP server on %s", httpServer.Addr)
-			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			var err error
+			if serverTLS != nil && cfg.ServerTLS.HTTP {
+				httpServer.TLSConfig = serverTLS
+				log.Printf("Starting HTTPS server on %s", httpServer.Addr)
+				err = httpServer.ListenAndServeTLS("", "")
+			} else {
+				log.Printf("Starting HTTP server on %s", httpServer.Addr)
+				err = httpServer.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
 				log.Fatalf("HTTP server error: %v", err)
 			}
 		}()
@@ -99,12 +435,23 @@ func main() {
 	// Setup gRPC server
 	var grpcServer *grpc.Server
 	if cfg.RunTLSServer {
-		grpcServer = grpc.NewServer(
+		serverOpts := []grpc.ServerOption{
 			grpc.MaxRecvMsgSize(cfg.MaxCallRecvMsgSize),
 			grpc.MaxSendMsgSize(cfg.MaxCallSendMsgSize),
-		)
+			grpc.ChainUnaryInterceptor(middleware.RequestIDUnary, middleware.RecoveryUnary),
+			grpc.ChainStreamInterceptor(middleware.RequestIDStream, middleware.RecoveryStream),
+		}
+		if serverTLS != nil {
+			serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(serverTLS)))
+		}
+		if fc := cfg.FlowControl; fc != nil {
+			serverOpts = append(serverOpts, flowControlOptions(fc.Server)...)
+		}
+		// Calls to configured services are proxied by the active route table
+		serverOpts = append(serverOpts, router.StreamProxyOptions(routes.GRPC)...)
+		grpcServer = grpc.NewServer(serverOpts...)
 
-		grpcHandler.RegisterService(grpcServer)
+		routes.GRPC().RegisterService(grpcServer)
 		reflection.Register(grpcServer)
 
 		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Host, cfg.TLSPort))
@@ -120,6 +467,68 @@ func main() {
 		}()
 	}
 
+	// Setup admin API
+	var adminServer *http.Server
+	if cfg.Admin != nil {
+		api, err := admin.New(cfg.Admin, configStore(), func(updated *config.Config) (<-chan error, error) {
+			_, promoted, err := applyFileConfig(routes, updated)
+			return promoted, err
+		})
+		if err != nil {
+			log.Fatalf("Failed to set up admin API: %v", err)
+		}
+		defer api.Close()
+		if apiKeys != nil {
+			api.ManageAPIKeys(apiKeys)
+		}
+		api.ManageDescriptors(reflector)
+		api.ServeHistory(routeHistory, serviceHistory)
+		api.ServeStreams(router.Streams())
+		adminServer = &http.Server{
+			Addr:         cfg.Admin.Address,
+			Handler:      api.Handler(),
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 30 * time.Second,
+		}
+		if cfg.Admin.TLS != nil {
+			adminServer.TLSConfig, err = adminTLSConfig(cfg.Admin.TLS)
+			if err != nil {
+				log.Fatalf("Failed to configure admin TLS: %v", err)
+			}
+		}
+
+		go func() {
+			log.Printf("Starting admin API on %s", adminServer.Addr)
+			var err error
+			if adminServer.TLSConfig != nil {
+				err = adminServer.ListenAndServeTLS("", "")
+			} else {
+				err = adminServer.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Admin API error: %v", err)
+			}
+		}()
+	}
+
+	// Reload configuration on SIGHUP or when its file or etcd prefix changes.
+	// Routes, balancers and CORS are rebuilt; listener, storage and cluster
+	// settings need a restart.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	changes := watchConfig(backgroundCtx)
+	go func() {
+		for {
+			select {
+			case <-backgroundCtx.Done():
+				return
+			case <-hangup:
+			case <-changes:
+			}
+			reloadConfig(routes)
+		}
+	}()
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -136,9 +545,68 @@ func main() {
 		}
 	}
 
+	if adminServer != nil {
+		if err := adminServer.Shutdown(ctx); err != nil {
+			log.Printf("Admin API shutdown error: %v", err)
+		}
+	}
+
 	if grpcServer != nil {
 		grpcServer.GracefulStop()
 	}
 
+	if cfg.WarmState != nil {
+		if err := connectionPool.SaveWarmState(cfg.WarmState.File); err != nil {
+			log.Printf("Failed to save warm state: %v", err)
+		}
+	}
+
 	log.Println("Servers stopped")
 }
+
+// reloadConfig loads the configuration file again and switches routes to it
+func reloadConfig(routes *routeTable) {
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Printf("Failed to reload config: %v", err)
+		return
+	}
+	changed, _, err := applyFileConfig(routes, cfg)
+	if err != nil {
+		log.Printf("Failed to reload config: %v", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	log.Printf("Configuration reloaded: %d HTTP routes, %d gRPC services", len(cfg.HTTPRoutes), len(cfg.GRPCServices))
+}
+
+// applyFileConfig switches routes to a configuration read from its file or etcd,
+// reporting whether it differed from the active one and, through the channel,
+// whether it was promoted
+func applyFileConfig(routes *routeTable, cfg *config.Config) (bool, <-chan error, error) {
+	if *devMode {
+		cfg.EnableDevMode()
+	}
+	return routes.reload(cfg)
+}
+
+// flowControlOptions returns gRPC server options for the configured windows
+// and buffers
+func flowControlOptions(w config.FlowWindows) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if w.StreamWindow > 0 {
+		opts = append(opts, grpc.InitialWindowSize(w.StreamWindow))
+	}
+	if w.ConnWindow > 0 {
+		opts = append(opts, grpc.InitialConnWindowSize(w.ConnWindow))
+	}
+	if w.WriteBuffer > 0 {
+		opts = append(opts, grpc.WriteBufferSize(w.WriteBuffer))
+	}
+	if w.ReadBuffer > 0 {
+		opts = append(opts, grpc.ReadBufferSize(w.ReadBuffer))
+	}
+	return opts
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"dynamic-gateway/internal/metrics"
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/streams"
+)
+
+// registerPoolMetrics exposes the state of the connection pool, read on
+// every scrape
+func registerPoolMetrics(p *pool.ConnectionPool) {
+	metrics.NewCollector("gateway_pool_connections",
+		"gRPC connections held by the pool, by connectivity state",
+		"gauge", func(report func(float64, ...string)) {
+			for backend, state := range p.HealthCheck() {
+				report(1, backend, state)
+			}
+		}, "backend", "state")
+	metrics.NewCollector("gateway_pool_dials_total",
+		"Connections established to backends",
+		"counter", func(report func(float64, ...string)) {
+			for backend, s := range p.DialStats() {
+				report(float64(s.Connections), backend)
+			}
+		}, "backend")
+	metrics.NewCollector("gateway_pool_dial_failures_total",
+		"Failed attempts to connect to backends",
+		"counter", func(report func(float64, ...string)) {
+			for backend, s := range p.DialStats() {
+				report(float64(s.Failures), backend)
+			}
+		}, "backend")
+	metrics.NewCollector("gateway_pool_address_error_rate",
+		"Error rate of the addresses backend hostnames resolve to",
+		"gauge", func(report func(float64, ...string)) {
+			for _, a := range p.AddressStats() {
+				report(a.ErrorRate, a.Backend, a.Address)
+			}
+		}, "backend", "address")
+	metrics.NewCollector("gateway_pool_address_ejected",
+		"Whether an address a backend hostname resolves to is ejected",
+		"gauge", func(report func(float64, ...string)) {
+			for _, a := range p.AddressStats() {
+				ejected := 0.0
+				if a.Ejected {
+					ejected = 1
+				}
+				report(ejected, a.Backend, a.Address)
+			}
+		}, "backend", "address")
+	metrics.NewCollector("gateway_pool_dial_circuit_open",
+		"Addresses not dialed for a cool-down after repeated dial failures",
+		"gauge", func(report func(float64, ...string)) {
+			for _, address := range p.DialCircuits() {
+				report(1, address)
+			}
+		}, "address")
+}
+
+// registerStreamMetrics exposes the streams open on HTTP routes and gRPC
+// services and the goroutines relaying them, read on every scrape
+func registerStreamMetrics(routes, services *streams.Set) {
+	for _, set := range []struct {
+		protocol, label, kind string
+		streams               *streams.Set
+	}{{"http", "route", "HTTP routes", routes}, {"grpc", "service", "gRPC services", services}} {
+		metrics.NewCollector("gateway_"+set.protocol+"_streams_open",
+			"Streams open on "+set.kind,
+			"gauge", func(report func(float64, ...string)) {
+				for _, s := range set.streams.Stats() {
+					report(float64(s.Streams), s.Name)
+				}
+			}, set.label)
+		metrics.NewCollector("gateway_"+set.protocol+"_stream_goroutines",
+			"Goroutines serving and relaying the streams of "+set.kind,
+			"gauge", func(report func(float64, ...string)) {
+				for _, s := range set.streams.Stats() {
+					report(float64(s.Goroutines), s.Name)
+				}
+			}, set.label)
+		metrics.NewCollector("gateway_"+set.protocol+"_streams_rejected_total",
+			"Streams refused over the max_streams of "+set.kind,
+			"counter", func(report func(float64, ...string)) {
+				for _, s := range set.streams.Stats() {
+					report(float64(s.Rejected), s.Name)
+				}
+			}, set.label)
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"dynamic-gateway/internal/apikey"
+	"dynamic-gateway/internal/breaker"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/journal"
+	"dynamic-gateway/internal/kube"
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/resolver"
+	"dynamic-gateway/internal/rollout"
+	"dynamic-gateway/internal/router"
+	"dynamic-gateway/internal/schema"
+	"dynamic-gateway/internal/storage"
+	"dynamic-gateway/internal/tracing"
+)
+
+// routeTable builds the HTTP handler chain for a configuration and swaps it
+// in when the configuration changes
+type routeTable struct {
+	connectionPool *pool.ConnectionPool
+	descriptors    *schema.Store
+	store          storage.Store
+	journal        *journal.Journal
+	breakers       *breaker.Set
+	tracer         *tracing.Tracer
+	apiKeys        *apikey.Keys
+	switcher       *rollout.Switcher
+	current        *router.HTTPHandler
+	grpc           *router.GRPCHandler
+	active         *config.Config
+	base           config.Config
+	sources        map[string]routeSource
+	endpoints      *kube.Endpoints    // watches kubernetes:/// backends once named
+	resolver       *resolver.Resolver // resolves dns:/// and dns+srv:/// backends once named
+	mu             sync.Mutex
+}
+
+// routeSource holds the routes contributed by a dynamic provider
+type routeSource struct {
+	routes   []config.HTTPRoute
+	services []config.GRPCService
+}
+
+// newRouteTable creates a route table serving cfg
+func newRouteTable(cfg *config.Config, connectionPool *pool.ConnectionPool, descriptors *schema.Store, store storage.Store, requestJournal *journal.Journal, tracer *tracing.Tracer, apiKeys *apikey.Keys) (*routeTable, error) {
+	t := &routeTable{
+		connectionPool: connectionPool,
+		descriptors:    descriptors,
+		store:          store,
+		journal:        requestJournal,
+		breakers:       breaker.NewSet(cfg.CircuitBreaker),
+		tracer:         tracer,
+		apiKeys:        apiKeys,
+		base:           *cfg,
+		sources:        make(map[string]routeSource),
+	}
+	t.breakers.ConfigureOutliers(cfg.OutlierDetection)
+	cfg, err := t.resolveEndpoints(cfg)
+	if err != nil {
+		return nil, err
+	}
+	chain, handler, grpcHandler, err := t.build(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current = handler
+	t.active = cfg
+	t.grpc = grpcHandler
+	t.switcher = rollout.NewSwitcher(chain)
+	return t, nil
+}
+
+// build creates the middleware chain and routers for cfg
+func (t *routeTable) build(cfg *config.Config) (http.Handler, *router.HTTPHandler, *router.GRPCHandler, error) {
+	return router.Build(cfg, router.Deps{
+		Pool:        t.connectionPool,
+		Descriptors: t.descriptors,
+		Store:       t.store,
+		Journal:     t.journal,
+		Breakers:    t.breakers,
+		Tracer:      t.tracer,
+		APIKeys:     t.apiKeys,
+	})
+}
+
+// Handler returns the handler serving the active configuration
+func (t *routeTable) Handler() http.Handler {
+	return t.switcher
+}
+
+// Router returns the router of the active configuration
+func (t *routeTable) Router() *router.HTTPHandler {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.current
+}
+
+// GRPC returns the gRPC handler of the active configuration
+func (t *routeTable) GRPC() *router.GRPCHandler {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.grpc
+}
+
+// Breakers returns the circuits of every backend; they outlive configurations
+func (t *routeTable) Breakers() *breaker.Set {
+	return t.breakers
+}
+
+// update replaces the routes contributed by a dynamic source and applies the
+// file configuration merged with every source
+func (t *routeTable) update(source string, routes []config.HTTPRoute, services []config.GRPCService) error {
+	t.mu.Lock()
+	t.sources[source] = routeSource{routes: routes, services: services}
+	merged := t.merged(&t.base)
+	t.mu.Unlock()
+
+	_, err := t.apply(merged, nil)
+	return err
+}
+
+// reload replaces the file configuration, keeping routes from dynamic sources.
+// An unchanged configuration is ignored and reported as such. The file
+// configuration is replaced once the new one is promoted, so a canary rolled
+// back leaves later updates merging with the configuration still serving; the
+// returned channel receives nil then, or the reason of the rollback.
+func (t *routeTable) reload(cfg *config.Config) (bool, <-chan error, error) {
+	t.mu.Lock()
+	if reflect.DeepEqual(t.base, *cfg) {
+		t.mu.Unlock()
+		return false, applied(), nil
+	}
+	merged := t.merged(cfg)
+	t.mu.Unlock()
+
+	promoted, err := t.apply(merged, cfg)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, promoted, nil
+}
+
+// applied returns a channel reporting a configuration as serving
+func applied() <-chan error {
+	result := make(chan error, 1)
+	result <- nil
+	return result
+}
+
+// merged combines the file configuration base with every dynamic source
+func (t *routeTable) merged(base *config.Config) *config.Config {
+	merged := *base
+	merged.HTTPRoutes = append([]config.HTTPRoute{}, base.HTTPRoutes...)
+	merged.GRPCServices = append([]config.GRPCService{}, base.GRPCServices...)
+	for _, name := range sortedSources(t.sources) {
+		merged.HTTPRoutes = append(merged.HTTPRoutes, t.sources[name].routes...)
+		merged.GRPCServices = append(merged.GRPCServices, t.sources[name].services...)
+	}
+	return &merged
+}
+
+// Config returns the active configuration
+func (t *routeTable) Config() *config.Config {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.active
+}
+
+func sortedSources(sources map[string]routeSource) []string {
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apply validates cfg and switches to it, behind a canary when configured.
+// A non-nil base becomes the file configuration once cfg is promoted. The
+// returned channel receives nil once cfg is serving, or the reason it was
+// rolled back.
+func (t *routeTable) apply(cfg *config.Config, base *config.Config) (<-chan error, error) {
+	if err := router.Validate(cfg, t.descriptors); err != nil {
+		return nil, err
+	}
+	cfg, err := t.resolveEndpoints(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Endpoint changes may leave the active configuration as it is
+	if reflect.DeepEqual(cfg, t.active) {
+		if base != nil {
+			t.base = *base
+		}
+		return applied(), nil
+	}
+
+	chain, handler, grpcHandler, err := t.build(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	handler.Inherit(t.current)
+	grpcHandler.Inherit(t.grpc)
+
+	result, err := t.switcher.Apply(chain, cfg.ConfigCanary)
+	if err != nil {
+		handler.Close()
+		grpcHandler.Close()
+		return nil, err
+	}
+	promoted := make(chan error, 1)
+	go func() {
+		err := <-result
+		if err != nil {
+			handler.Close()
+			grpcHandler.Close()
+		} else {
+			t.mu.Lock()
+			previous := t.active
+			previousHandler, previousGRPC := t.current, t.grpc
+			t.current = handler
+			t.grpc = grpcHandler
+			t.active = cfg
+			if base != nil {
+				t.base = *base
+			}
+			t.mu.Unlock()
+			previousHandler.Close()
+			previousGRPC.Close()
+			t.breakers.Configure(cfg.CircuitBreaker)
+			t.breakers.ConfigureOutliers(cfg.OutlierDetection)
+
+			// Drop pooled connections to backends that discovery removed
+			current := backendAddresses(cfg)
+			for address := range backendAddresses(previous) {
+				if !current[address] {
+					t.connectionPool.Evict(address)
+				}
+			}
+		}
+		promoted <- err
+	}()
+	return promoted, nil
+}
+
+// backendAddresses returns every backend address referenced by cfg
+func backendAddresses(cfg *config.Config) map[string]bool {
+	addresses := make(map[string]bool)
+	add := func(backends []config.Backend) {
+		for _, b := range backends {
+			addresses[b.Address] = true
+		}
+	}
+	for _, route := range cfg.HTTPRoutes {
+		add(route.Backends)
+		for _, version := range route.Versions {
+			add(version.Backends)
+		}
+		for _, backends := range route.Pools {
+			add(backends)
+		}
+		for _, schedule := range route.Schedules {
+			add(schedule.Backends)
+		}
+	}
+	for _, svc := range cfg.GRPCServices {
+		add(svc.Backends)
+		for _, backends := range svc.Pools {
+			add(backends)
+		}
+	}
+	return addresses
+}
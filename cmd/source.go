@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"dynamic-gateway/internal/admin"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/etcd"
+)
+
+// etcdSource is the etcd prefix the configuration is kept under when -config
+// names one rather than a file
+var etcdSource *etcd.Source
+
+// openConfigSource selects the configuration source -config names
+func openConfigSource() error {
+	if !etcd.IsSource(*configPath) {
+		return nil
+	}
+	source, err := etcd.Open(*configPath)
+	if err != nil {
+		return err
+	}
+	etcdSource = source
+	log.Printf("Reading configuration from %s", source)
+	return nil
+}
+
+// loadConfig reads the configuration from its source
+func loadConfig() (*config.Config, error) {
+	if etcdSource == nil {
+		return config.LoadConfig(*configPath)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	data, _, err := etcdSource.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return config.ParseConfig(data)
+}
+
+// watchConfig signals when the configuration source changes; files are
+// polled, etcd prefixes watched
+func watchConfig(ctx context.Context) <-chan struct{} {
+	if etcdSource == nil {
+		return config.Watch(ctx, *configPath, 2*time.Second)
+	}
+	return etcdSource.Watch(ctx)
+}
+
+// configStore returns where the admin API writes configuration changes
+func configStore() admin.Store {
+	if etcdSource == nil {
+		return admin.FileStore(*configPath)
+	}
+	return &etcdStore{source: etcdSource}
+}
+
+// etcdStore writes admin API changes back to etcd, refusing them when another
+// gateway changed the configuration since it was read. The admin API reads
+// and writes under its own lock, so the revision read is the one written
+// against.
+type etcdStore struct {
+	source   *etcd.Source
+	revision int64
+}
+
+func (s *etcdStore) Read() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	data, revision, err := s.source.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration: %w", err)
+	}
+	s.revision = revision
+	return data, nil
+}
+
+func (s *etcdStore) Write(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := s.source.Save(ctx, data, s.revision)
+	if errors.Is(err, etcd.ErrConflict) {
+		return fmt.Errorf("%w; retry the request", err)
+	}
+	return err
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// serverTLSConfig loads the listener certificate, generating a self-signed one
+// in dev mode when no files are configured, and the client CA bundle if any
+func serverTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	if cfg.ServerTLS.CertFile != "" {
+		cert, err = tls.LoadX509KeyPair(cfg.ServerTLS.CertFile, cfg.ServerTLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load server certificate: %w", err)
+		}
+	} else {
+		if !cfg.Dev {
+			return nil, fmt.Errorf("server_tls.cert_file is required")
+		}
+		cert, err = selfSignedCertificate(cfg.Host)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate development certificate: %w", err)
+		}
+		fingerprint := sha256.Sum256(cert.Certificate[0])
+		log.Printf("Using generated self-signed certificate (sha256 %x); clients must skip verification or trust it explicitly", fingerprint)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+
+	// Client certificates are verified when presented; requests without one
+	// are still accepted and fall back to other consumer identities unless a
+	// certificate is required
+	if cfg.ServerTLS.ClientCAFile != "" {
+		data, err := os.ReadFile(cfg.ServerTLS.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.ServerTLS.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = roots
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.ServerTLS.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// adminTLSConfig loads the admin API certificate and the CA bundle verifying
+// client certificates; callers without one may still present a token
+func adminTLSConfig(t *config.AdminTLS) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if t.ClientCAFile != "" {
+		data, err := os.ReadFile(t.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin client CA bundle: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", t.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = roots
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// selfSignedCertificate creates an in-memory certificate valid for localhost,
+// the loopback addresses, this machine's hostname and host
+func selfSignedCertificate(host string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "dynamic-gateway development"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(30 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = append(template.IPAddresses, ip)
+	} else if host != "" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
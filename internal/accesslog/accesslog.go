@@ -0,0 +1,166 @@
+// Package accesslog writes one record per HTTP request the gateway serves, as
+// JSON or in Apache's combined log format, to stdout, a rotated file or syslog.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Entry is one served request
+type Entry struct {
+	Time       time.Time `json:"time"`
+	RequestID  string    `json:"request_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr"`
+	Consumer   string    `json:"consumer,omitempty"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Protocol   string    `json:"protocol"`
+	Route      string    `json:"route,omitempty"`
+	Backend    string    `json:"backend,omitempty"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	LatencyMS  float64   `json:"latency_ms"`
+	Referer    string    `json:"referer,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// Logger formats entries and writes them to the configured output
+type Logger struct {
+	format  string
+	out     io.WriteCloser
+	mu      sync.Mutex
+	lastErr string
+}
+
+// New opens the configured output
+func New(cfg *config.AccessLog) (*Logger, error) {
+	var out io.WriteCloser
+	var err error
+	switch cfg.Output {
+	case "stdout":
+		out = stdout{}
+	case "file":
+		out, err = newRotatingFile(cfg.Path, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups)
+	case "syslog":
+		out, err = newSyslog(cfg.SyslogAddress, cfg.SyslogTag)
+	default:
+		return nil, fmt.Errorf("unknown access log output %q", cfg.Output)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{format: cfg.Format, out: out}, nil
+}
+
+// Log writes an entry; write failures are logged once until writes succeed
+// again
+func (l *Logger) Log(e Entry) {
+	var line []byte
+	if l.format == "combined" {
+		line = combined(e)
+	} else {
+		line, _ = json.Marshal(e)
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.out.Write(line); err != nil {
+		if err.Error() != l.lastErr {
+			log.Printf("Failed to write access log: %v", err)
+		}
+		l.lastErr = err.Error()
+		return
+	}
+	if l.lastErr != "" {
+		log.Printf("Writing access log again")
+		l.lastErr = ""
+	}
+}
+
+// Close closes the output
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.out.Close()
+}
+
+// combined formats an entry in Apache's combined log format, followed by
+// the latency in milliseconds, request ID, route and backend:
+//
+//	host - user [time] "request" status bytes "referer" "user-agent" latency "id" "route" "backend"
+func combined(e Entry) []byte {
+	host, _, err := net.SplitHostPort(e.RemoteAddr)
+	if err != nil {
+		host = e.RemoteAddr
+	}
+	target := e.Path
+	if e.Query != "" {
+		target += "?" + e.Query
+	}
+	size := "-"
+	if e.Bytes > 0 {
+		size = strconv.FormatInt(e.Bytes, 10)
+	}
+
+	var b strings.Builder
+	b.WriteString(orDash(host))
+	b.WriteString(" - ")
+	b.WriteString(orDash(e.Consumer))
+	b.WriteString(e.Time.Format(" [02/Jan/2006:15:04:05 -0700] "))
+	b.WriteString(quote(e.Method + " " + target + " " + e.Protocol))
+	fmt.Fprintf(&b, " %d %s ", e.Status, size)
+	b.WriteString(quote(e.Referer))
+	b.WriteByte(' ')
+	b.WriteString(quote(e.UserAgent))
+	fmt.Fprintf(&b, " %.3f ", e.LatencyMS)
+	b.WriteString(quote(e.RequestID))
+	b.WriteByte(' ')
+	b.WriteString(quote(e.Route))
+	b.WriteByte(' ')
+	b.WriteString(quote(e.Backend))
+	return []byte(b.String())
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// quote encloses a field in double quotes, escaping as Apache does
+func quote(s string) string {
+	if s == "" {
+		return `"-"`
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c == 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
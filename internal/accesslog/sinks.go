@@ -0,0 +1,177 @@
+package accesslog
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// stdout writes entries to standard output, which the gateway never closes
+type stdout struct{}
+
+func (stdout) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdout) Close() error                { return nil }
+
+// rotatingFile appends to a file, renaming it to path.1 once it reaches
+// maxSize; older files move to path.2 and so on, up to maxBackups of them
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	f := &rotatingFile{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *rotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open access log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open access log file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// Write is called with the logger's lock held
+func (f *rotatingFile) Write(p []byte) (int, error) {
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *rotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	if f.maxBackups == 0 {
+		os.Remove(f.path)
+	}
+	for i := f.maxBackups; i > 0; i-- {
+		from := f.path
+		if i > 1 {
+			from += "." + strconv.Itoa(i-1)
+		}
+		os.Rename(from, f.path+"."+strconv.Itoa(i))
+	}
+	return f.open()
+}
+
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// syslogPriority is facility local0, severity info
+const syslogPriority = 16*8 + 6
+
+// syslog sends each entry as one message to a syslog daemon, reconnecting
+// after failed writes
+type syslog struct {
+	network string // "" for the local daemon
+	address string
+	tag     string
+	conn    net.Conn
+}
+
+func newSyslog(address, tag string) (*syslog, error) {
+	s := &syslog{tag: tag}
+	if address != "" {
+		u, err := url.Parse(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid syslog address %q: %w", address, err)
+		}
+		s.network, s.address = u.Scheme, u.Host
+		if u.Scheme == "unix" {
+			s.network, s.address = "unixgram", u.Path
+		}
+	}
+	if err := s.connect(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *syslog) connect() error {
+	if s.network != "" {
+		conn, err := net.Dial(s.network, s.address)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		s.conn = conn
+		return nil
+	}
+	for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, path); err == nil {
+				s.conn = conn
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("failed to connect to syslog: no local syslog daemon")
+}
+
+// Write is called with the logger's lock held; p ends in a newline, which
+// frames messages over TCP and is dropped otherwise
+func (s *syslog) Write(p []byte) (int, error) {
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := s.conn.Write(s.message(p)); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// message formats p as the local daemon expects, or as RFC 5424 for remote
+// ones
+func (s *syslog) message(p []byte) []byte {
+	if s.network != "tcp" {
+		p = p[:len(p)-1]
+	}
+	if s.network == "" || s.network == "unixgram" {
+		return fmt.Appendf(nil, "<%d>%s %s[%d]: %s", syslogPriority, time.Now().Format(time.Stamp), s.tag, os.Getpid(), p)
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	return fmt.Appendf(nil, "<%d>1 %s %s %s %d - - %s", syslogPriority, time.Now().Format(time.RFC3339), hostname, s.tag, os.Getpid(), p)
+}
+
+func (s *syslog) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
@@ -0,0 +1,579 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/apikey"
+	"dynamic-gateway/internal/buildinfo"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/history"
+	"dynamic-gateway/internal/rollout"
+	"dynamic-gateway/internal/schema"
+	"dynamic-gateway/internal/streams"
+)
+
+var (
+	errNotFound = errors.New("not found")
+	errConflict = errors.New("already exists")
+)
+
+// ApplyFunc validates and activates a configuration. The channel receives nil
+// once the configuration is serving, which may take a canary's probation, or
+// the reason it was rolled back.
+type ApplyFunc func(cfg *config.Config) (<-chan error, error)
+
+// Store holds the configuration document the admin API changes
+type Store interface {
+	Read() ([]byte, error)
+	Write(data []byte) error
+}
+
+// FileStore is a configuration file
+type FileStore string
+
+func (f FileStore) Read() ([]byte, error) {
+	data, err := os.ReadFile(string(f))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return data, nil
+}
+
+func (f FileStore) Write(data []byte) error {
+	return writeFile(string(f), data)
+}
+
+// Server exposes runtime management of routes, services and backends. Changes
+// are made to the stored configuration document, so variables stay
+// unresolved, and written back once the gateway serves them.
+type Server struct {
+	store Store
+	auth  *authenticator
+	audit *auditLog
+	file  *os.File // audit log file, if any
+	apply ApplyFunc
+	mu    sync.Mutex
+
+	apiKeys        *apikey.Keys
+	reflector      *schema.Reflector
+	routeHistory   *history.History
+	serviceHistory *history.History
+	routeStreams   *streams.Set
+	serviceStreams *streams.Set
+}
+
+// New creates an admin API managing the configuration held by store
+func New(cfg *config.Admin, store Store, apply ApplyFunc) (*Server, error) {
+	auth, err := newAuthenticator(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{store: store, auth: auth, audit: &auditLog{}, apply: apply}
+	if cfg.AuditLog != "" {
+		s.file, err = os.OpenFile(cfg.AuditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open admin audit log: %w", err)
+		}
+		s.audit.out = s.file
+	}
+	return s, nil
+}
+
+// Close closes the audit log
+func (s *Server) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// Handler returns the authenticated admin API. Callers need the role of the
+// call, and every mutating call is audited, including those refused.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /admin/routes", s.listRoutes)
+	mux.HandleFunc("POST /admin/routes", s.addRoute)
+	mux.HandleFunc("DELETE /admin/routes", s.removeRoute)
+	mux.HandleFunc("POST /admin/routes/backends", s.addRouteBackend)
+	mux.HandleFunc("DELETE /admin/routes/backends", s.removeRouteBackend)
+	mux.HandleFunc("GET /admin/services", s.listServices)
+	mux.HandleFunc("POST /admin/services", s.addService)
+	mux.HandleFunc("DELETE /admin/services/{name}", s.removeService)
+	mux.HandleFunc("POST /admin/services/{name}/backends", s.addServiceBackend)
+	mux.HandleFunc("DELETE /admin/services/{name}/backends", s.removeServiceBackend)
+	mux.HandleFunc("GET /admin/sampling", s.getSampling)
+	mux.HandleFunc("PUT /admin/sampling", s.setSampling)
+	mux.HandleFunc("PUT /admin/routes/sampling", s.setRouteSampling)
+	mux.HandleFunc("DELETE /admin/routes/sampling", s.removeRouteSampling)
+	mux.HandleFunc("GET /admin/api-keys", s.listAPIKeys)
+	mux.HandleFunc("POST /admin/api-keys", s.createAPIKey)
+	mux.HandleFunc("DELETE /admin/api-keys/{id}", s.revokeAPIKey)
+	mux.HandleFunc("DELETE /admin/descriptors", s.invalidateDescriptors)
+	mux.HandleFunc("DELETE /admin/services/{name}/descriptors", s.invalidateDescriptors)
+	mux.HandleFunc("GET /admin/history", s.getHistory)
+	mux.HandleFunc("GET /admin/streams", s.getStreams)
+	mux.HandleFunc("GET /admin/version", s.version)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		caller, ok := s.auth.authenticate(r)
+		required := requiredRole(r)
+		if required > ReadOnly {
+			recorder := &statusRecorder{ResponseWriter: w}
+			defer func() {
+				rec := auditRecord{
+					Time:   time.Now(),
+					Method: r.Method,
+					Path:   r.URL.Path,
+					Query:  r.URL.RawQuery,
+					Remote: r.RemoteAddr,
+					Status: recorder.status,
+				}
+				if ok {
+					rec.Principal, rec.Role = caller.name, caller.role.String()
+				}
+				s.audit.record(rec)
+			}()
+			w = recorder
+		}
+
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if caller.role < required {
+			http.Error(w, fmt.Sprintf("role %s may not %s %s", caller.role, r.Method, r.URL.Path), http.StatusForbidden)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// version reports the running gateway build
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildinfo.Get())
+}
+
+func (s *Server) listRoutes(w http.ResponseWriter, r *http.Request) {
+	raw, err := s.read()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	routes, err := redacted(nonNil(raw.HTTPRoutes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, routes)
+}
+
+func (s *Server) addRoute(w http.ResponseWriter, r *http.Request) {
+	var route config.HTTPRoute
+	if !decode(w, r, &route) {
+		return
+	}
+	s.modify(w, http.StatusCreated, route, func(raw *config.Config) error {
+		for _, existing := range raw.HTTPRoutes {
+			if existing.Path == route.Path && strings.Join(existing.Methods, ",") == strings.Join(route.Methods, ",") {
+				return fmt.Errorf("route %s %w", route.Path, errConflict)
+			}
+		}
+		raw.HTTPRoutes = append(raw.HTTPRoutes, route)
+		return nil
+	})
+}
+
+// removeRoute deletes every route with the ?path= path
+func (s *Server) removeRoute(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	s.modify(w, http.StatusNoContent, nil, func(raw *config.Config) error {
+		kept := raw.HTTPRoutes[:0]
+		for _, route := range raw.HTTPRoutes {
+			if route.Path != path {
+				kept = append(kept, route)
+			}
+		}
+		if len(kept) == len(raw.HTTPRoutes) {
+			return fmt.Errorf("route %s %w", path, errNotFound)
+		}
+		raw.HTTPRoutes = kept
+		return nil
+	})
+}
+
+// addRouteBackend adds a backend to every route with the ?path= path
+func (s *Server) addRouteBackend(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	var backend config.Backend
+	if !decode(w, r, &backend) {
+		return
+	}
+	s.modify(w, http.StatusCreated, backend, func(raw *config.Config) error {
+		found := false
+		for i := range raw.HTTPRoutes {
+			if raw.HTTPRoutes[i].Path != path {
+				continue
+			}
+			found = true
+			backends, err := addBackend(raw.HTTPRoutes[i].Backends, backend)
+			if err != nil {
+				return err
+			}
+			raw.HTTPRoutes[i].Backends = backends
+		}
+		if !found {
+			return fmt.Errorf("route %s %w", path, errNotFound)
+		}
+		return nil
+	})
+}
+
+// removeRouteBackend drains the ?address= backend from routes with the ?path= path
+func (s *Server) removeRouteBackend(w http.ResponseWriter, r *http.Request) {
+	path, address := r.URL.Query().Get("path"), r.URL.Query().Get("address")
+	s.modify(w, http.StatusNoContent, nil, func(raw *config.Config) error {
+		found := false
+		for i := range raw.HTTPRoutes {
+			if raw.HTTPRoutes[i].Path != path {
+				continue
+			}
+			backends, err := removeBackend(raw.HTTPRoutes[i].Backends, address)
+			if err == nil {
+				found = true
+				raw.HTTPRoutes[i].Backends = backends
+			}
+		}
+		if !found {
+			return fmt.Errorf("backend %s of route %s %w", address, path, errNotFound)
+		}
+		return nil
+	})
+}
+
+func (s *Server) listServices(w http.ResponseWriter, r *http.Request) {
+	raw, err := s.read()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	services, err := redacted(nonNil(raw.GRPCServices))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, services)
+}
+
+func (s *Server) addService(w http.ResponseWriter, r *http.Request) {
+	var svc config.GRPCService
+	if !decode(w, r, &svc) {
+		return
+	}
+	s.modify(w, http.StatusCreated, svc, func(raw *config.Config) error {
+		if findService(raw, svc.ServiceName) >= 0 {
+			return fmt.Errorf("service %s %w", svc.ServiceName, errConflict)
+		}
+		raw.GRPCServices = append(raw.GRPCServices, svc)
+		return nil
+	})
+}
+
+func (s *Server) removeService(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	s.modify(w, http.StatusNoContent, nil, func(raw *config.Config) error {
+		i := findService(raw, name)
+		if i < 0 {
+			return fmt.Errorf("service %s %w", name, errNotFound)
+		}
+		raw.GRPCServices = append(raw.GRPCServices[:i], raw.GRPCServices[i+1:]...)
+		return nil
+	})
+}
+
+func (s *Server) addServiceBackend(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var backend config.Backend
+	if !decode(w, r, &backend) {
+		return
+	}
+	s.modify(w, http.StatusCreated, backend, func(raw *config.Config) error {
+		i := findService(raw, name)
+		if i < 0 {
+			return fmt.Errorf("service %s %w", name, errNotFound)
+		}
+		backends, err := addBackend(raw.GRPCServices[i].Backends, backend)
+		if err != nil {
+			return err
+		}
+		raw.GRPCServices[i].Backends = backends
+		return nil
+	})
+}
+
+// removeServiceBackend drains the ?address= backend from a service
+func (s *Server) removeServiceBackend(w http.ResponseWriter, r *http.Request) {
+	name, address := r.PathValue("name"), r.URL.Query().Get("address")
+	s.modify(w, http.StatusNoContent, nil, func(raw *config.Config) error {
+		i := findService(raw, name)
+		if i < 0 {
+			return fmt.Errorf("service %s %w", name, errNotFound)
+		}
+		backends, err := removeBackend(raw.GRPCServices[i].Backends, address)
+		if err != nil {
+			return err
+		}
+		raw.GRPCServices[i].Backends = backends
+		return nil
+	})
+}
+
+// routeSampling is a route's sampling override
+type routeSampling struct {
+	Path     string           `json:"path"`
+	Methods  []string         `json:"methods,omitempty"`
+	Sampling *config.Sampling `json:"sampling"`
+}
+
+// getSampling lists the global sampling rates and every route override
+func (s *Server) getSampling(w http.ResponseWriter, r *http.Request) {
+	raw, err := s.read()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	routes := []routeSampling{}
+	for _, route := range raw.HTTPRoutes {
+		if route.Sampling != nil {
+			routes = append(routes, routeSampling{Path: route.Path, Methods: route.Methods, Sampling: route.Sampling})
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"global": raw.Sampling, "routes": routes})
+}
+
+// setSampling replaces the global sampling rates
+func (s *Server) setSampling(w http.ResponseWriter, r *http.Request) {
+	var sampling config.Sampling
+	if !decode(w, r, &sampling) {
+		return
+	}
+	s.modify(w, http.StatusOK, sampling, func(raw *config.Config) error {
+		raw.Sampling = &sampling
+		return nil
+	})
+}
+
+// setRouteSampling overrides the sampling rates of routes with the ?path= path
+func (s *Server) setRouteSampling(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	var sampling config.Sampling
+	if !decode(w, r, &sampling) {
+		return
+	}
+	s.modify(w, http.StatusOK, sampling, func(raw *config.Config) error {
+		found := false
+		for i := range raw.HTTPRoutes {
+			if raw.HTTPRoutes[i].Path == path {
+				found = true
+				raw.HTTPRoutes[i].Sampling = &sampling
+			}
+		}
+		if !found {
+			return fmt.Errorf("route %s %w", path, errNotFound)
+		}
+		return nil
+	})
+}
+
+// removeRouteSampling returns routes with the ?path= path to the global rates
+func (s *Server) removeRouteSampling(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	s.modify(w, http.StatusNoContent, nil, func(raw *config.Config) error {
+		found := false
+		for i := range raw.HTTPRoutes {
+			if raw.HTTPRoutes[i].Path == path && raw.HTTPRoutes[i].Sampling != nil {
+				found = true
+				raw.HTTPRoutes[i].Sampling = nil
+			}
+		}
+		if !found {
+			return fmt.Errorf("sampling override of route %s %w", path, errNotFound)
+		}
+		return nil
+	})
+}
+
+// modify changes the stored configuration, activates the result and
+// persists it, responding with status and result on success
+func (s *Server) modify(w http.ResponseWriter, status int, result any, change func(raw *config.Config) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	original, err := s.store.Read()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	before, err := decodeConfig(original)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	raw, _ := decodeConfig(original)
+	if err := change(raw); err != nil {
+		switch {
+		case errors.Is(err, errNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, errConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+
+	// Only the sections changed are written back, so the rest of the document
+	// keeps its keys and formatting
+	data, err := patchDocument(original, before, raw)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	cfg, err := config.ParseConfig(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	promoted, err := s.apply(cfg)
+	if errors.Is(err, rollout.ErrCanaryInProgress) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The change is persisted only once it is promoted, so a canary rolled
+	// back does not come back with the next restart. The wait may outlast the
+	// server's write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err := <-promoted; err != nil {
+		http.Error(w, fmt.Sprintf("change rolled back: %v", err), http.StatusConflict)
+		return
+	}
+	if err := s.store.Write(data); err != nil {
+		http.Error(w, fmt.Sprintf("change applied but not persisted: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if result == nil {
+		w.WriteHeader(status)
+		return
+	}
+	writeJSON(w, status, result)
+}
+
+// read decodes the stored configuration without resolving variables or
+// defaults
+func (s *Server) read() (*config.Config, error) {
+	data, err := s.store.Read()
+	if err != nil {
+		return nil, err
+	}
+	return decodeConfig(data)
+}
+
+func decodeConfig(data []byte) (*config.Config, error) {
+	var raw config.Config
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to decode configuration: %w", err)
+	}
+	return &raw, nil
+}
+
+// writeFile replaces path atomically, keeping its permissions
+func writeFile(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func findService(raw *config.Config, name string) int {
+	for i, svc := range raw.GRPCServices {
+		if svc.ServiceName == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func addBackend(backends []config.Backend, backend config.Backend) ([]config.Backend, error) {
+	if backend.Address == "" {
+		return nil, fmt.Errorf("address is required")
+	}
+	for _, b := range backends {
+		if b.Address == backend.Address {
+			return nil, fmt.Errorf("backend %s %w", backend.Address, errConflict)
+		}
+	}
+	return append(backends, backend), nil
+}
+
+func removeBackend(backends []config.Backend, address string) ([]config.Backend, error) {
+	for i, b := range backends {
+		if b.Address == address {
+			return append(backends[:i:i], backends[i+1:]...), nil
+		}
+	}
+	return nil, fmt.Errorf("backend %s %w", address, errNotFound)
+}
+
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
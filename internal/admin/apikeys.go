@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"dynamic-gateway/internal/apikey"
+)
+
+// ManageAPIKeys serves the creation, listing and revocation of the API keys
+// held by keys
+func (s *Server) ManageAPIKeys(keys *apikey.Keys) {
+	s.apiKeys = keys
+}
+
+// listAPIKeys lists the keys without the keys themselves
+func (s *Server) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !s.hasAPIKeys(w) {
+		return
+	}
+	keys, err := s.apiKeys.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, nonNil(keys))
+}
+
+// createAPIKey generates a key for a consumer, returned only in the response
+func (s *Server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.hasAPIKeys(w) {
+		return
+	}
+	var record apikey.Key
+	if !decode(w, r, &record) {
+		return
+	}
+	if record.Consumer == "" {
+		http.Error(w, "consumer is required", http.StatusBadRequest)
+		return
+	}
+	if record.Quota < 0 {
+		http.Error(w, "quota must not be negative", http.StatusBadRequest)
+		return
+	}
+	if record.Window != "" {
+		if d, err := time.ParseDuration(record.Window); err != nil || d <= 0 {
+			http.Error(w, "invalid window "+record.Window, http.StatusBadRequest)
+			return
+		}
+	}
+
+	key, record, err := s.apiKeys.Create(r.Context(), record)
+	if errors.Is(err, apikey.ErrReadOnly) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusCreated, createdKey{Key: key, keyRecord: record})
+}
+
+// createdKey is a new key with its record
+type createdKey struct {
+	Key string `json:"key"`
+	keyRecord
+}
+
+type keyRecord = apikey.Key
+
+// revokeAPIKey deletes the key with the {id} ID
+func (s *Server) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.hasAPIKeys(w) {
+		return
+	}
+	switch err := s.apiKeys.Revoke(r.Context(), r.PathValue("id")); {
+	case errors.Is(err, apikey.ErrUnknownKey):
+		http.Error(w, "API key "+r.PathValue("id")+" "+errNotFound.Error(), http.StatusNotFound)
+	case errors.Is(err, apikey.ErrReadOnly):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) hasAPIKeys(w http.ResponseWriter) bool {
+	if s.apiKeys == nil {
+		http.Error(w, "api_keys is not configured", http.StatusNotFound)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// auditRecord describes a mutating admin API call
+type auditRecord struct {
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Query     string    `json:"query,omitempty"`
+	Remote    string    `json:"remote"`
+	Status    int       `json:"status"`
+}
+
+// auditLog writes a JSON line per mutating call, to the gateway log when no
+// file is configured
+type auditLog struct {
+	mu  sync.Mutex
+	out io.Writer
+}
+
+func (a *auditLog) record(rec auditRecord) {
+	data, _ := json.Marshal(rec)
+	if a.out == nil {
+		log.Printf("Admin audit: %s", data)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.out.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write admin audit log: %v; %s", err, data)
+	}
+}
+
+// statusRecorder captures the status written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
@@ -0,0 +1,159 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/idtoken"
+)
+
+// Role is what an admin API caller may do; each role includes the ones below
+type Role int
+
+const (
+	ReadOnly Role = iota + 1 // list routes, services and the version
+	Operator                 // add and remove backends
+	Admin                    // add and remove routes and services
+)
+
+var roleNames = map[string]Role{"read_only": ReadOnly, "operator": Operator, "admin": Admin}
+
+func (r Role) String() string {
+	for name, role := range roleNames {
+		if role == r {
+			return name
+		}
+	}
+	return "none"
+}
+
+// principal is an authenticated caller
+type principal struct {
+	name string
+	role Role
+}
+
+// staticToken is a configured bearer token
+type staticToken struct {
+	token []byte
+	principal
+}
+
+// authenticator identifies callers from their client certificate or bearer
+// token
+type authenticator struct {
+	tokens      []staticToken
+	clientRoles map[string]Role
+	oidc        idtoken.Provider
+	roleClaim   string
+	oidcRoles   map[string]Role
+}
+
+func newAuthenticator(cfg *config.Admin) (*authenticator, error) {
+	a := &authenticator{clientRoles: make(map[string]Role), oidcRoles: make(map[string]Role)}
+	if token := secret(cfg.Token, cfg.TokenEnv); token != "" {
+		a.tokens = append(a.tokens, staticToken{[]byte(token), principal{"token", Admin}})
+	}
+	for i, t := range cfg.Tokens {
+		token := secret(t.Token, t.TokenEnv)
+		if token == "" {
+			return nil, fmt.Errorf("admin token %d is empty", i)
+		}
+		name := t.Name
+		if name == "" {
+			name = fmt.Sprintf("token %d", i)
+		}
+		a.tokens = append(a.tokens, staticToken{[]byte(token), principal{name, roleNames[t.Role]}})
+	}
+	if cfg.TLS != nil {
+		for name, role := range cfg.TLS.ClientRoles {
+			a.clientRoles[name] = roleNames[role]
+		}
+	}
+	if o := cfg.OIDC; o != nil {
+		provider, err := idtoken.New(o.Provider, o.Settings)
+		if err != nil {
+			return nil, fmt.Errorf("invalid admin oidc: %w", err)
+		}
+		a.oidc, a.roleClaim = provider, o.RoleClaim
+		for value, role := range o.Roles {
+			a.oidcRoles[value] = roleNames[role]
+		}
+	}
+	return a, nil
+}
+
+// authenticate identifies the caller; a verified client certificate with a
+// role takes precedence over a bearer token
+func (a *authenticator) authenticate(r *http.Request) (principal, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		name := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if role, ok := a.clientRoles[name]; ok {
+			return principal{"cert:" + name, role}, true
+		}
+	}
+
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || given == "" {
+		return principal{}, false
+	}
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(given), t.token) == 1 {
+			return t.principal, true
+		}
+	}
+	if a.oidc != nil {
+		return a.verifyIDToken(r.Context(), given)
+	}
+	return principal{}, false
+}
+
+// verifyIDToken grants an ID token the highest role its role claim maps to
+func (a *authenticator) verifyIDToken(ctx context.Context, token string) (principal, bool) {
+	claims, err := a.oidc.Verify(ctx, token)
+	if err != nil {
+		return principal{}, false
+	}
+	var values []string
+	switch v := claims[a.roleClaim].(type) {
+	case string:
+		values = strings.Fields(v)
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+	best := Role(0)
+	for _, value := range values {
+		best = max(best, a.oidcRoles[value])
+	}
+	return principal{"oidc:" + claims.Subject(), best}, true
+}
+
+// secret returns a configured value or the environment variable holding it
+func secret(value, env string) string {
+	if value == "" && env != "" {
+		return os.Getenv(env)
+	}
+	return value
+}
+
+// requiredRole returns the role a request needs: reads need read_only,
+// backend and sampling changes operator and anything else admin
+func requiredRole(r *http.Request) Role {
+	if slices.Contains([]string{http.MethodGet, http.MethodHead}, r.Method) {
+		return ReadOnly
+	}
+	if strings.HasSuffix(r.URL.Path, "/backends") || strings.HasSuffix(r.URL.Path, "/sampling") || strings.HasSuffix(r.URL.Path, "/descriptors") {
+		return Operator
+	}
+	return Admin
+}
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+
+	"dynamic-gateway/internal/schema"
+)
+
+// ManageDescriptors serves the invalidation of descriptors cached by
+// reflector
+func (s *Server) ManageDescriptors(reflector *schema.Reflector) {
+	s.reflector = reflector
+}
+
+// invalidateDescriptors fetches the reflected descriptors of the {name}
+// service, or of every reflected service, again
+func (s *Server) invalidateDescriptors(w http.ResponseWriter, r *http.Request) {
+	if s.reflector == nil {
+		http.Error(w, "reflection is not available", http.StatusNotFound)
+		return
+	}
+	switch err := s.reflector.Invalidate(r.Context(), r.PathValue("name")); {
+	case errors.Is(err, schema.ErrNotReflected):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		// The descriptors fetched before stay in use
+		http.Error(w, "failed to fetch descriptors: "+err.Error(), http.StatusBadGateway)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,304 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// patchDocument applies the difference between before and after, the
+// decoded forms of original, to original itself. Sections that did not
+// change are kept as written, keys the configuration does not know survive
+// and fields that were never set are not filled in with zero values.
+func patchDocument(original []byte, before, after any) ([]byte, error) {
+	patched, err := patchValue(original, reflect.ValueOf(before), reflect.ValueOf(after))
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, patched, "", "  "); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// patchValue returns original changed the way before changed into after
+func patchValue(original json.RawMessage, before, after reflect.Value) (json.RawMessage, error) {
+	if reflect.DeepEqual(before.Interface(), after.Interface()) {
+		return original, nil
+	}
+	for after.Kind() == reflect.Pointer {
+		if after.IsNil() || before.IsNil() {
+			return fresh(after)
+		}
+		before, after = before.Elem(), after.Elem()
+	}
+	switch after.Kind() {
+	case reflect.Struct:
+		if isObject(original) {
+			return patchStruct(original, before, after)
+		}
+	case reflect.Map:
+		if isObject(original) && after.Type().Key().Kind() == reflect.String {
+			return patchMap(original, before, after)
+		}
+	case reflect.Slice:
+		if isArray(original) {
+			return patchSlice(original, before, after)
+		}
+	}
+	return fresh(after)
+}
+
+func patchStruct(original json.RawMessage, before, after reflect.Value) (json.RawMessage, error) {
+	members, err := objectMembers(original)
+	if err != nil {
+		return nil, err
+	}
+	fields := jsonFields(after.Type())
+	seen := make(map[int]bool)
+	var out []member
+	for _, m := range members {
+		i, ok := fields[strings.ToLower(m.key)]
+		if !ok || seen[i] {
+			// Unknown to the configuration, kept as it is
+			out = append(out, m)
+			continue
+		}
+		seen[i] = true
+		b, a := before.Field(i), after.Field(i)
+		if a.IsZero() && !b.IsZero() {
+			continue
+		}
+		value, err := patchValue(m.value, b, a)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, member{key: m.key, value: value})
+	}
+	for i := range after.NumField() {
+		f := after.Type().Field(i)
+		if _, ok := fields[strings.ToLower(jsonName(f))]; !ok || seen[i] || after.Field(i).IsZero() {
+			continue
+		}
+		value, err := fresh(after.Field(i))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, member{key: jsonName(f), value: value})
+	}
+	return encodeObject(out)
+}
+
+func patchMap(original json.RawMessage, before, after reflect.Value) (json.RawMessage, error) {
+	members, err := objectMembers(original)
+	if err != nil {
+		return nil, err
+	}
+	var out []member
+	seen := make(map[string]bool)
+	for _, m := range members {
+		key := reflect.ValueOf(m.key).Convert(after.Type().Key())
+		a := after.MapIndex(key)
+		if !a.IsValid() {
+			continue
+		}
+		seen[m.key] = true
+		b := before.MapIndex(key)
+		if !b.IsValid() {
+			b = reflect.Zero(a.Type())
+		}
+		value, err := patchValue(m.value, b, a)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, member{key: m.key, value: value})
+	}
+	var added []string
+	for _, key := range after.MapKeys() {
+		if !seen[key.String()] {
+			added = append(added, key.String())
+		}
+	}
+	sort.Strings(added)
+	for _, key := range added {
+		value, err := fresh(after.MapIndex(reflect.ValueOf(key).Convert(after.Type().Key())))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, member{key: key, value: value})
+	}
+	return encodeObject(out)
+}
+
+// patchSlice patches elements in place when the length is unchanged, and
+// otherwise keeps the elements found unchanged in before and writes the rest
+// anew
+func patchSlice(original json.RawMessage, before, after reflect.Value) (json.RawMessage, error) {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(original, &elements); err != nil {
+		return nil, err
+	}
+	if len(elements) != before.Len() {
+		return fresh(after)
+	}
+	out := make([]json.RawMessage, after.Len())
+	used := make([]bool, before.Len())
+	for i := range out {
+		var err error
+		switch {
+		case before.Len() == after.Len():
+			out[i], err = patchValue(elements[i], before.Index(i), after.Index(i))
+		default:
+			out[i], err = fresh(after.Index(i))
+			for j := range used {
+				if !used[j] && reflect.DeepEqual(before.Index(j).Interface(), after.Index(i).Interface()) {
+					used[j] = true
+					out[i] = elements[j]
+					break
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(out)
+}
+
+type member struct {
+	key   string
+	value json.RawMessage
+}
+
+// objectMembers returns the members of a JSON object in document order
+func objectMembers(data json.RawMessage) ([]member, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var members []member
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := token.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected %v in object", token)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		members = append(members, member{key: key, value: value})
+	}
+	return members, nil
+}
+
+func encodeObject(members []member) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// fresh encodes v leaving out the fields it does not set
+func fresh(v reflect.Value) (json.RawMessage, error) {
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(prune(doc))
+}
+
+// prune drops the zero-valued members of objects
+func prune(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			value = prune(value)
+			if isEmpty(value) {
+				delete(v, key)
+				continue
+			}
+			v[key] = value
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = prune(value)
+		}
+	}
+	return v
+}
+
+func isEmpty(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// jsonFields maps the lowercased JSON names of t's fields to their indexes,
+// matching keys the way encoding/json does
+func jsonFields(t reflect.Type) map[string]int {
+	fields := make(map[string]int)
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if name := jsonName(f); f.IsExported() && name != "-" {
+			fields[strings.ToLower(name)] = i
+		}
+	}
+	return fields
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
+
+func isObject(data json.RawMessage) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '{'
+}
+
+func isArray(data json.RawMessage) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && data[0] == '['
+}
@@ -0,0 +1,96 @@
+package admin
+
+import (
+	"strings"
+	"testing"
+
+	"dynamic-gateway/internal/config"
+)
+
+func TestPatchDocument(t *testing.T) {
+	const original = `{
+  "server": {"port": 8080},
+  "x-owner": "platform",
+  "http_routes": [
+    {"path": "/a", "backends": [{"address": "a:1"}], "x-note": "keep"},
+    {"path": "/b", "backends": [{"address": "b:1"}]}
+  ]
+}`
+	tests := []struct {
+		name    string
+		change  func(cfg *config.Config)
+		want    []string
+		notWant []string
+	}{
+		{
+			name:   "unchanged",
+			change: func(cfg *config.Config) {},
+			want:   []string{`"x-owner": "platform"`, `"x-note": "keep"`},
+		},
+		{
+			name: "append route",
+			change: func(cfg *config.Config) {
+				cfg.HTTPRoutes = append(cfg.HTTPRoutes, config.HTTPRoute{Path: "/c"})
+			},
+			want:    []string{`"x-owner": "platform"`, `"x-note": "keep"`, `"path": "/c"`},
+			notWant: []string{`"strip_path"`, `"timeout"`, `"grpc_services"`},
+		},
+		{
+			name: "add backend",
+			change: func(cfg *config.Config) {
+				cfg.HTTPRoutes[0].Backends = append(cfg.HTTPRoutes[0].Backends, config.Backend{Address: "a:2"})
+			},
+			want:    []string{`"x-note": "keep"`, `"address": "a:2"`},
+			notWant: []string{`"weight"`},
+		},
+		{
+			name: "remove route",
+			change: func(cfg *config.Config) {
+				cfg.HTTPRoutes = cfg.HTTPRoutes[1:]
+			},
+			want:    []string{`"x-owner": "platform"`, `"path": "/b"`},
+			notWant: []string{`"path": "/a"`, `"x-note"`},
+		},
+		{
+			name: "set sampling",
+			change: func(cfg *config.Config) {
+				rate := 0.5
+				cfg.HTTPRoutes[1].Sampling = &config.Sampling{Tracing: &rate}
+			},
+			want:    []string{`"x-note": "keep"`, `"tracing": 0.5`},
+			notWant: []string{`"access_log"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, err := decodeConfig([]byte(original))
+			if err != nil {
+				t.Fatal(err)
+			}
+			after, _ := decodeConfig([]byte(original))
+			tt.change(after)
+
+			data, err := patchDocument([]byte(original), before, after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decodeConfig(data)
+			if err != nil {
+				t.Fatalf("patched document does not decode: %v\n%s", err, data)
+			}
+			if len(got.HTTPRoutes) != len(after.HTTPRoutes) {
+				t.Errorf("got %d routes, want %d", len(got.HTTPRoutes), len(after.HTTPRoutes))
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(data), s) {
+					t.Errorf("missing %s in\n%s", s, data)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(string(data), s) {
+					t.Errorf("unexpected %s in\n%s", s, data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"net/http"
+	"time"
+
+	"dynamic-gateway/internal/history"
+)
+
+// ServeHistory serves the request history of HTTP routes held by routes and
+// of gRPC services held by services
+func (s *Server) ServeHistory(routes, services *history.History) {
+	s.routeHistory, s.serviceHistory = routes, services
+}
+
+// getHistory summarizes every route and service over the ?since= duration,
+// default the whole window, or lists the intervals of the ?route= route or
+// the ?service= service
+func (s *Server) getHistory(w http.ResponseWriter, r *http.Request) {
+	if s.routeHistory == nil || s.serviceHistory == nil {
+		http.Error(w, "request history is not available", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	var since time.Duration
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = time.ParseDuration(value); err != nil || since <= 0 {
+			http.Error(w, "invalid since "+value, http.StatusBadRequest)
+			return
+		}
+	}
+	now := time.Now()
+
+	for _, series := range []struct {
+		param   string
+		history *history.History
+	}{{"route", s.routeHistory}, {"service", s.serviceHistory}} {
+		name := query.Get(series.param)
+		if name == "" {
+			continue
+		}
+		buckets, ok := series.history.Buckets(name, since, now)
+		if !ok {
+			http.Error(w, "no requests recorded for "+series.param+" "+name, http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			series.param: name,
+			"resolution": series.history.Resolution().String(),
+			"buckets":    buckets,
+		})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"resolution": s.routeHistory.Resolution().String(),
+		"routes":     s.routeHistory.Summaries(since, now),
+		"services":   s.serviceHistory.Summaries(since, now),
+	})
+}
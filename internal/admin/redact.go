@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"dynamic-gateway/internal/redact"
+)
+
+// secretKeys are the configuration fields holding credentials, masked
+// whenever routes and services are listed, whatever the caller's role
+var secretKeys = map[string]bool{
+	"credential":    true,
+	"token":         true,
+	"client_secret": true,
+}
+
+// redacted returns v as JSON-shaped data with credentials masked and
+// passwords removed from URLs such as backend proxies
+func redacted(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return redactValue(doc), nil
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if s, ok := value.(string); ok && s != "" && secretKeys[strings.ToLower(key)] {
+				v[key] = redact.Mask
+				continue
+			}
+			v[key] = redactValue(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+	case string:
+		if !strings.Contains(v, "@") {
+			return v
+		}
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				return u.Redacted()
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,26 @@
+package admin
+
+import (
+	"net/http"
+
+	"dynamic-gateway/internal/streams"
+)
+
+// ServeStreams serves the counts of the streams open on HTTP routes, held by
+// routes, and on gRPC services, held by services
+func (s *Server) ServeStreams(routes, services *streams.Set) {
+	s.routeStreams, s.serviceStreams = routes, services
+}
+
+// getStreams lists the streams, relaying goroutines and refused streams of
+// every route and service that has had a stream
+func (s *Server) getStreams(w http.ResponseWriter, r *http.Request) {
+	if s.routeStreams == nil || s.serviceStreams == nil {
+		http.Error(w, "stream counts are not available", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"routes":   s.routeStreams.Stats(),
+		"services": s.serviceStreams.Stats(),
+	})
+}
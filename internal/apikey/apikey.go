@@ -0,0 +1,309 @@
+// Package apikey authenticates clients by API keys and enforces per-key
+// request quotas. Keys are held by their SHA-256 hash, in a JSON file or in the
+// gateway's shared storage, where the admin API creates and revokes them.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/storage"
+)
+
+var (
+	// ErrUnknownKey is returned for keys that are not in the source
+	ErrUnknownKey = errors.New("unknown API key")
+
+	// ErrReadOnly is returned when changing keys held in a file
+	ErrReadOnly = errors.New("API keys are read from a file")
+)
+
+// Key is a client's API key, without the key itself
+type Key struct {
+	ID       string    `json:"id"` // leading characters of the key's hash
+	Consumer string    `json:"consumer"`
+	Quota    int64     `json:"quota,omitempty"`  // requests per window, default the global quota
+	Window   string    `json:"window,omitempty"` // default the global window
+	Created  time.Time `json:"created,omitempty"`
+}
+
+// Usage is a key's quota in the current window
+type Usage struct {
+	Limit     int64 // 0 for unlimited
+	Remaining int64
+	ResetAt   time.Time
+	Exceeded  bool // the request charged is over the quota
+}
+
+// idLength is the number of hex digits of a key's hash that identify it
+const idLength = 12
+
+// storePrefix prefixes the storage keys of API keys, followed by their hash
+const storePrefix = "apikey:"
+
+// filePollInterval is how often a key file is checked for changes
+const filePollInterval = 5 * time.Second
+
+// Keys looks up API keys and counts their requests
+type Keys struct {
+	store    storage.Store
+	file     string // read instead of the store when set
+	quota    int64
+	window   time.Duration
+	failOpen bool
+
+	mu       sync.Mutex
+	modified time.Time
+	byHash   map[string]Key
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates the key source configured by cfg; quotas are counted in store,
+// so replicas sharing Redis storage share them
+func New(cfg *config.APIKeys, store storage.Store) (*Keys, error) {
+	// Validated with the configuration
+	window, _ := time.ParseDuration(cfg.Window)
+	k := &Keys{store: store, quota: cfg.Quota, window: window, failOpen: cfg.FailOpen}
+	if cfg.Source == "file" {
+		k.file = cfg.File
+		if err := k.reload(); err != nil {
+			return nil, err
+		}
+		k.stop, k.done = make(chan struct{}), make(chan struct{})
+		go k.watch()
+	}
+	return k, nil
+}
+
+// FailOpen reports whether requests are admitted when their usage cannot be
+// counted
+func (k *Keys) FailOpen() bool {
+	return k.failOpen
+}
+
+// Close stops watching the key file
+func (k *Keys) Close() {
+	if k.stop != nil {
+		close(k.stop)
+		<-k.done
+	}
+}
+
+// watch reads the key file again whenever it changes until the keys are closed
+func (k *Keys) watch() {
+	defer close(k.done)
+	ticker := time.NewTicker(filePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case <-ticker.C:
+			if err := k.reload(); err != nil {
+				log.Printf("Failed to reload API keys: %v", err)
+			}
+		}
+	}
+}
+
+// Hash returns the hex SHA-256 hash keys are held by
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lookup returns the key's record
+func (k *Keys) Lookup(ctx context.Context, key string) (Key, error) {
+	hash := Hash(key)
+	if k.file != "" {
+		k.mu.Lock()
+		defer k.mu.Unlock()
+		record, ok := k.byHash[hash]
+		if !ok {
+			return Key{}, ErrUnknownKey
+		}
+		return record, nil
+	}
+
+	data, err := k.store.Get(ctx, storePrefix+hash)
+	if errors.Is(err, storage.ErrNotFound) {
+		return Key{}, ErrUnknownKey
+	}
+	if err != nil {
+		return Key{}, err
+	}
+	var record Key
+	if err := json.Unmarshal(data, &record); err != nil {
+		return Key{}, fmt.Errorf("invalid API key record: %w", err)
+	}
+	return record, nil
+}
+
+// Charge counts a request against the key's quota and returns what is left.
+// Requests over the quota leave nothing remaining.
+func (k *Keys) Charge(ctx context.Context, key Key) (Usage, error) {
+	limit, window := k.quota, k.window
+	if key.Quota > 0 {
+		limit = key.Quota
+	}
+	if d, err := time.ParseDuration(key.Window); err == nil && d > 0 {
+		window = d
+	}
+	if limit == 0 {
+		return Usage{}, nil
+	}
+
+	start := time.Now().Truncate(window)
+	usage := Usage{Limit: limit, ResetAt: start.Add(window)}
+	used, err := k.store.IncrBy(ctx, fmt.Sprintf("apikey_quota:%s:%d", key.ID, start.Unix()), 1, time.Until(usage.ResetAt))
+	if err != nil {
+		return usage, err
+	}
+	usage.Remaining, usage.Exceeded = max(limit-used, 0), used > limit
+	return usage, nil
+}
+
+// List returns the keys of the source, ordered by ID
+func (k *Keys) List(ctx context.Context) ([]Key, error) {
+	var keys []Key
+	if k.file != "" {
+		k.mu.Lock()
+		for _, record := range k.byHash {
+			keys = append(keys, record)
+		}
+		k.mu.Unlock()
+	} else {
+		records, err := k.store.List(ctx, storePrefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range records {
+			var record Key
+			if json.Unmarshal(data, &record) == nil {
+				keys = append(keys, record)
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// Create generates a key for record's consumer and stores it; the key is
+// only ever returned here
+func (k *Keys) Create(ctx context.Context, record Key) (string, Key, error) {
+	if k.file != "" {
+		return "", Key{}, ErrReadOnly
+	}
+	var b [24]byte
+	rand.Read(b[:])
+	key := "gw_" + hex.EncodeToString(b[:])
+	hash := Hash(key)
+
+	record.ID = hash[:idLength]
+	record.Created = time.Now().UTC()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return "", Key{}, err
+	}
+	if err := k.store.Set(ctx, storePrefix+hash, data, 0); err != nil {
+		return "", Key{}, err
+	}
+	return key, record, nil
+}
+
+// Revoke deletes the key with the given ID
+func (k *Keys) Revoke(ctx context.Context, id string) error {
+	if k.file != "" {
+		return ErrReadOnly
+	}
+	records, err := k.store.List(ctx, storePrefix)
+	if err != nil {
+		return err
+	}
+	for name := range records {
+		if len(id) == idLength && strings.HasPrefix(name, storePrefix+id) {
+			return k.store.Delete(ctx, name)
+		}
+	}
+	return ErrUnknownKey
+}
+
+// fileKey is an entry of a key file, holding the key or its hash
+type fileKey struct {
+	Key      string `json:"key"`
+	SHA256   string `json:"sha256"`
+	Consumer string `json:"consumer"`
+	Quota    int64  `json:"quota"`
+	Window   string `json:"window"`
+}
+
+// reload reads the key file again when it has changed since it was last
+// read. A file that fails to load after an edit, or goes missing, leaves the
+// previous keys in use.
+func (k *Keys) reload() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	info, err := os.Stat(k.file)
+	if err != nil && k.byHash == nil {
+		return fmt.Errorf("failed to read API key file: %w", err)
+	}
+	if err != nil || info.ModTime().Equal(k.modified) {
+		return nil
+	}
+	k.modified = info.ModTime()
+
+	byHash, err := readKeyFile(k.file)
+	if err != nil && k.byHash == nil {
+		return err
+	}
+	if err != nil {
+		log.Printf("Keeping previous API keys: %v", err)
+		return nil
+	}
+	k.byHash = byHash
+	return nil
+}
+
+// readKeyFile reads a JSON list of keys, indexed by their hash
+func readKeyFile(path string) (map[string]Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API key file: %w", err)
+	}
+	var entries []fileKey
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid API key file: %w", err)
+	}
+	byHash := make(map[string]Key, len(entries))
+	for i, e := range entries {
+		hash := strings.ToLower(e.SHA256)
+		if e.Key != "" {
+			hash = Hash(e.Key)
+		}
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 || e.Consumer == "" {
+			return nil, fmt.Errorf("invalid API key file: entry %d requires a key or sha256 and a consumer", i)
+		}
+		if e.Window != "" {
+			if d, err := time.ParseDuration(e.Window); err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid API key file: invalid window %q for entry %d", e.Window, i)
+			}
+		}
+		byHash[hash] = Key{ID: hash[:idLength], Consumer: e.Consumer, Quota: e.Quota, Window: e.Window}
+	}
+	return byHash, nil
+}
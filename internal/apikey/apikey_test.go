@@ -0,0 +1,170 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/storage"
+)
+
+func TestStoreKeys(t *testing.T) {
+	ctx := context.Background()
+	keys, err := New(&config.APIKeys{Source: "store", Window: "1h"}, storage.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, created, err := keys.Create(ctx, Key{Consumer: "alice"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.ID != Hash(key)[:idLength] {
+		t.Errorf("ID = %s, want the leading characters of the key's hash", created.ID)
+	}
+	record, err := keys.Lookup(ctx, key)
+	if err != nil || record.Consumer != "alice" {
+		t.Fatalf("Lookup = %+v, %v, want alice's key", record, err)
+	}
+	if _, err := keys.Lookup(ctx, "gw_unknown"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Lookup of an unknown key err = %v, want ErrUnknownKey", err)
+	}
+	if list, _ := keys.List(ctx); len(list) != 1 || list[0].ID != created.ID {
+		t.Errorf("List = %+v, want the created key", list)
+	}
+
+	if err := keys.Revoke(ctx, created.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := keys.Lookup(ctx, key); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Lookup of a revoked key err = %v, want ErrUnknownKey", err)
+	}
+	if err := keys.Revoke(ctx, created.ID); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("second Revoke err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestCharge(t *testing.T) {
+	tests := []struct {
+		name          string
+		quota         int64 // global
+		key           Key
+		requests      int
+		wantLimit     int64
+		wantRemaining int64
+		wantExceeded  bool
+	}{
+		{name: "unlimited", key: Key{ID: "a"}, requests: 5},
+		{name: "global quota", quota: 3, key: Key{ID: "a"}, requests: 2, wantLimit: 3, wantRemaining: 1},
+		{name: "key quota", quota: 3, key: Key{ID: "a", Quota: 10}, requests: 4, wantLimit: 10, wantRemaining: 6},
+		{name: "exceeded", quota: 2, key: Key{ID: "a"}, requests: 3, wantLimit: 2, wantExceeded: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := New(&config.APIKeys{Source: "store", Quota: tt.quota, Window: "1h"}, storage.NewMemoryStore())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var usage Usage
+			for range tt.requests {
+				if usage, err = keys.Charge(context.Background(), tt.key); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if usage.Limit != tt.wantLimit || usage.Remaining != tt.wantRemaining || usage.Exceeded != tt.wantExceeded {
+				t.Errorf("usage = %+v, want limit %d, remaining %d, exceeded %v", usage, tt.wantLimit, tt.wantRemaining, tt.wantExceeded)
+			}
+		})
+	}
+}
+
+func TestFileKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{name: "key", file: `[{"key": "secret", "consumer": "alice"}]`},
+		{name: "hash", file: `[{"sha256": "` + Hash("secret") + `", "consumer": "alice"}]`},
+		{name: "no consumer", file: `[{"key": "secret"}]`, wantErr: true},
+		{name: "bad hash", file: `[{"sha256": "abc", "consumer": "alice"}]`, wantErr: true},
+		{name: "bad window", file: `[{"key": "secret", "consumer": "alice", "window": "soon"}]`, wantErr: true},
+		{name: "not a list", file: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			if err := os.WriteFile(path, []byte(tt.file), 0600); err != nil {
+				t.Fatal(err)
+			}
+			keys, err := New(&config.APIKeys{Source: "file", File: path, Window: "1h"}, storage.NewMemoryStore())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New err = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer keys.Close()
+
+			ctx := context.Background()
+			if record, err := keys.Lookup(ctx, "secret"); err != nil || record.Consumer != "alice" {
+				t.Errorf("Lookup = %+v, %v, want alice's key", record, err)
+			}
+			if _, _, err := keys.Create(ctx, Key{Consumer: "bob"}); !errors.Is(err, ErrReadOnly) {
+				t.Errorf("Create err = %v, want ErrReadOnly", err)
+			}
+		})
+	}
+}
+
+func TestFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	write := func(data string, modified time.Time) {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`[{"key": "old", "consumer": "alice"}]`, start)
+	keys, err := New(&config.APIKeys{Source: "file", File: path, Window: "1h"}, storage.NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keys.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		name     string
+		file     string // written before reloading, if any
+		remove   bool
+		wantKeys map[string]bool
+	}{
+		{name: "edited", file: `[{"key": "new", "consumer": "alice"}]`, wantKeys: map[string]bool{"old": false, "new": true}},
+		{name: "broken edit keeps previous keys", file: `[{"key": `, wantKeys: map[string]bool{"new": true}},
+		{name: "removed file keeps previous keys", remove: true, wantKeys: map[string]bool{"new": true}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.remove {
+				os.Remove(path)
+			} else {
+				write(tt.file, start.Add(time.Duration(i+1)*time.Minute))
+			}
+			if err := keys.reload(); err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+			for key, want := range tt.wantKeys {
+				if _, err := keys.Lookup(ctx, key); (err == nil) != want {
+					t.Errorf("Lookup(%s) err = %v, want known %v", key, err, want)
+				}
+			}
+		})
+	}
+}
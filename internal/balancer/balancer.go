@@ -0,0 +1,66 @@
+package balancer
+
+import "fmt"
+
+// Balancer selects backends for requests
+type Balancer interface {
+	Next() string
+	// NextFrom returns the next backend among those eligible reports true
+	// for, or "" when none is. A nil eligible admits every backend.
+	NextFrom(eligible func(backend string) bool) string
+	UpdateBackends(backends []string)
+	GetBackends() []string
+	State() State
+	Restore(state State)
+}
+
+// filter returns the backends eligible reports true for
+func filter(backends []string, eligible func(backend string) bool) []string {
+	if eligible == nil {
+		return backends
+	}
+	var kept []string
+	for _, addr := range backends {
+		if eligible(addr) {
+			kept = append(kept, addr)
+		}
+	}
+	return kept
+}
+
+// LoadTracker is implemented by balancers that account for in-flight requests
+type LoadTracker interface {
+	// Begin marks a request to backend as started; done must be called when it completes
+	Begin(backend string) (done func())
+}
+
+// FailureTracker is implemented by balancers that learn from failed requests
+type FailureTracker interface {
+	// Failed reports a request to backend that failed
+	Failed(backend string)
+}
+
+// Scorer is implemented by balancers whose choices follow per-backend scores
+type Scorer interface {
+	// Scores reports each backend's score
+	Scores() []Score
+}
+
+// New creates a balancer for the named policy; weights are used by weighted
+// policies and may be nil
+func New(policy string, backends []string, weights map[string]int) (Balancer, error) {
+	switch policy {
+	case "", "round_robin":
+		return NewRoundRobinBalancer(backends), nil
+	case "weighted_round_robin":
+		return NewWeightedRoundRobinBalancer(backends, weights), nil
+	case "consistent_hash":
+		return NewConsistentHashBalancer(backends, weights), nil
+	case "p2c":
+		return NewP2CBalancer(backends), nil
+	case "peak_ewma":
+		return NewPeakEWMABalancer(backends), nil
+	default:
+		return nil, fmt.Errorf("unknown load balancing policy %q", policy)
+	}
+}
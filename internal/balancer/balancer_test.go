@@ -0,0 +1,75 @@
+package balancer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: ""},
+		{policy: "round_robin"},
+		{policy: "weighted_round_robin"},
+		{policy: "consistent_hash"},
+		{policy: "p2c"},
+		{policy: "peak_ewma"},
+		{policy: "random", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			b, err := New(tt.policy, []string{"a", "b"}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && b.Next() == "" {
+				t.Error("Next returned no backend")
+			}
+		})
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	tests := []struct {
+		name     string
+		backends []string
+		eligible func(string) bool
+		want     []string
+	}{
+		{
+			name:     "rotates",
+			backends: []string{"a", "b", "c"},
+			want:     []string{"a", "b", "c", "a"},
+		},
+		{
+			name:     "skips ineligible",
+			backends: []string{"a", "b", "c"},
+			eligible: func(addr string) bool { return addr != "b" },
+			want:     []string{"a", "c", "c", "a"},
+		},
+		{
+			name:     "none eligible",
+			backends: []string{"a", "b"},
+			eligible: func(string) bool { return false },
+			want:     []string{"", ""},
+		},
+		{
+			name: "no backends",
+			want: []string{""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewRoundRobinBalancer(tt.backends)
+			var got []string
+			for range tt.want {
+				got = append(got, b.NextFrom(tt.eligible))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("picks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
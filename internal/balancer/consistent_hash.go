@@ -0,0 +1,162 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// virtualNodes is the number of ring points per unit of backend weight; more
+// points spread keys more evenly across backends
+const virtualNodes = 100
+
+// Keyed is implemented by balancers that pick backends by a request key
+type Keyed interface {
+	// ForKey returns a balancer whose Next yields the backend owning key,
+	// then the following distinct backends on the ring
+	ForKey(key string) Balancer
+}
+
+// ConsistentHashBalancer maps request keys onto a hash ring of backends, so
+// requests with the same key reach the same backend and only the keys of a
+// removed backend move when the backends change. Requests without a key are
+// spread round-robin.
+type ConsistentHashBalancer struct {
+	backends []string
+	weights  map[string]int
+	ring     []ringPoint
+	counter  uint32
+	mu       sync.RWMutex
+}
+
+type ringPoint struct {
+	hash    uint64
+	backend string
+}
+
+// NewConsistentHashBalancer creates a consistent hashing balancer; backends
+// without a positive weight get a weight of 1
+func NewConsistentHashBalancer(backends []string, weights map[string]int) *ConsistentHashBalancer {
+	b := &ConsistentHashBalancer{weights: weights}
+	b.UpdateBackends(backends)
+	return b
+}
+
+// Next returns the next backend in round-robin order, for requests without a key
+func (b *ConsistentHashBalancer) Next() string {
+	return b.NextFrom(nil)
+}
+
+// NextFrom returns the next eligible backend in round-robin order
+func (b *ConsistentHashBalancer) NextFrom(eligible func(backend string) bool) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return nextInOrder(b.backends, &b.counter, eligible)
+}
+
+// ForKey returns a walk of the ring starting at the backend owning key
+func (b *ConsistentHashBalancer) ForKey(key string) Balancer {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	ring := b.ring
+	hash := hashKey(key)
+	start := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= hash })
+	return &ringWalk{parent: b, ring: ring, next: start, seen: make(map[string]bool)}
+}
+
+// UpdateBackends rebuilds the ring for the given backends
+func (b *ConsistentHashBalancer) UpdateBackends(backends []string) {
+	var ring []ringPoint
+	for _, addr := range backends {
+		weight := b.weights[addr]
+		if weight <= 0 {
+			weight = 1
+		}
+		for i := 0; i < weight*virtualNodes; i++ {
+			ring = append(ring, ringPoint{hash: hashKey(addr + "#" + strconv.Itoa(i)), backend: addr})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.backends = backends
+	b.ring = ring
+}
+
+// GetBackends returns current backends
+func (b *ConsistentHashBalancer) GetBackends() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]string{}, b.backends...)
+}
+
+// State returns the position of the round-robin spread of keyless requests
+func (b *ConsistentHashBalancer) State() State {
+	return State{Counter: atomic.LoadUint32(&b.counter)}
+}
+
+// Restore resumes from the state of a previous balancer; the ring itself
+// depends only on the backends
+func (b *ConsistentHashBalancer) Restore(state State) {
+	atomic.StoreUint32(&b.counter, state.Counter)
+}
+
+// ringWalk yields the distinct backends of a ring from a key's position on
+type ringWalk struct {
+	parent *ConsistentHashBalancer
+	ring   []ringPoint
+	next   int
+	seen   map[string]bool
+	mu     sync.Mutex
+}
+
+// Next returns the next backend on the ring not yet returned; once every
+// backend has been returned the walk starts over
+func (w *ringWalk) Next() string {
+	return w.NextFrom(nil)
+}
+
+// NextFrom returns the next eligible backend on the ring not yet returned
+func (w *ringWalk) NextFrom(eligible func(backend string) bool) string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.ring) == 0 {
+		return ""
+	}
+	for range 2 {
+		for i := 0; i < len(w.ring); i++ {
+			point := w.ring[(w.next+i)%len(w.ring)]
+			if !w.seen[point.backend] && (eligible == nil || eligible(point.backend)) {
+				w.seen[point.backend] = true
+				w.next = (w.next + i + 1) % len(w.ring)
+				return point.backend
+			}
+		}
+		clear(w.seen)
+	}
+	return ""
+}
+
+func (w *ringWalk) UpdateBackends(backends []string) { w.parent.UpdateBackends(backends) }
+func (w *ringWalk) GetBackends() []string            { return w.parent.GetBackends() }
+func (w *ringWalk) State() State                     { return w.parent.State() }
+func (w *ringWalk) Restore(state State)              { w.parent.Restore(state) }
+
+// hashKey hashes a key or ring point, mixing the FNV hash so that similar
+// strings such as a backend's virtual node names spread across the ring
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
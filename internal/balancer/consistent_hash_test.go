@@ -0,0 +1,59 @@
+package balancer
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestConsistentHash(t *testing.T) {
+	backends := []string{"a", "b", "c", "d"}
+	b := NewConsistentHashBalancer(backends, nil)
+
+	owners := make(map[string]string)
+	for i := range 1000 {
+		key := "user-" + strconv.Itoa(i)
+		owners[key] = b.ForKey(key).Next()
+		if again := b.ForKey(key).Next(); again != owners[key] {
+			t.Fatalf("key %s moved from %s to %s", key, owners[key], again)
+		}
+	}
+
+	// Removing a backend moves only the keys it owned
+	b.UpdateBackends([]string{"a", "b", "c"})
+	for key, owner := range owners {
+		got := b.ForKey(key).Next()
+		if owner != "d" && got != owner {
+			t.Errorf("key %s moved from %s to %s", key, owner, got)
+		}
+		if got == "d" {
+			t.Errorf("key %s still owned by removed backend", key)
+		}
+	}
+}
+
+func TestConsistentHashWalk(t *testing.T) {
+	tests := []struct {
+		name     string
+		eligible func(string) bool
+		want     int
+	}{
+		{name: "every backend once", want: 3},
+		{name: "eligible only", eligible: func(addr string) bool { return addr != "b" }, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			walk := NewConsistentHashBalancer([]string{"a", "b", "c"}, nil).ForKey("key")
+			seen := make(map[string]bool)
+			for range tt.want {
+				addr := walk.NextFrom(tt.eligible)
+				if addr == "" || seen[addr] {
+					t.Fatalf("walk returned %q after %v", addr, seen)
+				}
+				seen[addr] = true
+			}
+			if addr := walk.NextFrom(tt.eligible); !seen[addr] {
+				t.Errorf("walk did not start over: got %q", addr)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package balancer
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// P2CBalancer implements least-request balancing with power of two choices:
+// it samples two random backends and picks the one with fewer in-flight requests
+type P2CBalancer struct {
+	backends []string
+	inflight map[string]*int64
+	mu       sync.RWMutex
+}
+
+// NewP2CBalancer creates a new power-of-two-choices balancer
+func NewP2CBalancer(backends []string) *P2CBalancer {
+	b := &P2CBalancer{}
+	b.UpdateBackends(backends)
+	return b
+}
+
+// Next returns the less loaded of two randomly sampled backends
+func (b *P2CBalancer) Next() string {
+	return b.NextFrom(nil)
+}
+
+// NextFrom returns the less loaded of two randomly sampled eligible backends
+func (b *P2CBalancer) NextFrom(eligible func(backend string) bool) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	first, second := sampleTwo(filter(b.backends, eligible))
+	if second != "" && atomic.LoadInt64(b.inflight[second]) < atomic.LoadInt64(b.inflight[first]) {
+		return second
+	}
+	return first
+}
+
+// sampleTwo returns two distinct random backends, the second "" when there
+// is only one
+func sampleTwo(backends []string) (first, second string) {
+	switch len(backends) {
+	case 0:
+		return "", ""
+	case 1:
+		return backends[0], ""
+	}
+
+	i := rand.Intn(len(backends))
+	j := rand.Intn(len(backends) - 1)
+	if j >= i {
+		j++
+	}
+	return backends[i], backends[j]
+}
+
+// Begin counts an in-flight request to backend
+func (b *P2CBalancer) Begin(backend string) func() {
+	b.mu.RLock()
+	counter := b.inflight[backend]
+	b.mu.RUnlock()
+
+	if counter == nil {
+		return func() {}
+	}
+	atomic.AddInt64(counter, 1)
+	return func() { atomic.AddInt64(counter, -1) }
+}
+
+// UpdateBackends updates the list of backends, keeping counts of those retained
+func (b *P2CBalancer) UpdateBackends(backends []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	inflight := make(map[string]*int64, len(backends))
+	for _, addr := range backends {
+		if counter, ok := b.inflight[addr]; ok {
+			inflight[addr] = counter
+		} else {
+			inflight[addr] = new(int64)
+		}
+	}
+	b.backends = backends
+	b.inflight = inflight
+}
+
+// GetBackends returns current backends
+func (b *P2CBalancer) GetBackends() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]string{}, b.backends...)
+}
+
+// State returns the balancer state; selection is stateless
+func (b *P2CBalancer) State() State {
+	return State{}
+}
+
+// Restore is a no-op; in-flight counts belong to the previous balancer
+func (b *P2CBalancer) Restore(state State) {}
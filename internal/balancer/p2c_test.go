@@ -0,0 +1,20 @@
+package balancer
+
+import "testing"
+
+func TestP2CPrefersLessLoaded(t *testing.T) {
+	b := NewP2CBalancer([]string{"a", "b"})
+	done := b.Begin("a")
+	for range 20 {
+		if got := b.Next(); got != "b" {
+			t.Fatalf("Next = %q with a loaded, want b", got)
+		}
+	}
+	done()
+	if got := b.NextFrom(func(addr string) bool { return addr == "a" }); got != "a" {
+		t.Errorf("NextFrom = %q, want the only eligible backend a", got)
+	}
+	if got := NewP2CBalancer(nil).Next(); got != "" {
+		t.Errorf("Next without backends = %q, want none", got)
+	}
+}
@@ -0,0 +1,202 @@
+package balancer
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// ewmaDecay is the time over which old latency samples lose most of
+	// their weight
+	ewmaDecay = 10 * time.Second
+	// failurePenalty is the latency a failed request counts as, so backends
+	// failing fast do not attract traffic
+	failurePenalty = time.Second
+)
+
+// PeakEWMABalancer implements latency-aware balancing: it samples two random
+// backends and picks the one with the lower cost, an exponentially weighted
+// moving average of its latency that jumps to any higher sample at once,
+// multiplied by its in-flight requests plus one
+type PeakEWMABalancer struct {
+	backends []string
+	stats    map[string]*ewmaStats
+	mu       sync.RWMutex
+}
+
+type ewmaStats struct {
+	mu       sync.Mutex
+	latency  float64 // nanoseconds
+	updated  time.Time
+	inflight int64
+	failures int64
+}
+
+// Score reports the state a latency-aware balancer keeps for a backend
+type Score struct {
+	Backend  string  `json:"backend"`
+	Latency  float64 `json:"latency_ms"` // peak EWMA
+	Inflight int64   `json:"inflight"`
+	Failures int64   `json:"failures"`
+	Cost     float64 `json:"cost"`
+}
+
+// NewPeakEWMABalancer creates a latency-aware balancer
+func NewPeakEWMABalancer(backends []string) *PeakEWMABalancer {
+	b := &PeakEWMABalancer{}
+	b.UpdateBackends(backends)
+	return b
+}
+
+// Next returns the cheaper of two randomly sampled backends
+func (b *PeakEWMABalancer) Next() string {
+	return b.NextFrom(nil)
+}
+
+// NextFrom returns the cheaper of two randomly sampled eligible backends
+func (b *PeakEWMABalancer) NextFrom(eligible func(backend string) bool) string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	first, second := sampleTwo(filter(b.backends, eligible))
+	if second != "" && b.stats[second].cost() < b.stats[first].cost() {
+		return second
+	}
+	return first
+}
+
+// Begin counts an in-flight request to backend; done records its latency
+func (b *PeakEWMABalancer) Begin(backend string) func() {
+	b.mu.RLock()
+	s := b.stats[backend]
+	b.mu.RUnlock()
+
+	if s == nil {
+		return func() {}
+	}
+	s.mu.Lock()
+	s.inflight++
+	s.mu.Unlock()
+
+	start := time.Now()
+	return func() {
+		now := time.Now()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.inflight--
+		s.observe(now, now.Sub(start))
+	}
+}
+
+// Failed records a failed request to backend as a penalty latency
+func (b *PeakEWMABalancer) Failed(backend string) {
+	b.mu.RLock()
+	s := b.stats[backend]
+	b.mu.RUnlock()
+
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures++
+	s.observe(time.Now(), failurePenalty)
+}
+
+// UpdateBackends updates the list of backends, keeping the statistics of
+// those retained
+func (b *PeakEWMABalancer) UpdateBackends(backends []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := make(map[string]*ewmaStats, len(backends))
+	for _, addr := range backends {
+		if s, ok := b.stats[addr]; ok {
+			stats[addr] = s
+		} else {
+			stats[addr] = &ewmaStats{}
+		}
+	}
+	b.backends = backends
+	b.stats = stats
+}
+
+// GetBackends returns current backends
+func (b *PeakEWMABalancer) GetBackends() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]string{}, b.backends...)
+}
+
+// State returns the latency averages to carry over to a replacement balancer
+func (b *PeakEWMABalancer) State() State {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	latencies := make(map[string]time.Duration, len(b.stats))
+	for addr, s := range b.stats {
+		s.mu.Lock()
+		latencies[addr] = time.Duration(s.latency)
+		s.mu.Unlock()
+	}
+	return State{Latencies: latencies}
+}
+
+// Restore resumes from the latency averages of a previous balancer; in-flight
+// counts belong to the previous balancer
+func (b *PeakEWMABalancer) Restore(state State) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	now := time.Now()
+	for addr, latency := range state.Latencies {
+		if s := b.stats[addr]; s != nil {
+			s.mu.Lock()
+			s.latency, s.updated = float64(latency), now
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Scores reports every backend's latency average and cost, ordered by address
+func (b *PeakEWMABalancer) Scores() []Score {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	scores := make([]Score, 0, len(b.stats))
+	for addr, s := range b.stats {
+		cost := s.cost()
+		s.mu.Lock()
+		scores = append(scores, Score{
+			Backend:  addr,
+			Latency:  s.latency / float64(time.Millisecond),
+			Inflight: s.inflight,
+			Failures: s.failures,
+			Cost:     cost / float64(time.Millisecond),
+		})
+		s.mu.Unlock()
+	}
+	sort.Slice(scores, func(i, j int) bool { return scores[i].Backend < scores[j].Backend })
+	return scores
+}
+
+// observe adds a latency sample; the caller holds s.mu
+func (s *ewmaStats) observe(now time.Time, latency time.Duration) {
+	sample := float64(latency)
+	if sample > s.latency {
+		s.latency = sample
+	} else {
+		weight := math.Exp(-float64(now.Sub(s.updated)) / float64(ewmaDecay))
+		s.latency = s.latency*weight + sample*(1-weight)
+	}
+	s.updated = now
+}
+
+// cost weighs the latency average by the requests already waiting on it
+func (s *ewmaStats) cost() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latency * float64(s.inflight+1)
+}
@@ -22,23 +22,50 @@ func NewRoundRobinBalancer(backends []string) *RoundRobinBalancer {
 
 // Next returns the next backend in round-robin order
 func (b *RoundRobinBalancer) Next() string {
+	return b.NextFrom(nil)
+}
+
+// NextFrom returns the first eligible backend from the next position in
+// round-robin order
+func (b *RoundRobinBalancer) NextFrom(eligible func(backend string) bool) string {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
+	return nextInOrder(b.backends, &b.counter, eligible)
+}
 
-	if len(b.backends) == 0 {
+// nextInOrder advances counter once and returns the first eligible backend
+// from its position on
+func nextInOrder(backends []string, counter *uint32, eligible func(backend string) bool) string {
+	if len(backends) == 0 {
 		return ""
 	}
 
-	index := atomic.AddUint32(&b.counter, 1)
-	return b.backends[int(index-1)%len(b.backends)]
+	index := int(atomic.AddUint32(counter, 1) - 1)
+	for i := range backends {
+		addr := backends[(index+i)%len(backends)]
+		if eligible == nil || eligible(addr) {
+			return addr
+		}
+	}
+	return ""
 }
 
-// UpdateBackends updates the list of backends
+// UpdateBackends updates the list of backends; the rotation position is kept
+// so updates don't send a burst of traffic to the first backend
 func (b *RoundRobinBalancer) UpdateBackends(backends []string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.backends = backends
-	atomic.StoreUint32(&b.counter, 0)
+}
+
+// State returns the balancer state to carry over to a replacement balancer
+func (b *RoundRobinBalancer) State() State {
+	return State{Counter: atomic.LoadUint32(&b.counter)}
+}
+
+// Restore resumes from the state of a previous balancer
+func (b *RoundRobinBalancer) Restore(state State) {
+	atomic.StoreUint32(&b.counter, state.Counter)
 }
 
 // GetBackends returns current backends
@@ -0,0 +1,10 @@
+package balancer
+
+import "time"
+
+// State is balancer state carried across configuration reloads
+type State struct {
+	Counter   uint32
+	Weights   map[string]int           // current weights of weighted round-robin
+	Latencies map[string]time.Duration // latency averages of peak EWMA
+}
@@ -0,0 +1,13 @@
+package balancer
+
+import "testing"
+
+func TestRoundRobinRestore(t *testing.T) {
+	old := NewRoundRobinBalancer([]string{"a", "b", "c"})
+	old.Next()
+	b := NewRoundRobinBalancer([]string{"a", "b", "c"})
+	b.Restore(old.State())
+	if got := b.Next(); got != "b" {
+		t.Errorf("Next after Restore = %q, want b", got)
+	}
+}
@@ -0,0 +1,36 @@
+package balancer
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// Subset deterministically picks size backends for the instance identified by
+// seed using rendezvous hashing. Each instance keeps a stable subset, and
+// because every backend is equally likely to rank highly for a given seed,
+// load stays even across the fleet.
+func Subset(backends []string, size int, seed string) []string {
+	if size <= 0 || size >= len(backends) {
+		return backends
+	}
+
+	type scored struct {
+		addr  string
+		score uint64
+	}
+	ranked := make([]scored, len(backends))
+	for i, addr := range backends {
+		h := fnv.New64a()
+		h.Write([]byte(seed))
+		h.Write([]byte{0})
+		h.Write([]byte(addr))
+		ranked[i] = scored{addr: addr, score: h.Sum64()}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+
+	subset := make([]string, size)
+	for i := range subset {
+		subset[i] = ranked[i].addr
+	}
+	return subset
+}
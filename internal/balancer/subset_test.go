@@ -0,0 +1,31 @@
+package balancer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSubset(t *testing.T) {
+	backends := []string{"a", "b", "c", "d", "e", "f"}
+	tests := []struct {
+		name string
+		size int
+		want int
+	}{
+		{name: "smaller", size: 3, want: 3},
+		{name: "whole", size: 6, want: 6},
+		{name: "larger", size: 10, want: 6},
+		{name: "unset", size: 0, want: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Subset(backends, tt.size, "instance-1")
+			if len(got) != tt.want {
+				t.Fatalf("got %d backends, want %d", len(got), tt.want)
+			}
+			if again := Subset(backends, tt.size, "instance-1"); !slices.Equal(got, again) {
+				t.Errorf("subset changed from %q to %q", got, again)
+			}
+		})
+	}
+}
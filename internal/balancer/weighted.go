@@ -0,0 +1,97 @@
+package balancer
+
+import "sync"
+
+// WeightedRoundRobinBalancer implements smooth weighted round-robin: each pick
+// raises every backend's current weight by its weight and takes the highest,
+// which then drops by the total. Backends receive traffic in proportion to
+// their weights, interleaved rather than in bursts.
+type WeightedRoundRobinBalancer struct {
+	backends []string
+	weights  map[string]int
+	current  map[string]int
+	mu       sync.Mutex
+}
+
+// NewWeightedRoundRobinBalancer creates a weighted round-robin balancer;
+// backends without a positive weight get a weight of 1
+func NewWeightedRoundRobinBalancer(backends []string, weights map[string]int) *WeightedRoundRobinBalancer {
+	b := &WeightedRoundRobinBalancer{weights: weights, current: make(map[string]int)}
+	b.UpdateBackends(backends)
+	return b
+}
+
+// Next returns the backend with the highest current weight
+func (b *WeightedRoundRobinBalancer) Next() string {
+	return b.NextFrom(nil)
+}
+
+// NextFrom returns the eligible backend with the highest current weight,
+// weighing only the eligible backends
+func (b *WeightedRoundRobinBalancer) NextFrom(eligible func(backend string) bool) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best, total := "", 0
+	for _, addr := range filter(b.backends, eligible) {
+		weight := b.weight(addr)
+		b.current[addr] += weight
+		total += weight
+		if best == "" || b.current[addr] > b.current[best] {
+			best = addr
+		}
+	}
+	if best != "" {
+		b.current[best] -= total
+	}
+	return best
+}
+
+func (b *WeightedRoundRobinBalancer) weight(addr string) int {
+	if w := b.weights[addr]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// UpdateBackends updates the list of backends, keeping the current weights
+// of those retained
+func (b *WeightedRoundRobinBalancer) UpdateBackends(backends []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	current := make(map[string]int, len(backends))
+	for _, addr := range backends {
+		current[addr] = b.current[addr]
+	}
+	b.backends = backends
+	b.current = current
+}
+
+// GetBackends returns current backends
+func (b *WeightedRoundRobinBalancer) GetBackends() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string{}, b.backends...)
+}
+
+// State returns the current weights to carry over to a replacement balancer
+func (b *WeightedRoundRobinBalancer) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	current := make(map[string]int, len(b.current))
+	for addr, w := range b.current {
+		current[addr] = w
+	}
+	return State{Weights: current}
+}
+
+// Restore resumes from the current weights of a previous balancer, for the
+// backends both share
+func (b *WeightedRoundRobinBalancer) Restore(state State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for addr := range b.current {
+		b.current[addr] = state.Weights[addr]
+	}
+}
@@ -0,0 +1,65 @@
+package balancer
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestWeightedRoundRobin(t *testing.T) {
+	tests := []struct {
+		name     string
+		backends []string
+		weights  map[string]int
+		eligible func(string) bool
+		picks    int
+		want     map[string]int
+	}{
+		{
+			name:     "proportional",
+			backends: []string{"a", "b", "c"},
+			weights:  map[string]int{"a": 5, "b": 1, "c": 1},
+			picks:    70,
+			want:     map[string]int{"a": 50, "b": 10, "c": 10},
+		},
+		{
+			name:     "missing weights count as one",
+			backends: []string{"a", "b"},
+			weights:  map[string]int{"a": 3, "b": -1},
+			picks:    40,
+			want:     map[string]int{"a": 30, "b": 10},
+		},
+		{
+			name:     "only eligible",
+			backends: []string{"a", "b", "c"},
+			weights:  map[string]int{"a": 2, "b": 1, "c": 1},
+			eligible: func(addr string) bool { return addr != "a" },
+			picks:    10,
+			want:     map[string]int{"b": 5, "c": 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewWeightedRoundRobinBalancer(tt.backends, tt.weights)
+			got := make(map[string]int)
+			for range tt.picks {
+				got[b.NextFrom(tt.eligible)]++
+			}
+			for addr, n := range tt.want {
+				if got[addr] != n {
+					t.Errorf("%s picked %d times, want %d (all picks %v)", addr, got[addr], n, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWeightedRoundRobinInterleaves(t *testing.T) {
+	b := NewWeightedRoundRobinBalancer([]string{"a", "b"}, map[string]int{"a": 2, "b": 1})
+	var got []string
+	for range 6 {
+		got = append(got, b.Next())
+	}
+	if want := []string{"a", "b", "a", "a", "b", "a"}; !slices.Equal(got, want) {
+		t.Errorf("picks = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,213 @@
+package breaker
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// State is the state of a backend's circuit
+type State string
+
+const (
+	Closed   State = "closed"    // requests flow normally
+	Open     State = "open"      // requests go to other backends
+	HalfOpen State = "half_open" // a trial request decides whether to close
+)
+
+// Set tracks a circuit per backend address and, with outlier detection,
+// ejects backends failing too often. A nil Set, or one without settings,
+// admits every request.
+type Set struct {
+	settings        *settings
+	circuits        map[string]*circuit
+	outlierSettings *outlierSettings
+	outliers        map[string]*outlier
+	mu              sync.Mutex
+}
+
+type settings struct {
+	consecutiveFailures int
+	errorRate           float64
+	minRequests         int
+	window              time.Duration
+	openDuration        time.Duration
+}
+
+type circuit struct {
+	state       State
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	trialAt     time.Time // start of the trial request in flight, if any
+}
+
+// Status reports the circuit of a backend
+type Status struct {
+	Backend             string    `json:"backend"`
+	State               State     `json:"state"`
+	Requests            int       `json:"requests"` // in the current window
+	Failures            int       `json:"failures"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitzero"`
+}
+
+// NewSet creates a set of circuits using cfg, which may be nil to disable
+// circuit breaking until Configure is called
+func NewSet(cfg *config.CircuitBreaker) *Set {
+	s := &Set{circuits: make(map[string]*circuit), outliers: make(map[string]*outlier)}
+	s.Configure(cfg)
+	return s
+}
+
+// Configure replaces the settings; circuit states are kept
+func (s *Set) Configure(cfg *config.CircuitBreaker) {
+	var st *settings
+	if cfg != nil {
+		st = &settings{
+			consecutiveFailures: cfg.ConsecutiveFailures,
+			errorRate:           cfg.ErrorRate,
+			minRequests:         cfg.MinRequests,
+		}
+		st.window, _ = time.ParseDuration(cfg.Window)
+		st.openDuration, _ = time.ParseDuration(cfg.OpenDuration)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = st
+	if st == nil {
+		s.circuits = make(map[string]*circuit)
+	}
+}
+
+// Allow reports whether a request may be sent to backend. Once an open
+// circuit has waited out the open duration, one trial request is admitted at
+// a time until a result is recorded. Ejected outliers are admitted gradually
+// once their ejection ends.
+func (s *Set) Allow(backend string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.outlierSettings != nil && !s.admitOutlier(backend, now) {
+		return false
+	}
+	if s.settings == nil {
+		return true
+	}
+
+	c := s.circuits[backend]
+	if c == nil || c.state == Closed {
+		return true
+	}
+	if c.state == Open {
+		if now.Sub(c.openedAt) < s.settings.openDuration {
+			return false
+		}
+		c.state = HalfOpen
+		log.Printf("Circuit for backend %s is half-open", backend)
+	}
+	// A trial that never reported back is replaced after the open duration
+	if !c.trialAt.IsZero() && now.Sub(c.trialAt) < s.settings.openDuration {
+		return false
+	}
+	c.trialAt = now
+	return true
+}
+
+// Record reports the outcome of a request to backend
+func (s *Set) Record(backend string, ok bool) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.outlierSettings != nil {
+		s.recordOutlier(backend, ok, now)
+	}
+	if s.settings == nil {
+		return
+	}
+
+	c := s.circuits[backend]
+	if c == nil {
+		c = &circuit{state: Closed}
+		s.circuits[backend] = c
+	}
+
+	switch c.state {
+	case Open:
+		// Requests started before the circuit opened
+		return
+	case HalfOpen:
+		c.trialAt = time.Time{}
+		if ok {
+			*c = circuit{state: Closed}
+			log.Printf("Circuit for backend %s closed", backend)
+		} else {
+			c.state = Open
+			c.openedAt = now
+			log.Printf("Circuit for backend %s reopened after a failed trial request", backend)
+		}
+		return
+	}
+
+	if now.Sub(c.windowStart) >= s.settings.window {
+		c.windowStart = now
+		c.requests, c.failures = 0, 0
+	}
+	c.requests++
+	if ok {
+		c.consecutive = 0
+		return
+	}
+	c.failures++
+	c.consecutive++
+
+	tripped := s.settings.consecutiveFailures > 0 && c.consecutive >= s.settings.consecutiveFailures
+	if c.requests >= s.settings.minRequests && float64(c.failures)/float64(c.requests) >= s.settings.errorRate {
+		tripped = true
+	}
+	if tripped {
+		c.state = Open
+		c.openedAt = now
+		log.Printf("Circuit for backend %s opened after %d of %d requests failed (%d in a row)", backend, c.failures, c.requests, c.consecutive)
+	}
+}
+
+// Status reports every backend's circuit, ordered by address
+func (s *Set) Status() []Status {
+	statuses := []Status{}
+	if s == nil {
+		return statuses
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for backend, c := range s.circuits {
+		status := Status{
+			Backend:             backend,
+			State:               c.state,
+			Requests:            c.requests,
+			Failures:            c.failures,
+			ConsecutiveFailures: c.consecutive,
+		}
+		if c.state != Closed {
+			status.OpenedAt = c.openedAt
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Backend < statuses[j].Backend
+	})
+	return statuses
+}
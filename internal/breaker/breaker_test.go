@@ -0,0 +1,111 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+func testBreaker() *config.CircuitBreaker {
+	return &config.CircuitBreaker{
+		ConsecutiveFailures: 3,
+		ErrorRate:           0.5,
+		MinRequests:         10,
+		Window:              "1m",
+		OpenDuration:        "30s",
+	}
+}
+
+func TestTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes []bool
+		want     State
+	}{
+		{name: "successes", outcomes: []bool{true, true, true}, want: Closed},
+		{name: "consecutive failures", outcomes: []bool{true, false, false, false}, want: Open},
+		{name: "failures interrupted", outcomes: []bool{false, false, true, false, false}, want: Closed},
+		{
+			name:     "error rate",
+			outcomes: []bool{true, false, true, false, true, false, true, false, true, false},
+			want:     Open,
+		},
+		{
+			name:     "error rate below min requests",
+			outcomes: []bool{true, false, true, false, true, false},
+			want:     Closed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSet(testBreaker())
+			for _, ok := range tt.outcomes {
+				s.Record("a", ok)
+			}
+			if got := s.Status()[0].State; got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+			if allowed := s.Allow("a"); allowed != (tt.want == Closed) {
+				t.Errorf("Allow = %v in state %s", allowed, tt.want)
+			}
+			if !s.Allow("b") {
+				t.Error("Allow refused another backend")
+			}
+		})
+	}
+}
+
+func TestHalfOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		trial bool
+		want  State
+	}{
+		{name: "trial succeeds", trial: true, want: Closed},
+		{name: "trial fails", trial: false, want: Open},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSet(testBreaker())
+			for range 3 {
+				s.Record("a", false)
+			}
+			// Wait out the open duration
+			s.mu.Lock()
+			s.circuits["a"].openedAt = time.Now().Add(-time.Minute)
+			s.mu.Unlock()
+
+			if !s.Allow("a") {
+				t.Fatal("trial request refused")
+			}
+			if s.Allow("a") {
+				t.Fatal("second request admitted while the trial is in flight")
+			}
+			s.Record("a", tt.trial)
+			if got := s.Status()[0].State; got != tt.want {
+				t.Errorf("state = %s, want %s", got, tt.want)
+			}
+			if allowed := s.Allow("a"); allowed != tt.trial {
+				t.Errorf("Allow after the trial = %v, want %v", allowed, tt.trial)
+			}
+		})
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	var nilSet *Set
+	for name, s := range map[string]*Set{"nil": nilSet, "unconfigured": NewSet(nil)} {
+		t.Run(name, func(t *testing.T) {
+			for range 10 {
+				s.Record("a", false)
+			}
+			if !s.Allow("a") {
+				t.Error("Allow refused a request without circuit breaking")
+			}
+			if got := s.Status(); len(got) != 0 {
+				t.Errorf("Status = %v, want none", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package breaker
+
+import (
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// outlierSettings are the parsed outlier detection settings
+type outlierSettings struct {
+	errorRate    float64
+	minRequests  int
+	interval     time.Duration
+	baseEjection time.Duration
+	maxEjection  time.Duration
+	readmission  time.Duration
+}
+
+// outlier tracks a backend's failure rate and ejections
+type outlier struct {
+	windowStart time.Time
+	requests    int
+	failures    int
+	ejections   int       // consecutive ejections, lengthening the next one
+	ejectedAt   time.Time // start of the last ejection
+	until       time.Time // end of the last ejection
+}
+
+// OutlierStatus reports the outlier detection state of a backend
+type OutlierStatus struct {
+	Backend    string    `json:"backend"`
+	Ejected    bool      `json:"ejected"`
+	Requests   int       `json:"requests"` // in the current interval
+	Failures   int       `json:"failures"`
+	Ejections  int       `json:"ejections"` // consecutive
+	EjectedAt  time.Time `json:"ejected_at,omitzero"`
+	Until      time.Time `json:"until,omitzero"`
+	Admittance float64   `json:"admittance"` // share of its traffic the backend receives
+}
+
+// ConfigureOutliers replaces the outlier detection settings; cfg may be nil
+// to disable outlier detection. Ejections are kept.
+func (s *Set) ConfigureOutliers(cfg *config.OutlierDetection) {
+	var st *outlierSettings
+	if cfg != nil {
+		st = &outlierSettings{
+			errorRate:   cfg.ErrorRate,
+			minRequests: cfg.MinRequests,
+		}
+		st.interval, _ = time.ParseDuration(cfg.Interval)
+		st.baseEjection, _ = time.ParseDuration(cfg.BaseEjectionTime)
+		st.maxEjection, _ = time.ParseDuration(cfg.MaxEjectionTime)
+		st.readmission, _ = time.ParseDuration(cfg.ReadmissionPeriod)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.outlierSettings = st
+	if st == nil {
+		s.outliers = make(map[string]*outlier)
+	}
+}
+
+// admitOutlier reports whether an outlier backend may take a request: none
+// while ejected, then a share growing linearly over the readmission period.
+// The caller holds s.mu.
+func (s *Set) admitOutlier(backend string, now time.Time) bool {
+	o := s.outliers[backend]
+	if o == nil {
+		return true
+	}
+	return rand.Float64() < o.admittance(now, s.outlierSettings.readmission)
+}
+
+// recordOutlier counts the outcome of a request and ejects the backend when
+// its failure rate in the interval is too high. The caller holds s.mu.
+func (s *Set) recordOutlier(backend string, ok bool, now time.Time) {
+	st := s.outlierSettings
+	o := s.outliers[backend]
+	if o == nil {
+		o = &outlier{windowStart: now}
+		s.outliers[backend] = o
+	}
+	if now.Before(o.until) {
+		// Requests started before the ejection
+		return
+	}
+
+	if now.Sub(o.windowStart) >= st.interval {
+		// A backend back to a full share through a whole interval has
+		// recovered, and its next ejection is shorter
+		if o.ejections > 0 && o.windowStart.After(o.until.Add(st.readmission)) {
+			o.ejections--
+		}
+		o.windowStart = now
+		o.requests, o.failures = 0, 0
+	}
+	o.requests++
+	if !ok {
+		o.failures++
+	}
+	if o.requests < st.minRequests || float64(o.failures)/float64(o.requests) < st.errorRate {
+		return
+	}
+
+	ejection := st.maxEjection
+	if o.ejections < 30 {
+		ejection = min(st.baseEjection<<o.ejections, st.maxEjection)
+	}
+	o.ejections++
+	o.ejectedAt, o.until = now, now.Add(ejection)
+	log.Printf("Ejected outlier backend %s for %v after %d of %d requests failed", backend, ejection, o.failures, o.requests)
+	o.windowStart = o.until
+	o.requests, o.failures = 0, 0
+}
+
+// admittance returns the share of requests a backend receives
+func (o *outlier) admittance(now time.Time, readmission time.Duration) float64 {
+	switch {
+	case now.Before(o.until):
+		return 0
+	case o.until.IsZero() || readmission <= 0 || now.Sub(o.until) >= readmission:
+		return 1
+	}
+	return float64(now.Sub(o.until)) / float64(readmission)
+}
+
+// Outliers reports the outlier detection state of every backend, ordered by
+// address
+func (s *Set) Outliers() []OutlierStatus {
+	statuses := []OutlierStatus{}
+	if s == nil {
+		return statuses
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.outlierSettings == nil {
+		return statuses
+	}
+
+	now := time.Now()
+	for backend, o := range s.outliers {
+		statuses = append(statuses, OutlierStatus{
+			Backend:    backend,
+			Ejected:    now.Before(o.until),
+			Requests:   o.requests,
+			Failures:   o.failures,
+			Ejections:  o.ejections,
+			EjectedAt:  o.ejectedAt,
+			Until:      o.until,
+			Admittance: o.admittance(now, s.outlierSettings.readmission),
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Backend < statuses[j].Backend
+	})
+	return statuses
+}
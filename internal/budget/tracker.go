@@ -0,0 +1,75 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"dynamic-gateway/internal/storage"
+)
+
+// Tracker enforces per-consumer cost budgets over fixed windows
+type Tracker struct {
+	store  storage.Store
+	limit  int64
+	window time.Duration
+}
+
+// NewTracker creates a tracker allowing limit cost units per consumer per window
+func NewTracker(store storage.Store, limit int64, window time.Duration) *Tracker {
+	return &Tracker{
+		store:  store,
+		limit:  limit,
+		window: window,
+	}
+}
+
+// Limit returns the configured budget per window
+func (t *Tracker) Limit() int64 {
+	return t.limit
+}
+
+// Remaining returns the budget left for consumer and when it resets
+func (t *Tracker) Remaining(ctx context.Context, consumer string) (int64, time.Time, error) {
+	key, resetAt := t.windowKey(consumer)
+
+	value, err := t.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return t.limit, resetAt, nil
+	}
+	if err != nil {
+		return 0, resetAt, err
+	}
+
+	spent, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, resetAt, fmt.Errorf("invalid budget usage for %s: %w", consumer, err)
+	}
+	return t.remaining(spent), resetAt, nil
+}
+
+// Charge records cost against the consumer's budget and returns what is left
+func (t *Tracker) Charge(ctx context.Context, consumer string, cost int64) (int64, time.Time, error) {
+	key, resetAt := t.windowKey(consumer)
+
+	spent, err := t.store.IncrBy(ctx, key, cost, time.Until(resetAt))
+	if err != nil {
+		return 0, resetAt, err
+	}
+	return t.remaining(spent), resetAt, nil
+}
+
+// windowKey returns the storage key of the consumer's current window and its end
+func (t *Tracker) windowKey(consumer string) (string, time.Time) {
+	start := time.Now().Truncate(t.window)
+	return fmt.Sprintf("budget:%s:%d", consumer, start.Unix()), start.Add(t.window)
+}
+
+func (t *Tracker) remaining(spent int64) int64 {
+	if spent >= t.limit {
+		return 0
+	}
+	return t.limit - spent
+}
@@ -0,0 +1,46 @@
+package budget
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"dynamic-gateway/internal/storage"
+)
+
+func TestTracker(t *testing.T) {
+	tests := []struct {
+		name    string
+		charges []int64
+		want    int64
+	}{
+		{name: "unused", want: 100},
+		{name: "partly spent", charges: []int64{30, 20}, want: 50},
+		{name: "exactly spent", charges: []int64{100}, want: 0},
+		{name: "overspent", charges: []int64{80, 80}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			tracker := NewTracker(storage.NewMemoryStore(), 100, time.Hour)
+			for _, cost := range tt.charges {
+				if _, _, err := tracker.Charge(ctx, "alice", cost); err != nil {
+					t.Fatal(err)
+				}
+			}
+			remaining, resetAt, err := tracker.Remaining(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if remaining != tt.want {
+				t.Errorf("remaining = %d, want %d", remaining, tt.want)
+			}
+			if until := time.Until(resetAt); until <= 0 || until > time.Hour {
+				t.Errorf("resets in %v, want within the window", until)
+			}
+			if other, _, _ := tracker.Remaining(ctx, "bob"); other != 100 {
+				t.Errorf("other consumer has %d left, want 100", other)
+			}
+		})
+	}
+}
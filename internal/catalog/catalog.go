@@ -0,0 +1,187 @@
+package catalog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Catalog is the machine-readable listing of everything the gateway exposes.
+// It is served without authentication, so backends are only listed when the
+// configuration opts in with catalog.list_backends.
+type Catalog struct {
+	HTTPRoutes   []Entry `json:"http_routes"`
+	GRPCServices []Entry `json:"grpc_services"`
+}
+
+// Entry describes a single route or service
+type Entry struct {
+	Name           string            `json:"name"`
+	Methods        []string          `json:"methods,omitempty"`
+	TargetProtocol string            `json:"target_protocol"`
+	Description    string            `json:"description,omitempty"`
+	Owner          string            `json:"owner,omitempty"`
+	Tags           []string          `json:"tags,omitempty"`
+	Backends       []Backend         `json:"backends,omitempty"`
+	Policies       map[string]any    `json:"policies,omitempty"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+// Backend describes an upstream target without credentials
+type Backend struct {
+	Address   string `json:"address"`
+	Weight    int    `json:"weight,omitempty"`
+	TLS       bool   `json:"tls,omitempty"`
+	Federated bool   `json:"federated,omitempty"`
+}
+
+// Build renders the catalog for a configuration
+func Build(cfg *config.Config) *Catalog {
+	catalog := &Catalog{
+		HTTPRoutes:   make([]Entry, 0, len(cfg.HTTPRoutes)),
+		GRPCServices: make([]Entry, 0, len(cfg.GRPCServices)),
+	}
+	listBackends := cfg.Catalog != nil && cfg.Catalog.ListBackends
+	backends := func(list []config.Backend) []Backend {
+		if !listBackends {
+			return nil
+		}
+		result := make([]Backend, len(list))
+		for i, b := range list {
+			result[i] = Backend{Address: b.Address, Weight: b.Weight, TLS: b.TLS, Federated: b.Federated}
+		}
+		return result
+	}
+
+	for _, route := range cfg.HTTPRoutes {
+		protocol := route.TargetProtocol
+		if protocol == "" {
+			protocol = "http"
+		}
+
+		policies := map[string]any{}
+		if route.Timeout != "" {
+			policies["timeout"] = route.Timeout
+		}
+		if route.StripPath {
+			policies["strip_path"] = true
+		}
+		if route.Cost > 0 || route.CostHeader != "" {
+			policies["cost"] = map[string]any{"static": route.Cost, "header": route.CostHeader}
+		}
+		if route.Deprecation != nil {
+			policies["deprecation"] = route.Deprecation
+		}
+		if route.Redirects != nil {
+			policies["redirects"] = route.Redirects
+		}
+		if route.Auth != nil && route.Auth.Mode != "" {
+			// Only the mode is published; credentials stay private
+			policies["auth"] = route.Auth.Mode
+		}
+
+		catalog.HTTPRoutes = append(catalog.HTTPRoutes, Entry{
+			Name:           route.Path,
+			Methods:        route.Methods,
+			TargetProtocol: protocol,
+			Description:    route.Docs.Description,
+			Owner:          route.Docs.Owner,
+			Tags:           route.Docs.Tags,
+			Backends:       backends(route.Backends),
+			Policies:       nonEmpty(policies),
+			Metadata:       route.Metadata,
+		})
+	}
+
+	for _, svc := range cfg.GRPCServices {
+		protocol := "http"
+		if svc.IsGRPC {
+			protocol = "grpc"
+		}
+
+		policies := map[string]any{}
+		if svc.Timeout != "" {
+			policies["timeout"] = svc.Timeout
+		}
+		if svc.RetryAttempts > 0 {
+			policies["retry_attempts"] = svc.RetryAttempts
+		}
+		if svc.MaxCallRecvMsgSize > 0 {
+			policies["max_call_recv_msg_size"] = svc.MaxCallRecvMsgSize
+		}
+
+		catalog.GRPCServices = append(catalog.GRPCServices, Entry{
+			Name:           svc.ServiceName,
+			TargetProtocol: protocol,
+			Description:    svc.Docs.Description,
+			Owner:          svc.Docs.Owner,
+			Tags:           svc.Docs.Tags,
+			Backends:       backends(svc.Backends),
+			Policies:       nonEmpty(policies),
+			Metadata:       svc.Metadata,
+		})
+	}
+
+	// Routes sharing a path are told apart by their methods
+	sort.Slice(catalog.HTTPRoutes, func(i, j int) bool {
+		a, b := catalog.HTTPRoutes[i], catalog.HTTPRoutes[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return strings.Join(a.Methods, ",") < strings.Join(b.Methods, ",")
+	})
+	sort.Slice(catalog.GRPCServices, func(i, j int) bool {
+		return catalog.GRPCServices[i].Name < catalog.GRPCServices[j].Name
+	})
+
+	return catalog
+}
+
+// Handler serves the catalog of the configuration returned by current as JSON,
+// optionally filtered by ?tag= or ?owner=
+func Handler(current func() *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		catalog := Build(current())
+
+		if tag, owner := r.URL.Query().Get("tag"), r.URL.Query().Get("owner"); tag != "" || owner != "" {
+			catalog.HTTPRoutes = filter(catalog.HTTPRoutes, tag, owner)
+			catalog.GRPCServices = filter(catalog.GRPCServices, tag, owner)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(catalog)
+	}
+}
+
+func filter(entries []Entry, tag, owner string) []Entry {
+	result := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		if owner != "" && e.Owner != owner {
+			continue
+		}
+		if tag != "" && !contains(e.Tags, tag) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func nonEmpty(m map[string]any) map[string]any {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
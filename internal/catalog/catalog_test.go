@@ -0,0 +1,42 @@
+package catalog
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"dynamic-gateway/internal/config"
+)
+
+func TestBuild(t *testing.T) {
+	routes := []config.HTTPRoute{
+		{Path: "/orders", Methods: []string{"POST"}, Backends: []config.Backend{{Address: "http://orders-write:8080"}}},
+		{Path: "/accounts", Backends: []config.Backend{{Address: "http://accounts:8080"}}},
+		{Path: "/orders", Methods: []string{"GET"}, Backends: []config.Backend{{Address: "http://orders-read:8080"}}},
+	}
+	tests := []struct {
+		name         string
+		catalog      *config.Catalog
+		wantBackends bool
+	}{
+		{name: "backends left out by default"},
+		{name: "backends left out", catalog: &config.Catalog{}},
+		{name: "backends listed", catalog: &config.Catalog{ListBackends: true}, wantBackends: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Build(&config.Config{HTTPRoutes: routes, Catalog: tt.catalog})
+
+			var got []string
+			for _, e := range c.HTTPRoutes {
+				got = append(got, strings.TrimSpace(strings.Join(e.Methods, ",")+" "+e.Name))
+				if listed := len(e.Backends) > 0; listed != tt.wantBackends {
+					t.Errorf("%s lists backends %v, want %v", e.Name, e.Backends, tt.wantBackends)
+				}
+			}
+			if want := []string{"/accounts", "GET /orders", "POST /orders"}; !slices.Equal(got, want) {
+				t.Errorf("routes = %q, want %q", got, want)
+			}
+		})
+	}
+}
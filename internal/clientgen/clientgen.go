@@ -0,0 +1,228 @@
+package clientgen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/schema"
+)
+
+// Options controls client generation
+type Options struct {
+	Package string // Go package name
+}
+
+// endpoint is a single generated client method
+type endpoint struct {
+	Name       string
+	HTTPMethod string
+	Path       string   // path with {param} placeholders
+	Params     []string // path parameter names in order
+	Wildcard   bool     // route matches any sub-path
+	Input      protoreflect.MessageDescriptor
+	Output     protoreflect.MessageDescriptor
+}
+
+var paramPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// collect derives client endpoints from HTTP routes; gRPC-target routes are
+// expanded into one typed endpoint per method known to the descriptor store
+func collect(cfg *config.Config, descriptors *schema.Store) []endpoint {
+	var endpoints []endpoint
+	seen := make(map[string]bool)
+
+	add := func(e endpoint) {
+		name := e.Name
+		for i := 2; seen[e.Name]; i++ {
+			e.Name = fmt.Sprintf("%s%d", name, i)
+		}
+		seen[e.Name] = true
+		endpoints = append(endpoints, e)
+	}
+
+	for _, route := range cfg.HTTPRoutes {
+		if route.TargetProtocol == "grpc" && descriptors != nil {
+			prefix := strings.Split(strings.Trim(route.Path, "/"), "/")[0]
+			for _, svcName := range sortedServices(descriptors) {
+				methods := serviceMethods(descriptors, svcName)
+				for _, m := range methods {
+					add(endpoint{
+						Name:       exportName(lastSegment(svcName)) + exportName(string(m.Name())),
+						HTTPMethod: "POST",
+						Path:       fmt.Sprintf("/%s/%s/%s", prefix, svcName, m.Name()),
+						Input:      m.Input(),
+						Output:     m.Output(),
+					})
+				}
+			}
+			continue
+		}
+
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = []string{"GET", "POST", "PUT", "DELETE"}
+		}
+
+		path := strings.TrimSuffix(route.Path, "*")
+		var params []string
+		for _, match := range paramPattern.FindAllStringSubmatch(path, -1) {
+			params = append(params, match[1])
+		}
+
+		for _, method := range methods {
+			add(endpoint{
+				Name:       exportName(strings.ToLower(method)) + exportName(paramPattern.ReplaceAllString(path, "")),
+				HTTPMethod: strings.ToUpper(method),
+				Path:       path,
+				Params:     params,
+				Wildcard:   strings.HasSuffix(route.Path, "*"),
+			})
+		}
+	}
+
+	return endpoints
+}
+
+// collectMessages returns every message type reachable from typed endpoints
+func collectMessages(endpoints []endpoint) []protoreflect.MessageDescriptor {
+	seen := make(map[protoreflect.FullName]bool)
+	var messages []protoreflect.MessageDescriptor
+
+	var visit func(md protoreflect.MessageDescriptor)
+	visit = func(md protoreflect.MessageDescriptor) {
+		if md == nil || seen[md.FullName()] || wellKnown(md) {
+			return
+		}
+		seen[md.FullName()] = true
+		messages = append(messages, md)
+
+		fields := md.Fields()
+		for i := 0; i < fields.Len(); i++ {
+			f := fields.Get(i)
+			if f.IsMap() {
+				visit(f.MapValue().Message())
+			} else {
+				visit(f.Message())
+			}
+		}
+	}
+
+	for _, e := range endpoints {
+		visit(e.Input)
+		visit(e.Output)
+	}
+
+	sort.Slice(messages, func(i, j int) bool { return messages[i].FullName() < messages[j].FullName() })
+	return messages
+}
+
+func sortedServices(descriptors *schema.Store) []string {
+	services := descriptors.Services()
+	sort.Strings(services)
+	return services
+}
+
+func serviceMethods(descriptors *schema.Store, service string) []protoreflect.MethodDescriptor {
+	var methods []protoreflect.MethodDescriptor
+	for _, name := range descriptors.Methods(service) {
+		if m, ok := descriptors.FindMethod(service, name); ok && !m.IsStreamingClient() && !m.IsStreamingServer() {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// typeNames maps messages to their generated type names
+type typeNames map[protoreflect.FullName]string
+
+// newTypeNames names messages after their package-relative name, qualifying
+// the names that collide with another message or with an identifier the
+// generated client reserves
+func newTypeNames(messages []protoreflect.MessageDescriptor, reserved ...string) typeNames {
+	count := make(map[string]int)
+	for _, md := range messages {
+		count[shortName(md)]++
+	}
+	used := make(map[string]bool)
+	for _, name := range reserved {
+		used[name] = true
+	}
+
+	names := make(typeNames)
+	for _, md := range messages {
+		if name := shortName(md); count[name] == 1 && !used[name] {
+			names[md.FullName()] = name
+			used[name] = true
+		}
+	}
+	for _, md := range messages {
+		if _, ok := names[md.FullName()]; ok {
+			continue
+		}
+		qualified := exportName(string(md.FullName()))
+		name := qualified
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s%d", qualified, i)
+		}
+		names[md.FullName()] = name
+		used[name] = true
+	}
+	return names
+}
+
+// of returns the generated type name of a message
+func (n typeNames) of(md protoreflect.MessageDescriptor) string {
+	if name, ok := n[md.FullName()]; ok {
+		return name
+	}
+	return shortName(md)
+}
+
+// shortName returns a message's name relative to its package
+func shortName(md protoreflect.MessageDescriptor) string {
+	name := strings.TrimPrefix(string(md.FullName()), string(md.ParentFile().Package())+".")
+	return exportName(strings.ReplaceAll(name, ".", "_"))
+}
+
+// wellKnown reports whether a message is a google.protobuf type with special JSON mapping
+func wellKnown(md protoreflect.MessageDescriptor) bool {
+	return strings.HasPrefix(string(md.FullName()), "google.protobuf.")
+}
+
+// exportName converts an arbitrary identifier or path into an exported Go name
+func exportName(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// paramName converts a path parameter into a lowerCamel identifier
+func paramName(s string) string {
+	name := exportName(s)
+	if name == "" {
+		return "param"
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func lastSegment(fullName string) string {
+	return fullName[strings.LastIndex(fullName, ".")+1:]
+}
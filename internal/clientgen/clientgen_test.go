@@ -0,0 +1,225 @@
+package clientgen
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/schema"
+)
+
+// testDescriptors holds two packages whose messages collide by name:
+//
+//	billing.v1: Item, Response, Invoice{items, response},
+//	            BillingService.GetInvoice(Invoice) Invoice
+//	orders.v1:  Item, Client, OrderLine, Order{items, client, lines, legacy_lines},
+//	            Order.Line, OrderService.Get(Order) Order
+func testDescriptors(t *testing.T) *schema.Store {
+	t.Helper()
+	message := func(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+		return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+	}
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type, typeName string, repeated bool) *descriptorpb.FieldDescriptorProto {
+		label := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL
+		if repeated {
+			label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+		}
+		f := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(name),
+			JsonName: proto.String(name),
+			Number:   proto.Int32(number),
+			Type:     typ.Enum(),
+			Label:    label.Enum(),
+		}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+	const (
+		msg = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE
+		str = descriptorpb.FieldDescriptorProto_TYPE_STRING
+		i64 = descriptorpb.FieldDescriptorProto_TYPE_INT64
+	)
+	service := func(name, method, input, output string) *descriptorpb.ServiceDescriptorProto {
+		return &descriptorpb.ServiceDescriptorProto{
+			Name:   proto.String(name),
+			Method: []*descriptorpb.MethodDescriptorProto{{Name: proto.String(method), InputType: proto.String(input), OutputType: proto.String(output)}},
+		}
+	}
+
+	order := message("Order",
+		field("items", 1, msg, ".orders.v1.Item", true),
+		field("client", 2, msg, ".orders.v1.Client", false),
+		field("lines", 3, msg, ".orders.v1.Order.Line", true),
+		field("legacy_lines", 4, msg, ".orders.v1.OrderLine", true),
+	)
+	order.NestedType = []*descriptorpb.DescriptorProto{message("Line", field("sku", 1, str, "", false))}
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{
+		{
+			Name:    proto.String("billing.proto"),
+			Package: proto.String("billing.v1"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{
+				message("Item", field("id", 1, str, "", false)),
+				message("Response", field("status", 1, str, "", false)),
+				message("Invoice",
+					field("items", 1, msg, ".billing.v1.Item", true),
+					field("response", 2, msg, ".billing.v1.Response", false),
+				),
+			},
+			Service: []*descriptorpb.ServiceDescriptorProto{service("BillingService", "GetInvoice", ".billing.v1.Invoice", ".billing.v1.Invoice")},
+		},
+		{
+			Name:    proto.String("orders.proto"),
+			Package: proto.String("orders.v1"),
+			Syntax:  proto.String("proto3"),
+			MessageType: []*descriptorpb.DescriptorProto{
+				message("Item", field("quantity", 1, i64, "", false)),
+				message("Client", field("name", 1, str, "", false)),
+				message("OrderLine", field("sku", 1, str, "", false)),
+				order,
+			},
+			Service: []*descriptorpb.ServiceDescriptorProto{service("OrderService", "Get", ".orders.v1.Order", ".orders.v1.Order")},
+		},
+	}}
+
+	store := schema.NewStore()
+	if err := store.Update("test", set); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func testConfig() *config.Config {
+	return &config.Config{HTTPRoutes: []config.HTTPRoute{
+		{Path: "/rpc/*", TargetProtocol: "grpc"},
+		{Path: "/users/{id}", Methods: []string{"GET"}},
+		{Path: "/files/*", Methods: []string{"GET"}},
+	}}
+}
+
+func TestTypeNames(t *testing.T) {
+	messages := collectMessages(collect(testConfig(), testDescriptors(t)))
+	tests := []struct {
+		name     string
+		reserved []string
+		want     map[protoreflect.FullName]string
+	}{
+		{
+			name: "unreserved",
+			want: map[protoreflect.FullName]string{
+				"billing.v1.Invoice":   "Invoice",
+				"billing.v1.Response":  "Response",
+				"billing.v1.Item":      "BillingV1Item",
+				"orders.v1.Item":       "OrdersV1Item",
+				"orders.v1.Client":     "Client",
+				"orders.v1.Order":      "Order",
+				"orders.v1.Order.Line": "OrdersV1OrderLine",
+				"orders.v1.OrderLine":  "OrdersV1OrderLine2",
+			},
+		},
+		{
+			name:     "go",
+			reserved: goReserved,
+			want: map[protoreflect.FullName]string{
+				"billing.v1.Response": "Response",
+				"billing.v1.Item":     "BillingV1Item",
+				"orders.v1.Client":    "OrdersV1Client",
+			},
+		},
+		{
+			name:     "typescript",
+			reserved: tsReserved,
+			want: map[protoreflect.FullName]string{
+				"billing.v1.Response": "BillingV1Response",
+				"orders.v1.Item":      "OrdersV1Item",
+				"orders.v1.Client":    "OrdersV1Client",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names := newTypeNames(messages, tt.reserved...)
+			for fullName, want := range tt.want {
+				if got := names[fullName]; got != want {
+					t.Errorf("%s named %q, want %q", fullName, got, want)
+				}
+			}
+			seen := make(map[string]protoreflect.FullName)
+			for fullName, name := range names {
+				if other, ok := seen[name]; ok {
+					t.Errorf("%s and %s both named %s", fullName, other, name)
+				}
+				seen[name] = fullName
+			}
+		})
+	}
+}
+
+func TestGenerateGo(t *testing.T) {
+	out, err := GenerateGo(testConfig(), testDescriptors(t), Options{Package: "billingclient"})
+	if err != nil {
+		t.Fatalf("GenerateGo: %v", err)
+	}
+	// gofmt aligns struct fields, so spacing is compared loosely
+	code := regexp.MustCompile(`[ \t]+`).ReplaceAllString(string(out), " ")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "package", want: "package billingclient\n"},
+		{name: "qualified colliding type", want: "type BillingV1Item struct {"},
+		{name: "qualified reserved type", want: "type OrdersV1Client struct {"},
+		{name: "field of qualified type", want: "Client *OrdersV1Client `json:\"client,omitempty\"`"},
+		{name: "nested and top-level collision", want: "Lines []*OrdersV1OrderLine `json:"},
+		{name: "suffixed collision", want: "LegacyLines []*OrdersV1OrderLine2 `json:"},
+		{name: "int64 as string", want: "Quantity int64 `json:\"quantity,omitempty,string\"`"},
+		{name: "typed method", want: "func (c *Client) OrderServiceGet(ctx context.Context, req *Order) (*Order, error) {"},
+		{name: "path parameter", want: "func (c *Client) GetUsers(ctx context.Context, id string, query url.Values, body interface{}) (*http.Response, error) {"},
+		{name: "wildcard sub-path", want: "func (c *Client) GetFiles(ctx context.Context, subPath string, query url.Values, body interface{}) (*http.Response, error) {"},
+		{name: "client type kept", want: "type Client struct {"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(code, tt.want) {
+				t.Errorf("missing %q in\n%s", tt.want, code)
+			}
+		})
+	}
+	if strings.Count(code, "type Client struct") != 1 {
+		t.Errorf("Client declared more than once in\n%s", code)
+	}
+}
+
+func TestGenerateTypeScript(t *testing.T) {
+	code := string(GenerateTypeScript(testConfig(), testDescriptors(t)))
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "qualified colliding type", want: "export interface OrdersV1Item {"},
+		{name: "qualified reserved type", want: "export interface BillingV1Response {"},
+		{name: "field of qualified type", want: "response?: BillingV1Response;"},
+		{name: "typed method", want: "async billingServiceGetInvoice(req: Invoice): Promise<Invoice> {"},
+		{name: "path parameter", want: "async getUsers(id: string, query?: Record<string, string>, body?: unknown): Promise<Response> {"},
+		{name: "wildcard sub-path", want: "async getFiles(subPath = \"\", query?: Record<string, string>, body?: unknown): Promise<Response> {"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !strings.Contains(code, tt.want) {
+				t.Errorf("missing %q in\n%s", tt.want, code)
+			}
+		})
+	}
+	for _, name := range []string{"Client", "Response", "Error"} {
+		if strings.Contains(code, "export interface "+name+" {") {
+			t.Errorf("message declared as reserved name %s", name)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package clientgen
+
+import (
+	"fmt"
+	"go/format"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/schema"
+)
+
+// goReserved are the type and function names the Go client declares itself
+var goReserved = []string{"Client", "NewClient", "Error"}
+
+// GenerateGo renders a Go client for the configured HTTP routes
+func GenerateGo(cfg *config.Config, descriptors *schema.Store, opts Options) ([]byte, error) {
+	pkg := opts.Package
+	if pkg == "" {
+		pkg = "gatewayclient"
+	}
+
+	endpoints := collect(cfg, descriptors)
+	messages := collectMessages(endpoints)
+	names := newTypeNames(messages, goReserved...)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "// Code generated by gateway gen-client. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	b.WriteString(`import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the gateway's configured routes
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Header     http.Header
+}
+
+// NewClient creates a client for the gateway at baseURL
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: strings.TrimSuffix(baseURL, "/"), HTTPClient: http.DefaultClient, Header: http.Header{}}
+}
+
+// Error is returned for non-2xx responses
+type Error struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gateway returned status %d: %s", e.StatusCode, e.Body)
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &Error{StatusCode: resp.StatusCode, Body: data}
+	}
+	return resp, json.Unmarshal(data, out)
+}
+`)
+
+	for _, e := range endpoints {
+		b.WriteString("\n")
+		writeGoEndpoint(&b, e, names)
+	}
+
+	for _, md := range messages {
+		b.WriteString("\n")
+		writeGoMessage(&b, md, names)
+	}
+
+	formatted, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated client: %w", err)
+	}
+	return formatted, nil
+}
+
+func writeGoEndpoint(b *strings.Builder, e endpoint, names typeNames) {
+	pathExpr := fmt.Sprintf("%q", e.Path)
+	args := []string{"ctx context.Context"}
+	if len(e.Params) > 0 {
+		format := paramPattern.ReplaceAllString(e.Path, "%s")
+		var values []string
+		for _, p := range e.Params {
+			args = append(args, paramName(p)+" string")
+			values = append(values, "url.PathEscape("+paramName(p)+")")
+		}
+		pathExpr = fmt.Sprintf("fmt.Sprintf(%q, %s)", format, strings.Join(values, ", "))
+	}
+
+	if e.Input != nil {
+		fmt.Fprintf(b, "// %s calls %s %s\n", e.Name, e.HTTPMethod, e.Path)
+		fmt.Fprintf(b, "func (c *Client) %s(%s, req *%s) (*%s, error) {\n", e.Name, strings.Join(args, ", "), names.of(e.Input), names.of(e.Output))
+		fmt.Fprintf(b, "\tvar resp %s\n", names.of(e.Output))
+		fmt.Fprintf(b, "\tif _, err := c.do(ctx, %q, %s, nil, req, &resp); err != nil {\n\t\treturn nil, err\n\t}\n", e.HTTPMethod, pathExpr)
+		b.WriteString("\treturn &resp, nil\n}\n")
+		return
+	}
+
+	// Untyped passthrough route: sub-path, query and body are caller supplied
+	if e.Wildcard {
+		args = append(args, "subPath string")
+		pathExpr += " + subPath"
+	}
+	args = append(args, "query url.Values", "body interface{}")
+	fmt.Fprintf(b, "// %s calls %s %s; the caller must close the response body\n", e.Name, e.HTTPMethod, e.Path)
+	fmt.Fprintf(b, "func (c *Client) %s(%s) (*http.Response, error) {\n", e.Name, strings.Join(args, ", "))
+	fmt.Fprintf(b, "\treturn c.do(ctx, %q, %s, query, body, nil)\n}\n", e.HTTPMethod, pathExpr)
+}
+
+func writeGoMessage(b *strings.Builder, md protoreflect.MessageDescriptor, names typeNames) {
+	fmt.Fprintf(b, "// %s mirrors %s\n", names.of(md), md.FullName())
+	fmt.Fprintf(b, "type %s struct {\n", names.of(md))
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		tag := f.JSONName() + ",omitempty"
+		if isInt64(f) && !f.IsList() && !f.IsMap() {
+			tag += ",string"
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", exportName(string(f.Name())), goType(f, names), tag)
+	}
+	b.WriteString("}\n")
+}
+
+func goType(f protoreflect.FieldDescriptor, names typeNames) string {
+	// protojson encodes 64-bit integers as strings; the ",string" tag only
+	// covers singular fields, so collections use json.Number
+	if f.IsMap() {
+		if isInt64(f.MapValue()) {
+			return "map[string]json.Number"
+		}
+		return "map[string]" + goScalar(f.MapValue(), names)
+	}
+	if f.IsList() {
+		if isInt64(f) {
+			return "[]json.Number"
+		}
+		return "[]" + goScalar(f, names)
+	}
+	return goScalar(f, names)
+}
+
+func goScalar(f protoreflect.FieldDescriptor, names typeNames) string {
+	switch f.Kind() {
+	case protoreflect.BoolKind:
+		return "bool"
+	case protoreflect.StringKind, protoreflect.EnumKind:
+		return "string"
+	case protoreflect.BytesKind:
+		return "[]byte"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return "int32"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return "uint32"
+	case protoreflect.FloatKind:
+		return "float32"
+	case protoreflect.DoubleKind:
+		return "float64"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "int64"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "uint64"
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if wellKnown(f.Message()) {
+			return "json.RawMessage"
+		}
+		return "*" + names.of(f.Message())
+	}
+	return "json.RawMessage"
+}
+
+func isInt64(f protoreflect.FieldDescriptor) bool {
+	switch f.Kind() {
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return true
+	}
+	return false
+}
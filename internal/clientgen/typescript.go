@@ -0,0 +1,141 @@
+package clientgen
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/schema"
+)
+
+// tsReserved are the names the TypeScript client declares or relies on
+// from the global scope
+var tsReserved = []string{"Client", "GatewayError", "Error", "Response", "Promise", "Record"}
+
+// GenerateTypeScript renders a fetch-based TypeScript client for the configured HTTP routes
+func GenerateTypeScript(cfg *config.Config, descriptors *schema.Store) []byte {
+	endpoints := collect(cfg, descriptors)
+	messages := collectMessages(endpoints)
+	names := newTypeNames(messages, tsReserved...)
+
+	var b strings.Builder
+	b.WriteString(`// Code generated by gateway gen-client. DO NOT EDIT.
+
+export class GatewayError extends Error {
+  constructor(public status: number, public body: string) {
+    super(` + "`gateway returned status ${status}: ${body}`" + `);
+  }
+}
+
+export class Client {
+  constructor(private baseURL: string, private headers: Record<string, string> = {}) {
+    this.baseURL = baseURL.replace(/\/$/, "");
+  }
+
+  private async do(method: string, path: string, query?: Record<string, string>, body?: unknown): Promise<Response> {
+    const qs = query && Object.keys(query).length > 0 ? "?" + new URLSearchParams(query).toString() : "";
+    const headers: Record<string, string> = { ...this.headers };
+    if (body !== undefined) {
+      headers["Content-Type"] = "application/json";
+    }
+    return fetch(this.baseURL + path + qs, {
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+  }
+
+  private async json<T>(resp: Response): Promise<T> {
+    const text = await resp.text();
+    if (!resp.ok) {
+      throw new GatewayError(resp.status, text);
+    }
+    return JSON.parse(text) as T;
+  }
+`)
+
+	for _, e := range endpoints {
+		b.WriteString("\n")
+		writeTSEndpoint(&b, e, names)
+	}
+	b.WriteString("}\n")
+
+	for _, md := range messages {
+		b.WriteString("\n")
+		writeTSMessage(&b, md, names)
+	}
+
+	return []byte(b.String())
+}
+
+func writeTSEndpoint(b *strings.Builder, e endpoint, names typeNames) {
+	name := paramName(e.Name)
+	var args []string
+	path := "\"" + e.Path + "\""
+	if len(e.Params) > 0 {
+		path = "`" + paramPattern.ReplaceAllStringFunc(e.Path, func(m string) string {
+			return "${encodeURIComponent(" + paramName(m[1:len(m)-1]) + ")}"
+		}) + "`"
+		for _, p := range e.Params {
+			args = append(args, paramName(p)+": string")
+		}
+	}
+
+	if e.Input != nil {
+		args = append(args, "req: "+names.of(e.Input))
+		fmt.Fprintf(b, "  /** %s %s */\n", e.HTTPMethod, e.Path)
+		fmt.Fprintf(b, "  async %s(%s): Promise<%s> {\n", name, strings.Join(args, ", "), names.of(e.Output))
+		fmt.Fprintf(b, "    return this.json<%s>(await this.do(%q, %s, undefined, req));\n  }\n", names.of(e.Output), e.HTTPMethod, path)
+		return
+	}
+
+	if e.Wildcard {
+		args = append(args, "subPath = \"\"")
+		path += " + subPath"
+	}
+	args = append(args, "query?: Record<string, string>", "body?: unknown")
+	fmt.Fprintf(b, "  /** %s %s */\n", e.HTTPMethod, e.Path)
+	fmt.Fprintf(b, "  async %s(%s): Promise<Response> {\n", name, strings.Join(args, ", "))
+	fmt.Fprintf(b, "    return this.do(%q, %s, query, body);\n  }\n", e.HTTPMethod, path)
+}
+
+func writeTSMessage(b *strings.Builder, md protoreflect.MessageDescriptor, names typeNames) {
+	fmt.Fprintf(b, "/** %s */\n", md.FullName())
+	fmt.Fprintf(b, "export interface %s {\n", names.of(md))
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		fmt.Fprintf(b, "  %s?: %s;\n", f.JSONName(), tsType(f, names))
+	}
+	b.WriteString("}\n")
+}
+
+func tsType(f protoreflect.FieldDescriptor, names typeNames) string {
+	if f.IsMap() {
+		return "Record<string, " + tsScalar(f.MapValue(), names) + ">"
+	}
+	if f.IsList() {
+		return tsScalar(f, names) + "[]"
+	}
+	return tsScalar(f, names)
+}
+
+func tsScalar(f protoreflect.FieldDescriptor, names typeNames) string {
+	switch f.Kind() {
+	case protoreflect.BoolKind:
+		return "boolean"
+	case protoreflect.StringKind, protoreflect.EnumKind, protoreflect.BytesKind:
+		return "string"
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if wellKnown(f.Message()) {
+			return "unknown"
+		}
+		return names.of(f.Message())
+	}
+	if isInt64(f) {
+		return "string"
+	}
+	return "number"
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Elector decides which gateway instance runs singleton tasks
+type Elector interface {
+	// Identity returns this instance's identity
+	Identity() string
+	// IsLeader reports whether this instance currently holds leadership
+	IsLeader() bool
+	// Run participates in the election until ctx is cancelled
+	Run(ctx context.Context)
+}
+
+// New creates the elector selected by configuration
+func New(cfg *config.Cluster) (Elector, error) {
+	if cfg == nil || cfg.Mode == "" || cfg.Mode == "standalone" {
+		return &standalone{identity: Identity(cfg)}, nil
+	}
+
+	switch cfg.Mode {
+	case "kubernetes":
+		return newKubernetesLease(cfg, Identity(cfg))
+	default:
+		return nil, fmt.Errorf("unknown cluster mode %q", cfg.Mode)
+	}
+}
+
+// RunSingleton runs task every interval on the leader only
+func RunSingleton(ctx context.Context, elector Elector, name string, interval time.Duration, task func(context.Context) error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !elector.IsLeader() {
+					continue
+				}
+				if err := task(ctx); err != nil {
+					log.Printf("Singleton task %s failed: %v", name, err)
+				}
+			}
+		}
+	}()
+}
+
+// standalone is always the leader of a single-instance cluster
+type standalone struct {
+	identity string
+}
+
+func (s *standalone) Identity() string        { return s.identity }
+func (s *standalone) IsLeader() bool          { return true }
+func (s *standalone) Run(ctx context.Context) {}
+
+// Identity returns the configured identity or the hostname
+func Identity(cfg *config.Cluster) string {
+	if cfg != nil && cfg.Identity != "" {
+		return cfg.Identity
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		return hostname
+	}
+	return fmt.Sprintf("gateway-%d", os.Getpid())
+}
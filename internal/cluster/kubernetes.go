@@ -0,0 +1,196 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/kube"
+)
+
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// kubernetesLease elects a leader using a coordination.k8s.io/v1 Lease
+type kubernetesLease struct {
+	identity      string
+	name          string
+	path          string
+	client        *kube.Client
+	leaseDuration time.Duration
+	renewInterval time.Duration
+
+	leaderUntil time.Time
+	mu          sync.RWMutex
+}
+
+type lease struct {
+	APIVersion string         `json:"apiVersion"`
+	Kind       string         `json:"kind"`
+	Metadata   map[string]any `json:"metadata"`
+	Spec       leaseSpec      `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// newKubernetesLease creates an elector using the in-cluster service account
+func newKubernetesLease(cfg *config.Cluster, identity string) (*kubernetesLease, error) {
+	client, err := kube.InCluster()
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = client.Namespace
+	}
+	if namespace == "" {
+		return nil, fmt.Errorf("failed to determine namespace for lease")
+	}
+
+	leaseName := cfg.LeaseName
+	if leaseName == "" {
+		leaseName = "dynamic-gateway"
+	}
+
+	return &kubernetesLease{
+		identity:      identity,
+		name:          leaseName,
+		path:          fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", namespace),
+		client:        client,
+		leaseDuration: parseDuration(cfg.LeaseDuration, 15*time.Second),
+		renewInterval: parseDuration(cfg.RenewInterval, 5*time.Second),
+	}, nil
+}
+
+func (k *kubernetesLease) Identity() string {
+	return k.identity
+}
+
+func (k *kubernetesLease) IsLeader() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return time.Now().Before(k.leaderUntil)
+}
+
+func (k *kubernetesLease) Run(ctx context.Context) {
+	ticker := time.NewTicker(k.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		wasLeader := k.IsLeader()
+		acquired, err := k.tryAcquire(ctx)
+		if err != nil {
+			log.Printf("Leader election failed: %v", err)
+		}
+
+		k.mu.Lock()
+		if acquired {
+			k.leaderUntil = time.Now().Add(k.leaseDuration)
+		} else if err == nil {
+			k.leaderUntil = time.Time{}
+		}
+		k.mu.Unlock()
+
+		if isLeader := k.IsLeader(); isLeader != wasLeader {
+			log.Printf("Cluster leadership changed: %s leader=%v", k.identity, isLeader)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// tryAcquire creates or renews the lease, returning whether this instance holds it
+func (k *kubernetesLease) tryAcquire(ctx context.Context) (bool, error) {
+	name := k.name
+	now := time.Now()
+	current, status, err := k.do(ctx, http.MethodGet, k.path+"/"+name, nil)
+	if err != nil {
+		return false, err
+	}
+
+	if status == http.StatusNotFound {
+		created := &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   map[string]any{"name": name},
+			Spec:       k.spec(now, now, 0),
+		}
+		_, status, err = k.do(ctx, http.MethodPost, k.path, created)
+		if err != nil {
+			return false, err
+		}
+		return status == http.StatusCreated, nil
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("unexpected status %d reading lease", status)
+	}
+
+	// Respect a live lease held by another instance
+	holder := current.Spec.HolderIdentity
+	renewTime, _ := time.Parse(microTimeFormat, current.Spec.RenewTime)
+	expiry := renewTime.Add(time.Duration(current.Spec.LeaseDurationSeconds) * time.Second)
+	if holder != "" && holder != k.identity && now.Before(expiry) {
+		return false, nil
+	}
+
+	acquireTime := current.Spec.AcquireTime
+	transitions := current.Spec.LeaseTransitions
+	if holder != k.identity {
+		acquireTime = now.Format(microTimeFormat)
+		transitions++
+	}
+	acquired, _ := time.Parse(microTimeFormat, acquireTime)
+	current.Spec = k.spec(acquired, now, transitions)
+
+	// Update is guarded by metadata.resourceVersion; a conflict means another instance won
+	_, status, err = k.do(ctx, http.MethodPut, k.path+"/"+name, current)
+	if err != nil {
+		return false, err
+	}
+	return status == http.StatusOK, nil
+}
+
+func (k *kubernetesLease) spec(acquired, renewed time.Time, transitions int) leaseSpec {
+	return leaseSpec{
+		HolderIdentity:       k.identity,
+		LeaseDurationSeconds: int(k.leaseDuration.Seconds()),
+		AcquireTime:          acquired.UTC().Format(microTimeFormat),
+		RenewTime:            renewed.UTC().Format(microTimeFormat),
+		LeaseTransitions:     transitions,
+	}
+}
+
+// do sends a request to the API server and decodes a lease from the response
+func (k *kubernetesLease) do(ctx context.Context, method, path string, body *lease) (*lease, int, error) {
+	var result lease
+	var in any
+	if body != nil {
+		in = body
+	}
+	status, err := k.client.Do(ctx, method, path, in, &result)
+	if err != nil || (status != http.StatusOK && status != http.StatusCreated) {
+		return nil, status, err
+	}
+	return &result, status, nil
+}
+
+func parseDuration(value string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	const base = `"http_port": 8080, "run_http_server": true, "variables": {"users": "http://users:8080"}`
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			doc:  `{` + base + `, "http_routes": [{"path": "/users", "backends": [{"address": "{{ .vars.users }}"}]}]}`,
+		},
+		{
+			name:    "no port",
+			doc:     `{"run_http_server": true}`,
+			wantErr: "at least one port",
+		},
+		{
+			name:    "no server",
+			doc:     `{"http_port": 8080}`,
+			wantErr: "at least one server",
+		},
+		{
+			name:    "service without backends",
+			doc:     `{` + base + `, "grpc_services": [{"service_name": "users.v1.Users"}]}`,
+			wantErr: "at least one backend is required for service users.v1.Users",
+		},
+		{
+			name:    "negative weight",
+			doc:     `{` + base + `, "grpc_services": [{"service_name": "users.v1.Users", "backends": [{"address": "users:9000", "weight": -1}]}]}`,
+			wantErr: "weight must not be negative",
+		},
+		{
+			name:    "unknown load balancing",
+			doc:     `{` + base + `, "grpc_services": [{"service_name": "users.v1.Users", "load_balancing": "random", "backends": [{"address": "users:9000"}]}]}`,
+			wantErr: `unknown load_balancing "random"`,
+		},
+		{
+			name:    "negative stream limit",
+			doc:     `{` + base + `, "grpc_services": [{"service_name": "users.v1.Users", "max_streams_per_client": -1, "backends": [{"address": "users:9000"}]}]}`,
+			wantErr: "max_streams_per_client must not be negative",
+		},
+		{
+			name:    "reflection ttl without reflection",
+			doc:     `{` + base + `, "grpc_services": [{"service_name": "users.v1.Users", "reflection_ttl": "1m", "backends": [{"address": "users:9000"}]}]}`,
+			wantErr: "reflection_ttl requires reflection",
+		},
+		{
+			name:    "invalid reflection interval",
+			doc:     `{` + base + `, "reflection_interval": "often"}`,
+			wantErr: "invalid reflection_interval",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfig([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
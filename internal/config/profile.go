@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// ProfileEnv selects the configuration profile when no -profile flag is
+	// given
+	ProfileEnv = "GATEWAY_PROFILE"
+
+	// DefaultProfile is the configuration outside of profiles
+	DefaultProfile = "default"
+)
+
+// activeProfile is the profile configurations are parsed with
+var activeProfile = os.Getenv(ProfileEnv)
+
+// SelectProfile sets the profile configurations are parsed with, overriding
+// GATEWAY_PROFILE; "" and "default" select the configuration outside of
+// profiles
+func SelectProfile(name string) {
+	activeProfile = name
+}
+
+// ActiveProfile returns the profile configurations are parsed with
+func ActiveProfile() string {
+	if activeProfile == "" {
+		return DefaultProfile
+	}
+	return activeProfile
+}
+
+// applyProfile deep-merges the active profile of a configuration over the
+// fields outside of profiles: objects are merged key by key, other values
+// replace the default's, and null removes a field. The profiles themselves are
+// dropped from the result.
+func applyProfile(data []byte) ([]byte, error) {
+	name := ActiveProfile()
+	var doc map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		// Reported by the caller's decoding
+		return data, nil
+	}
+	raw, ok := doc["profiles"]
+	if !ok && name == DefaultProfile {
+		return data, nil
+	}
+	profiles, ok := raw.(map[string]any)
+	if raw != nil && !ok {
+		return nil, fmt.Errorf("profiles must be an object of profile names")
+	}
+	for key, overlay := range profiles {
+		if _, ok := overlay.(map[string]any); !ok {
+			return nil, fmt.Errorf("profile %q must be an object", key)
+		}
+		if _, ok := overlay.(map[string]any)["profiles"]; ok {
+			return nil, fmt.Errorf("profile %q cannot declare profiles", key)
+		}
+	}
+	delete(doc, "profiles")
+
+	if overlay, ok := profiles[name]; ok {
+		doc = mergeProfile(doc, overlay.(map[string]any))
+	} else if name != DefaultProfile {
+		names := make([]string, 0, len(profiles))
+		for key := range profiles {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown profile %q; the configuration declares %s", name, profileList(names))
+	}
+	return json.Marshal(doc)
+}
+
+// mergeProfile merges overlay into base as a JSON merge patch (RFC 7386)
+func mergeProfile(base, overlay map[string]any) map[string]any {
+	if base == nil {
+		base = make(map[string]any, len(overlay))
+	}
+	for key, value := range overlay {
+		switch value := value.(type) {
+		case nil:
+			delete(base, key)
+		case map[string]any:
+			existing, _ := base[key].(map[string]any)
+			base[key] = mergeProfile(existing, value)
+		default:
+			base[key] = value
+		}
+	}
+	return base
+}
+
+func profileList(names []string) string {
+	if len(names) == 0 {
+		return "no profiles"
+	}
+	return "profiles " + strings.Join(names, ", ")
+}
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		base    string
+		overlay string
+		want    string
+	}{
+		{
+			name:    "replaces values",
+			base:    `{"host": "0.0.0.0", "http_port": 8080}`,
+			overlay: `{"http_port": 9090}`,
+			want:    `{"host": "0.0.0.0", "http_port": 9090}`,
+		},
+		{
+			name:    "merges objects key by key",
+			base:    `{"storage": {"type": "redis", "address": "redis:6379"}}`,
+			overlay: `{"storage": {"address": "redis.prod:6379"}}`,
+			want:    `{"storage": {"type": "redis", "address": "redis.prod:6379"}}`,
+		},
+		{
+			name:    "null removes",
+			base:    `{"host": "0.0.0.0", "tracing": {"endpoint": "collector:4317"}}`,
+			overlay: `{"tracing": null}`,
+			want:    `{"host": "0.0.0.0"}`,
+		},
+		{
+			name:    "replaces arrays whole",
+			base:    `{"http_routes": [{"path": "/a"}, {"path": "/b"}]}`,
+			overlay: `{"http_routes": [{"path": "/c"}]}`,
+			want:    `{"http_routes": [{"path": "/c"}]}`,
+		},
+		{
+			name:    "adds objects",
+			base:    `{"host": "0.0.0.0"}`,
+			overlay: `{"storage": {"type": "memory"}}`,
+			want:    `{"host": "0.0.0.0", "storage": {"type": "memory"}}`,
+		},
+		{
+			name:    "object replaces scalar",
+			base:    `{"storage": "memory"}`,
+			overlay: `{"storage": {"type": "redis"}}`,
+			want:    `{"storage": {"type": "redis"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var base, overlay, want map[string]any
+			for _, doc := range []struct {
+				data string
+				v    *map[string]any
+			}{{tt.base, &base}, {tt.overlay, &overlay}, {tt.want, &want}} {
+				if err := json.Unmarshal([]byte(doc.data), doc.v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := mergeProfile(base, overlay); !reflect.DeepEqual(got, want) {
+				t.Errorf("merged = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestParseConfigProfile(t *testing.T) {
+	const doc = `{
+  "host": "0.0.0.0",
+  "http_port": 8080,
+  "storage": {"type": "redis", "address": "redis:6379"},
+  "profiles": {
+    "staging": {"http_port": 9090},
+    "production": {"storage": {"address": "redis.prod:6379"}}
+  }
+}`
+	tests := []struct {
+		profile     string
+		doc         string
+		wantPort    int
+		wantAddress string
+		wantErr     string
+	}{
+		{profile: "", doc: doc, wantPort: 8080, wantAddress: "redis:6379"},
+		{profile: DefaultProfile, doc: doc, wantPort: 8080, wantAddress: "redis:6379"},
+		{profile: "staging", doc: doc, wantPort: 9090, wantAddress: "redis:6379"},
+		{profile: "production", doc: doc, wantPort: 8080, wantAddress: "redis.prod:6379"},
+		{profile: "qa", doc: doc, wantErr: `unknown profile "qa"; the configuration declares profiles production, staging`},
+		{profile: "qa", doc: `{"http_port": 8080}`, wantErr: `unknown profile "qa"; the configuration declares no profiles`},
+		{profile: "staging", doc: `{"profiles": []}`, wantErr: "profiles must be an object"},
+		{profile: "staging", doc: `{"profiles": {"staging": 1}}`, wantErr: `profile "staging" must be an object`},
+		{profile: "staging", doc: `{"profiles": {"staging": {"profiles": {}}}}`, wantErr: `profile "staging" cannot declare profiles`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.profile+" "+tt.wantErr, func(t *testing.T) {
+			defer SelectProfile(activeProfile)
+			SelectProfile(tt.profile)
+
+			cfg, err := ParseConfig([]byte(tt.doc))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.HTTPPort != tt.wantPort {
+				t.Errorf("http_port = %d, want %d", cfg.HTTPPort, tt.wantPort)
+			}
+			if cfg.Storage == nil || cfg.Storage.Address != tt.wantAddress {
+				t.Errorf("storage = %+v, want address %s", cfg.Storage, tt.wantAddress)
+			}
+		})
+	}
+}
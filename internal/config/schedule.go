@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is a recurring time window given as a cron expression of five
+// fields, "minute hour day-of-month month day-of-week". A minute is within
+// the window when every field matches it, e.g. "* 2-3 * * *" covers 02:00 to
+// 03:59 nightly.
+type Window struct {
+	minutes, hours, days, months, weekdays []bool
+	location                               *time.Location
+}
+
+// maxWindowSearch bounds the search for the end of a window
+const maxWindowSearch = 7 * 24 * time.Hour
+
+// ParseWindow parses a cron expression evaluated in the named IANA time zone,
+// UTC when empty
+func ParseWindow(expr, timezone string) (*Window, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("want 5 fields in %q, got %d", expr, len(fields))
+	}
+	location := time.UTC
+	if timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", timezone)
+		}
+	}
+
+	w := &Window{location: location}
+	ranges := []struct {
+		set      *[]bool
+		min, max int
+		name     string
+	}{
+		{&w.minutes, 0, 59, "minute"},
+		{&w.hours, 0, 23, "hour"},
+		{&w.days, 1, 31, "day of month"},
+		{&w.months, 1, 12, "month"},
+		{&w.weekdays, 0, 7, "day of week"},
+	}
+	for i, r := range ranges {
+		set, err := parseCronField(fields[i], r.min, r.max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", r.name, fields[i], err)
+		}
+		*r.set = set
+	}
+	// Sunday is 0 or 7
+	w.weekdays[0] = w.weekdays[0] || w.weekdays[7]
+	return w, nil
+}
+
+// parseCronField parses a comma-separated list of *, values, ranges and
+// steps such as */15 or 1-5
+func parseCronField(field string, min, max int) ([]bool, error) {
+	set := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		spec, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+
+		lo, hi := min, max
+		if spec != "*" {
+			first, last, isRange := strings.Cut(spec, "-")
+			var err error
+			if lo, err = strconv.Atoi(first); err != nil {
+				return nil, fmt.Errorf("invalid value %q", first)
+			}
+			hi = lo
+			if isRange {
+				if hi, err = strconv.Atoi(last); err != nil {
+					return nil, fmt.Errorf("invalid value %q", last)
+				}
+			} else if hasStep {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%s is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// Contains reports whether t falls within the window
+func (w *Window) Contains(t time.Time) bool {
+	t = t.In(w.location)
+	return w.minutes[t.Minute()] && w.hours[t.Hour()] && w.days[t.Day()] &&
+		w.months[t.Month()] && w.weekdays[t.Weekday()]
+}
+
+// End returns when the window containing t closes, or false when it stays
+// open for more than a week
+func (w *Window) End(t time.Time) (time.Time, bool) {
+	next := t.Truncate(time.Minute)
+	for limit := t.Add(maxWindowSearch); next.Before(limit); {
+		next = next.Add(time.Minute)
+		if !w.Contains(next) {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
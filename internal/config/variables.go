@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// resolveVariables substitutes {{ .vars.name }} references in backend
+// addresses and route paths with values from the variables block
+func (c *Config) resolveVariables() error {
+	data := map[string]any{"vars": c.Variables}
+	resolve := func(value *string) error {
+		if !strings.Contains(*value, "{{") {
+			return nil
+		}
+		tmpl, err := template.New("").Option("missingkey=error").Parse(*value)
+		if err != nil {
+			return fmt.Errorf("invalid template %q: %w", *value, err)
+		}
+		var buf strings.Builder
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("failed to resolve %q: %w", *value, err)
+		}
+		*value = buf.String()
+		return nil
+	}
+	resolveBackends := func(backends []Backend) error {
+		for i := range backends {
+			if err := resolve(&backends[i].Address); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := range c.HTTPRoutes {
+		route := &c.HTTPRoutes[i]
+		if err := resolve(&route.Path); err != nil {
+			return err
+		}
+		if err := resolveBackends(route.Backends); err != nil {
+			return err
+		}
+		for _, version := range route.Versions {
+			if err := resolveBackends(version.Backends); err != nil {
+				return err
+			}
+		}
+		for _, pool := range route.Pools {
+			if err := resolveBackends(pool); err != nil {
+				return err
+			}
+		}
+		for _, schedule := range route.Schedules {
+			if err := resolveBackends(schedule.Backends); err != nil {
+				return err
+			}
+		}
+		if route.Mirror != nil {
+			if err := resolve(&route.Mirror.Backend); err != nil {
+				return err
+			}
+		}
+	}
+	for i := range c.GRPCServices {
+		svc := &c.GRPCServices[i]
+		if err := resolveBackends(svc.Backends); err != nil {
+			return err
+		}
+		for _, pool := range svc.Pools {
+			if err := resolveBackends(pool); err != nil {
+				return err
+			}
+		}
+	}
+	if c.DefaultBackend != nil {
+		if err := resolveBackends(c.DefaultBackend.Backends); err != nil {
+			return err
+		}
+	}
+	if c.Probes != nil {
+		for i := range c.Probes.Checks {
+			if err := resolve(&c.Probes.Checks[i].Path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveVariables(t *testing.T) {
+	const doc = `{
+  "variables": {"env": "staging", "users": "users.internal:8080"},
+  "http_routes": [{
+    "path": "/{{ .vars.env }}/users",
+    "backends": [{"address": "http://{{ .vars.users }}"}],
+    "pools": {"blue": [{"address": "http://blue.{{ .vars.users }}"}]},
+    "mirror": {"backend": "http://shadow.{{ .vars.users }}"}
+  }],
+  "grpc_services": [{"service_name": "users.v1.Users", "backends": [{"address": "{{ .vars.users }}"}]}],
+  "probes": {"checks": [{"path": "/{{ .vars.env }}/healthz"}]}
+}`
+	cfg, err := ParseConfig([]byte(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := cfg.HTTPRoutes[0]
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{name: "route path", got: route.Path, want: "/staging/users"},
+		{name: "route backend", got: route.Backends[0].Address, want: "http://users.internal:8080"},
+		{name: "pool backend", got: route.Pools["blue"][0].Address, want: "http://blue.users.internal:8080"},
+		{name: "mirror", got: route.Mirror.Backend, want: "http://shadow.users.internal:8080"},
+		{name: "service backend", got: cfg.GRPCServices[0].Backends[0].Address, want: "users.internal:8080"},
+		{name: "probe path", got: cfg.Probes.Checks[0].Path, want: "/staging/healthz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveVariablesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		doc     string
+		wantErr string
+	}{
+		{
+			name:    "undefined variable",
+			doc:     `{"variables": {"env": "staging"}, "http_routes": [{"path": "/{{ .vars.region }}"}]}`,
+			wantErr: "failed to resolve",
+		},
+		{
+			name:    "no variables",
+			doc:     `{"http_routes": [{"path": "/x", "backends": [{"address": "{{ .vars.host }}"}]}]}`,
+			wantErr: "failed to resolve",
+		},
+		{
+			name:    "malformed template",
+			doc:     `{"variables": {"env": "staging"}, "http_routes": [{"path": "/{{ .vars.env"}]}`,
+			wantErr: "invalid template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(tt.doc))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+)
+
+// Watch polls the configuration file every interval and signals on the
+// returned channel when its contents change. Editors that replace the file
+// rather than writing in place are handled since the path is re-read.
+func Watch(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+
+	go func() {
+		last := fileDigest(path)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			digest := fileDigest(path)
+			if digest == nil || bytes.Equal(digest, last) {
+				continue
+			}
+			last = digest
+
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changes
+}
+
+// fileDigest hashes the file contents, returning nil when it cannot be read
+func fileDigest(path string) []byte {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
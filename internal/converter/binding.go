@@ -0,0 +1,191 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	"dynamic-gateway/internal/schema"
+)
+
+// NewBoundMessages builds the request and an empty response message for an
+// HTTP binding the way grpc-gateway does: the body fills the whole request or
+// the named field, path variables set their fields, and when the body is not
+// "*" query parameters set the remaining fields
+func NewBoundMessages(binding *schema.HTTPBinding, params map[string]string, query url.Values, body []byte, binary bool) (proto.Message, proto.Message, error) {
+	request := dynamicpb.NewMessage(binding.Method.Input())
+
+	if len(body) > 0 && binding.Body != "" {
+		switch {
+		case binary && binding.Body == "*":
+			if err := unmarshalBinary(body, request); err != nil {
+				return nil, nil, err
+			}
+		case binary:
+			return nil, nil, fmt.Errorf("binary protobuf bodies must map to the whole request")
+		default:
+			if err := unmarshalBody(request, binding.Body, body); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal request: %w", err)
+			}
+		}
+	}
+
+	for path, value := range params {
+		if err := setField(request, path, value); err != nil {
+			return nil, nil, fmt.Errorf("invalid path parameter %s: %w", path, err)
+		}
+	}
+
+	if binding.Body != "*" {
+		for key, values := range query {
+			if _, bound := params[key]; bound {
+				continue
+			}
+			for _, value := range values {
+				// Unknown parameters such as cache busters are ignored
+				if err := setField(request, key, value); err != nil && !errors.Is(err, errUnknownField) {
+					return nil, nil, fmt.Errorf("invalid query parameter %s: %w", key, err)
+				}
+			}
+		}
+	}
+
+	return request, dynamicpb.NewMessage(binding.Method.Output()), nil
+}
+
+// MarshalBoundResponse converts a response to JSON, returning only the
+// binding's response_body field when one is set
+func MarshalBoundResponse(binding *schema.HTTPBinding, response proto.Message) ([]byte, error) {
+	if binding.ResponseBody == "" {
+		return MarshalMessage(response)
+	}
+	msg := response.ProtoReflect()
+	fd := findField(msg.Descriptor(), binding.ResponseBody)
+	if fd == nil {
+		return nil, fmt.Errorf("response has no field %s", binding.ResponseBody)
+	}
+
+	// Marshal the field through a wrapper so every field kind encodes as JSON
+	wrapper := dynamicpb.NewMessage(msg.Descriptor())
+	wrapper.Set(fd, msg.Get(fd))
+	data, err := marshalJSON(protojson.MarshalOptions{UseProtoNames: true, EmitUnpopulated: true}, wrapper)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields[string(fd.Name())], nil
+}
+
+// unmarshalBody decodes a JSON body into the whole message or one field
+func unmarshalBody(request *dynamicpb.Message, field string, body []byte) error {
+	if field != "*" {
+		fd := findField(request.Descriptor(), field)
+		if fd == nil {
+			return fmt.Errorf("request has no field %s", field)
+		}
+		body = []byte(fmt.Sprintf("{%q:%s}", fd.JSONName(), body))
+	}
+	decoded := dynamicpb.NewMessage(request.Descriptor())
+	if err := protojson.Unmarshal(body, decoded); err != nil {
+		return err
+	}
+	proto.Merge(request, decoded)
+	return nil
+}
+
+// errUnknownField reports a parameter naming no field of the message
+var errUnknownField = errors.New("unknown field")
+
+// setField sets the field at a dotted path from its string form, appending
+// to repeated fields
+func setField(msg protoreflect.Message, path, value string) error {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fd := findField(msg.Descriptor(), name)
+		if fd == nil {
+			return errUnknownField
+		}
+		if fd.Kind() != protoreflect.MessageKind || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("%s is not a message field", name)
+		}
+		msg = msg.Mutable(fd).Message()
+	}
+
+	fd := findField(msg.Descriptor(), names[len(names)-1])
+	if fd == nil {
+		return errUnknownField
+	}
+	if fd.IsMap() {
+		return fmt.Errorf("map fields cannot be set from strings")
+	}
+	v, err := parseScalar(fd, value)
+	if err != nil {
+		return err
+	}
+	if fd.IsList() {
+		msg.Mutable(fd).List().Append(v)
+		return nil
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+// findField looks a field up by proto or JSON name
+func findField(md protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := md.Fields().ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return md.Fields().ByJSONName(name)
+}
+
+// parseScalar converts a path or query value to the field's type
+func parseScalar(fd protoreflect.FieldDescriptor, value string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(value), nil
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(value)), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(value)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(value, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(value, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(value, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(value, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(value, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(value, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(value)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("unknown enum value %q", value)
+		}
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), nil
+	}
+	return protoreflect.Value{}, fmt.Errorf("field %s of kind %s cannot be set from a string", fd.Name(), fd.Kind())
+}
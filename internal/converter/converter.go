@@ -0,0 +1,169 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/schema"
+)
+
+// Protocol identifies a wire protocol on either side of a conversion
+type Protocol string
+
+const (
+	HTTP Protocol = "http"
+	GRPC Protocol = "grpc"
+	// GRPCStream routes bridge WebSockets to gRPC streams in the router
+	// rather than through a converter
+	GRPCStream Protocol = "grpc-stream"
+)
+
+// Request is a protocol-neutral call handed to a converter
+type Request struct {
+	Service string
+	Method  string
+	Backend string
+	// Dial configures TLS, SNI and authority for the backend connection
+	Dial pool.Options
+
+	// HTTP is set when the source protocol is HTTP
+	HTTP *http.Request
+	// Accept is the negotiated response media type for HTTP sources, empty for
+	// the converter's default
+	Accept string
+	// Binding is the google.api.http binding matched by an HTTP source, with
+	// the values of its path variables
+	Binding    *schema.HTTPBinding
+	PathParams map[string]string
+	// Message is set when the source protocol is gRPC; incoming metadata is
+	// carried on the context
+	Message proto.Message
+
+	// CallOptions apply to upstream gRPC calls
+	CallOptions []grpc.CallOption
+	// MaxResponseSize bounds the upstream response in bytes (0 for unlimited);
+	// for gRPC backends it bounds each received message
+	MaxResponseSize int
+	// Page collects one page of a server stream into a unary response
+	Page *Page
+	// Table renders a server stream as a CSV or XLSX download
+	Table *Table
+}
+
+// Page selects the messages of a server stream returned in one response
+type Page struct {
+	Offset int // messages skipped
+	Size   int // messages returned at most
+	// NextToken is returned for clients to continue when more messages follow
+	NextToken string
+}
+
+// Response is the converted result of a call
+type Response struct {
+	// Body is the encoded response for HTTP sources
+	Body []byte
+	// ContentType describes Body, defaulting to application/json
+	ContentType string
+	// Message is the response for gRPC sources
+	Message proto.Message
+	// Stream yields the framed messages of a server-streaming call for HTTP
+	// sources; Body is unused when it is set
+	Stream Stream
+}
+
+// Stream is a response delivered as a sequence of chunks
+type Stream interface {
+	// Next returns the next chunk to write, or io.EOF after the last one
+	Next() ([]byte, error)
+}
+
+// Converter translates a call from one protocol to another
+type Converter interface {
+	Convert(ctx context.Context, req *Request) (*Response, error)
+}
+
+// Dependencies are the shared resources available to converter factories
+type Dependencies struct {
+	Pool        *pool.ConnectionPool
+	Descriptors *schema.Store
+}
+
+// Factory builds a converter from shared dependencies
+type Factory func(deps Dependencies) Converter
+
+type pair struct {
+	source Protocol
+	target Protocol
+}
+
+var (
+	factories   = make(map[pair]Factory)
+	factoriesMu sync.RWMutex
+)
+
+// Register makes a converter available for a (source, target) protocol pair.
+// It is intended to be called from init functions of converter packages.
+func Register(source, target Protocol, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	key := pair{source, target}
+	if _, exists := factories[key]; exists {
+		panic(fmt.Sprintf("converter for %s→%s already registered", source, target))
+	}
+	factories[key] = factory
+}
+
+// Supported reports whether a converter is registered for the pair
+func Supported(source, target Protocol) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	_, ok := factories[pair{source, target}]
+	return ok
+}
+
+// Targets returns the registered target protocols for a source protocol
+func Targets(source Protocol) []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	var targets []string
+	for key := range factories {
+		if key.source == source {
+			targets = append(targets, string(key.target))
+		}
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Registry holds converter instances for every registered protocol pair
+type Registry struct {
+	converters map[pair]Converter
+}
+
+// NewRegistry instantiates all registered converters
+func NewRegistry(deps Dependencies) *Registry {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	registry := &Registry{converters: make(map[pair]Converter, len(factories))}
+	for key, factory := range factories {
+		registry.converters[key] = factory(deps)
+	}
+	return registry
+}
+
+// Get returns the converter for a protocol pair
+func (r *Registry) Get(source, target Protocol) (Converter, bool) {
+	c, ok := r.converters[pair{source, target}]
+	return c, ok
+}
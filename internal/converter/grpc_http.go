@@ -0,0 +1,99 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/redact"
+	"dynamic-gateway/internal/schema"
+)
+
+func init() {
+	Register(GRPC, HTTP, func(deps Dependencies) Converter {
+		return &grpcToHTTP{descriptors: deps.Descriptors, pool: deps.Pool}
+	})
+}
+
+// grpcToHTTP converts unary gRPC calls to JSON POSTs on {backend}/{service}/{method}
+type grpcToHTTP struct {
+	descriptors *schema.Store
+	pool        *pool.ConnectionPool
+}
+
+func (c *grpcToHTTP) Convert(ctx context.Context, req *Request) (*Response, error) {
+	// Convert protobuf to JSON, keeping proto field names
+	switch req.Message.(type) {
+	case *dynamicpb.Message, *structpb.Struct:
+	default:
+		return nil, fmt.Errorf("unsupported message type")
+	}
+	requestJSON, err := marshalJSON(protojson.MarshalOptions{UseProtoNames: true}, req.Message)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Create HTTP request
+	httpURL := fmt.Sprintf("%s/%s/%s", req.Backend, req.Service, req.Method)
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", httpURL, bytes.NewReader(requestJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	// Add headers from gRPC metadata
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for key, values := range md {
+			for _, value := range values {
+				httpReq.Header.Add(key, value)
+			}
+		}
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if req.Dial.Authority != "" {
+		httpReq.Host = req.Dial.Authority
+	}
+
+	// Execute HTTP request
+	client, err := c.pool.HTTPClient(req.Dial, 0)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response, bounded by the service's max message size
+	body := io.Reader(resp.Body)
+	if req.MaxResponseSize > 0 {
+		body = io.LimitReader(resp.Body, int64(req.MaxResponseSize)+1)
+	}
+	responseBytes, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if req.MaxResponseSize > 0 && len(responseBytes) > req.MaxResponseSize {
+		return nil, fmt.Errorf("response exceeds max message size of %d bytes", req.MaxResponseSize)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP request failed with status %d: %s", resp.StatusCode, string(redact.Body(responseBytes)))
+	}
+
+	// Convert response back to protobuf
+	response, err := UnmarshalResponse(c.descriptors, req.Service, req.Method, responseBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Response{Message: response}, nil
+}
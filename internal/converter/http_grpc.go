@@ -0,0 +1,125 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/schema"
+)
+
+func init() {
+	Register(HTTP, GRPC, func(deps Dependencies) Converter {
+		return &httpToGRPC{connectionPool: deps.Pool, descriptors: deps.Descriptors}
+	})
+}
+
+// httpToGRPC converts JSON HTTP requests to unary gRPC calls
+type httpToGRPC struct {
+	connectionPool *pool.ConnectionPool
+	descriptors    *schema.Store
+}
+
+func (c *httpToGRPC) Convert(ctx context.Context, req *Request) (*Response, error) {
+	httpReq := req.HTTP
+
+	// Read HTTP body
+	bodyBytes, err := io.ReadAll(httpReq.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	defer httpReq.Body.Close()
+
+	// Build request and response messages from JSON or binary protobuf
+	var request, response proto.Message
+	if req.Binding != nil {
+		request, response, err = NewBoundMessages(req.Binding, req.PathParams, httpReq.URL.Query(), bodyBytes, isProtobuf(httpReq.Header.Get("Content-Type")))
+	} else if isProtobuf(httpReq.Header.Get("Content-Type")) {
+		request, response, err = NewMessages(c.descriptors, req.Service, req.Method, nil)
+		if err == nil {
+			err = unmarshalBinary(bodyBytes, request)
+		}
+	} else {
+		request, response, err = NewMessages(c.descriptors, req.Service, req.Method, bodyBytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Get gRPC connection
+	conn, err := c.connectionPool.GetConnectionWithOptions(ctx, req.Backend, req.Dial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	// Prepare metadata from HTTP headers; route metadata already on the
+	// outgoing context takes precedence
+	md := metadata.New(nil)
+	for key, values := range httpReq.Header {
+		md.Append(key, values...)
+	}
+	if routeMD, ok := metadata.FromOutgoingContext(ctx); ok {
+		for key, values := range routeMD {
+			md.Set(key, values...)
+		}
+	}
+	ctx = metadata.NewOutgoingContext(ctx, md)
+
+	// Create dynamic method path
+	fullMethod := fmt.Sprintf("/%s/%s", req.Service, req.Method)
+
+	// Invoke gRPC method
+	opts := append([]grpc.CallOption{grpc.WaitForReady(true)}, req.CallOptions...)
+	if req.MaxResponseSize > 0 {
+		opts = append(opts, grpc.MaxCallRecvMsgSize(req.MaxResponseSize))
+	}
+	if method := c.method(req); method != nil && (method.IsStreamingClient() || method.IsStreamingServer()) {
+		if method.IsStreamingClient() {
+			return nil, fmt.Errorf("client-streaming method %s cannot be called over HTTP", fullMethod)
+		}
+		return openServerStream(ctx, conn, fullMethod, method, request, req, opts)
+	}
+	err = conn.Invoke(ctx, fullMethod, request, response, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("gRPC invocation failed: %w", err)
+	}
+
+	// Encode the response in the negotiated media type
+	if isProtobuf(req.Accept) {
+		body, err := marshalBinary(response)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal response: %w", err)
+		}
+		return &Response{Body: body, ContentType: MediaProtobuf}, nil
+	}
+
+	var responseJSON []byte
+	if req.Binding != nil {
+		responseJSON, err = MarshalBoundResponse(req.Binding, response)
+	} else {
+		responseJSON, err = MarshalMessage(response)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+
+	return &Response{Body: responseJSON, ContentType: MediaJSON}, nil
+}
+
+// method returns the descriptor of the called method, if known
+func (c *httpToGRPC) method(req *Request) protoreflect.MethodDescriptor {
+	if req.Binding != nil {
+		return req.Binding.Method
+	}
+	if c.descriptors == nil {
+		return nil
+	}
+	method, _ := c.descriptors.FindMethod(req.Service, req.Method)
+	return method
+}
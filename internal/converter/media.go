@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"fmt"
+	"mime"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Media types understood by converters
+const (
+	MediaJSON        = "application/json"
+	MediaProtobuf    = "application/protobuf"
+	MediaNDJSON      = "application/x-ndjson"
+	MediaEventStream = "text/event-stream"
+	MediaCSV         = "text/csv"
+	MediaXLSX        = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// isProtobuf reports whether a Content-Type or Accept value names binary protobuf
+func isProtobuf(value string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+	return mediaType == MediaProtobuf || mediaType == "application/x-protobuf"
+}
+
+// unmarshalBinary decodes a binary protobuf body into a typed message
+func unmarshalBinary(body []byte, msg proto.Message) error {
+	if _, ok := msg.(*structpb.Struct); ok {
+		return fmt.Errorf("binary protobuf requires method descriptors")
+	}
+	if err := proto.Unmarshal(body, msg); err != nil {
+		return fmt.Errorf("failed to unmarshal request: %w", err)
+	}
+	return nil
+}
+
+// marshalBinary encodes a typed message as binary protobuf
+func marshalBinary(msg proto.Message) ([]byte, error) {
+	if _, ok := msg.(*structpb.Struct); ok {
+		return nil, fmt.Errorf("binary protobuf requires method descriptors")
+	}
+	return proto.Marshal(msg)
+}
@@ -0,0 +1,106 @@
+package converter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	"dynamic-gateway/internal/schema"
+)
+
+// NewMessages builds the request and an empty response message for a method,
+// using typed descriptors when available and falling back to structpb
+func NewMessages(descriptors *schema.Store, serviceName, methodName string, body []byte) (proto.Message, proto.Message, error) {
+	if descriptors != nil {
+		if method, ok := descriptors.FindMethod(serviceName, methodName); ok {
+			request := dynamicpb.NewMessage(method.Input())
+			if len(body) > 0 {
+				if err := protojson.Unmarshal(body, request); err != nil {
+					return nil, nil, fmt.Errorf("failed to unmarshal request: %w", err)
+				}
+			}
+			return request, dynamicpb.NewMessage(method.Output()), nil
+		}
+		if len(descriptors.Methods(serviceName)) > 0 {
+			return nil, nil, fmt.Errorf("unknown method %s for service %s", methodName, serviceName)
+		}
+	}
+
+	// Decode JSON straight into a protobuf Struct
+	requestStruct := &structpb.Struct{}
+	if len(body) > 0 {
+		if err := protojson.Unmarshal(body, requestStruct); err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal request: %w", err)
+		}
+	}
+
+	return requestStruct, &structpb.Struct{}, nil
+}
+
+// NewResponse returns an empty response message for a method
+func NewResponse(descriptors *schema.Store, serviceName, methodName string) proto.Message {
+	if descriptors != nil {
+		if method, ok := descriptors.FindMethod(serviceName, methodName); ok {
+			return dynamicpb.NewMessage(method.Output())
+		}
+	}
+	return &structpb.Struct{}
+}
+
+// UnmarshalResponse converts a JSON response body to the method's response message
+func UnmarshalResponse(descriptors *schema.Store, serviceName, methodName string, body []byte) (proto.Message, error) {
+	response := NewResponse(descriptors, serviceName, methodName)
+	if dynMsg, ok := response.(*dynamicpb.Message); ok {
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, dynMsg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+		}
+		return dynMsg, nil
+	}
+
+	responseStruct := &structpb.Struct{}
+	if err := protojson.Unmarshal(body, responseStruct); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return responseStruct, nil
+}
+
+// MarshalMessage converts a response message to compact JSON. The same
+// message always gives the same bytes, so ETags and cache keys computed over
+// them hold across gateway builds.
+func MarshalMessage(msg proto.Message) ([]byte, error) {
+	return marshalJSON(protojson.MarshalOptions{}, msg)
+}
+
+// marshalBuffer is the scratch space of one marshalJSON call
+type marshalBuffer struct {
+	raw     []byte
+	compact bytes.Buffer
+}
+
+// marshalBuffers are reused across requests rather than grown per message
+var marshalBuffers = sync.Pool{New: func() any { return new(marshalBuffer) }}
+
+// marshalJSON marshals msg with opts and compacts the result. protojson varies
+// its whitespace between builds so callers cannot depend on it; compacting
+// removes the variation, leaving output determined by the message alone.
+func marshalJSON(opts protojson.MarshalOptions, msg proto.Message) ([]byte, error) {
+	buf := marshalBuffers.Get().(*marshalBuffer)
+	defer marshalBuffers.Put(buf)
+
+	raw, err := opts.MarshalAppend(buf.raw[:0], msg)
+	if err != nil {
+		return nil, err
+	}
+	buf.raw = raw
+	buf.compact.Reset()
+	if err := json.Compact(&buf.compact, raw); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.compact.Bytes()), nil
+}
@@ -0,0 +1,57 @@
+package converter
+
+import (
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestMarshalMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  map[string]any
+		want string
+	}{
+		{name: "empty", msg: map[string]any{}, want: `{}`},
+		{name: "keys sorted", msg: map[string]any{"b": 1, "a": "x"}, want: `{"a":"x","b":1}`},
+		{
+			name: "nested",
+			msg:  map[string]any{"order": map[string]any{"id": "o-1", "items": []any{"a", "b"}}},
+			want: `{"order":{"id":"o-1","items":["a","b"]}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := structpb.NewStruct(tt.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 3 {
+				got, err := MarshalMessage(msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.want {
+					t.Fatalf("MarshalMessage = %s, want %s", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMarshalMessage(b *testing.B) {
+	msg, err := structpb.NewStruct(map[string]any{
+		"id":     "o-1",
+		"status": "shipped",
+		"items":  []any{map[string]any{"sku": "a-1", "quantity": 2}, map[string]any{"sku": "b-7", "quantity": 1}},
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := MarshalMessage(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
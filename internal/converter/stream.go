@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// openServerStream starts a server-streaming call and returns a response that
+// relays each message as it arrives, as newline-delimited JSON or, when the
+// client accepts it, server-sent events
+func openServerStream(ctx context.Context, conn *grpc.ClientConn, fullMethod string, method protoreflect.MethodDescriptor, request proto.Message, req *Request, opts []grpc.CallOption) (*Response, error) {
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, fullMethod, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("gRPC invocation failed: %w", err)
+	}
+	if err := stream.SendMsg(request); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("gRPC invocation failed: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, fmt.Errorf("gRPC invocation failed: %w", err)
+	}
+
+	if req.Page != nil {
+		return readPage(stream, method, req)
+	}
+	if req.Table != nil {
+		return openTable(stream, method, req.Table)
+	}
+
+	s := &messageStream{stream: stream, method: method, req: req}
+	contentType := MediaNDJSON
+	if req.Accept == MediaEventStream || (req.Accept == "" && strings.Contains(req.HTTP.Header.Get("Accept"), MediaEventStream)) {
+		s.events = true
+		contentType = MediaEventStream
+	}
+	return &Response{ContentType: contentType, Stream: s}, nil
+}
+
+// messageStream frames server-streamed messages for HTTP clients. Like
+// grpc-gateway, NDJSON lines wrap messages in "result" and the terminal
+// status in "error".
+type messageStream struct {
+	stream grpc.ClientStream
+	method protoreflect.MethodDescriptor
+	req    *Request
+	events bool
+	done   bool
+}
+
+func (s *messageStream) Next() ([]byte, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+
+	msg := dynamicpb.NewMessage(s.method.Output())
+	err := s.stream.RecvMsg(msg)
+	if err == io.EOF {
+		s.done = true
+		return nil, io.EOF
+	}
+	if err != nil {
+		// Headers are already sent, so failures are reported in-band
+		s.done = true
+		st := status.Convert(err)
+		data, _ := json.Marshal(map[string]any{"code": int(st.Code()), "message": st.Message()})
+		return s.frame("error", data), nil
+	}
+
+	var data []byte
+	if s.req.Binding != nil {
+		data, err = MarshalBoundResponse(s.req.Binding, msg)
+	} else {
+		data, err = MarshalMessage(msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return s.frame("result", data), nil
+}
+
+// frame encodes one message or error for the negotiated stream format
+func (s *messageStream) frame(kind string, data []byte) []byte {
+	if s.events {
+		if kind == "error" {
+			return []byte(fmt.Sprintf("event: error\ndata: %s\n\n", data))
+		}
+		return []byte(fmt.Sprintf("data: %s\n\n", data))
+	}
+	return []byte(fmt.Sprintf("{%q:%s}\n", kind, data))
+}
+
+// readPage reads one page of a server stream and returns it as a JSON object
+// with the messages in "items" and, when the stream continues past the page,
+// "next_page_token". Reading stops after the page; the caller ends the call.
+func readPage(stream grpc.ClientStream, method protoreflect.MethodDescriptor, req *Request) (*Response, error) {
+	page := req.Page
+	items := make([]json.RawMessage, 0, page.Size)
+	more := false
+	for i := 0; ; i++ {
+		msg := dynamicpb.NewMessage(method.Output())
+		err := stream.RecvMsg(msg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gRPC invocation failed: %w", err)
+		}
+		if i < page.Offset {
+			continue
+		}
+		if len(items) == page.Size {
+			more = true
+			break
+		}
+
+		var data []byte
+		if req.Binding != nil {
+			data, err = MarshalBoundResponse(req.Binding, msg)
+		} else {
+			data, err = MarshalMessage(msg)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal response: %w", err)
+		}
+		items = append(items, data)
+	}
+
+	body := map[string]any{"items": items}
+	if more {
+		body["next_page_token"] = page.NextToken
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	return &Response{Body: data, ContentType: MediaJSON}, nil
+}
@@ -0,0 +1,299 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Table renders the messages of a server stream as the rows of a spreadsheet
+type Table struct {
+	Format  string        // MediaCSV or MediaXLSX
+	Columns []TableColumn // default every top-level field of the message
+	Header  bool          // whether a row of column headers comes first
+}
+
+// TableColumn is a value of every message, addressed by the keys leading to
+// it in the message's JSON
+type TableColumn struct {
+	Header string
+	Path   []string
+}
+
+// tableMarshal keeps unset fields, so rows have a value in every column
+var tableMarshal = protojson.MarshalOptions{EmitUnpopulated: true}
+
+// openTable reads the first message of a server stream, so calls failing
+// before any data are reported as errors, and returns a response rendering
+// the stream as a table
+func openTable(stream grpc.ClientStream, method protoreflect.MethodDescriptor, table *Table) (*Response, error) {
+	first := dynamicpb.NewMessage(method.Output())
+	err := stream.RecvMsg(first)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("gRPC invocation failed: %w", err)
+	}
+
+	columns := table.Columns
+	if len(columns) == 0 {
+		fields := method.Output().Fields()
+		for i := 0; i < fields.Len(); i++ {
+			name := fields.Get(i).JSONName()
+			columns = append(columns, TableColumn{Header: name, Path: []string{name}})
+		}
+	}
+
+	s := &tableStream{stream: stream, output: method.Output(), columns: columns, done: err == io.EOF}
+	if !s.done {
+		s.first = first
+	}
+	if table.Format == MediaXLSX {
+		s.rows = newXLSXWriter(&s.buf)
+	} else {
+		s.rows = &csvWriter{w: csv.NewWriter(&s.buf)}
+	}
+	if table.Header {
+		header := make([]any, len(columns))
+		for i, column := range columns {
+			header[i] = column.Header
+		}
+		if err := s.rows.row(header); err != nil {
+			return nil, err
+		}
+	}
+	if s.done {
+		if err := s.rows.close(); err != nil {
+			return nil, err
+		}
+	}
+	return &Response{ContentType: table.Format, Stream: s}, nil
+}
+
+// tableStream writes a row per message. A stream failing midway ends the
+// download early, as a table has no place for the error.
+type tableStream struct {
+	stream  grpc.ClientStream
+	output  protoreflect.MessageDescriptor
+	columns []TableColumn
+	first   *dynamicpb.Message // read before the response started
+	rows    rowWriter
+	buf     bytes.Buffer
+	done    bool
+}
+
+// rowWriter encodes rows into the stream's buffer
+type rowWriter interface {
+	row(cells []any) error
+	// close completes the document
+	close() error
+}
+
+func (s *tableStream) Next() ([]byte, error) {
+	// XLSX rows are compressed, so a message may not produce output yet
+	for s.buf.Len() == 0 {
+		if s.done {
+			return nil, io.EOF
+		}
+		if err := s.read(); err != nil {
+			s.done = true
+			return nil, err
+		}
+	}
+	chunk := bytes.Clone(s.buf.Bytes())
+	s.buf.Reset()
+	return chunk, nil
+}
+
+// read writes the row of the next message, or completes the document after
+// the last one
+func (s *tableStream) read() error {
+	msg := s.first
+	s.first = nil
+	if msg == nil {
+		msg = dynamicpb.NewMessage(s.output)
+		if err := s.stream.RecvMsg(msg); err == io.EOF {
+			s.done = true
+			return s.rows.close()
+		} else if err != nil {
+			return fmt.Errorf("gRPC stream failed: %w", err)
+		}
+	}
+
+	data, err := tableMarshal.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+	cells := make([]any, len(s.columns))
+	for i, column := range s.columns {
+		cells[i] = cellValue(doc, column.Path)
+	}
+	return s.rows.row(cells)
+}
+
+// cellValue returns the value at path in a decoded message: a string,
+// json.Number, bool or nil. Objects and lists are kept as compact JSON.
+func cellValue(doc any, path []string) any {
+	for _, key := range path {
+		object, ok := doc.(map[string]any)
+		if !ok {
+			return nil
+		}
+		doc = object[key]
+	}
+	switch v := doc.(type) {
+	case map[string]any, []any:
+		var b strings.Builder
+		encoder := json.NewEncoder(&b)
+		encoder.SetEscapeHTML(false)
+		encoder.Encode(v)
+		return strings.TrimSuffix(b.String(), "\n")
+	}
+	return doc
+}
+
+// cellText formats a cell value as text
+func cellText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// csvWriter writes rows as RFC 4180 CSV
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) row(cells []any) error {
+	record := make([]string, len(cells))
+	for i, cell := range cells {
+		record[i] = cellText(cell)
+	}
+	c.w.Write(record)
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) close() error {
+	return nil
+}
+
+// xlsxWriter writes rows to the single worksheet of an Office Open XML
+// workbook, zipped as it goes. Strings are inline, so the workbook needs no
+// shared string table that would have to wait for the last row.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet io.Writer
+	rows  int
+	err   error
+}
+
+// Parts of the workbook besides its worksheet
+var xlsxParts = []struct{ name, content string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func newXLSXWriter(w io.Writer) *xlsxWriter {
+	x := &xlsxWriter{zip: zip.NewWriter(w)}
+	for _, part := range xlsxParts {
+		x.write(part.name, part.content)
+	}
+	if x.err == nil {
+		x.sheet, x.err = x.zip.Create("xl/worksheets/sheet1.xml")
+	}
+	x.print(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	return x
+}
+
+func (x *xlsxWriter) write(name, content string) {
+	if x.err != nil {
+		return
+	}
+	var part io.Writer
+	if part, x.err = x.zip.Create(name); x.err == nil {
+		_, x.err = io.WriteString(part, content)
+	}
+}
+
+func (x *xlsxWriter) print(s string) {
+	if x.err == nil {
+		_, x.err = io.WriteString(x.sheet, s)
+	}
+}
+
+func (x *xlsxWriter) row(cells []any) error {
+	x.rows++
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, x.rows)
+	for i, cell := range cells {
+		ref := columnName(i) + strconv.Itoa(x.rows)
+		switch v := cell.(type) {
+		case nil:
+			continue
+		case json.Number:
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, v)
+		case bool:
+			value := 0
+			if v {
+				value = 1
+			}
+			fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, value)
+		default:
+			fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			xml.EscapeText(&b, []byte(cellText(v)))
+			b.WriteString(`</t></is></c>`)
+		}
+	}
+	b.WriteString(`</row>`)
+	x.print(b.String())
+	return x.err
+}
+
+func (x *xlsxWriter) close() error {
+	x.print(`</sheetData></worksheet>`)
+	if x.err != nil {
+		return x.err
+	}
+	return x.zip.Close()
+}
+
+// columnName returns the spreadsheet name of the zero-based column i: A, B,
+// ..., Z, AA, AB and so on
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
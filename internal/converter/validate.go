@@ -0,0 +1,31 @@
+package converter
+
+import (
+	"fmt"
+
+	"dynamic-gateway/internal/config"
+)
+
+// ValidateConfig checks that every configured protocol pair has a registered converter
+func ValidateConfig(cfg *config.Config) error {
+	for _, route := range cfg.HTTPRoutes {
+		switch route.TargetProtocol {
+		case "", "http", "auto", string(GRPCStream):
+			continue
+		}
+		if !Supported(HTTP, Protocol(route.TargetProtocol)) {
+			return fmt.Errorf("unsupported target_protocol %q for route %s (available: %v)", route.TargetProtocol, route.Path, Targets(HTTP))
+		}
+	}
+
+	for _, svc := range cfg.GRPCServices {
+		if svc.TargetProtocol == "" || svc.TargetProtocol == "grpc" {
+			continue
+		}
+		if !Supported(GRPC, Protocol(svc.TargetProtocol)) {
+			return fmt.Errorf("unsupported target_protocol %q for service %s (available: %v)", svc.TargetProtocol, svc.ServiceName, Targets(GRPC))
+		}
+	}
+
+	return nil
+}
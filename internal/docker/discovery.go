@@ -0,0 +1,161 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+const defaultHost = "unix:///var/run/docker.sock"
+
+// UpdateFunc receives the complete set of routes and services derived from
+// the running containers whenever it changes
+type UpdateFunc func(routes []config.HTTPRoute, services []config.GRPCService)
+
+// Discovery polls the Docker API and registers labelled containers as backends
+type Discovery struct {
+	cfg      *config.Docker
+	baseURL  string
+	client   *http.Client
+	interval time.Duration
+	onUpdate UpdateFunc
+
+	published bool
+	routes    []config.HTTPRoute
+	services  []config.GRPCService
+	skipped   map[string]bool
+	lastErr   string
+}
+
+// NewDiscovery creates a discovery provider for the configured Docker endpoint
+func NewDiscovery(cfg *config.Docker, onUpdate UpdateFunc) (*Discovery, error) {
+	host := cfg.Host
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		host = defaultHost
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid docker host %q: %w", host, err)
+	}
+
+	transport := &http.Transport{}
+	baseURL := "http://" + u.Host
+	switch u.Scheme {
+	case "unix":
+		socket := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		baseURL = "http://docker"
+	case "tcp", "http":
+	case "https":
+		baseURL = "https://" + u.Host
+	default:
+		return nil, fmt.Errorf("unsupported docker host scheme %q", u.Scheme)
+	}
+
+	interval, _ := time.ParseDuration(cfg.Interval)
+	return &Discovery{
+		cfg:      cfg,
+		baseURL:  baseURL,
+		client:   &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		interval: interval,
+		onUpdate: onUpdate,
+	}, nil
+}
+
+// Run polls the running containers until ctx is cancelled
+func (d *Discovery) Run(ctx context.Context) {
+	for {
+		d.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.interval):
+		}
+	}
+}
+
+// poll lists containers and publishes the translated routes when they change.
+// Failures and skipped containers are logged once, so a stopped Docker daemon
+// or an unlabelled container does not flood the log.
+func (d *Discovery) poll(ctx context.Context) {
+	containers, err := d.list(ctx)
+	if err != nil {
+		if ctx.Err() == nil && err.Error() != d.lastErr {
+			log.Printf("Docker discovery failed: %v", err)
+		}
+		d.lastErr = err.Error()
+		return
+	}
+	d.lastErr = ""
+
+	routes, services, skipped := d.translate(containers)
+	seen := make(map[string]bool, len(skipped))
+	for _, reason := range skipped {
+		if !d.skipped[reason] {
+			log.Printf("Docker discovery skipped %s", reason)
+		}
+		seen[reason] = true
+	}
+	d.skipped = seen
+
+	if d.published && reflect.DeepEqual(routes, d.routes) && reflect.DeepEqual(services, d.services) {
+		return
+	}
+	d.published, d.routes, d.services = true, routes, services
+	d.onUpdate(routes, services)
+}
+
+// list returns the running containers that may be registered
+func (d *Discovery) list(ctx context.Context) ([]container, error) {
+	label := labelEnable + "=true"
+	if d.cfg.Project != "" {
+		label = composeProject + "=" + d.cfg.Project
+	}
+	filters, _ := json.Marshal(map[string][]string{"label": {label}})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"/containers/json?filters="+url.QueryEscape(string(filters)), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing containers returned %s", resp.Status)
+	}
+
+	var containers []container
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("failed to decode containers: %w", err)
+	}
+	return containers, nil
+}
+
+// name returns the compose service name of a container, or its container name
+func (c container) name() string {
+	if service := c.Labels[composeService]; service != "" {
+		return service
+	}
+	if len(c.Names) > 0 {
+		return strings.TrimPrefix(c.Names[0], "/")
+	}
+	return c.ID
+}
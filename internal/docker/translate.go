@@ -0,0 +1,199 @@
+package docker
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Labels read from containers
+const (
+	labelEnable       = "gateway.enable"        // "true" to register, "false" to skip a project container
+	labelPort         = "gateway.port"          // container port, default the only exposed port
+	labelProtocol     = "gateway.protocol"      // "http" (default) or "grpc"
+	labelPath         = "gateway.path"          // HTTP route path, default /<service>
+	labelMethods      = "gateway.methods"       // comma-separated HTTP methods, default all
+	labelStripPath    = "gateway.strip_path"    // strip the route path upstream, default true
+	labelGRPCServices = "gateway.grpc_services" // comma-separated fully qualified gRPC services
+	labelReflection   = "gateway.reflection"    // discover descriptors through gRPC reflection
+
+	composeProject = "com.docker.compose.project"
+	composeService = "com.docker.compose.service"
+)
+
+type container struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Labels map[string]string `json:"Labels"`
+	Ports  []struct {
+		IP          string `json:"IP"`
+		PrivatePort int    `json:"PrivatePort"`
+		PublicPort  int    `json:"PublicPort"`
+		Type        string `json:"Type"`
+	} `json:"Ports"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// translate maps containers onto routes and services. Replicas of a compose
+// service share a route or service and become its backends.
+// Containers that cannot be registered are reported in skipped.
+func (d *Discovery) translate(containers []container) ([]config.HTTPRoute, []config.GRPCService, []string) {
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].name()+containers[i].ID < containers[j].name()+containers[j].ID
+	})
+
+	var routes []config.HTTPRoute
+	var services []config.GRPCService
+	var skipped []string
+	routeIndex := make(map[string]int)
+	serviceIndex := make(map[string]int)
+
+	for _, c := range containers {
+		if enable, err := strconv.ParseBool(c.Labels[labelEnable]); err == nil && !enable {
+			continue
+		}
+		address, err := d.address(c)
+		if err != nil {
+			skipped = append(skipped, fmt.Sprintf("container %s: %v", c.name(), err))
+			continue
+		}
+
+		switch protocol := c.Labels[labelProtocol]; protocol {
+		case "", "http":
+			route := config.HTTPRoute{
+				Path:      c.Labels[labelPath],
+				Methods:   splitLabel(c.Labels[labelMethods]),
+				StripPath: true,
+				Docs:      config.RouteDocs{Description: "Docker container " + c.name()},
+			}
+			if route.Path == "" {
+				route.Path = "/" + c.name()
+			}
+			if strip, err := strconv.ParseBool(c.Labels[labelStripPath]); err == nil {
+				route.StripPath = strip
+			}
+			backend := config.Backend{Address: "http://" + address}
+
+			key := route.Path + " " + strings.Join(route.Methods, ",")
+			if i, ok := routeIndex[key]; ok {
+				routes[i].Backends = append(routes[i].Backends, backend)
+				continue
+			}
+			route.Backends = []config.Backend{backend}
+			routeIndex[key] = len(routes)
+			routes = append(routes, route)
+		case "grpc":
+			names := splitLabel(c.Labels[labelGRPCServices])
+			if len(names) == 0 {
+				skipped = append(skipped, fmt.Sprintf("container %s: %s names no gRPC services", c.name(), labelGRPCServices))
+				continue
+			}
+			reflection, _ := strconv.ParseBool(c.Labels[labelReflection])
+			for _, name := range names {
+				backend := config.Backend{Address: address}
+				if i, ok := serviceIndex[name]; ok {
+					services[i].Backends = append(services[i].Backends, backend)
+					continue
+				}
+				serviceIndex[name] = len(services)
+				services = append(services, config.GRPCService{
+					ServiceName: name,
+					IsGRPC:      true,
+					Reflection:  reflection,
+					Backends:    []config.Backend{backend},
+					Docs:        config.RouteDocs{Description: "Docker container " + c.name()},
+				})
+			}
+		default:
+			skipped = append(skipped, fmt.Sprintf("container %s: unknown protocol %q", c.name(), protocol))
+		}
+	}
+
+	// The gateway picks the first matching prefix, so longer paths go first
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Path) > len(routes[j].Path)
+	})
+	return routes, services, skipped
+}
+
+// address returns host:port for reaching a container, either on its network
+// or through the port published on the Docker host
+func (d *Discovery) address(c container) (string, error) {
+	port := 0
+	if value := c.Labels[labelPort]; value != "" {
+		p, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s %q", labelPort, value)
+		}
+		port = p
+	} else {
+		exposed := make(map[int]bool)
+		for _, p := range c.Ports {
+			if p.Type == "tcp" {
+				exposed[p.PrivatePort] = true
+			}
+		}
+		switch len(exposed) {
+		case 0:
+			return "", fmt.Errorf("no exposed port, set %s", labelPort)
+		case 1:
+		default:
+			return "", fmt.Errorf("set %s to choose among %d exposed ports", labelPort, len(exposed))
+		}
+		for p := range exposed {
+			port = p
+		}
+	}
+
+	if d.cfg.Published {
+		for _, p := range c.Ports {
+			if p.PrivatePort != port || p.PublicPort == 0 || p.Type != "tcp" {
+				continue
+			}
+			host := p.IP
+			if host == "" || host == "0.0.0.0" || host == "::" {
+				host = "127.0.0.1"
+			}
+			return net.JoinHostPort(host, strconv.Itoa(p.PublicPort)), nil
+		}
+		return "", fmt.Errorf("port %d is not published", port)
+	}
+
+	networks := c.NetworkSettings.Networks
+	if d.cfg.Network != "" {
+		if n, ok := networks[d.cfg.Network]; ok && n.IPAddress != "" {
+			return net.JoinHostPort(n.IPAddress, strconv.Itoa(port)), nil
+		}
+		return "", fmt.Errorf("not attached to network %s", d.cfg.Network)
+	}
+	names := make([]string, 0, len(networks))
+	for name := range networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := networks[name].IPAddress; ip != "" {
+			return net.JoinHostPort(ip, strconv.Itoa(port)), nil
+		}
+	}
+	return "", fmt.Errorf("no network address")
+}
+
+// splitLabel parses a comma-separated label value
+func splitLabel(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
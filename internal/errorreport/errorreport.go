@@ -0,0 +1,316 @@
+package errorreport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/requestinfo"
+)
+
+// queueSize bounds reports waiting to be sent; further reports are dropped
+const queueSize = 100
+
+// Report describes an error captured by the gateway
+type Report struct {
+	Message string
+	Panic   bool
+	Stack   []byte // output of runtime/debug.Stack, if any
+	Request *http.Request
+	Tags    map[string]string
+}
+
+// Reporter sends reports to a Sentry-compatible store endpoint in the background
+type Reporter struct {
+	endpoint     string
+	auth         string
+	environment  string
+	release      string
+	serverErrors bool
+	sampleRate   float64
+	serverName   string
+	client       *http.Client
+	queue        chan map[string]any
+	done         chan struct{}
+	closeOnce    sync.Once
+}
+
+// New creates a reporter for the configured DSN and starts its sender
+func New(cfg *config.ErrorReporting) (*Reporter, error) {
+	dsn := cfg.DSN
+	if cfg.DSNEnv != "" {
+		dsn = os.Getenv(cfg.DSNEnv)
+	}
+	endpoint, key, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	serverName, _ := os.Hostname()
+
+	r := &Reporter{
+		endpoint:     endpoint,
+		auth:         fmt.Sprintf("Sentry sentry_version=7, sentry_client=dynamic-gateway/1.0, sentry_key=%s", key),
+		environment:  cfg.Environment,
+		release:      cfg.Release,
+		serverErrors: cfg.ServerErrors,
+		sampleRate:   cfg.SampleRate,
+		serverName:   serverName,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		queue:        make(chan map[string]any, queueSize),
+		done:         make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+// parseDSN derives the store endpoint and public key from a DSN of the form
+// https://<key>@<host>[/<path>]/<project>
+func parseDSN(dsn string) (string, string, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Host == "" || u.User == nil {
+		return "", "", fmt.Errorf("invalid error reporting DSN")
+	}
+	path := strings.Trim(u.Path, "/")
+	i := strings.LastIndex(path, "/")
+	prefix, project := "", path
+	if i >= 0 {
+		prefix, project = "/"+path[:i], path[i+1:]
+	}
+	if project == "" {
+		return "", "", fmt.Errorf("error reporting DSN has no project")
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, prefix, project), u.User.Username(), nil
+}
+
+// ServerErrors reports whether 5xx responses and failed calls are reported,
+// applying the sample rate
+func (r *Reporter) ServerErrors() bool {
+	if r == nil || !r.serverErrors {
+		return false
+	}
+	return r.sampleRate >= 1 || mathrand.Float64() < r.sampleRate
+}
+
+// Capture queues a report, dropping it when the queue is full
+func (r *Reporter) Capture(report Report) {
+	if r == nil {
+		return
+	}
+	select {
+	case r.queue <- r.event(report):
+	default:
+		log.Printf("Error report dropped, queue full: %s", report.Message)
+	}
+}
+
+// Close sends queued reports, waiting at most timeout
+func (r *Reporter) Close(timeout time.Duration) {
+	if r == nil {
+		return
+	}
+	r.closeOnce.Do(func() { close(r.queue) })
+	select {
+	case <-r.done:
+	case <-time.After(timeout):
+	}
+}
+
+func (r *Reporter) run() {
+	defer close(r.done)
+	for event := range r.queue {
+		if err := r.send(event); err != nil {
+			log.Printf("Failed to send error report: %v", err)
+		}
+	}
+}
+
+func (r *Reporter) send(event map[string]any) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", r.auth)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("error tracker returned %s", resp.Status)
+	}
+	return nil
+}
+
+// event builds the Sentry event payload for a report
+func (r *Reporter) event(report Report) map[string]any {
+	id := make([]byte, 16)
+	rand.Read(id)
+
+	level := "error"
+	if report.Panic {
+		level = "fatal"
+	}
+	event := map[string]any{
+		"event_id":    hex.EncodeToString(id),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       level,
+		"logger":      "dynamic-gateway",
+		"server_name": r.serverName,
+		"message":     map[string]any{"formatted": report.Message},
+	}
+	if r.environment != "" {
+		event["environment"] = r.environment
+	}
+	if r.release != "" {
+		event["release"] = r.release
+	}
+
+	tags := make(map[string]string, len(report.Tags)+3)
+	for k, v := range report.Tags {
+		tags[k] = v
+	}
+	if req := report.Request; req != nil {
+		event["request"] = requestContext(req)
+		if info := requestinfo.From(req.Context()); info != nil {
+			setTag(tags, "route", info.Route)
+			setTag(tags, "backend", info.Backend)
+			setTag(tags, "request_id", info.RequestID)
+			if info.Consumer != "" {
+				event["user"] = map[string]any{"id": info.Consumer}
+			}
+		}
+	}
+	if len(tags) > 0 {
+		event["tags"] = tags
+	}
+
+	if len(report.Stack) > 0 {
+		kind := "error"
+		if report.Panic {
+			kind = "panic"
+		}
+		event["exception"] = map[string]any{
+			"values": []map[string]any{{
+				"type":       kind,
+				"value":      report.Message,
+				"stacktrace": map[string]any{"frames": parseStack(report.Stack)},
+				"mechanism":  map[string]any{"type": "dynamic-gateway", "handled": !report.Panic},
+			}},
+		}
+	}
+	return event
+}
+
+// sensitiveHeaders are never sent to the error tracker
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Cookie":              true,
+	"Proxy-Authorization": true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// requestContext describes the request without credentials
+func requestContext(req *http.Request) map[string]any {
+	headers := make(map[string]string, len(req.Header))
+	for name, values := range req.Header {
+		if sensitiveHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	return map[string]any{
+		"method":       req.Method,
+		"url":          scheme + "://" + req.Host + req.URL.Path,
+		"query_string": req.URL.RawQuery,
+		"headers":      headers,
+		"env":          map[string]string{"REMOTE_ADDR": req.RemoteAddr},
+	}
+}
+
+// parseStack converts runtime/debug.Stack output into Sentry frames, oldest
+// call first
+func parseStack(stack []byte) []map[string]any {
+	lines := strings.Split(strings.TrimSpace(string(stack)), "\n")
+	var frames []map[string]any
+	for i := 1; i+1 < len(lines); i += 2 {
+		function := strings.TrimPrefix(lines[i], "created by ")
+		function, _, _ = strings.Cut(function, " in goroutine")
+		if paren := strings.LastIndex(function, "("); paren > 0 && strings.HasSuffix(function, ")") {
+			function = function[:paren]
+		}
+		location := strings.TrimSpace(lines[i+1])
+		if sp := strings.Index(location, " +"); sp > 0 {
+			location = location[:sp]
+		}
+		file, line := location, 0
+		if colon := strings.LastIndex(location, ":"); colon > 0 {
+			file = location[:colon]
+			line, _ = strconv.Atoi(location[colon+1:])
+		}
+
+		// The package ends at the first dot after the last slash
+		module, name := "", function
+		offset := strings.LastIndex(function, "/") + 1
+		if dot := strings.Index(function[offset:], "."); dot >= 0 {
+			module, name = function[:offset+dot], function[offset+dot+1:]
+		}
+		frames = append(frames, map[string]any{
+			"function": name,
+			"module":   module,
+			"filename": file,
+			"abs_path": file,
+			"lineno":   line,
+			"in_app":   strings.HasPrefix(module, "dynamic-gateway/"),
+		})
+	}
+
+	// Sentry lists the outermost frame first
+	for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+		frames[i], frames[j] = frames[j], frames[i]
+	}
+	return frames
+}
+
+func setTag(tags map[string]string, key, value string) {
+	if value != "" {
+		tags[key] = value
+	}
+}
+
+// defaultReporter holds the process-wide reporter used by recovery middleware
+var defaultReporter atomic.Pointer[Reporter]
+
+// SetDefault installs the process-wide reporter
+func SetDefault(r *Reporter) {
+	defaultReporter.Store(r)
+}
+
+// Default returns the process-wide reporter, which may be nil
+func Default() *Reporter {
+	return defaultReporter.Load()
+}
@@ -0,0 +1,458 @@
+// Package etcd reads, writes and watches a gateway configuration kept under
+// an etcd prefix, so a fleet of gateways shares one source of truth. It talks
+// to the etcd v3 JSON gateway, served by etcd on its client port.
+package etcd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Scheme prefixes configuration sources in etcd, as in
+	// etcd://etcd-0:2379,etcd-1:2379/gateway
+	Scheme = "etcd://"
+	// TLSScheme is Scheme for etcd clusters serving TLS
+	TLSScheme = "etcds://"
+
+	requestTimeout = 10 * time.Second
+)
+
+// ErrConflict means the configuration changed in etcd after it was read
+var ErrConflict = errors.New("configuration changed in etcd since it was read")
+
+// IsSource reports whether a configuration path names an etcd prefix
+func IsSource(path string) bool {
+	return strings.HasPrefix(path, Scheme) || strings.HasPrefix(path, TLSScheme)
+}
+
+// Source is a configuration stored under an etcd prefix. Every key directly
+// under the prefix holds the JSON value of the top-level configuration field
+// it is named after, e.g. /gateway/http_routes holds the route list.
+type Source struct {
+	endpoints []string // base URLs, tried in turn
+	prefix    string
+	username  string
+	password  string
+	client    *http.Client
+	watcher   *http.Client
+
+	mu       sync.Mutex
+	token    string // auth token when a username is given
+	current  int    // endpoint that last answered
+	revision int64  // revision of the last load
+}
+
+// Open parses an etcd:// or etcds:// source. The password of a user given in
+// the URL may instead be set in ETCD_PASSWORD, keeping it out of the command
+// line.
+func Open(source string) (*Source, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid etcd source %q: %w", source, err)
+	}
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("invalid etcd source %q: want %shost:port/prefix", source, Scheme)
+	}
+
+	scheme := "http"
+	if u.Scheme+"://" == TLSScheme {
+		scheme = "https"
+	}
+	s := &Source{
+		prefix:  strings.TrimSuffix(u.Path, "/") + "/",
+		client:  &http.Client{Timeout: requestTimeout},
+		watcher: &http.Client{},
+	}
+	for _, host := range strings.Split(u.Host, ",") {
+		s.endpoints = append(s.endpoints, scheme+"://"+host)
+	}
+	if u.User != nil {
+		s.username = u.User.Username()
+		s.password, _ = u.User.Password()
+		if s.password == "" {
+			s.password = os.Getenv("ETCD_PASSWORD")
+		}
+	}
+	return s, nil
+}
+
+// String describes the source without credentials
+func (s *Source) String() string {
+	return fmt.Sprintf("etcd prefix %s on %s", s.prefix, strings.Join(s.endpoints, ","))
+}
+
+// keyValue is a key and value as the JSON gateway encodes them
+type keyValue struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+type responseHeader struct {
+	Revision int64 `json:"revision,string"`
+}
+
+// Load reads the configuration document under the prefix and returns it with
+// the revision it was read at
+func (s *Source) Load(ctx context.Context) ([]byte, int64, error) {
+	kvs, revision, err := s.rangePrefix(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(kvs) == 0 {
+		return nil, 0, fmt.Errorf("no configuration under %s", s)
+	}
+
+	doc := make(map[string]json.RawMessage, len(kvs))
+	for _, kv := range kvs {
+		name, err := s.field(kv.Key)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !json.Valid(kv.Value) {
+			return nil, 0, fmt.Errorf("etcd key %s does not hold JSON", kv.Key)
+		}
+		doc[name] = kv.Value
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	s.mu.Lock()
+	s.revision = revision
+	s.mu.Unlock()
+	return data, revision, nil
+}
+
+// Save writes a configuration document back, one key per top-level field,
+// skipping unchanged fields and deleting the keys of fields it no longer has.
+// It fails with ErrConflict when a key was changed after revision.
+func (s *Source) Save(ctx context.Context, data []byte, revision int64) error {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to decode configuration: %w", err)
+	}
+	kvs, _, err := s.rangePrefix(ctx)
+	if err != nil {
+		return err
+	}
+	stored := make(map[string][]byte, len(kvs))
+	for _, kv := range kvs {
+		stored[string(kv.Key)] = kv.Value
+	}
+
+	var ops []map[string]any
+	names := make([]string, 0, len(doc))
+	for name := range doc {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		var value bytes.Buffer
+		if err := json.Compact(&value, doc[name]); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", name, err)
+		}
+		key := s.prefix + name
+		if old, ok := stored[key]; ok && sameJSON(old, value.Bytes()) {
+			continue
+		}
+		ops = append(ops, map[string]any{"request_put": map[string]any{"key": []byte(key), "value": value.Bytes()}})
+	}
+	for key := range stored {
+		if _, ok := doc[strings.TrimPrefix(key, s.prefix)]; !ok {
+			ops = append(ops, map[string]any{"request_delete_range": map[string]any{"key": []byte(key)}})
+		}
+	}
+	if len(ops) == 0 {
+		return nil
+	}
+
+	// Every key under the prefix must be unchanged since the document was read
+	txn := map[string]any{
+		"compare": []map[string]any{{
+			"target":       "MOD",
+			"key":          []byte(s.prefix),
+			"range_end":    rangeEnd(s.prefix),
+			"mod_revision": strconv.FormatInt(revision+1, 10),
+			"result":       "LESS",
+		}},
+		"success": ops,
+	}
+	var resp struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	if err := s.call(ctx, "/v3/kv/txn", txn, &resp); err != nil {
+		return err
+	}
+	if !resp.Succeeded {
+		return ErrConflict
+	}
+	return nil
+}
+
+// Watch signals on the returned channel when keys under the prefix change
+// after the last load, reconnecting until ctx is done
+func (s *Source) Watch(ctx context.Context) <-chan struct{} {
+	changes := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		s.mu.Lock()
+		revision := s.revision
+		s.mu.Unlock()
+
+		backoff := time.Second
+		for {
+			err := s.watch(ctx, &revision, notify)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.Printf("Watch of %s failed: %v", s, err)
+			}
+
+			wait := time.Second
+			if err != nil {
+				wait = backoff
+				if backoff < 30*time.Second {
+					backoff *= 2
+				}
+			} else {
+				backoff = time.Second
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+	}()
+
+	return changes
+}
+
+// watch follows changes after *revision until the stream ends, advancing
+// *revision past the changes seen
+func (s *Source) watch(ctx context.Context, revision *int64, notify func()) error {
+	create := map[string]any{"key": []byte(s.prefix), "range_end": rangeEnd(s.prefix)}
+	if *revision > 0 {
+		create["start_revision"] = strconv.FormatInt(*revision+1, 10)
+	}
+	resp, err := s.send(ctx, s.watcher, "/v3/watch", map[string]any{"create_request": create})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Result struct {
+				Header          responseHeader    `json:"header"`
+				CompactRevision int64             `json:"compact_revision,string"`
+				Canceled        bool              `json:"canceled"`
+				CancelReason    string            `json:"cancel_reason"`
+				Events          []json.RawMessage `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if message.Error != nil {
+			return errors.New(message.Error.Message)
+		}
+
+		result := message.Result
+		if result.CompactRevision > 0 {
+			// Changes since revision are gone; reload and follow from now
+			*revision = 0
+			notify()
+			return fmt.Errorf("revision compacted")
+		}
+		if result.Canceled {
+			return fmt.Errorf("watch canceled: %s", result.CancelReason)
+		}
+		if len(result.Events) > 0 {
+			*revision = result.Header.Revision
+			notify()
+		}
+	}
+}
+
+// rangePrefix returns the keys under the prefix and the current revision
+func (s *Source) rangePrefix(ctx context.Context) ([]keyValue, int64, error) {
+	var resp struct {
+		Header responseHeader `json:"header"`
+		Kvs    []keyValue     `json:"kvs"`
+	}
+	err := s.call(ctx, "/v3/kv/range", map[string]any{"key": []byte(s.prefix), "range_end": rangeEnd(s.prefix)}, &resp)
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Kvs, resp.Header.Revision, nil
+}
+
+// field returns the configuration field a key holds
+func (s *Source) field(key []byte) (string, error) {
+	name := strings.TrimPrefix(string(key), s.prefix)
+	if name == "" || strings.Contains(name, "/") {
+		return "", fmt.Errorf("unexpected etcd key %s: want one key per configuration field under %s", key, s.prefix)
+	}
+	return name, nil
+}
+
+// call posts a request to the JSON gateway and decodes the response into out
+func (s *Source) call(ctx context.Context, path string, body, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	resp, err := s.send(ctx, s.client, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode etcd response: %w", err)
+	}
+	return nil
+}
+
+// send posts a request, trying each endpoint in turn from the one that last
+// answered, and authenticates again once when the token has expired
+func (s *Source) send(ctx context.Context, client *http.Client, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	first := s.current
+	s.mu.Unlock()
+
+	var lastErr error
+	for i := range s.endpoints {
+		index := (first + i) % len(s.endpoints)
+		for attempt := 0; attempt < 2; attempt++ {
+			token, err := s.authenticate(ctx, client, index, attempt > 0)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoints[index]+path, bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if token != "" {
+				req.Header.Set("Authorization", token)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				lastErr = err
+				break
+			}
+			if resp.StatusCode == http.StatusUnauthorized && s.username != "" && attempt == 0 {
+				resp.Body.Close()
+				continue
+			}
+			if resp.StatusCode != http.StatusOK {
+				message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+				resp.Body.Close()
+				return nil, fmt.Errorf("etcd %s returned %s: %s", path, resp.Status, bytes.TrimSpace(message))
+			}
+
+			s.mu.Lock()
+			s.current = index
+			s.mu.Unlock()
+			return resp, nil
+		}
+	}
+	return nil, fmt.Errorf("no etcd endpoint reachable: %w", lastErr)
+}
+
+// authenticate returns the auth token for requests, requesting a new one
+// from an endpoint when there is none or renew is set
+func (s *Source) authenticate(ctx context.Context, client *http.Client, index int, renew bool) (string, error) {
+	if s.username == "" {
+		return "", nil
+	}
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	if token != "" && !renew {
+		return token, nil
+	}
+
+	data, _ := json.Marshal(map[string]string{"name": s.username, "password": s.password})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoints[index]+"/v3/auth/authenticate", bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("etcd authentication returned %s", resp.Status)
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&auth); err != nil {
+		return "", fmt.Errorf("failed to decode etcd authentication: %w", err)
+	}
+
+	s.mu.Lock()
+	s.token = auth.Token
+	s.mu.Unlock()
+	return auth.Token, nil
+}
+
+// rangeEnd returns the end of the key range covering every key with prefix
+func rangeEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0}
+}
+
+// sameJSON reports whether two JSON values are equal once compacted
+func sameJSON(a, b []byte) bool {
+	var ca, cb bytes.Buffer
+	if json.Compact(&ca, a) != nil || json.Compact(&cb, b) != nil {
+		return false
+	}
+	return bytes.Equal(ca.Bytes(), cb.Bytes())
+}
@@ -0,0 +1,133 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Envoy renders the configuration as an Envoy static bootstrap with one HTTP
+// listener and a cluster per route or service
+func Envoy(cfg *config.Config) map[string]any {
+	var routes, clusters []any
+
+	for i, route := range cfg.HTTPRoutes {
+		if route.TargetProtocol != "" && route.TargetProtocol != "http" {
+			continue
+		}
+		name := fmt.Sprintf("route_%d", i)
+
+		action := map[string]any{"cluster": name}
+		if route.Timeout != "" {
+			action["timeout"] = route.Timeout
+		}
+		if route.StripPath {
+			action["prefix_rewrite"] = "/"
+		}
+		if route.UpstreamHost != "" {
+			action["host_rewrite_literal"] = route.UpstreamHost
+		}
+
+		match := map[string]any{"prefix": strings.TrimSuffix(route.Path, "*")}
+		if len(route.Methods) > 0 {
+			match["headers"] = []any{map[string]any{
+				"name": ":method",
+				"string_match": map[string]any{
+					"safe_regex": map[string]any{"regex": strings.Join(route.Methods, "|")},
+				},
+			}}
+		}
+		routes = append(routes, map[string]any{"match": match, "route": action})
+		clusters = append(clusters, envoyCluster(name, route.Backends, false))
+	}
+
+	for _, svc := range cfg.GRPCServices {
+		if !svc.IsGRPC {
+			continue
+		}
+		name := resourceName(svc.ServiceName)
+		routes = append(routes, map[string]any{
+			"match": map[string]any{"prefix": "/" + svc.ServiceName + "/", "grpc": map[string]any{}},
+			"route": map[string]any{"cluster": name},
+		})
+		clusters = append(clusters, envoyCluster(name, svc.Backends, true))
+	}
+
+	listener := map[string]any{
+		"name": "http",
+		"address": map[string]any{"socket_address": map[string]any{
+			"address": "0.0.0.0", "port_value": cfg.HTTPPort,
+		}},
+		"filter_chains": []any{map[string]any{
+			"filters": []any{map[string]any{
+				"name": "envoy.filters.network.http_connection_manager",
+				"typed_config": map[string]any{
+					"@type":       "type.googleapis.com/envoy.extensions.filters.network.http_connection_manager.v3.HttpConnectionManager",
+					"stat_prefix": "ingress_http",
+					"route_config": map[string]any{
+						"name": "local_route",
+						"virtual_hosts": []any{map[string]any{
+							"name": "gateway", "domains": []any{"*"}, "routes": routes,
+						}},
+					},
+					"http_filters": []any{map[string]any{
+						"name":         "envoy.filters.http.router",
+						"typed_config": map[string]any{"@type": "type.googleapis.com/envoy.extensions.filters.http.router.v3.Router"},
+					}},
+				},
+			}},
+		}},
+	}
+
+	return map[string]any{
+		"static_resources": map[string]any{
+			"listeners": []any{listener},
+			"clusters":  clusters,
+		},
+	}
+}
+
+// envoyCluster builds a STRICT_DNS cluster for a backend pool
+func envoyCluster(name string, backends []config.Backend, http2 bool) map[string]any {
+	var endpoints []any
+	useTLS := false
+	for _, b := range backends {
+		host, port := splitAddress(b.Address)
+		if strings.HasPrefix(b.Address, "https://") || b.TLS {
+			useTLS = true
+		}
+		endpoint := map[string]any{"endpoint": map[string]any{"address": map[string]any{
+			"socket_address": map[string]any{"address": host, "port_value": port},
+		}}}
+		if b.Weight > 0 {
+			endpoint["load_balancing_weight"] = b.Weight
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	cluster := map[string]any{
+		"name":            name,
+		"type":            "STRICT_DNS",
+		"connect_timeout": "5s",
+		"load_assignment": map[string]any{
+			"cluster_name": name,
+			"endpoints":    []any{map[string]any{"lb_endpoints": endpoints}},
+		},
+	}
+	if http2 {
+		cluster["typed_extension_protocol_options"] = map[string]any{
+			"envoy.extensions.upstreams.http.v3.HttpProtocolOptions": map[string]any{
+				"@type":                "type.googleapis.com/envoy.extensions.upstreams.http.v3.HttpProtocolOptions",
+				"explicit_http_config": map[string]any{"http2_protocol_options": map[string]any{}},
+			},
+		}
+	}
+	if useTLS {
+		cluster["transport_socket"] = map[string]any{
+			"name":         "envoy.transport_sockets.tls",
+			"typed_config": map[string]any{"@type": "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.UpstreamTlsContext"},
+		}
+	}
+	return cluster
+}
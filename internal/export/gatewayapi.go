@@ -0,0 +1,194 @@
+package export
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Options controls exported manifests
+type Options struct {
+	Namespace string // namespace of generated routes
+	Gateway   string // name of the parent Gateway resource
+}
+
+// GatewayAPI renders the configuration as Kubernetes Gateway API HTTPRoute and
+// GRPCRoute manifests. Routes that transcode between protocols have no Gateway
+// API equivalent and are skipped with a warning.
+func GatewayAPI(cfg *config.Config, opts Options) []map[string]any {
+	var manifests []map[string]any
+
+	for _, route := range cfg.HTTPRoutes {
+		if route.TargetProtocol != "" && route.TargetProtocol != "http" {
+			log.Printf("Skipping route %s: %s transcoding cannot be expressed in Gateway API", route.Path, route.TargetProtocol)
+			continue
+		}
+		manifests = append(manifests, resource("HTTPRoute", "route"+route.Path, opts, map[string]any{
+			"parentRefs": parentRefs(opts),
+			"rules":      []any{httpRule(route)},
+		}))
+	}
+
+	for _, svc := range cfg.GRPCServices {
+		if !svc.IsGRPC {
+			log.Printf("Skipping service %s: gRPC to HTTP transcoding cannot be expressed in Gateway API", svc.ServiceName)
+			continue
+		}
+		manifests = append(manifests, resource("GRPCRoute", svc.ServiceName, opts, map[string]any{
+			"parentRefs": parentRefs(opts),
+			"rules": []any{map[string]any{
+				"matches":     []any{map[string]any{"method": map[string]any{"service": svc.ServiceName}}},
+				"backendRefs": backendRefs(svc.Backends),
+			}},
+		}))
+	}
+
+	uniqueNames(manifests)
+	return manifests
+}
+
+// httpRule converts an HTTP route into a single HTTPRoute rule
+func httpRule(route config.HTTPRoute) map[string]any {
+	pathType := "PathPrefix"
+	path := strings.TrimSuffix(route.Path, "*")
+
+	var matches []any
+	if len(route.Methods) == 0 {
+		matches = append(matches, map[string]any{"path": map[string]any{"type": pathType, "value": path}})
+	}
+	for _, method := range route.Methods {
+		matches = append(matches, map[string]any{
+			"path":   map[string]any{"type": pathType, "value": path},
+			"method": strings.ToUpper(method),
+		})
+	}
+
+	rule := map[string]any{
+		"matches":     matches,
+		"backendRefs": backendRefs(route.Backends),
+	}
+
+	var filters []any
+	if route.StripPath {
+		filters = append(filters, map[string]any{
+			"type": "URLRewrite",
+			"urlRewrite": map[string]any{
+				"path": map[string]any{"type": "ReplacePrefixMatch", "replacePrefixMatch": "/"},
+			},
+		})
+	}
+	if route.UpstreamHost != "" {
+		filters = append(filters, map[string]any{
+			"type":       "URLRewrite",
+			"urlRewrite": map[string]any{"hostname": route.UpstreamHost},
+		})
+	}
+	if route.Auth != nil && route.Auth.Mode == "strip" {
+		filters = append(filters, map[string]any{
+			"type":                  "RequestHeaderModifier",
+			"requestHeaderModifier": map[string]any{"remove": []any{"Authorization"}},
+		})
+	}
+	if len(filters) > 0 {
+		rule["filters"] = filters
+	}
+	if route.Timeout != "" {
+		rule["timeouts"] = map[string]any{"request": route.Timeout}
+	}
+	return rule
+}
+
+// backendRefs maps backend addresses onto Service references. Hosts of the
+// form name.namespace.svc... keep their namespace.
+func backendRefs(backends []config.Backend) []any {
+	var refs []any
+	for _, b := range backends {
+		host, port := splitAddress(b.Address)
+		labels := strings.Split(host, ".")
+		ref := map[string]any{"name": labels[0]}
+		if len(labels) > 2 && labels[2] == "svc" {
+			ref["namespace"] = labels[1]
+		}
+		if port > 0 {
+			ref["port"] = port
+		}
+		if b.Weight > 0 {
+			ref["weight"] = b.Weight
+		}
+		refs = append(refs, ref)
+	}
+	return refs
+}
+
+// splitAddress extracts host and port from a backend URL or host:port
+func splitAddress(address string) (string, int) {
+	if strings.Contains(address, "://") {
+		if u, err := url.Parse(address); err == nil {
+			address = u.Host
+			if u.Port() == "" {
+				if u.Scheme == "https" {
+					address += ":443"
+				} else {
+					address += ":80"
+				}
+			}
+		}
+	}
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return address, 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+func parentRefs(opts Options) []any {
+	return []any{map[string]any{"name": opts.Gateway}}
+}
+
+// resource wraps a spec in Gateway API object metadata
+func resource(kind, name string, opts Options, spec map[string]any) map[string]any {
+	metadata := map[string]any{"name": resourceName(name)}
+	if opts.Namespace != "" {
+		metadata["namespace"] = opts.Namespace
+	}
+	return map[string]any{
+		"apiVersion": "gateway.networking.k8s.io/v1",
+		"kind":       kind,
+		"metadata":   metadata,
+		"spec":       spec,
+	}
+}
+
+var invalidName = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// resourceName converts an arbitrary string into a DNS-1123 resource name
+func resourceName(s string) string {
+	name := strings.Trim(invalidName.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(name) > 63 {
+		name = strings.TrimRight(name[:63], "-")
+	}
+	if name == "" {
+		name = "route"
+	}
+	return name
+}
+
+// uniqueNames makes generated resource names unique within a kind
+func uniqueNames(manifests []map[string]any) {
+	seen := make(map[string]int)
+	for _, m := range manifests {
+		metadata := m["metadata"].(map[string]any)
+		key := m["kind"].(string) + "/" + metadata["name"].(string)
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			metadata["name"] = fmt.Sprintf("%s-%d", metadata["name"], n)
+		}
+	}
+}
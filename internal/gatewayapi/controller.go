@@ -0,0 +1,212 @@
+package gatewayapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/kube"
+)
+
+const apiPrefix = "/apis/gateway.networking.k8s.io/v1"
+
+// Route kinds watched by the controller, by resource plural
+const (
+	httpRoutes = "httproutes"
+	grpcRoutes = "grpcroutes"
+)
+
+var (
+	// errExpired means the watch resource version is too old and a relist is needed
+	errExpired = errors.New("resource version expired")
+	// errNotInstalled means the route CRD does not exist in the cluster
+	errNotInstalled = errors.New("resource not installed")
+)
+
+// UpdateFunc receives the complete set of translated routes whenever a watched
+// HTTPRoute or GRPCRoute changes
+type UpdateFunc func(routes []config.HTTPRoute, services []config.GRPCService)
+
+// Controller reconciles Gateway API routes from the cluster into gateway config
+type Controller struct {
+	cfg      *config.GatewayAPI
+	client   *kube.Client
+	onUpdate UpdateFunc
+
+	objects map[string]map[string]json.RawMessage // plural -> namespace/name -> object
+	synced  map[string]bool
+	mu      sync.Mutex
+}
+
+// NewController creates a controller using the in-cluster service account
+func NewController(cfg *config.GatewayAPI, onUpdate UpdateFunc) (*Controller, error) {
+	client, err := kube.InCluster()
+	if err != nil {
+		return nil, err
+	}
+	return &Controller{
+		cfg:      cfg,
+		client:   client,
+		onUpdate: onUpdate,
+		objects:  map[string]map[string]json.RawMessage{httpRoutes: {}, grpcRoutes: {}},
+		synced:   make(map[string]bool),
+	}, nil
+}
+
+// Run watches HTTPRoutes and GRPCRoutes until ctx is cancelled
+func (c *Controller) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, plural := range []string{httpRoutes, grpcRoutes} {
+		wg.Add(1)
+		go func(plural string) {
+			defer wg.Done()
+			c.watch(ctx, plural)
+		}(plural)
+	}
+	wg.Wait()
+}
+
+// watch lists and then watches one route kind, relisting whenever the watch ends
+func (c *Controller) watch(ctx context.Context, plural string) {
+	backoff := time.Second
+	for {
+		err := c.sync(ctx, plural)
+		if ctx.Err() != nil {
+			return
+		}
+
+		wait := backoff
+		switch {
+		case err == nil || errors.Is(err, errExpired):
+			backoff = time.Second
+			wait = 0
+		case errors.Is(err, errNotInstalled):
+			// CRD not installed; check again occasionally
+			wait = 5 * time.Minute
+		default:
+			log.Printf("Gateway API watch of %s failed: %v", plural, err)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// sync lists all objects of a kind and follows changes until the watch ends
+func (c *Controller) sync(ctx context.Context, plural string) error {
+	path := c.path(plural)
+
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []json.RawMessage `json:"items"`
+	}
+	status, err := c.client.Do(ctx, http.MethodGet, path, nil, &list)
+	if err != nil {
+		return err
+	}
+
+	objects := make(map[string]json.RawMessage)
+	switch status {
+	case http.StatusOK:
+		for _, item := range list.Items {
+			key, err := objectKey(item)
+			if err != nil {
+				return err
+			}
+			objects[key] = item
+		}
+	case http.StatusNotFound:
+		log.Printf("Gateway API %s are not installed in the cluster", plural)
+	default:
+		return fmt.Errorf("listing %s returned status %d", plural, status)
+	}
+
+	c.mu.Lock()
+	c.objects[plural] = objects
+	c.synced[plural] = true
+	c.mu.Unlock()
+	c.publish()
+
+	if status == http.StatusNotFound {
+		return errNotInstalled
+	}
+
+	return c.client.Watch(ctx, path, list.Metadata.ResourceVersion, func(event kube.Event) error {
+		switch event.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+		case "ERROR":
+			var apiStatus struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &apiStatus)
+			if apiStatus.Code == http.StatusGone {
+				return errExpired
+			}
+			return fmt.Errorf("watch error: %s", apiStatus.Message)
+		default:
+			return nil
+		}
+
+		key, err := objectKey(event.Object)
+		if err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		if event.Type == "DELETED" {
+			delete(c.objects[plural], key)
+		} else {
+			c.objects[plural][key] = event.Object
+		}
+		c.mu.Unlock()
+		c.publish()
+		return nil
+	})
+}
+
+// path returns the collection path for a route kind
+func (c *Controller) path(plural string) string {
+	if c.cfg.Namespace == "" {
+		return apiPrefix + "/" + plural
+	}
+	return fmt.Sprintf("%s/namespaces/%s/%s", apiPrefix, c.cfg.Namespace, plural)
+}
+
+// publish translates the current objects and delivers them once every kind
+// has been listed, so a partial view never replaces a complete one. Updates
+// are delivered under the lock to keep them in order.
+func (c *Controller) publish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.synced[httpRoutes] || !c.synced[grpcRoutes] {
+		return
+	}
+	c.onUpdate(c.translateHTTPRoutes(c.objects[httpRoutes]), c.translateGRPCRoutes(c.objects[grpcRoutes]))
+}
+
+// objectKey returns namespace/name of a raw object
+func objectKey(raw json.RawMessage) (string, error) {
+	var obj struct {
+		Metadata objectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return "", fmt.Errorf("failed to decode object: %w", err)
+	}
+	return obj.Metadata.Namespace + "/" + obj.Metadata.Name, nil
+}
@@ -0,0 +1,272 @@
+package gatewayapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+)
+
+type objectMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type parentRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type backendRef struct {
+	Group     string `json:"group"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Port      int    `json:"port"`
+	Weight    *int   `json:"weight"`
+}
+
+type httpRoute struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		ParentRefs []parentRef `json:"parentRefs"`
+		Rules      []struct {
+			Matches []struct {
+				Path *struct {
+					Type  string `json:"type"`
+					Value string `json:"value"`
+				} `json:"path"`
+				Method string `json:"method"`
+			} `json:"matches"`
+			Filters []struct {
+				Type       string `json:"type"`
+				URLRewrite *struct {
+					Hostname string `json:"hostname"`
+					Path     *struct {
+						Type               string `json:"type"`
+						ReplacePrefixMatch string `json:"replacePrefixMatch"`
+					} `json:"path"`
+				} `json:"urlRewrite"`
+				RequestHeaderModifier *struct {
+					Remove []string `json:"remove"`
+				} `json:"requestHeaderModifier"`
+			} `json:"filters"`
+			BackendRefs []backendRef `json:"backendRefs"`
+			Timeouts    *struct {
+				Request string `json:"request"`
+			} `json:"timeouts"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+type grpcRoute struct {
+	Metadata objectMeta `json:"metadata"`
+	Spec     struct {
+		ParentRefs []parentRef `json:"parentRefs"`
+		Rules      []struct {
+			Matches []struct {
+				Method *struct {
+					Service string `json:"service"`
+				} `json:"method"`
+			} `json:"matches"`
+			BackendRefs []backendRef `json:"backendRefs"`
+		} `json:"rules"`
+	} `json:"spec"`
+}
+
+// translateHTTPRoutes maps HTTPRoute rules onto gateway routes. Each match
+// becomes a route; longer paths sort first since the gateway picks the first
+// matching prefix.
+func (c *Controller) translateHTTPRoutes(objects map[string]json.RawMessage) []config.HTTPRoute {
+	var routes []config.HTTPRoute
+	for _, key := range sortedKeys(objects) {
+		var obj httpRoute
+		if err := json.Unmarshal(objects[key], &obj); err != nil {
+			log.Printf("Skipping HTTPRoute %s: %v", key, err)
+			continue
+		}
+		if !c.attached(obj.Spec.ParentRefs) {
+			continue
+		}
+
+		for i, rule := range obj.Spec.Rules {
+			template := config.HTTPRoute{
+				Docs: config.RouteDocs{Description: fmt.Sprintf("HTTPRoute %s rule %d", key, i)},
+			}
+			if rule.Timeouts != nil && rule.Timeouts.Request != "" && rule.Timeouts.Request != "0s" {
+				template.Timeout = rule.Timeouts.Request
+			}
+
+			supported := true
+			for _, filter := range rule.Filters {
+				switch filter.Type {
+				case "URLRewrite":
+					if rewrite := filter.URLRewrite; rewrite != nil {
+						template.UpstreamHost = rewrite.Hostname
+						if p := rewrite.Path; p != nil {
+							if p.Type != "ReplacePrefixMatch" || p.ReplacePrefixMatch != "/" {
+								supported = false
+							}
+							template.StripPath = true
+						}
+					}
+				case "RequestHeaderModifier":
+					if m := filter.RequestHeaderModifier; m != nil {
+						for _, name := range m.Remove {
+							if http.CanonicalHeaderKey(name) == "Authorization" {
+								template.Auth = &config.AuthPassthrough{Mode: "strip"}
+							}
+						}
+					}
+				default:
+					supported = false
+				}
+			}
+			if !supported {
+				log.Printf("Skipping HTTPRoute %s rule %d: unsupported filter", key, i)
+				continue
+			}
+
+			for _, ref := range rule.BackendRefs {
+				if address, ok := c.serviceAddress(obj.Metadata.Namespace, ref); ok {
+					template.Backends = append(template.Backends, config.Backend{
+						Address: "http://" + address,
+						Weight:  weight(ref),
+					})
+				}
+			}
+			if len(template.Backends) == 0 {
+				log.Printf("Skipping HTTPRoute %s rule %d: no usable backends", key, i)
+				continue
+			}
+
+			if len(rule.Matches) == 0 {
+				route := template
+				route.Path = "/"
+				routes = append(routes, route)
+			}
+			for _, match := range rule.Matches {
+				route := template
+				route.Path = "/"
+				if match.Path != nil {
+					if match.Path.Type == "RegularExpression" {
+						log.Printf("Skipping HTTPRoute %s rule %d match: regular expressions are not supported", key, i)
+						continue
+					}
+					// Exact matches are approximated by the gateway's prefix matching
+					route.Path = match.Path.Value
+				}
+				if match.Method != "" {
+					route.Methods = []string{match.Method}
+				}
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return len(routes[i].Path) > len(routes[j].Path)
+	})
+	return routes
+}
+
+// translateGRPCRoutes maps GRPCRoute rules onto gateway services. Routing is
+// per service, so method matches only select the service name.
+func (c *Controller) translateGRPCRoutes(objects map[string]json.RawMessage) []config.GRPCService {
+	var services []config.GRPCService
+	seen := make(map[string]string)
+	for _, key := range sortedKeys(objects) {
+		var obj grpcRoute
+		if err := json.Unmarshal(objects[key], &obj); err != nil {
+			log.Printf("Skipping GRPCRoute %s: %v", key, err)
+			continue
+		}
+		if !c.attached(obj.Spec.ParentRefs) {
+			continue
+		}
+
+		for i, rule := range obj.Spec.Rules {
+			var backends []config.Backend
+			for _, ref := range rule.BackendRefs {
+				if address, ok := c.serviceAddress(obj.Metadata.Namespace, ref); ok {
+					backends = append(backends, config.Backend{Address: address, Weight: weight(ref)})
+				}
+			}
+			if len(backends) == 0 {
+				log.Printf("Skipping GRPCRoute %s rule %d: no usable backends", key, i)
+				continue
+			}
+
+			for _, match := range rule.Matches {
+				if match.Method == nil || match.Method.Service == "" {
+					log.Printf("Skipping GRPCRoute %s rule %d match: a service is required", key, i)
+					continue
+				}
+				name := match.Method.Service
+				if owner, ok := seen[name]; ok {
+					log.Printf("Skipping GRPCRoute %s: service %s is already routed by %s", key, name, owner)
+					continue
+				}
+				seen[name] = key
+				services = append(services, config.GRPCService{
+					ServiceName: name,
+					IsGRPC:      true,
+					Backends:    backends,
+					Docs:        config.RouteDocs{Description: "GRPCRoute " + key},
+				})
+			}
+		}
+	}
+	return services
+}
+
+// attached reports whether a route references the configured Gateway
+func (c *Controller) attached(refs []parentRef) bool {
+	if c.cfg.GatewayName == "" {
+		return true
+	}
+	for _, ref := range refs {
+		if ref.Kind != "" && ref.Kind != "Gateway" {
+			continue
+		}
+		if ref.Name == c.cfg.GatewayName {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceAddress resolves a Service backend reference to its cluster DNS name
+func (c *Controller) serviceAddress(namespace string, ref backendRef) (string, bool) {
+	if (ref.Group != "" && ref.Group != "core") || (ref.Kind != "" && ref.Kind != "Service") || ref.Port == 0 {
+		return "", false
+	}
+	if ref.Weight != nil && *ref.Weight == 0 {
+		return "", false
+	}
+	if ref.Namespace != "" {
+		namespace = ref.Namespace
+	}
+	return fmt.Sprintf("%s.%s.svc.%s:%d", ref.Name, namespace, strings.TrimSuffix(c.cfg.ClusterDomain, "."), ref.Port), true
+}
+
+func weight(ref backendRef) int {
+	if ref.Weight == nil {
+		return 0
+	}
+	return *ref.Weight
+}
+
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,210 @@
+// Package history keeps a rolling in-memory record of request counts, errors
+// and latency per route, so recent behavior can be triaged from the admin API
+// without a metrics stack.
+package history
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Latencies are counted in buckets growing by latencyGrowth from 1ms, the last
+// bucket holding everything from about a minute on
+const (
+	latencyGrowth  = 1.25
+	latencyBuckets = 50
+)
+
+// History holds the requests of the last window per name, in buckets of
+// resolution
+type History struct {
+	resolution time.Duration
+	size       int // buckets per series
+
+	mu     sync.Mutex
+	series map[string][]*bucket // rings indexed by bucket number modulo size
+}
+
+type bucket struct {
+	number    int64 // start time divided by resolution
+	requests  uint64
+	errors    uint64
+	latencies [latencyBuckets]uint32
+}
+
+// Bucket is the summary of requests started in one interval
+type Bucket struct {
+	Start     time.Time `json:"start"`
+	Requests  uint64    `json:"requests"`
+	Errors    uint64    `json:"errors"`
+	ErrorRate float64   `json:"error_rate"`
+	P99       float64   `json:"p99_ms"` // upper bound of the 99th percentile latency, 0 without requests
+}
+
+// Summary is the summary of a name's requests over the whole window
+type Summary struct {
+	Name string `json:"name"`
+	Bucket
+}
+
+// New creates a history of window in buckets of resolution
+func New(window, resolution time.Duration) *History {
+	return &History{
+		resolution: resolution,
+		size:       int(max(window/resolution, 1)),
+		series:     make(map[string][]*bucket),
+	}
+}
+
+// Resolution returns the length of a bucket
+func (h *History) Resolution() time.Duration {
+	return h.resolution
+}
+
+// Record counts a request to name that started at start and took elapsed
+func (h *History) Record(name string, start time.Time, elapsed time.Duration, failed bool) {
+	if h == nil {
+		return
+	}
+	number := start.UnixNano() / int64(h.resolution)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ring := h.series[name]
+	if ring == nil {
+		ring = make([]*bucket, h.size)
+		h.series[name] = ring
+	}
+	b := ring[number%int64(h.size)]
+	if b == nil {
+		b = &bucket{}
+		ring[number%int64(h.size)] = b
+	}
+	if b.number > number {
+		// Requests finishing after their interval left the window
+		return
+	}
+	if b.number != number {
+		// The slot held a bucket a full window ago
+		*b = bucket{number: number}
+	}
+	b.requests++
+	if failed {
+		b.errors++
+	}
+	b.latencies[latencyBucket(elapsed)]++
+}
+
+// Names returns the names with requests recorded, sorted
+func (h *History) Names() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	names := make([]string, 0, len(h.series))
+	for name := range h.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Buckets returns the buckets of name over the last since, oldest first,
+// including those without requests. It reports false for names without
+// requests recorded.
+func (h *History) Buckets(name string, since time.Duration, now time.Time) ([]Bucket, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ring, ok := h.series[name]
+	if !ok {
+		return nil, false
+	}
+	first, last := h.span(since, now)
+
+	buckets := make([]Bucket, 0, last-first+1)
+	for number := first; number <= last; number++ {
+		out := Bucket{Start: time.Unix(0, number*int64(h.resolution)).UTC()}
+		if b := ring[number%int64(h.size)]; b != nil && b.number == number {
+			out = b.summary(out.Start)
+		}
+		buckets = append(buckets, out)
+	}
+	return buckets, true
+}
+
+// Summaries returns the totals of every name over the last since, sorted by
+// name
+func (h *History) Summaries(since time.Duration, now time.Time) []Summary {
+	names := h.Names()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	first, last := h.span(since, now)
+	start := time.Unix(0, first*int64(h.resolution)).UTC()
+
+	summaries := make([]Summary, 0, len(names))
+	for _, name := range names {
+		var requests, errors uint64
+		var latencies [latencyBuckets]uint64
+		for _, b := range h.series[name] {
+			if b == nil || b.number < first || b.number > last {
+				continue
+			}
+			requests += b.requests
+			errors += b.errors
+			for i, n := range b.latencies {
+				latencies[i] += uint64(n)
+			}
+		}
+		summaries = append(summaries, Summary{Name: name, Bucket: summarize(start, requests, errors, latencies[:])})
+	}
+	return summaries
+}
+
+// span returns the numbers of the first and last buckets of the last since,
+// or of the whole window when since is 0 or longer
+func (h *History) span(since time.Duration, now time.Time) (first, last int64) {
+	last = now.UnixNano() / int64(h.resolution)
+	first = last - int64(h.size) + 1
+	if n := int64((since + h.resolution - 1) / h.resolution); since > 0 && n < int64(h.size) {
+		first = last - n + 1
+	}
+	return first, last
+}
+
+func (b *bucket) summary(start time.Time) Bucket {
+	return summarize(start, b.requests, b.errors, b.latencies[:])
+}
+
+// summarize computes the rates of requests counted in latency buckets
+func summarize[T uint32 | uint64](start time.Time, requests, errors uint64, latencies []T) Bucket {
+	out := Bucket{Start: start, Requests: requests, Errors: errors}
+	if requests == 0 {
+		return out
+	}
+	out.ErrorRate = float64(errors) / float64(requests)
+
+	// The smallest bucket bound covering 99% of the requests
+	rank := uint64(math.Ceil(float64(requests) * 0.99))
+	var seen uint64
+	for i, n := range latencies {
+		seen += uint64(n)
+		if seen >= rank {
+			out.P99 = math.Round(latencyBound(i)*100) / 100
+			break
+		}
+	}
+	return out
+}
+
+// latencyBucket returns the bucket counting a request that took elapsed
+func latencyBucket(elapsed time.Duration) int {
+	ms := float64(elapsed) / float64(time.Millisecond)
+	if ms <= 1 {
+		return 0
+	}
+	return min(int(math.Ceil(math.Log(ms)/math.Log(latencyGrowth))), latencyBuckets-1)
+}
+
+// latencyBound returns the upper bound in milliseconds of bucket i
+func latencyBound(i int) float64 {
+	return math.Pow(latencyGrowth, float64(i))
+}
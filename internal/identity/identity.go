@@ -0,0 +1,125 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// ForwardedClientCertHeader describes the client certificate verified by the
+// gateway to backends
+const ForwardedClientCertHeader = "X-Forwarded-Client-Cert"
+
+type consumerKey struct{}
+
+// WithConsumer attaches a consumer identity to the context
+func WithConsumer(ctx context.Context, consumer string) context.Context {
+	return context.WithValue(ctx, consumerKey{}, consumer)
+}
+
+// Consumer returns the consumer identity attached to the context
+func Consumer(ctx context.Context) string {
+	consumer, _ := ctx.Value(consumerKey{}).(string)
+	return consumer
+}
+
+type claimsKey struct{}
+
+// WithClaims attaches the claims of the verified bearer token to the context
+func WithClaims(ctx context.Context, claims map[string]any) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// Claims returns the claims of the verified bearer token attached to the
+// context, nil without one
+func Claims(ctx context.Context) map[string]any {
+	claims, _ := ctx.Value(claimsKey{}).(map[string]any)
+	return claims
+}
+
+// FromRequest resolves the consumer of a request from its context, the given
+// header, or the client IP, in that order
+func FromRequest(r *http.Request, header string) string {
+	if consumer := Consumer(r.Context()); consumer != "" {
+		return consumer
+	}
+	if header != "" {
+		if consumer := r.Header.Get(header); consumer != "" {
+			return consumer
+		}
+	}
+	return ClientIP(r)
+}
+
+// FromTrustedRequest resolves the consumer like FromRequest, but reads header
+// only on requests sent from one of the trusted networks, the upstreams
+// allowed to name the consumer
+func FromTrustedRequest(r *http.Request, header string, trusted []netip.Prefix) string {
+	addr, err := netip.ParseAddr(ClientIP(r))
+	if err != nil || !slices.ContainsFunc(trusted, func(p netip.Prefix) bool { return p.Contains(addr.Unmap()) }) {
+		header = ""
+	}
+	return FromRequest(r, header)
+}
+
+// ClientIP returns the remote IP of the request without the port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// FromCertificate returns the identity of the verified client certificate on
+// a TLS connection: its first URI SAN (such as a SPIFFE ID), DNS SAN or email
+// SAN, falling back to the subject common name. It is empty when the client
+// presented no verified certificate.
+func FromCertificate(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := state.VerifiedChains[0][0]
+	switch {
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	}
+	return cert.Subject.CommonName
+}
+
+// quoteEscaper escapes a value quoted in X-Forwarded-Client-Cert
+var quoteEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// ForwardedClientCert describes the verified client certificate on a TLS
+// connection in the X-Forwarded-Client-Cert format: the SHA-256 hash of the
+// certificate, its subject and its URI and DNS SANs, e.g.
+// Hash=3f...;Subject="CN=billing";URI=spiffe://example.org/billing. It is
+// empty when the client presented no verified certificate.
+func ForwardedClientCert(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	cert := state.VerifiedChains[0][0]
+	hash := sha256.Sum256(cert.Raw)
+
+	var b strings.Builder
+	b.WriteString("Hash=" + hex.EncodeToString(hash[:]))
+	b.WriteString(`;Subject="` + quoteEscaper.Replace(cert.Subject.String()) + `"`)
+	for _, uri := range cert.URIs {
+		b.WriteString(";URI=" + uri.String())
+	}
+	for _, name := range cert.DNSNames {
+		b.WriteString(";DNS=" + name)
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package idtoken
+
+import "sync"
+
+// flights lets concurrent callers asking for the same key share one call
+type flights[T any] struct {
+	mu    sync.Mutex
+	calls map[string]*flight[T]
+}
+
+type flight[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// do calls fn for key unless a call for key is under way, in which case it
+// waits for that call and returns its result
+func (g *flights[T]) do(key string, fn func() (T, error)) (T, error) {
+	g.mu.Lock()
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		<-c.done
+		return c.value, c.err
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*flight[T])
+	}
+	c := &flight[T]{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.value, c.err = fn()
+	return c.value, c.err
+}
+
+// wait waits for the call for key under way, reporting false when there is
+// none
+func (g *flights[T]) wait(key string) bool {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	g.mu.Unlock()
+	if ok {
+		<-c.done
+	}
+	return ok
+}
@@ -0,0 +1,203 @@
+package idtoken
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxIntrospected bounds the results an introspector caches; the least
+	// recently used are dropped first
+	maxIntrospected = 10000
+	// negativeTTL bounds how long tokens found inactive or invalid are
+	// remembered, as a token may become active just after being issued
+	negativeTTL = 10 * time.Second
+)
+
+var errInactive = errors.New("token is not active")
+
+// ErrUnavailable is returned when a token cannot be verified as the
+// introspection endpoint fails to answer
+var ErrUnavailable = errors.New("token introspection unavailable")
+
+// introspector validates opaque tokens with an OAuth2 token introspection
+// endpoint (RFC 7662), caching results so each token costs a call at most
+// once per TTL. Concurrent requests with the same token share one call.
+type introspector struct {
+	url          string
+	clientID     string
+	clientSecret string
+	audiences    []string
+	scopes       []string
+	ttl          time.Duration
+
+	mu      sync.Mutex
+	cache   map[[sha256.Size]byte]*list.Element // of *introspected
+	recent  *list.List                          // most recently used first
+	flights flights[introspected]
+}
+
+type introspected struct {
+	key     [sha256.Size]byte
+	claims  Claims
+	err     error
+	expires time.Time
+}
+
+// NewIntrospection verifies tokens by asking the introspection endpoint at
+// endpoint, authenticated as clientID, whether they are active. Active
+// tokens must name one of audiences, if any, and grant every scope of
+// scopes. Results are cached for ttl, never past the token's expiry.
+func NewIntrospection(endpoint, clientID, clientSecret string, audiences, scopes []string, ttl time.Duration) Provider {
+	return &introspector{
+		url:          endpoint,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		audiences:    audiences,
+		scopes:       scopes,
+		ttl:          ttl,
+		cache:        make(map[[sha256.Size]byte]*list.Element),
+		recent:       list.New(),
+	}
+}
+
+// Verify implements Provider
+func (i *introspector) Verify(ctx context.Context, token string) (Claims, error) {
+	key := sha256.Sum256([]byte(token))
+	if cached, ok := i.cached(key, time.Now()); ok {
+		return cached.claims, cached.err
+	}
+
+	result, err := i.flights.do(string(key[:]), func() (introspected, error) {
+		// The call outlives the request starting it, as others may wait for it
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksClient.Timeout)
+		defer cancel()
+		return i.verify(ctx, key, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.claims, result.err
+}
+
+// verify introspects a token and caches the result; failures to reach the
+// endpoint are not cached
+func (i *introspector) verify(ctx context.Context, key [sha256.Size]byte, token string) (introspected, error) {
+	claims, err := i.introspect(ctx, token)
+	if err != nil {
+		return introspected{}, err
+	}
+	now := time.Now()
+	result := introspected{key: key, claims: claims, err: errInactive, expires: now.Add(min(i.ttl, negativeTTL))}
+	if claims != nil {
+		if result.err = i.check(claims, now); result.err == nil {
+			result.expires = now.Add(i.ttl)
+		}
+		if exp, ok := numericDate(claims["exp"]); ok && exp.Before(result.expires) {
+			result.expires = exp
+		}
+	}
+	if result.err != nil {
+		result.claims = nil
+	}
+	i.store(result)
+	return result, nil
+}
+
+// cached returns the unexpired result for a token, marking it recently used
+func (i *introspector) cached(key [sha256.Size]byte, now time.Time) (*introspected, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	elem, ok := i.cache[key]
+	if !ok {
+		return nil, false
+	}
+	result := elem.Value.(*introspected)
+	if !now.Before(result.expires) {
+		i.recent.Remove(elem)
+		delete(i.cache, key)
+		return nil, false
+	}
+	i.recent.MoveToFront(elem)
+	return result, true
+}
+
+// store caches a result, dropping the least recently used beyond the limit
+func (i *introspector) store(result introspected) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if elem, ok := i.cache[result.key]; ok {
+		elem.Value = &result
+		i.recent.MoveToFront(elem)
+		return
+	}
+	i.cache[result.key] = i.recent.PushFront(&result)
+	for i.recent.Len() > maxIntrospected {
+		oldest := i.recent.Back()
+		i.recent.Remove(oldest)
+		delete(i.cache, oldest.Value.(*introspected).key)
+	}
+}
+
+// introspect asks the endpoint about a token, returning the claims of active
+// ones and nil for the others
+func (i *introspector) introspect(ctx context.Context, token string) (Claims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(i.clientID), url.QueryEscape(i.clientSecret))
+
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("%w: %s returned %s", ErrUnavailable, i.url, resp.Status)
+	}
+	var claims Claims
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	if active, _ := claims["active"].(bool); !active {
+		return nil, nil
+	}
+	return claims, nil
+}
+
+// check applies the audience, scope and validity period requirements the
+// endpoint may not know of
+func (i *introspector) check(claims Claims, now time.Time) error {
+	if !audienceIn(claims, []string{"aud"}, i.audiences) {
+		return fmt.Errorf("token is not for this audience")
+	}
+	granted, _ := claims["scope"].(string)
+	for _, scope := range i.scopes {
+		if !slices.Contains(strings.Fields(granted), scope) {
+			return fmt.Errorf("token lacks scope %s", scope)
+		}
+	}
+	if exp, ok := numericDate(claims["exp"]); ok && now.After(exp.Add(leeway)) {
+		return fmt.Errorf("token has expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(leeway).Before(nbf) {
+		return fmt.Errorf("token is not valid yet")
+	}
+	return nil
+}
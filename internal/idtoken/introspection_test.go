@@ -0,0 +1,138 @@
+package idtoken
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// introspectionEndpoint answers introspection requests from responses keyed
+// by token, counting the calls
+func introspectionEndpoint(t *testing.T, responses map[string]map[string]any) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if id, secret, _ := r.BasicAuth(); id != "gateway" || secret != "s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		response, ok := responses[r.FormValue("token")]
+		if !ok {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestIntrospection(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	responses := map[string]map[string]any{
+		"active":    {"active": true, "sub": "alice", "aud": "gateway", "scope": "read write", "exp": exp},
+		"inactive":  {"active": false},
+		"audience":  {"active": true, "sub": "alice", "aud": "other", "scope": "read", "exp": exp},
+		"scope":     {"active": true, "sub": "alice", "aud": "gateway", "scope": "write", "exp": exp},
+		"expired":   {"active": true, "sub": "alice", "aud": "gateway", "scope": "read", "exp": time.Now().Add(-time.Hour).Unix()},
+		"no expiry": {"active": true, "client_id": "batch", "aud": "gateway", "scope": "read"},
+	}
+	tests := []struct {
+		token     string
+		wantErr   bool
+		wantIs    error // the error wrapped, if it matters
+		wantCalls int32 // after verifying twice
+	}{
+		{token: "active", wantCalls: 1},
+		{token: "no expiry", wantCalls: 1},
+		{token: "inactive", wantErr: true, wantIs: errInactive, wantCalls: 1},
+		{token: "audience", wantErr: true, wantCalls: 1},
+		{token: "scope", wantErr: true, wantCalls: 1},
+		{token: "expired", wantErr: true, wantCalls: 2},
+		{token: "unreachable", wantErr: true, wantIs: ErrUnavailable, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			server, calls := introspectionEndpoint(t, responses)
+			provider := NewIntrospection(server.URL, "gateway", "s3cret", []string{"gateway"}, []string{"read"}, time.Minute)
+
+			for range 2 {
+				claims, err := provider.Verify(context.Background(), tt.token)
+				if (err != nil) != tt.wantErr || (tt.wantIs != nil && !errors.Is(err, tt.wantIs)) {
+					t.Fatalf("err = %v, want error %v (%v)", err, tt.wantErr, tt.wantIs)
+				}
+				if (claims == nil) != tt.wantErr {
+					t.Errorf("claims = %v, want some %v", claims, !tt.wantErr)
+				}
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("endpoint called %d times, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestIntrospectionCacheExpiry(t *testing.T) {
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		exp      time.Duration // from now, 0 for none
+		inactive bool
+		age      time.Duration // how old the cached result is when asked again
+		want     int32
+	}{
+		{name: "within ttl", ttl: time.Minute, age: 30 * time.Second, want: 1},
+		{name: "past ttl", ttl: time.Minute, age: 2 * time.Minute, want: 2},
+		{name: "past token expiry", ttl: time.Hour, exp: time.Minute, age: 2 * time.Minute, want: 2},
+		{name: "inactive within negative ttl", ttl: time.Hour, inactive: true, age: negativeTTL / 2, want: 1},
+		{name: "inactive past negative ttl", ttl: time.Hour, inactive: true, age: 2 * negativeTTL, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := map[string]any{"active": !tt.inactive, "sub": "alice"}
+			if tt.exp > 0 {
+				response["exp"] = time.Now().Add(tt.exp).Unix()
+			}
+			server, calls := introspectionEndpoint(t, map[string]map[string]any{"token": response})
+			provider := NewIntrospection(server.URL, "gateway", "s3cret", nil, nil, tt.ttl).(*introspector)
+
+			provider.Verify(context.Background(), "token")
+			// Age the cached result instead of waiting
+			provider.mu.Lock()
+			for _, elem := range provider.cache {
+				elem.Value.(*introspected).expires = elem.Value.(*introspected).expires.Add(-tt.age)
+			}
+			provider.mu.Unlock()
+			provider.Verify(context.Background(), "token")
+
+			if got := calls.Load(); got != tt.want {
+				t.Errorf("endpoint called %d times, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntrospectionSharedCall(t *testing.T) {
+	server, calls := introspectionEndpoint(t, map[string]map[string]any{"token": {"active": true, "sub": "alice"}})
+	provider := NewIntrospection(server.URL, "gateway", "s3cret", nil, nil, time.Minute)
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if _, err := provider.Verify(context.Background(), "token"); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("endpoint called %d times, want 1", got)
+	}
+}
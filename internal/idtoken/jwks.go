@@ -0,0 +1,270 @@
+package idtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	keyRefresh = time.Hour   // keys are fetched again this often
+	minRefresh = time.Minute // and at most this often for an unknown key id
+)
+
+// jwksClient fetches key sets and discovery documents
+var jwksClient = &http.Client{Timeout: 10 * time.Second}
+
+// sets shares key sets between providers and configuration reloads, keyed
+// by URL, so keys are fetched once per issuer
+var sets sync.Map // map[string]*keySet
+
+// keySet caches the signing keys of an issuer. Keys are fetched again
+// periodically and when a token names a key id not in the cache, which is
+// how issuers rotate keys. Fetches happen outside the lock, one at a time.
+type keySet struct {
+	discovery string // OpenID configuration naming the JWKS URL
+
+	mu          sync.Mutex
+	url         string // JWKS URL, empty until discovered
+	keys        map[string]crypto.PublicKey
+	fetched     time.Time
+	lastAttempt time.Time
+	users       int           // providers refreshing the set in the background
+	stop        chan struct{} // ends the background refresh
+	fetches     flights[struct{}]
+}
+
+// keysAt returns the key set published at a JWKS URL
+func keysAt(url string) *keySet {
+	set, _ := sets.LoadOrStore(url, &keySet{url: url})
+	return set.(*keySet)
+}
+
+// discoveredKeys returns the key set an issuer's OpenID configuration names
+func discoveredKeys(issuer string) *keySet {
+	discovery := issuer + "/.well-known/openid-configuration"
+	set, _ := sets.LoadOrStore(discovery, &keySet{discovery: discovery})
+	return set.(*keySet)
+}
+
+// key returns the key with the given id; tokens without a key id may use
+// the only key of a set
+func (s *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	key, ok := s.lookup(kid)
+	due := (!ok || time.Since(s.fetched) >= keyRefresh) && time.Since(s.lastAttempt) >= minRefresh
+	s.mu.Unlock()
+
+	if due {
+		err := s.refresh(ctx)
+		s.mu.Lock()
+		cached := s.keys != nil
+		key, ok = s.lookup(kid)
+		s.mu.Unlock()
+		if err != nil {
+			if !cached {
+				return nil, err
+			}
+			log.Printf("Keeping cached signing keys: %v", err)
+		}
+	} else if !ok && s.fetches.wait("") {
+		// Fetched by another request just now
+		s.mu.Lock()
+		key, ok = s.lookup(kid)
+		s.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// refreshEvery fetches the keys now and then every interval in the
+// background, so rotated keys are known before tokens signed by them arrive.
+// A set has one such goroutine, at the interval first asked for, until every
+// caller has called the returned release.
+func (s *keySet) refreshEvery(interval time.Duration) (release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users++
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+		go s.refreshLoop(interval, s.stop)
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.users--; s.users == 0 {
+				close(s.stop)
+				s.stop = nil
+			}
+		})
+	}
+}
+
+func (s *keySet) refreshLoop(interval time.Duration, stop <-chan struct{}) {
+	for {
+		if err := s.refresh(context.Background()); err != nil {
+			log.Printf("Failed to refresh signing keys: %v", err)
+		}
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// refresh fetches the key set, joining a fetch already under way. The fetch
+// outlives the caller's context, since others may be waiting for it.
+func (s *keySet) refresh(ctx context.Context) error {
+	_, err := s.fetches.do("", func() (struct{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), jwksClient.Timeout)
+		defer cancel()
+		return struct{}{}, s.fetch(ctx)
+	})
+	return err
+}
+
+// fetch fetches the key set, discovering its URL first if needed
+func (s *keySet) fetch(ctx context.Context) error {
+	s.mu.Lock()
+	s.lastAttempt = time.Now()
+	url := s.url
+	s.mu.Unlock()
+
+	if url == "" {
+		var config struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := fetchJSON(ctx, s.discovery, &config); err != nil {
+			return fmt.Errorf("failed to discover signing keys: %w", err)
+		}
+		if config.JWKSURI == "" {
+			return fmt.Errorf("no jwks_uri in %s", s.discovery)
+		}
+		url = config.JWKSURI
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := fetchJSON(ctx, url, &doc); err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no usable signing keys at %s", url)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.url = url
+	s.keys = keys
+	s.fetched = time.Now()
+	return nil
+}
+
+// jwk is a JSON Web Key
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes an RSA or EC key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil || !e.IsInt64() {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		if _, err := key.ECDH(); err != nil {
+			return nil, fmt.Errorf("invalid EC key: %w", err)
+		}
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+// fetchJSON decodes the JSON document at url into v
+func fetchJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,263 @@
+package idtoken
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// issuer publishes signing keys and signs tokens with them, counting the
+// fetches of its key set
+type issuer struct {
+	server  *httptest.Server
+	fetches atomic.Int32
+
+	mu   sync.Mutex
+	keys map[string]*ecdsa.PrivateKey
+	down bool
+}
+
+func newIssuer(t *testing.T, kids ...string) *issuer {
+	t.Helper()
+	iss := &issuer{keys: make(map[string]*ecdsa.PrivateKey)}
+	for _, kid := range kids {
+		iss.rotate(t, kid)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": iss.server.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.fetches.Add(1)
+		iss.mu.Lock()
+		defer iss.mu.Unlock()
+		if iss.down {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		var keys []map[string]string
+		for kid, key := range iss.keys {
+			keys = append(keys, map[string]string{
+				"kty": "EC",
+				"kid": kid,
+				"use": "sig",
+				"crv": "P-256",
+				"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+				"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	iss.server = httptest.NewServer(mux)
+	t.Cleanup(iss.server.Close)
+	return iss
+}
+
+// rotate publishes a new key
+func (iss *issuer) rotate(t *testing.T, kid string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.keys[kid] = key
+}
+
+// sign returns an ES256 token with claims signed by the key kid
+func (iss *issuer) sign(t *testing.T, kid string, claims map[string]any) string {
+	t.Helper()
+	iss.mu.Lock()
+	key := iss.keys[kid]
+	iss.mu.Unlock()
+
+	header, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": kid})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (iss *issuer) claims(overrides map[string]any) map[string]any {
+	claims := map[string]any{
+		"iss": iss.server.URL,
+		"sub": "alice",
+		"aud": "gateway",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range overrides {
+		claims[name] = value
+	}
+	return claims
+}
+
+func TestVerify(t *testing.T) {
+	iss := newIssuer(t, "k1")
+	other := newIssuer(t, "k1")
+	tests := []struct {
+		name    string
+		token   func() string
+		wantErr string
+	}{
+		{name: "valid", token: func() string { return iss.sign(t, "k1", iss.claims(nil)) }},
+		{
+			name: "audience in list",
+			token: func() string {
+				return iss.sign(t, "k1", iss.claims(map[string]any{"aud": []string{"other", "gateway"}}))
+			},
+		},
+		{
+			name:    "other audience",
+			token:   func() string { return iss.sign(t, "k1", iss.claims(map[string]any{"aud": "other"})) },
+			wantErr: "audience",
+		},
+		{
+			name:    "other issuer",
+			token:   func() string { return iss.sign(t, "k1", iss.claims(map[string]any{"iss": "https://evil.example.com"})) },
+			wantErr: "issuer",
+		},
+		{
+			name: "expired",
+			token: func() string {
+				return iss.sign(t, "k1", iss.claims(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}))
+			},
+			wantErr: "expired",
+		},
+		{
+			name: "expired within leeway",
+			token: func() string {
+				return iss.sign(t, "k1", iss.claims(map[string]any{"exp": time.Now().Add(-leeway / 2).Unix()}))
+			},
+		},
+		{
+			name: "not yet valid",
+			token: func() string {
+				return iss.sign(t, "k1", iss.claims(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()}))
+			},
+			wantErr: "not valid yet",
+		},
+		{
+			name:    "signed by another key",
+			token:   func() string { return other.sign(t, "k1", iss.claims(nil)) },
+			wantErr: "signature",
+		},
+		{name: "malformed", token: func() string { return "not.a-token" }, wantErr: "malformed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewJWT(iss.server.URL, []string{"gateway"}, iss.server.URL+"/jwks", time.Hour)
+			defer v.(*verifier).Close()
+
+			claims, err := v.Verify(context.Background(), tt.token())
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if claims.Subject() != "alice" {
+					t.Errorf("subject = %q, want alice", claims.Subject())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeySetCaching(t *testing.T) {
+	tests := []struct {
+		name        string
+		kid         string // key the second token is signed by, published before it
+		stale       bool   // the last fetch attempt is older than minRefresh
+		down        bool   // the key set cannot be fetched the second time
+		wantFetches int32
+		wantErr     bool
+	}{
+		{name: "cached key", kid: "k1", wantFetches: 1},
+		{name: "rotated key", kid: "k2", stale: true, wantFetches: 2},
+		{name: "unknown key fetched at most once a minute", kid: "k2", wantFetches: 1, wantErr: true},
+		{name: "cached keys kept when the fetch fails", kid: "k1", stale: true, down: true, wantFetches: 2},
+		{name: "rotated key unavailable", kid: "k2", stale: true, down: true, wantFetches: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iss := newIssuer(t, "k1")
+			set := keysAt(iss.server.URL + "/jwks")
+			v := &verifier{issuer: iss.server.URL, audienceClaims: []string{"aud"}, keys: set}
+			ctx := context.Background()
+
+			if _, err := v.Verify(ctx, iss.sign(t, "k1", iss.claims(nil))); err != nil {
+				t.Fatalf("first Verify: %v", err)
+			}
+			if tt.kid != "k1" {
+				iss.rotate(t, tt.kid)
+			}
+			if tt.stale {
+				set.mu.Lock()
+				set.lastAttempt = time.Now().Add(-minRefresh)
+				set.fetched = time.Now().Add(-keyRefresh)
+				set.mu.Unlock()
+			}
+			token := iss.sign(t, tt.kid, iss.claims(nil))
+			iss.mu.Lock()
+			iss.down = tt.down
+			iss.mu.Unlock()
+
+			_, err := v.Verify(ctx, token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("second Verify err = %v, want error %v", err, tt.wantErr)
+			}
+			if got := iss.fetches.Load(); got != tt.wantFetches {
+				t.Errorf("key set fetched %d times, want %d", got, tt.wantFetches)
+			}
+		})
+	}
+}
+
+func TestKeySetDiscovery(t *testing.T) {
+	iss := newIssuer(t, "k1")
+	v := &verifier{issuer: iss.server.URL, audienceClaims: []string{"aud"}, keys: discoveredKeys(iss.server.URL)}
+	if _, err := v.Verify(context.Background(), iss.sign(t, "k1", iss.claims(nil))); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if got := iss.fetches.Load(); got != 1 {
+		t.Errorf("key set fetched %d times, want 1", got)
+	}
+}
+
+func TestKeySetSharedFetch(t *testing.T) {
+	iss := newIssuer(t, "k1")
+	v := &verifier{issuer: iss.server.URL, audienceClaims: []string{"aud"}, keys: keysAt(iss.server.URL + "/jwks")}
+	token := iss.sign(t, "k1", iss.claims(nil))
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if _, err := v.Verify(context.Background(), token); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+	if got := iss.fetches.Load(); got != 1 {
+		t.Errorf("key set fetched %d times, want 1", got)
+	}
+}
@@ -0,0 +1,192 @@
+// Package idtoken verifies ID tokens (JWTs) issued by identity providers.
+package idtoken
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Claims are the payload of a verified token
+type Claims map[string]any
+
+// Subject returns the token's sub claim
+func (c Claims) Subject() string {
+	sub, _ := c["sub"].(string)
+	return sub
+}
+
+// Provider verifies tokens issued by one identity provider
+type Provider interface {
+	// Verify checks a token's signature, issuer, audience and lifetime and
+	// returns its claims
+	Verify(ctx context.Context, token string) (Claims, error)
+}
+
+// Factory builds a provider from the settings of a pipeline entry
+type Factory func(settings map[string]string) (Provider, error)
+
+// providers holds the identity providers settings may name
+var providers = map[string]Factory{
+	"oidc":     newOIDC,
+	"auth0":    newAuth0,
+	"keycloak": newKeycloak,
+	"firebase": newFirebase,
+	"cognito":  newCognito,
+}
+
+// Register adds an identity provider that settings may name
+func Register(name string, factory Factory) {
+	providers[name] = factory
+}
+
+// Names returns the registered provider names
+func Names() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New creates the named provider
+func New(name string, settings map[string]string) (Provider, error) {
+	factory, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown id token provider %q (available: %v)", name, Names())
+	}
+	return factory(settings)
+}
+
+// NewJWT verifies tokens of issuer signed by the keys published at jwksURL,
+// which are fetched again every refresh in the background until the
+// provider is closed. Tokens for any audience are accepted when audiences is
+// empty.
+func NewJWT(issuer string, audiences []string, jwksURL string, refresh time.Duration) Provider {
+	keys := keysAt(jwksURL)
+	release := keys.refreshEvery(refresh)
+	return &verifier{issuer: issuer, audiences: audiences, audienceClaims: []string{"aud"}, keys: keys, release: release}
+}
+
+// newOIDC verifies tokens of any OpenID Connect issuer, finding its keys
+// through discovery unless jwks_url is set
+func newOIDC(settings map[string]string) (Provider, error) {
+	s, err := readSettings("oidc", settings, "issuer", "audience", "jwks_url")
+	if err != nil {
+		return nil, err
+	}
+	if s["issuer"] == "" || s["audience"] == "" {
+		return nil, fmt.Errorf("oidc requires issuer and audience")
+	}
+	issuer := strings.TrimSuffix(s["issuer"], "/")
+	keys := discoveredKeys(issuer)
+	if s["jwks_url"] != "" {
+		keys = keysAt(s["jwks_url"])
+	}
+	return &verifier{issuer: s["issuer"], audiences: splitList(s["audience"]), audienceClaims: []string{"aud"}, keys: keys}, nil
+}
+
+// newAuth0 verifies tokens of an Auth0 tenant domain
+func newAuth0(settings map[string]string) (Provider, error) {
+	s, err := readSettings("auth0", settings, "domain", "audience")
+	if err != nil {
+		return nil, err
+	}
+	if s["domain"] == "" || s["audience"] == "" {
+		return nil, fmt.Errorf("auth0 requires domain and audience")
+	}
+	base := "https://" + strings.TrimSuffix(strings.TrimPrefix(s["domain"], "https://"), "/")
+	return &verifier{
+		issuer:         base + "/",
+		audiences:      splitList(s["audience"]),
+		audienceClaims: []string{"aud"},
+		keys:           keysAt(base + "/.well-known/jwks.json"),
+	}, nil
+}
+
+// newKeycloak verifies tokens of a Keycloak realm. Access tokens name the
+// client in azp rather than aud, so either may carry the audience.
+func newKeycloak(settings map[string]string) (Provider, error) {
+	s, err := readSettings("keycloak", settings, "url", "realm", "audience")
+	if err != nil {
+		return nil, err
+	}
+	if s["url"] == "" || s["realm"] == "" || s["audience"] == "" {
+		return nil, fmt.Errorf("keycloak requires url, realm and audience")
+	}
+	issuer := strings.TrimSuffix(s["url"], "/") + "/realms/" + s["realm"]
+	return &verifier{
+		issuer:         issuer,
+		audiences:      splitList(s["audience"]),
+		audienceClaims: []string{"aud", "azp"},
+		keys:           keysAt(issuer + "/protocol/openid-connect/certs"),
+	}, nil
+}
+
+// firebaseKeys is where Firebase Authentication publishes its signing keys
+const firebaseKeys = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+
+// newFirebase verifies Firebase Authentication ID tokens of a project, whose
+// audience is the project itself
+func newFirebase(settings map[string]string) (Provider, error) {
+	s, err := readSettings("firebase", settings, "project_id")
+	if err != nil {
+		return nil, err
+	}
+	if s["project_id"] == "" {
+		return nil, fmt.Errorf("firebase requires project_id")
+	}
+	return &verifier{
+		issuer:         "https://securetoken.google.com/" + s["project_id"],
+		audiences:      []string{s["project_id"]},
+		audienceClaims: []string{"aud"},
+		keys:           keysAt(firebaseKeys),
+	}, nil
+}
+
+// newCognito verifies tokens of an AWS Cognito user pool. ID tokens carry the
+// app client in aud and access tokens in client_id.
+func newCognito(settings map[string]string) (Provider, error) {
+	s, err := readSettings("cognito", settings, "region", "user_pool_id", "audience")
+	if err != nil {
+		return nil, err
+	}
+	if s["region"] == "" || s["user_pool_id"] == "" || s["audience"] == "" {
+		return nil, fmt.Errorf("cognito requires region, user_pool_id and audience")
+	}
+	issuer := fmt.Sprintf("https://cognito-idp.%s.amazonaws.com/%s", s["region"], s["user_pool_id"])
+	return &verifier{
+		issuer:         issuer,
+		audiences:      splitList(s["audience"]),
+		audienceClaims: []string{"aud", "client_id"},
+		keys:           keysAt(issuer + "/.well-known/jwks.json"),
+	}, nil
+}
+
+// readSettings rejects settings a provider does not take
+func readSettings(provider string, settings map[string]string, known ...string) (map[string]string, error) {
+	for key := range settings {
+		found := false
+		for _, k := range known {
+			found = found || k == key
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown setting %q for id token provider %s", key, provider)
+		}
+	}
+	return settings, nil
+}
+
+// splitList parses a comma-separated setting
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,188 @@
+package idtoken
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// leeway tolerates clock skew between the gateway and the issuer
+const leeway = time.Minute
+
+var errMalformed = errors.New("malformed token")
+
+// verifier checks tokens against an issuer, its audiences and its key set
+type verifier struct {
+	issuer         string
+	audiences      []string
+	audienceClaims []string // claims that may name the audience
+	keys           *keySet
+	release        func() // stops the background refresh of keys, if any
+}
+
+// Close stops refreshing the keys in the background once no other provider
+// needs them
+func (v *verifier) Close() error {
+	if v.release != nil {
+		v.release()
+	}
+	return nil
+}
+
+// Verify implements Provider
+func (v *verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformed
+	}
+	key, err := v.keys.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errMalformed
+	}
+	if iss, _ := claims["iss"].(string); iss != v.issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if !v.audienceMatches(claims) {
+		return nil, fmt.Errorf("token is not for this audience")
+	}
+	now := time.Now()
+	exp, ok := numericDate(claims["exp"])
+	if !ok || now.After(exp.Add(leeway)) {
+		return nil, fmt.Errorf("token has expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(leeway).Before(nbf) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+	return claims, nil
+}
+
+// audienceMatches reports whether any audience claim names an accepted
+// audience; tokens for any audience are accepted when none are configured
+func (v *verifier) audienceMatches(claims Claims) bool {
+	return audienceIn(claims, v.audienceClaims, v.audiences)
+}
+
+// audienceIn reports whether any of the named claims holds one of audiences,
+// or audiences is empty
+func audienceIn(claims Claims, names, audiences []string) bool {
+	if len(audiences) == 0 {
+		return true
+	}
+	for _, name := range names {
+		switch aud := claims[name].(type) {
+		case string:
+			if slices.Contains(audiences, aud) {
+				return true
+			}
+		case []any:
+			for _, a := range aud {
+				if s, ok := a.(string); ok && slices.Contains(audiences, s) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// verifySignature checks a JWS signature made with alg by key
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hash crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		hash = crypto.SHA256
+	case "384":
+		hash = crypto.SHA384
+	case "512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	invalid := errors.New("invalid token signature")
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return invalid
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return invalid
+		}
+	case strings.HasPrefix(alg, "ES"):
+		pub, ok := key.(*ecdsa.PublicKey)
+		size := 0
+		if ok {
+			size = (pub.Curve.Params().BitSize + 7) / 8
+		}
+		if !ok || len(signature) != 2*size {
+			return invalid
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return invalid
+		}
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// numericDate converts a JWT NumericDate claim
+func numericDate(v any) (time.Time, bool) {
+	seconds, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
@@ -0,0 +1,134 @@
+package journal
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/metrics"
+	"dynamic-gateway/internal/redact"
+)
+
+// Entry is one journaled request
+type Entry struct {
+	Time         time.Time       `json:"time"`
+	Consumer     string          `json:"consumer"`
+	Route        string          `json:"route"`
+	Method       string          `json:"method"`
+	Path         string          `json:"path"`
+	Backend      string          `json:"backend"`
+	Status       int             `json:"status"`
+	LatencyMS    float64         `json:"latency_ms"`
+	RequestBody  json.RawMessage `json:"request_body,omitempty"`
+	ResponseBody json.RawMessage `json:"response_body,omitempty"`
+}
+
+// queueSize is the number of entries held for the sink; more are dropped
+const queueSize = 1024
+
+var dropped = metrics.NewCounterVec("gateway_journal_dropped_total",
+	"Journal entries lost, by reason",
+	"reason")
+
+// Sink persists serialized journal entries
+type Sink interface {
+	Write(entry []byte) error
+	Close() error
+}
+
+// Journal records request metadata to an append-only sink
+type Journal struct {
+	sink     Sink
+	redactor *redact.Redactor
+	entries  chan Entry
+	wg       sync.WaitGroup
+}
+
+// New creates a journal for the configured sink
+func New(cfg *config.Journal) (*Journal, error) {
+	var sink Sink
+	var err error
+	switch cfg.Sink {
+	case "file":
+		sink, err = newFileSink(cfg.Path)
+	case "kafka":
+		sink = newKafkaSink(cfg.Brokers, cfg.Topic)
+	default:
+		return nil, fmt.Errorf("unknown journal sink %q", cfg.Sink)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redactor, err := redact.New(cfg.RedactFields, cfg.RedactPaths)
+	if err != nil {
+		sink.Close()
+		return nil, err
+	}
+
+	j := &Journal{
+		sink:     sink,
+		redactor: redactor.Merge(redact.Default()),
+		entries:  make(chan Entry, queueSize),
+	}
+
+	j.wg.Add(1)
+	go j.run()
+
+	return j, nil
+}
+
+// Record queues an entry without waiting on the sink. Entries are dropped,
+// and counted in gateway_journal_dropped_total, while the queue is full or
+// when the sink fails to write them, so the journal never slows requests.
+func (j *Journal) Record(entry Entry) {
+	select {
+	case j.entries <- entry:
+	default:
+		dropped.With("queue_full").Inc()
+	}
+}
+
+// Close flushes queued entries and closes the sink
+func (j *Journal) Close() error {
+	close(j.entries)
+	j.wg.Wait()
+	return j.sink.Close()
+}
+
+func (j *Journal) run() {
+	defer j.wg.Done()
+
+	for entry := range j.entries {
+		entry.Consumer = j.redactor.Value("consumer", entry.Consumer)
+		entry.Path = j.redactor.Value("path", entry.Path)
+		entry.RequestBody = j.body(entry.RequestBody)
+		entry.ResponseBody = j.body(entry.ResponseBody)
+
+		data, err := json.Marshal(entry)
+		if err != nil {
+			log.Printf("Failed to encode journal entry: %v", err)
+			continue
+		}
+		if err := j.sink.Write(data); err != nil {
+			dropped.With("write_failed").Inc()
+			log.Printf("Failed to write journal entry: %v", err)
+		}
+	}
+}
+
+// body redacts a captured body and keeps it only if it is valid JSON
+func (j *Journal) body(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	body = j.redactor.JSON(body)
+	if !json.Valid(body) {
+		encoded, _ := json.Marshal(string(body))
+		return encoded
+	}
+	return body
+}
@@ -0,0 +1,124 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/redact"
+)
+
+func TestFileJournal(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   Entry
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "metadata",
+			entry: Entry{Consumer: "alice", Route: "GET /users", Method: "GET", Path: "/users/1", Status: 200},
+			want:  []string{`"consumer":"alice"`, `"route":"GET /users"`, `"status":200`},
+		},
+		{
+			name:    "redacted body field",
+			entry:   Entry{RequestBody: json.RawMessage(`{"user":"alice","password":"hunter2"}`)},
+			want:    []string{`"user":"alice"`, redact.Mask},
+			notWant: []string{"hunter2"},
+		},
+		{
+			name:    "redacted body path",
+			entry:   Entry{ResponseBody: json.RawMessage(`{"card":{"number":"4111111111111111","brand":"visa"}}`)},
+			want:    []string{`"brand":"visa"`},
+			notWant: []string{"4111"},
+		},
+		{
+			name:  "body that is not JSON",
+			entry: Entry{ResponseBody: []byte("plain text")},
+			want:  []string{`"response_body":"plain text"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal.log")
+			j, err := New(&config.Journal{
+				Sink:         "file",
+				Path:         path,
+				RedactFields: []string{"password"},
+				RedactPaths:  []string{"$.card.number"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.entry.Time = time.Now()
+			j.Record(tt.entry)
+			if err := j.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			lines := readLines(t, path)
+			if len(lines) != 1 {
+				t.Fatalf("journal has %d entries, want 1", len(lines))
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(lines[0], s) {
+					t.Errorf("missing %s in %s", s, lines[0])
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(lines[0], s) {
+					t.Errorf("unexpected %s in %s", s, lines[0])
+				}
+			}
+		})
+	}
+}
+
+// stuckSink blocks every write until released
+type stuckSink struct{ release chan struct{} }
+
+func (s stuckSink) Write([]byte) error { <-s.release; return nil }
+func (s stuckSink) Close() error       { return nil }
+
+func TestRecordDoesNotBlock(t *testing.T) {
+	sink := stuckSink{release: make(chan struct{})}
+	redactor, _ := redact.New(nil, nil)
+	j := &Journal{sink: sink, redactor: redactor, entries: make(chan Entry, 1)}
+	j.wg.Add(1)
+	go j.run()
+
+	done := make(chan struct{})
+	go func() {
+		for range 10 {
+			j.Record(Entry{})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record blocked on a stuck sink")
+	}
+	close(sink.release)
+	j.Close()
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
@@ -0,0 +1,73 @@
+package journal
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// fileSink appends newline-delimited JSON entries to a file
+type fileSink struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal file: %w", err)
+	}
+	return &fileSink{file: file}, nil
+}
+
+func (s *fileSink) Write(entry []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.file.Write(append(entry, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
+
+// kafkaSink publishes entries to a Kafka topic in asynchronous batches;
+// batches the brokers do not accept are dropped
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+func newKafkaSink(brokers []string, topic string) *kafkaSink {
+	return &kafkaSink{
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			RequiredAcks: kafka.RequireAll,
+			BatchTimeout: 100 * time.Millisecond,
+			Async:        true,
+			Completion: func(messages []kafka.Message, err error) {
+				if err != nil {
+					dropped.With("publish_failed").Add(uint64(len(messages)))
+					log.Printf("Failed to publish %d journal entries: %v", len(messages), err)
+				}
+			},
+		},
+	}
+}
+
+func (s *kafkaSink) Write(entry []byte) error {
+	return s.writer.WriteMessages(context.Background(), kafka.Message{Value: entry})
+}
+
+func (s *kafkaSink) Close() error {
+	return s.writer.Close()
+}
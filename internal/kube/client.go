@@ -0,0 +1,143 @@
+package kube
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Client talks to the Kubernetes API server using the in-cluster service account
+type Client struct {
+	// Namespace is the namespace the gateway runs in, if known
+	Namespace string
+
+	baseURL string
+	token   string
+	client  *http.Client
+	watcher *http.Client
+}
+
+// InCluster creates a client from the pod's service account
+func InCluster() (*Client, error) {
+	host := os.Getenv("KUBERNETES_SERVICE_HOST")
+	port := os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running inside a kubernetes cluster")
+	}
+
+	token, err := os.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	caCert, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caCert)
+
+	// The namespace file is optional; callers may name namespaces explicitly
+	namespace, _ := os.ReadFile(serviceAccountDir + "/namespace")
+
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}
+	return &Client{
+		Namespace: strings.TrimSpace(string(namespace)),
+		baseURL:   fmt.Sprintf("https://%s:%s", host, port),
+		token:     strings.TrimSpace(string(token)),
+		client:    &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		watcher:   &http.Client{Transport: transport},
+	}, nil
+}
+
+// Do sends a request to path and decodes a successful JSON response into out.
+// It returns the response status code.
+func (c *Client) Do(ctx context.Context, method, path string, body, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		io.Copy(io.Discard, resp.Body)
+		return resp.StatusCode, nil
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// Event is a single watch notification
+type Event struct {
+	Type   string          `json:"type"` // ADDED, MODIFIED, DELETED, BOOKMARK or ERROR
+	Object json.RawMessage `json:"object"`
+}
+
+// Watch streams change events for the collection at path starting after
+// resourceVersion, calling handle for each until the stream ends
+func (c *Client) Watch(ctx context.Context, path, resourceVersion string, handle func(Event) error) error {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	url := fmt.Sprintf("%s%s%swatch=true&allowWatchBookmarks=true&resourceVersion=%s", c.baseURL, path, sep, resourceVersion)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.watcher.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("watch %s returned %s", path, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("failed to decode watch event: %w", err)
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
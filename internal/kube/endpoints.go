@@ -0,0 +1,381 @@
+package kube
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TargetScheme prefixes backends resolved from a service's endpoints, as in
+// kubernetes:///namespace/service:port
+const TargetScheme = "kubernetes:///"
+
+// syncTimeout bounds how long Watch waits for a new service to be listed
+const syncTimeout = 5 * time.Second
+
+// errExpired means the watch resource version is too old and a relist is needed
+var errExpired = errors.New("resource version expired")
+
+// IsTarget reports whether a backend address names a Kubernetes service
+func IsTarget(address string) bool {
+	return strings.HasPrefix(address, TargetScheme)
+}
+
+// target is a service port whose endpoints are backends
+type target struct {
+	namespace string
+	service   string
+	port      string // service port number or name
+}
+
+// parseTarget parses kubernetes:///namespace/service:port; the namespace may
+// be omitted for the gateway's own
+func parseTarget(address, namespace string) (target, error) {
+	rest := strings.TrimPrefix(address, TargetScheme)
+	if ns, svc, ok := strings.Cut(rest, "/"); ok {
+		namespace, rest = ns, svc
+	}
+	service, port, ok := strings.Cut(rest, ":")
+	if !ok || service == "" || port == "" {
+		return target{}, fmt.Errorf("invalid kubernetes backend %q: want %snamespace/service:port", address, TargetScheme)
+	}
+	if namespace == "" {
+		return target{}, fmt.Errorf("kubernetes backend %q names no namespace", address)
+	}
+	return target{namespace: namespace, service: service, port: port}, nil
+}
+
+// Endpoints watches the ready endpoints of the services backends name
+type Endpoints struct {
+	client   *Client
+	onChange func()
+
+	watches map[string]*endpointWatch // by backend address
+	mu      sync.Mutex
+}
+
+// endpointWatch follows the endpoints of one service port
+type endpointWatch struct {
+	target    target
+	cancel    context.CancelFunc
+	synced    chan struct{} // closed once listed
+	listed    bool
+	awaited   bool // Watch no longer waits, so changes are reported
+	addresses []string
+}
+
+// NewEndpoints creates a watcher using the in-cluster service account;
+// onChange is called whenever the endpoints of a watched service change
+func NewEndpoints(onChange func()) (*Endpoints, error) {
+	client, err := InCluster()
+	if err != nil {
+		return nil, err
+	}
+	return &Endpoints{client: client, onChange: onChange, watches: make(map[string]*endpointWatch)}, nil
+}
+
+// Watch follows the services named by addresses and stops following those no
+// longer named. It waits briefly for new services to be listed, so the
+// configuration naming them starts with their endpoints.
+func (e *Endpoints) Watch(addresses []string) error {
+	targets := make(map[string]target, len(addresses))
+	for _, address := range addresses {
+		t, err := parseTarget(address, e.client.Namespace)
+		if err != nil {
+			return err
+		}
+		targets[address] = t
+	}
+
+	e.mu.Lock()
+	var added []*endpointWatch
+	for address, w := range e.watches {
+		if _, ok := targets[address]; !ok {
+			w.cancel()
+			delete(e.watches, address)
+		}
+	}
+	for address, t := range targets {
+		if _, ok := e.watches[address]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		w := &endpointWatch{target: t, cancel: cancel, synced: make(chan struct{})}
+		e.watches[address] = w
+		added = append(added, w)
+		go e.run(ctx, w)
+	}
+	e.mu.Unlock()
+
+	deadline := time.After(syncTimeout)
+	for _, w := range added {
+		select {
+		case <-w.synced:
+		case <-deadline:
+			log.Printf("Endpoints of %s/%s not listed yet", w.target.namespace, w.target.service)
+		}
+	}
+
+	e.mu.Lock()
+	for _, w := range added {
+		w.awaited = true
+	}
+	e.mu.Unlock()
+	return nil
+}
+
+// Resolve returns the ready endpoints, as host:port, of the service a backend
+// address names
+func (e *Endpoints) Resolve(address string) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if w := e.watches[address]; w != nil {
+		return w.addresses
+	}
+	return nil
+}
+
+// run lists and then watches a service's endpoints, relisting whenever the
+// watch ends
+func (e *Endpoints) run(ctx context.Context, w *endpointWatch) {
+	backoff := time.Second
+	for {
+		err := e.sync(ctx, w)
+		if ctx.Err() != nil {
+			return
+		}
+
+		wait := backoff
+		if err == nil || errors.Is(err, errExpired) {
+			backoff = time.Second
+			wait = 0
+		} else {
+			log.Printf("Watch of endpoints of %s/%s failed: %v", w.target.namespace, w.target.service, err)
+			if backoff < 30*time.Second {
+				backoff *= 2
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// sync lists the endpoints of a service port and follows changes until the
+// watch ends. EndpointSlices are read where served, Endpoints otherwise.
+func (e *Endpoints) sync(ctx context.Context, w *endpointWatch) error {
+	portName, err := e.portName(ctx, w.target)
+	if err != nil {
+		return err
+	}
+
+	t := w.target
+	path := fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices?labelSelector=%s",
+		t.namespace, url.QueryEscape("kubernetes.io/service-name="+t.service))
+	decode := sliceAddresses
+
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []json.RawMessage `json:"items"`
+	}
+	status, err := e.client.Do(ctx, http.MethodGet, path, nil, &list)
+	if err == nil && status == http.StatusNotFound {
+		path = fmt.Sprintf("/api/v1/namespaces/%s/endpoints?fieldSelector=%s", t.namespace, url.QueryEscape("metadata.name="+t.service))
+		decode = endpointsAddresses
+		status, err = e.client.Do(ctx, http.MethodGet, path, nil, &list)
+	}
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("listing endpoints returned status %d", status)
+	}
+
+	objects := make(map[string][]string, len(list.Items))
+	for _, item := range list.Items {
+		name, addresses, err := decode(item, portName)
+		if err != nil {
+			return err
+		}
+		objects[name] = addresses
+	}
+	e.publish(w, objects)
+
+	return e.client.Watch(ctx, path, list.Metadata.ResourceVersion, func(event Event) error {
+		switch event.Type {
+		case "ADDED", "MODIFIED", "DELETED":
+		case "ERROR":
+			var apiStatus struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			}
+			json.Unmarshal(event.Object, &apiStatus)
+			if apiStatus.Code == http.StatusGone {
+				return errExpired
+			}
+			return fmt.Errorf("watch error: %s", apiStatus.Message)
+		default:
+			return nil
+		}
+
+		name, addresses, err := decode(event.Object, portName)
+		if err != nil {
+			return err
+		}
+		if event.Type == "DELETED" {
+			delete(objects, name)
+		} else {
+			objects[name] = addresses
+		}
+		e.publish(w, objects)
+		return nil
+	})
+}
+
+// publish records the endpoints of every object of a service and reports a
+// change once Watch has stopped waiting for them
+func (e *Endpoints) publish(w *endpointWatch, objects map[string][]string) {
+	var addresses []string
+	for _, list := range objects {
+		for _, address := range list {
+			if !slices.Contains(addresses, address) {
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	slices.Sort(addresses)
+
+	e.mu.Lock()
+	notify := w.awaited && !reflect.DeepEqual(addresses, w.addresses)
+	w.addresses = addresses
+	if !w.listed {
+		w.listed = true
+		close(w.synced)
+	}
+	e.mu.Unlock()
+
+	if notify {
+		e.onChange()
+	}
+}
+
+// portName returns the name of the service port a target names; endpoints
+// carry the service port's name with the container port number
+func (e *Endpoints) portName(ctx context.Context, t target) (string, error) {
+	var svc struct {
+		Spec struct {
+			Ports []struct {
+				Name string `json:"name"`
+				Port int    `json:"port"`
+			} `json:"ports"`
+		} `json:"spec"`
+	}
+	status, err := e.client.Do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/namespaces/%s/services/%s", t.namespace, t.service), nil, &svc)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("reading service returned status %d", status)
+	}
+	for _, p := range svc.Spec.Ports {
+		if p.Name == t.port || strconv.Itoa(p.Port) == t.port {
+			return p.Name, nil
+		}
+	}
+	return "", fmt.Errorf("service has no port %s", t.port)
+}
+
+// sliceAddresses returns the ready endpoints of an EndpointSlice on a port
+func sliceAddresses(raw json.RawMessage, portName string) (string, []string, error) {
+	var slice struct {
+		Metadata  objectMeta `json:"metadata"`
+		Endpoints []struct {
+			Addresses  []string `json:"addresses"`
+			Conditions struct {
+				Ready *bool `json:"ready"`
+			} `json:"conditions"`
+		} `json:"endpoints"`
+		Ports []endpointPort `json:"ports"`
+	}
+	if err := json.Unmarshal(raw, &slice); err != nil {
+		return "", nil, fmt.Errorf("failed to decode endpoint slice: %w", err)
+	}
+
+	port, ok := findPort(slice.Ports, portName)
+	if !ok {
+		return slice.Metadata.Name, nil, nil
+	}
+	var addresses []string
+	for _, ep := range slice.Endpoints {
+		// A missing condition means ready
+		if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+			continue
+		}
+		for _, ip := range ep.Addresses {
+			addresses = append(addresses, net.JoinHostPort(ip, strconv.Itoa(port)))
+		}
+	}
+	return slice.Metadata.Name, addresses, nil
+}
+
+// endpointsAddresses returns the ready addresses of an Endpoints object on a port
+func endpointsAddresses(raw json.RawMessage, portName string) (string, []string, error) {
+	var endpoints struct {
+		Metadata objectMeta `json:"metadata"`
+		Subsets  []struct {
+			Addresses []struct {
+				IP string `json:"ip"`
+			} `json:"addresses"`
+			Ports []endpointPort `json:"ports"`
+		} `json:"subsets"`
+	}
+	if err := json.Unmarshal(raw, &endpoints); err != nil {
+		return "", nil, fmt.Errorf("failed to decode endpoints: %w", err)
+	}
+
+	var addresses []string
+	for _, subset := range endpoints.Subsets {
+		port, ok := findPort(subset.Ports, portName)
+		if !ok {
+			continue
+		}
+		for _, a := range subset.Addresses {
+			addresses = append(addresses, net.JoinHostPort(a.IP, strconv.Itoa(port)))
+		}
+	}
+	return endpoints.Metadata.Name, addresses, nil
+}
+
+type objectMeta struct {
+	Name string `json:"name"`
+}
+
+type endpointPort struct {
+	Name string `json:"name"`
+	Port int    `json:"port"`
+}
+
+func findPort(ports []endpointPort, name string) (int, bool) {
+	for _, p := range ports {
+		if p.Name == name {
+			return p.Port, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,342 @@
+// Package metrics exposes gateway statistics in the Prometheus text
+// exposition format, so the gateway can be scraped without a client library.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// registry holds every metric family in the order they were created
+var registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+type family interface {
+	write(w io.Writer)
+}
+
+func register(f family) {
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.families = append(registry.families, f)
+}
+
+// Handler serves every registered metric
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w)
+	})
+}
+
+// Write writes every registered metric in the text exposition format
+func Write(w io.Writer) {
+	registry.mu.Lock()
+	families := append([]family(nil), registry.families...)
+	registry.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(buf)
+	}
+	buf.Flush()
+}
+
+// vec is a metric family partitioned by label values
+type vec[T any] struct {
+	name, help, kind string
+	labels           []string
+	newSeries        func() *T
+
+	mu     sync.RWMutex
+	series map[string]*T // by joined label values
+}
+
+func newVec[T any](name, help, kind string, labels []string, newSeries func() *T) *vec[T] {
+	return &vec[T]{name: name, help: help, kind: kind, labels: labels, newSeries: newSeries, series: make(map[string]*T)}
+}
+
+// with returns the series for label values, creating it on first use
+func (v *vec[T]) with(values []string) *T {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.RLock()
+	s := v.series[key]
+	v.mu.RUnlock()
+	if s != nil {
+		return s
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if s = v.series[key]; s == nil {
+		s = v.newSeries()
+		v.series[key] = s
+	}
+	return s
+}
+
+// each calls fn with the label values of every series, sorted
+func (v *vec[T]) each(fn func(values []string, s *T)) {
+	v.mu.RLock()
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	series := make([]*T, len(keys))
+	sort.Strings(keys)
+	for i, key := range keys {
+		series[i] = v.series[key]
+	}
+	v.mu.RUnlock()
+
+	for i, key := range keys {
+		fn(strings.Split(key, "\xff"), series[i])
+	}
+}
+
+func (v *vec[T]) header(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+// Counter is a value that only increases
+type Counter struct {
+	n atomic.Uint64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.n.Add(1)
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n uint64) {
+	c.n.Add(n)
+}
+
+// CounterVec is a family of counters partitioned by labels
+type CounterVec struct {
+	*vec[Counter]
+}
+
+// NewCounterVec creates and registers a counter family
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{newVec(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+	register(v)
+	return v
+}
+
+// With returns the counter for label values, in the order the labels were
+// declared
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values)
+}
+
+func (v *CounterVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(values []string, c *Counter) {
+		fmt.Fprintf(w, "%s%s %d\n", v.name, labelSet(v.labels, values, "", ""), c.n.Load())
+	})
+}
+
+// Gauge is a value that goes up and down
+type Gauge struct {
+	n atomic.Int64
+}
+
+// Inc adds one to the gauge
+func (g *Gauge) Inc() {
+	g.n.Add(1)
+}
+
+// Dec subtracts one from the gauge
+func (g *Gauge) Dec() {
+	g.n.Add(-1)
+}
+
+// GaugeVec is a family of gauges partitioned by labels
+type GaugeVec struct {
+	*vec[Gauge]
+}
+
+// NewGaugeVec creates and registers a gauge family
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{newVec(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+	register(v)
+	return v
+}
+
+// With returns the gauge for label values, in the order the labels were
+// declared
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.with(values)
+}
+
+func (v *GaugeVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(values []string, g *Gauge) {
+		fmt.Fprintf(w, "%s%s %d\n", v.name, labelSet(v.labels, values, "", ""), g.n.Load())
+	})
+}
+
+// Histogram counts observations into buckets
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64 // per bucket, not cumulative; the last is +Inf
+	sum     float64
+	count   uint64
+}
+
+// Observe records a value, such as a duration in seconds
+func (h *Histogram) Observe(value float64) {
+	i := sort.SearchFloat64s(h.buckets, value)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += value
+	h.count++
+	h.mu.Unlock()
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct {
+	*vec[Histogram]
+	buckets []float64
+}
+
+// NewHistogramVec creates and registers a histogram family with the given
+// bucket upper bounds, in increasing order
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &HistogramVec{buckets: buckets}
+	v.vec = newVec(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1)}
+	})
+	register(v)
+	return v
+}
+
+// With returns the histogram for label values, in the order the labels were
+// declared
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values)
+}
+
+func (v *HistogramVec) write(w io.Writer) {
+	v.header(w)
+	v.each(func(values []string, h *Histogram) {
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		sum, count := h.sum, h.count
+		h.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range v.buckets {
+			cumulative += counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelSet(v.labels, values, "le", formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelSet(v.labels, values, "le", "+Inf"), count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labelSet(v.labels, values, "", ""), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, labelSet(v.labels, values, "", ""), count)
+	})
+}
+
+// Collector reports values read from their source at scrape time, such as
+// the state of connection pools
+type Collector struct {
+	name, help, kind string
+	labels           []string
+	collect          func(report func(value float64, values ...string))
+}
+
+// NewCollector creates and registers a family of kind "gauge" or "counter"
+// whose values collect reports on every scrape, with label values in the
+// order labels are declared
+func NewCollector(name, help, kind string, collect func(report func(value float64, values ...string)), labels ...string) *Collector {
+	c := &Collector{name: name, help: help, kind: kind, labels: labels, collect: collect}
+	register(c)
+	return c
+}
+
+func (c *Collector) write(w io.Writer) {
+	type sample struct {
+		labels string
+		value  float64
+	}
+	var samples []sample
+	c.collect(func(value float64, values ...string) {
+		if len(values) != len(c.labels) {
+			panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", c.name, len(c.labels), len(values)))
+		}
+		samples = append(samples, sample{labelSet(c.labels, values, "", ""), value})
+	})
+	sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", c.name, escapeHelp(c.help), c.name, c.kind)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, s.labels, formatFloat(s.value))
+	}
+}
+
+// labelSet formats label pairs, with an extra pair when extraName is set
+func labelSet(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(values[i]))
+		b.WriteByte('"')
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, extraName, extraValue)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dynamic-gateway/internal/apikey"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+	"dynamic-gateway/internal/probe"
+	"dynamic-gateway/internal/requestinfo"
+)
+
+// APIKey middleware requires one of keys from header, or from the query
+// parameter when set and the header is absent, keys the consumer by the key's
+// consumer and enforces the key's request quota. The key is removed from the
+// request before it is forwarded. Requests whose usage cannot be counted are
+// rejected unless keys fail open.
+func APIKey(keys *apikey.Keys, header, queryParam string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(header)
+			r.Header.Del(header)
+			if queryParam != "" {
+				query := r.URL.Query()
+				if key == "" {
+					key = query.Get(queryParam)
+				}
+				if query.Has(queryParam) {
+					query.Del(queryParam)
+					r.URL.RawQuery = query.Encode()
+				}
+			}
+			if key == "" {
+				http.Error(w, "API key required", http.StatusUnauthorized)
+				return
+			}
+			if keys == nil {
+				http.Error(w, "API keys are not configured", http.StatusServiceUnavailable)
+				return
+			}
+
+			record, err := keys.Lookup(r.Context(), key)
+			if errors.Is(err, apikey.ErrUnknownKey) {
+				http.Error(w, "invalid API key", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to look up API key: %v", err)
+				http.Error(w, "failed to verify API key", http.StatusServiceUnavailable)
+				return
+			}
+
+			// Synthetic probes do not use up the key's quota
+			var usage apikey.Usage
+			if !probe.Synthetic(r.Context()) {
+				usage, err = keys.Charge(r.Context(), record)
+			}
+			if err != nil {
+				log.Printf("Failed to count API key %s usage: %v", record.ID, err)
+				if !keys.FailOpen() {
+					http.Error(w, "failed to count API key usage", http.StatusServiceUnavailable)
+					return
+				}
+			} else if usage.Limit > 0 {
+				reset := strconv.FormatInt(int64(time.Until(usage.ResetAt).Seconds()+0.5), 10)
+				w.Header().Set("X-Quota-Limit", strconv.FormatInt(usage.Limit, 10))
+				w.Header().Set("X-Quota-Remaining", strconv.FormatInt(usage.Remaining, 10))
+				w.Header().Set("X-Quota-Reset", reset)
+				if usage.Exceeded {
+					w.Header().Set("Retry-After", reset)
+					http.Error(w, "API key quota exceeded", http.StatusTooManyRequests)
+					return
+				}
+			}
+
+			r = r.WithContext(identity.WithConsumer(r.Context(), record.Consumer))
+			if info := requestinfo.From(r.Context()); info != nil {
+				info.Consumer = record.Consumer
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// apiKeyFactory builds APIKey; header (default X-API-Key) and query_param
+// pick where the key is read
+func apiKeyFactory(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error) {
+	if cfg.APIKeys == nil {
+		return nil, fmt.Errorf("middleware api_key requires api_keys")
+	}
+	header, queryParam := "X-API-Key", ""
+	for key, value := range settings {
+		switch key {
+		case "header":
+			header = value
+		case "query_param":
+			queryParam = value
+		default:
+			return nil, fmt.Errorf("unknown setting %q for middleware api_key", key)
+		}
+	}
+	return APIKey(deps.APIKeys, http.CanonicalHeaderKey(header), queryParam), nil
+}
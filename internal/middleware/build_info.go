@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"dynamic-gateway/internal/buildinfo"
+	"dynamic-gateway/internal/config"
+)
+
+// defaultBuildInfoHeader carries the gateway build unless the pipeline entry
+// names another header
+const defaultBuildInfoHeader = "X-Gateway-Version"
+
+// BuildInfo middleware adds the gateway version and commit to every response
+// so operators can tell which build served a request
+func BuildInfo(header string) func(http.Handler) http.Handler {
+	version := buildinfo.Get().String()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(header, version)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func buildInfoFactory(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error) {
+	header := defaultBuildInfoHeader
+	for key, value := range settings {
+		if key != "header" || value == "" {
+			return nil, fmt.Errorf("invalid setting %q for middleware build_info", key)
+		}
+		header = value
+	}
+	return BuildInfo(header), nil
+}
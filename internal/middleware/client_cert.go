@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+)
+
+// ClientCertificate middleware keys the consumer by the verified client
+// certificate so cost budgets, version pins and journal entries follow the
+// certificate rather than an API key header or the client IP
+func ClientCertificate(cfg *config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if cfg.ServerTLS == nil || !cfg.ServerTLS.ClientIdentity {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if consumer := identity.FromCertificate(r.TLS); consumer != "" {
+				r = r.WithContext(identity.WithConsumer(r.Context(), consumer))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
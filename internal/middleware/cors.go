@@ -13,6 +13,8 @@ func CORS(cfg *config.Config) func(http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
 
+			// Route pipelines may narrow an origin allowed by the global one
+			w.Header().Del("Access-Control-Allow-Origin")
 			if cfg.AllowAllOrigin {
 				w.Header().Set("Access-Control-Allow-Origin", "*")
 			} else if len(cfg.AllowedOrigins) > 0 {
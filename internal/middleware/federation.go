@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/federation"
+	"dynamic-gateway/internal/identity"
+)
+
+// Federation middleware accepts consumer identity from trusted peer gateways
+// and rejects requests that loop between gateways. The hop limit applies
+// without a federation block too, since any backend may be another gateway.
+func Federation(cfg *config.Config) func(http.Handler) http.Handler {
+	maxHops := federation.DefaultMaxHops
+	var maxSkew time.Duration
+	if cfg.Federation != nil {
+		maxHops = cfg.Federation.MaxHops
+		maxSkew, _ = time.ParseDuration(cfg.Federation.MaxSkew)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if federation.Hops(r.Header) >= maxHops {
+				http.Error(w, "gateway forwarding loop detected", http.StatusLoopDetected)
+				return
+			}
+			if cfg.Federation == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			consumer := r.Header.Get(federation.ConsumerHeader)
+			timestamp := r.Header.Get(federation.TimestampHeader)
+			signature := r.Header.Get(federation.SignatureHeader)
+			if federation.Verify(cfg.Federation.SharedSecret, consumer, timestamp, signature, maxSkew, time.Now()) {
+				r = r.WithContext(identity.WithConsumer(r.Context(), consumer))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
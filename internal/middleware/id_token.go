@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+	"dynamic-gateway/internal/idtoken"
+)
+
+// IDToken middleware requires a bearer ID token verified by provider and keys
+// the consumer by its subject. Requests without a valid token are rejected.
+func IDToken(provider idtoken.Provider, header string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token := r.Header.Get(header)
+			if header == "Authorization" {
+				var ok bool
+				if token, ok = strings.CutPrefix(token, "Bearer "); !ok {
+					token = ""
+				}
+			}
+			if token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "id token required", http.StatusUnauthorized)
+				return
+			}
+
+			claims, err := provider.Verify(r.Context(), token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				http.Error(w, "invalid id token: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+			ctx := identity.WithClaims(r.Context(), claims)
+			if sub := claims.Subject(); sub != "" {
+				ctx = identity.WithConsumer(ctx, sub)
+			}
+			r = r.WithContext(ctx)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// idTokenFactory builds IDToken from the provider named by the provider
+// setting; header picks where the token is read and the other settings
+// configure the provider
+func idTokenFactory(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error) {
+	name, header := "", "Authorization"
+	providerSettings := make(map[string]string)
+	for key, value := range settings {
+		switch key {
+		case "provider":
+			name = value
+		case "header":
+			header = value
+		default:
+			providerSettings[key] = value
+		}
+	}
+	provider, err := idtoken.New(name, providerSettings)
+	if err != nil {
+		return nil, err
+	}
+	return IDToken(provider, http.CanonicalHeaderKey(header)), nil
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dynamic-gateway/internal/apikey"
+	"dynamic-gateway/internal/config"
+)
+
+// Dependencies are the shared resources available to middleware factories
+type Dependencies struct {
+	APIKeys *apikey.Keys // keys api_key checks, nil without api_keys
+}
+
+// Factory builds a middleware from the gateway configuration, shared
+// dependencies and the settings of its pipeline entry
+type Factory func(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error)
+
+// factories holds the middlewares a pipeline may name
+var factories = map[string]Factory{
+	"recovery": func(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error) {
+		return Recovery, checkSettings("recovery", settings)
+	},
+	"request_id": func(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error) {
+		return RequestID, checkSettings("request_id", settings)
+	},
+	"logging": loggingFactory,
+	"cors":    corsFactory,
+	"client_certificate": func(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error) {
+		return ClientCertificate(cfg), checkSettings("client_certificate", settings)
+	},
+	"federation": func(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error) {
+		return Federation(cfg), checkSettings("federation", settings)
+	},
+	"build_info": buildInfoFactory,
+	"id_token":   idTokenFactory,
+	"api_key":    apiKeyFactory,
+}
+
+// DefaultPipeline is used when the configuration names no middleware
+var DefaultPipeline = []config.Middleware{
+	{Name: "request_id"},
+	{Name: "recovery"},
+	{Name: "logging"},
+	{Name: "cors"},
+	{Name: "client_certificate"},
+	{Name: "federation"},
+}
+
+// Register adds a middleware that pipelines may name
+func Register(name string, factory Factory) {
+	factories[name] = factory
+}
+
+// Names returns the registered middleware names
+func Names() []string {
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Chain wraps handler in the pipeline, the first entry outermost
+func Chain(cfg *config.Config, deps Dependencies, pipeline []config.Middleware, handler http.Handler) (http.Handler, error) {
+	for i := len(pipeline) - 1; i >= 0; i-- {
+		factory, ok := factories[pipeline[i].Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware %q (available: %v)", pipeline[i].Name, Names())
+		}
+		wrap, err := factory(cfg, deps, pipeline[i].Settings)
+		if err != nil {
+			return nil, err
+		}
+		handler = wrap(handler)
+	}
+	return handler, nil
+}
+
+// ValidateConfig checks that the global and route pipelines can be built
+func ValidateConfig(cfg *config.Config) error {
+	if _, err := Chain(cfg, Dependencies{}, cfg.Middleware, http.NotFoundHandler()); err != nil {
+		return fmt.Errorf("invalid middleware: %w", err)
+	}
+	for _, route := range cfg.HTTPRoutes {
+		if _, err := Chain(cfg, Dependencies{}, route.Middleware, http.NotFoundHandler()); err != nil {
+			return fmt.Errorf("invalid middleware for route %s: %w", route.Path, err)
+		}
+	}
+	return nil
+}
+
+// corsFactory builds CORS, optionally overriding the global origin and header
+// lists so routes can carry their own policy
+func corsFactory(cfg *config.Config, deps Dependencies, settings map[string]string) (func(http.Handler) http.Handler, error) {
+	policy := *cfg
+	for key, value := range settings {
+		switch key {
+		case "allowed_origins":
+			policy.AllowedOrigins = splitList(value)
+		case "allowed_headers":
+			policy.AllowedHeaders = splitList(value)
+		case "allow_all_origin":
+			allow, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cors setting allow_all_origin: %w", err)
+			}
+			policy.AllowAllOrigin = allow
+		default:
+			return nil, fmt.Errorf("unknown setting %q for middleware cors", key)
+		}
+	}
+	return CORS(&policy), nil
+}
+
+// checkSettings rejects settings on middlewares that take none
+func checkSettings(name string, settings map[string]string) error {
+	for key := range settings {
+		return fmt.Errorf("unknown setting %q for middleware %s", key, name)
+	}
+	return nil
+}
+
+// splitList parses a comma-separated setting
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,21 +1,145 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"runtime/debug"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/errorreport"
 )
 
-// Recovery middleware
+// Recovery middleware turns panics into 500 responses and reports them, and
+// 5xx responses when enabled, to the error tracker
 func Recovery(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reporter := errorreport.Default()
+
 		defer func() {
 			if err := recover(); err != nil {
-				log.Printf("Panic recovered: %v\n%s", err, debug.Stack())
+				stack := debug.Stack()
+				log.Printf("Panic recovered: %v\n%s", err, stack)
+				reporter.Capture(errorreport.Report{
+					Message: fmt.Sprintf("panic: %v", err),
+					Panic:   true,
+					Stack:   stack,
+					Request: r,
+				})
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			}
 		}()
 
-		next.ServeHTTP(w, r)
+		if !reporter.ServerErrors() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+		if recorder.status >= http.StatusInternalServerError {
+			reporter.Capture(errorreport.Report{
+				Message: fmt.Sprintf("%s %s returned %d", r.Method, r.URL.Path, recorder.status),
+				Request: r,
+				Tags:    map[string]string{"status": fmt.Sprint(recorder.status)},
+			})
+		}
+	})
+}
+
+// statusRecorder remembers the response status
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+// serverErrorCodes are gRPC statuses reported as server errors
+var serverErrorCodes = map[codes.Code]bool{
+	codes.Unknown:       true,
+	codes.Internal:      true,
+	codes.Unavailable:   true,
+	codes.DataLoss:      true,
+	codes.Unimplemented: true,
+}
+
+// RecoveryUnary is the gRPC equivalent of Recovery for unary calls
+func RecoveryUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer recoverGRPC(ctx, info.FullMethod, &err)
+	resp, err = handler(ctx, req)
+	reportGRPC(ctx, info.FullMethod, err)
+	return resp, err
+}
+
+// RecoveryStream is the gRPC equivalent of Recovery for streaming calls
+func RecoveryStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	defer recoverGRPC(stream.Context(), info.FullMethod, &err)
+	err = handler(srv, stream)
+	reportGRPC(stream.Context(), info.FullMethod, err)
+	return err
+}
+
+// recoverGRPC converts a panic in a call into an Internal status
+func recoverGRPC(ctx context.Context, method string, err *error) {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	stack := debug.Stack()
+	log.Printf("Panic recovered in %s: %v\n%s", method, recovered, stack)
+	errorreport.Default().Capture(errorreport.Report{
+		Message: fmt.Sprintf("panic: %v", recovered),
+		Panic:   true,
+		Stack:   stack,
+		Tags:    grpcTags(ctx, map[string]string{"grpc.method": method}),
+	})
+	*err = status.Error(codes.Internal, "internal error")
+}
+
+// reportGRPC reports a failed call when server errors are reported
+func reportGRPC(ctx context.Context, method string, err error) {
+	code := status.Code(err)
+	if err == nil || !serverErrorCodes[code] {
+		return
+	}
+	reporter := errorreport.Default()
+	if !reporter.ServerErrors() {
+		return
+	}
+	reporter.Capture(errorreport.Report{
+		Message: fmt.Sprintf("%s failed: %v", method, err),
+		Tags:    grpcTags(ctx, map[string]string{"grpc.method": method, "grpc.code": code.String()}),
 	})
 }
+
+// grpcTags adds the request ID of a call to the tags of its report
+func grpcTags(ctx context.Context, tags map[string]string) map[string]string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDMetadata); len(values) > 0 {
+			tags["request_id"] = values[0]
+		}
+	}
+	return tags
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"dynamic-gateway/internal/requestinfo"
+)
+
+const (
+	// RequestIDHeader carries the ID correlating a request across the
+	// gateway, its backends and its logs
+	RequestIDHeader = "X-Request-Id"
+
+	// RequestIDMetadata is the gRPC metadata key of the request ID
+	RequestIDMetadata = "x-request-id"
+
+	// maxRequestIDLength bounds IDs accepted from clients
+	maxRequestIDLength = 128
+)
+
+// RequestID middleware keeps the request ID of requests carrying a valid one
+// and assigns one to the others. The ID is forwarded to the backend, returned
+// to the client with the response, errors included, and recorded in access
+// logs and error reports.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		r.Header.Set(RequestIDHeader, id)
+		w.Header().Set(RequestIDHeader, id)
+		r, info := requestinfo.Ensure(r)
+		info.RequestID = id
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequestIDUnary is the gRPC equivalent of RequestID for unary calls; the ID
+// is returned in the response header metadata
+func RequestIDUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	return handler(requestIDContext(ctx), req)
+}
+
+// RequestIDStream is the gRPC equivalent of RequestID for streaming calls
+func RequestIDStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &contextStream{ServerStream: stream, ctx: requestIDContext(stream.Context())})
+}
+
+// requestIDContext returns ctx with the call's request ID, assigned if
+// needed, in its incoming metadata, which is forwarded to backends
+func requestIDContext(ctx context.Context) context.Context {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if values := incoming.Get(RequestIDMetadata); len(values) > 0 {
+		id = values[0]
+	}
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadata, id))
+
+	md := incoming.Copy()
+	if md == nil {
+		md = metadata.MD{}
+	}
+	md.Set(RequestIDMetadata, id)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+// contextStream replaces the context of a server stream
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// validRequestID reports whether a client's request ID may be kept: short
+// printable ASCII, so it can be logged and forwarded as is
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
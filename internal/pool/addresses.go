@@ -0,0 +1,234 @@
+package pool
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// addressDecay weighs each outcome in an address's error rate
+	addressDecay = 0.1
+	// minAddressWeight keeps failing addresses probed occasionally
+	minAddressWeight = 0.05
+	// maxDialFailures consecutive failed dials eject an address
+	maxDialFailures = 3
+	addressEjection = 30 * time.Second
+	// addressExpiry forgets addresses no longer resolved
+	addressExpiry = 10 * time.Minute
+)
+
+// AddressStats is the health of one IP address a backend hostname resolves to
+type AddressStats struct {
+	Address   string  `json:"address"`
+	Backend   string  `json:"backend"`
+	ErrorRate float64 `json:"error_rate"`
+	Ejected   bool    `json:"ejected"`
+}
+
+// addressHealth tracks the IP addresses backend hostnames resolve to, so
+// connections prefer healthy ones over those refusing connections or failing
+// requests
+type addressHealth struct {
+	mu        sync.Mutex
+	addresses map[string]*addressState // by ip:port
+}
+
+type addressState struct {
+	backend      string
+	errorRate    float64
+	dialFailures int
+	ejectedUntil time.Time
+	seen         time.Time
+}
+
+// order returns the addresses of a resolved backend in the order to try them:
+// a random order weighted by health, with ejected addresses last
+func (h *addressHealth) order(backend string, ips []string, port string) []string {
+	addresses := make([]string, len(ips))
+	for i, ip := range ips {
+		addresses[i] = net.JoinHostPort(ip, port)
+	}
+	if len(addresses) < 2 {
+		return addresses
+	}
+
+	now := time.Now()
+	weights := make(map[string]float64, len(addresses))
+	h.mu.Lock()
+	if h.addresses == nil {
+		h.addresses = make(map[string]*addressState)
+	}
+	for address, s := range h.addresses {
+		if now.Sub(s.seen) > addressExpiry {
+			delete(h.addresses, address)
+		}
+	}
+	for _, address := range addresses {
+		s := h.addresses[address]
+		if s == nil {
+			s = &addressState{}
+			h.addresses[address] = s
+		}
+		s.backend, s.seen = backend, now
+		if now.Before(s.ejectedUntil) {
+			continue
+		}
+		weights[address] = max(minAddressWeight, 1-s.errorRate)
+	}
+	h.mu.Unlock()
+
+	ordered := make([]string, 0, len(addresses))
+	remaining := make([]string, 0, len(weights))
+	for _, address := range addresses {
+		if _, ok := weights[address]; ok {
+			remaining = append(remaining, address)
+		}
+	}
+	for len(remaining) > 0 {
+		total := 0.0
+		for _, address := range remaining {
+			total += weights[address]
+		}
+		pick, i := rand.Float64()*total, 0
+		for ; i < len(remaining)-1; i++ {
+			if pick -= weights[remaining[i]]; pick < 0 {
+				break
+			}
+		}
+		ordered = append(ordered, remaining[i])
+		remaining = append(remaining[:i], remaining[i+1:]...)
+	}
+	for _, address := range addresses {
+		if _, ok := weights[address]; !ok {
+			ordered = append(ordered, address)
+		}
+	}
+	return ordered
+}
+
+// recordDial records a connection attempt to an address
+func (h *addressHealth) recordDial(address string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.addresses[address]
+	if s == nil {
+		return
+	}
+	if err == nil {
+		s.dialFailures = 0
+		return
+	}
+	s.errorRate += addressDecay * (1 - s.errorRate)
+	if s.dialFailures++; s.dialFailures >= maxDialFailures {
+		s.ejectedUntil = time.Now().Add(addressEjection)
+	}
+}
+
+// recordResult records the outcome of a request served from an address;
+// addresses of backends given by IP are not tracked
+func (h *addressHealth) recordResult(address string, failed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.addresses[address]
+	if s == nil {
+		return
+	}
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	s.errorRate += addressDecay * (sample - s.errorRate)
+}
+
+// AddressStats returns the health of the addresses of backends whose
+// hostname resolves to more than one address
+func (p *ConnectionPool) AddressStats() []AddressStats {
+	now := time.Now()
+	p.addresses.mu.Lock()
+	stats := make([]AddressStats, 0, len(p.addresses.addresses))
+	for address, s := range p.addresses.addresses {
+		stats = append(stats, AddressStats{
+			Address:   address,
+			Backend:   s.backend,
+			ErrorRate: s.errorRate,
+			Ejected:   now.Before(s.ejectedUntil),
+		})
+	}
+	p.addresses.mu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Backend != stats[j].Backend {
+			return stats[i].Backend < stats[j].Backend
+		}
+		return stats[i].Address < stats[j].Address
+	})
+	return stats
+}
+
+// dialAddresses connects to the first address of a backend that accepts,
+// trying them in order of health
+func (p *ConnectionPool) dialAddresses(ctx context.Context, dial func(context.Context, string, string) (net.Conn, error), network, backend string, ips []string, port string) (net.Conn, error) {
+	var err error
+	for _, address := range p.addresses.order(backend, ips, port) {
+		var conn net.Conn
+		conn, err = dial(ctx, network, address)
+		p.addresses.recordDial(address, err)
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, err
+}
+
+// healthDialer resolves HTTP backends itself so their addresses are tried in
+// order of health
+func (p *ConnectionPool) healthDialer(dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil || net.ParseIP(host) != nil {
+			return dial(ctx, network, address)
+		}
+		// LookupIPAddr reports to the request's trace, as the dialer would
+		resolved, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		ips := make([]string, len(resolved))
+		for i, ip := range resolved {
+			ips[i] = ip.String()
+		}
+		return p.dialAddresses(ctx, dial, network, address, ips, port)
+	}
+}
+
+// recordUnary records the outcome of unary calls against the address served
+func (p *ConnectionPool) recordUnary(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	var served peer.Peer
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Peer(&served))...)
+	if served.Addr != nil {
+		p.addresses.recordResult(served.Addr.String(), addressFailed(err))
+	}
+	return err
+}
+
+// addressFailed reports whether a call error suggests the address serving it
+// is broken
+func addressFailed(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
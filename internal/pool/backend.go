@@ -0,0 +1,33 @@
+package pool
+
+import (
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// BackendOptions returns the dial options a configured backend asks for
+func BackendOptions(b config.Backend) Options {
+	opts := Options{
+		TLS:         b.TLS,
+		SkipVerify:  b.TLSSkipVerify,
+		ServerName:  b.TLSServerName,
+		Authority:   b.Host,
+		Proxy:       b.Proxy,
+		HTTPVersion: b.HTTPVersion,
+	}
+	if g := b.GRPC; g != nil {
+		// Validated with the configuration
+		opts.GRPC = GRPCOptions{
+			InitialWindowSize: g.InitialWindowSize,
+			MaxHeaderListSize: g.MaxHeaderListSize,
+			UserAgent:         g.UserAgent,
+		}
+		if g.KeepaliveTime != "" {
+			opts.GRPC.KeepaliveTime, _ = time.ParseDuration(g.KeepaliveTime)
+			opts.GRPC.NoKeepalive = opts.GRPC.KeepaliveTime == 0
+		}
+		opts.GRPC.KeepaliveTimeout, _ = time.ParseDuration(g.KeepaliveTimeout)
+	}
+	return opts
+}
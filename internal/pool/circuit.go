@@ -0,0 +1,150 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// dialCircuitFailures consecutive failed dials open an address's circuit
+	dialCircuitFailures = 5
+	// dialCircuitCooldown is how long an open circuit refuses dials before
+	// one is let through to probe the address
+	dialCircuitCooldown = 10 * time.Second
+)
+
+// ErrDialCircuitOpen is matched by the errors returned instead of dialing an
+// address whose recent dials all failed. Nothing was sent to the backend, so
+// callers can move on to another one.
+var ErrDialCircuitOpen = errors.New("dial circuit open")
+
+// dialCircuitError refuses a dial; to gRPC it is an unavailable backend
+type dialCircuitError struct {
+	address   string
+	remaining time.Duration
+}
+
+func (e *dialCircuitError) Error() string {
+	return fmt.Sprintf("not dialing %s for another %s after repeated dial failures", e.address, e.remaining.Round(time.Second))
+}
+
+func (e *dialCircuitError) Is(target error) bool {
+	return target == ErrDialCircuitOpen
+}
+
+func (e *dialCircuitError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+// dialCircuit stops dialing addresses that keep refusing or timing out
+// connections, so requests fail fast instead of each waiting out the dial
+type dialCircuit struct {
+	mu        sync.Mutex
+	addresses map[string]*circuitState // by host:port
+}
+
+type circuitState struct {
+	failures  int
+	openUntil time.Time
+}
+
+// refused returns an error while the circuit of address is open, without
+// letting a probing dial through
+func (c *dialCircuit) refused(address string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.addresses[address]
+	if s == nil || s.failures < dialCircuitFailures {
+		return nil
+	}
+	if remaining := time.Until(s.openUntil); remaining > 0 {
+		return &dialCircuitError{address: address, remaining: remaining}
+	}
+	return nil
+}
+
+// allow returns an error when dials to address are refused. Once the
+// cool-down passes one dial is let through; the others wait out another
+// cool-down unless it succeeds.
+func (c *dialCircuit) allow(address string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.addresses[address]
+	if s == nil || s.failures < dialCircuitFailures {
+		return nil
+	}
+	now := time.Now()
+	if now.Before(s.openUntil) {
+		return &dialCircuitError{address: address, remaining: s.openUntil.Sub(now)}
+	}
+	s.openUntil = now.Add(dialCircuitCooldown)
+	return nil
+}
+
+// record records the outcome of a dial; dials abandoned by their caller say
+// nothing about the address
+func (c *dialCircuit) record(ctx context.Context, address string, err error) {
+	if err != nil && (ctx.Err() != nil || errors.Is(err, ErrDialCircuitOpen)) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		if s := c.addresses[address]; s != nil && s.failures >= dialCircuitFailures {
+			log.Printf("Dialing %s again", address)
+		}
+		delete(c.addresses, address)
+		return
+	}
+	if c.addresses == nil {
+		c.addresses = make(map[string]*circuitState)
+	}
+	s := c.addresses[address]
+	if s == nil {
+		s = &circuitState{}
+		c.addresses[address] = s
+	}
+	if s.failures++; s.failures == dialCircuitFailures {
+		log.Printf("Not dialing %s for %s after %d failed dials: %v", address, dialCircuitCooldown, s.failures, err)
+	}
+	if s.failures >= dialCircuitFailures {
+		s.openUntil = time.Now().Add(dialCircuitCooldown)
+	}
+}
+
+// DialCircuits returns the addresses dials are currently refused to
+func (p *ConnectionPool) DialCircuits() []string {
+	now := time.Now()
+	p.circuit.mu.Lock()
+	var open []string
+	for address, s := range p.circuit.addresses {
+		if s.failures >= dialCircuitFailures && now.Before(s.openUntil) {
+			open = append(open, address)
+		}
+	}
+	p.circuit.mu.Unlock()
+	sort.Strings(open)
+	return open
+}
+
+// circuitDialer refuses dials to addresses whose circuit is open and records
+// the outcome of the others
+func (p *ConnectionPool) circuitDialer(dial func(context.Context, string, string) (net.Conn, error)) func(context.Context, string, string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if err := p.circuit.allow(address); err != nil {
+			return nil, err
+		}
+		conn, err := dial(ctx, network, address)
+		p.circuit.record(ctx, address, err)
+		return conn, err
+	}
+}
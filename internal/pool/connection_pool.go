@@ -4,6 +4,8 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,8 +19,77 @@ import (
 // ConnectionPool manages gRPC connections
 type ConnectionPool struct {
 	connections sync.Map // map[string]*grpc.ClientConn
+	transports  sync.Map // map[Options]*http.Transport
+	dials       sync.Map // map[string]WarmBackend, how each connection was dialed
+	dialed      connTracker
+	timings     dialRecorder
+	addresses   addressHealth
+	circuit     dialCircuit
 	mu          sync.RWMutex
 	maxMsgSize  int
+	flow        FlowControl
+}
+
+// FlowControl sets HTTP/2 windows and buffers for new connections; zero
+// fields keep the gRPC defaults
+type FlowControl struct {
+	StreamWindow int32
+	ConnWindow   int32
+	WriteBuffer  int
+	ReadBuffer   int
+}
+
+// Options configures how a backend is dialed
+type Options struct {
+	TLS        bool   `json:"tls,omitempty"`
+	SkipVerify bool   `json:"skip_verify,omitempty"`
+	ServerName string `json:"server_name,omitempty"` // TLS SNI and verification name
+	Authority  string `json:"authority,omitempty"`   // gRPC :authority / HTTP Host sent upstream
+	Proxy      string `json:"proxy,omitempty"`       // forward proxy URL (http:// or socks5://), with optional credentials
+	CertFile   string `json:"cert_file,omitempty"`   // client certificate presented to TLS backends
+	KeyFile    string `json:"key_file,omitempty"`
+
+	HTTPVersion string      `json:"http_version,omitempty"` // "1.1" or "2" pins the HTTP protocol; negotiated when empty
+	GRPC        GRPCOptions `json:"grpc"`
+}
+
+// GRPCOptions overrides the connection settings of a gRPC backend; zero
+// fields keep the pool's defaults
+type GRPCOptions struct {
+	KeepaliveTime     time.Duration `json:"keepalive_time,omitempty"`
+	KeepaliveTimeout  time.Duration `json:"keepalive_timeout,omitempty"`
+	NoKeepalive       bool          `json:"no_keepalive,omitempty"` // send no keepalive pings
+	InitialWindowSize int32         `json:"initial_window_size,omitempty"`
+	MaxHeaderListSize uint32        `json:"max_header_list_size,omitempty"`
+	UserAgent         string        `json:"user_agent,omitempty"`
+}
+
+// key identifies a connection to address dialed with these options
+func (o Options) key(address string) string {
+	if o == (Options{}) {
+		return address
+	}
+	return fmt.Sprintf("%s|%t|%t|%s|%s|%s|%s|%s|%s|%v", address, o.TLS, o.SkipVerify, o.ServerName, o.Authority, o.Proxy, o.CertFile, o.KeyFile, o.HTTPVersion, o.GRPC)
+}
+
+// tlsConfig returns the client TLS configuration for these options. The
+// client certificate is loaded at each handshake so rotated files are used by
+// new connections.
+func (o Options) tlsConfig() *tls.Config {
+	cfg := &tls.Config{
+		InsecureSkipVerify: o.SkipVerify,
+		ServerName:         o.ServerName,
+	}
+	if o.CertFile != "" {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			return &cert, nil
+		}
+	}
+	return cfg
 }
 
 // NewConnectionPool creates a new connection pool
@@ -28,56 +99,135 @@ func NewConnectionPool(maxMsgSize int) *ConnectionPool {
 	}
 }
 
+// SetFlowControl sets the flow control settings of connections created from
+// now on
+func (p *ConnectionPool) SetFlowControl(flow FlowControl) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flow = flow
+}
+
 // GetConnection gets or creates a gRPC connection
 func (p *ConnectionPool) GetConnection(ctx context.Context, address string, useTLS bool, skipVerify bool) (*grpc.ClientConn, error) {
+	return p.GetConnectionWithOptions(ctx, address, Options{TLS: useTLS, SkipVerify: skipVerify})
+}
+
+// GetConnectionWithOptions gets or creates a gRPC connection dialed with opts
+func (p *ConnectionPool) GetConnectionWithOptions(ctx context.Context, address string, opts Options) (*grpc.ClientConn, error) {
+	key := opts.key(address)
+
 	// Check if connection exists and is ready
-	if conn, ok := p.connections.Load(address); ok {
+	if conn, ok := p.connections.Load(key); ok {
 		clientConn := conn.(*grpc.ClientConn)
 		state := clientConn.GetState()
 
-		// Reuse if connection is ready or connecting
-		if state == connectivity.Ready || state == connectivity.Connecting || state == connectivity.Idle {
+		if state == connectivity.Ready {
+			return clientConn, nil
+		}
+		// Calls on a connection still trying to reach an address whose
+		// dials keep failing would wait out its reconnects
+		if err := p.circuit.refused(address); err != nil {
+			return nil, err
+		}
+
+		// Reuse if connection is connecting
+		if state == connectivity.Connecting || state == connectivity.Idle {
 			return clientConn, nil
 		}
 
 		// Close and remove stale connection
 		clientConn.Close()
-		p.connections.Delete(address)
+		p.connections.Delete(key)
 	}
 
 	// Create new connection
-	conn, err := p.createConnection(ctx, address, useTLS, skipVerify)
+	if err := p.circuit.refused(address); err != nil {
+		return nil, err
+	}
+	conn, err := p.createConnection(ctx, address, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	p.connections.Store(address, conn)
+	p.connections.Store(key, conn)
+	p.dials.Store(key, WarmBackend{Address: address, Options: opts})
 	return conn, nil
 }
 
 // createConnection creates a new gRPC connection
-func (p *ConnectionPool) createConnection(ctx context.Context, address string, useTLS bool, skipVerify bool) (*grpc.ClientConn, error) {
+func (p *ConnectionPool) createConnection(ctx context.Context, address string, options Options) (*grpc.ClientConn, error) {
 	opts := []grpc.DialOption{
 		grpc.WithDefaultCallOptions(
 			grpc.MaxCallRecvMsgSize(p.maxMsgSize),
 			grpc.MaxCallSendMsgSize(p.maxMsgSize),
 		),
-		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+		grpc.WithChainUnaryInterceptor(p.recordUnary),
+	}
+	if !options.GRPC.NoKeepalive {
+		params := keepalive.ClientParameters{
 			Time:                10 * time.Second,
 			Timeout:             3 * time.Second,
 			PermitWithoutStream: true,
-		}),
+		}
+		if options.GRPC.KeepaliveTime > 0 {
+			params.Time = options.GRPC.KeepaliveTime
+		}
+		if options.GRPC.KeepaliveTimeout > 0 {
+			params.Timeout = options.GRPC.KeepaliveTimeout
+		}
+		opts = append(opts, grpc.WithKeepaliveParams(params))
 	}
 
-	// Configure TLS
-	if useTLS {
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: skipVerify,
-		}
-		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	// Apply flow control settings
+	p.mu.RLock()
+	flow := p.flow
+	p.mu.RUnlock()
+	if options.GRPC.InitialWindowSize > 0 {
+		flow.StreamWindow = options.GRPC.InitialWindowSize
+	}
+	if flow.StreamWindow > 0 {
+		opts = append(opts, grpc.WithInitialWindowSize(flow.StreamWindow))
+	}
+	if flow.ConnWindow > 0 {
+		opts = append(opts, grpc.WithInitialConnWindowSize(flow.ConnWindow))
+	}
+	if flow.WriteBuffer > 0 {
+		opts = append(opts, grpc.WithWriteBufferSize(flow.WriteBuffer))
+	}
+	if flow.ReadBuffer > 0 {
+		opts = append(opts, grpc.WithReadBufferSize(flow.ReadBuffer))
+	}
+
+	// Configure TLS, timing the handshake
+	if options.TLS {
+		opts = append(opts, grpc.WithTransportCredentials(&timedCredentials{
+			TransportCredentials: credentials.NewTLS(options.tlsConfig()),
+			pool:                 p,
+			backend:              address,
+		}))
 	} else {
 		opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	}
+	if options.Authority != "" {
+		opts = append(opts, grpc.WithAuthority(options.Authority))
+	}
+	if options.GRPC.MaxHeaderListSize > 0 {
+		opts = append(opts, grpc.WithMaxHeaderListSize(options.GRPC.MaxHeaderListSize))
+	}
+	if options.GRPC.UserAgent != "" {
+		opts = append(opts, grpc.WithUserAgent(options.GRPC.UserAgent))
+	}
+
+	// Tunnel through a forward proxy
+	var proxy dialFunc
+	if options.Proxy != "" {
+		dial, err := proxyDialer(options.Proxy)
+		if err != nil {
+			return nil, err
+		}
+		proxy = dial
+	}
+	opts = append(opts, grpc.WithContextDialer(p.timedDialer(address, options.TLS, proxy)))
 
 	// Create connection with timeout
 	conn, err := grpc.DialContext(ctx, address, opts...)
@@ -88,6 +238,40 @@ func (p *ConnectionPool) createConnection(ctx context.Context, address string, u
 	return conn, nil
 }
 
+// HTTPClient returns a client for HTTP backends dialed with opts. Transports are
+// shared so keep-alive connections are reused across requests.
+func (p *ConnectionPool) HTTPClient(opts Options, timeout time.Duration) (*http.Client, error) {
+	transport, ok := p.transports.Load(opts)
+	if !ok {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = opts.tlsConfig()
+		t.DialContext = p.circuitDialer(p.healthDialer(t.DialContext))
+		pinHTTPVersion(t, opts.HTTPVersion)
+		if err := configureProxy(t, opts.Proxy); err != nil {
+			return nil, err
+		}
+		p.trackDials(t)
+		transport, _ = p.transports.LoadOrStore(opts, t)
+	}
+	return &http.Client{Transport: &timedTransport{Transport: transport.(*http.Transport), pool: p}, Timeout: timeout}, nil
+}
+
+// pinHTTPVersion restricts a transport to one HTTP version. HTTP/2 is spoken
+// over TLS to https backends and as h2c with prior knowledge to http ones.
+func pinHTTPVersion(t *http.Transport, version string) {
+	var protocols http.Protocols
+	switch version {
+	case "1.1":
+		protocols.SetHTTP1(true)
+	case "2":
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+	default:
+		return
+	}
+	t.Protocols = &protocols
+}
+
 // CloseAll closes all connections
 func (p *ConnectionPool) CloseAll() {
 	p.connections.Range(func(key, value interface{}) bool {
@@ -96,6 +280,11 @@ func (p *ConnectionPool) CloseAll() {
 		p.connections.Delete(key)
 		return true
 	})
+	p.transports.Range(func(key, value interface{}) bool {
+		value.(*http.Transport).CloseIdleConnections()
+		p.transports.Delete(key)
+		return true
+	})
 }
 
 // HealthCheck checks connection health
@@ -103,7 +292,7 @@ func (p *ConnectionPool) HealthCheck() map[string]string {
 	health := make(map[string]string)
 
 	p.connections.Range(func(key, value interface{}) bool {
-		address := key.(string)
+		address, _, _ := strings.Cut(key.(string), "|")
 		conn := value.(*grpc.ClientConn)
 		state := conn.GetState()
 		health[address] = state.String()
@@ -0,0 +1,119 @@
+package pool
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// connTracker records HTTP connections by the address they were dialed to
+type connTracker struct {
+	mu    sync.Mutex
+	conns map[string]map[*trackedConn]struct{}
+}
+
+// trackedConn removes itself from the tracker when closed
+type trackedConn struct {
+	net.Conn
+	tracker *connTracker
+	address string
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() { c.tracker.remove(c) })
+	return c.Conn.Close()
+}
+
+func (t *connTracker) add(address string, conn net.Conn) net.Conn {
+	tracked := &trackedConn{Conn: conn, tracker: t, address: address}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conns == nil {
+		t.conns = make(map[string]map[*trackedConn]struct{})
+	}
+	if t.conns[address] == nil {
+		t.conns[address] = make(map[*trackedConn]struct{})
+	}
+	t.conns[address][tracked] = struct{}{}
+	return tracked
+}
+
+func (t *connTracker) remove(c *trackedConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns[c.address], c)
+	if len(t.conns[c.address]) == 0 {
+		delete(t.conns, c.address)
+	}
+}
+
+// take removes and returns the connections dialed to address
+func (t *connTracker) take(address string) []*trackedConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var conns []*trackedConn
+	for c := range t.conns[address] {
+		conns = append(conns, c)
+	}
+	return conns
+}
+
+// trackDials wraps the transport dialer so connections can be evicted by
+// address. Connections through an HTTP proxy are recorded under the proxy.
+func (p *ConnectionPool) trackDials(t *http.Transport) {
+	dial := t.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	t.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return p.dialed.add(address, conn), nil
+	}
+}
+
+// Evict closes pooled gRPC connections and HTTP keep-alive connections to a
+// backend that no longer exists, so no further calls reach it. Address may be
+// host:port or an http(s) URL.
+func (p *ConnectionPool) Evict(address string) {
+	hostPort := address
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		hostPort = u.Host
+		if u.Port() == "" {
+			port := "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+			hostPort = net.JoinHostPort(u.Hostname(), port)
+		}
+	}
+
+	closed := 0
+	p.connections.Range(func(key, value interface{}) bool {
+		connAddress, _, _ := strings.Cut(key.(string), "|")
+		if connAddress == address || connAddress == hostPort {
+			value.(*grpc.ClientConn).Close()
+			p.connections.Delete(key)
+			closed++
+		}
+		return true
+	})
+	for _, conn := range p.dialed.take(hostPort) {
+		conn.Close()
+		closed++
+	}
+
+	if closed > 0 {
+		log.Printf("Evicted %d connections to removed backend %s", closed, address)
+	}
+}
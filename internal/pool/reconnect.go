@@ -0,0 +1,48 @@
+package pool
+
+import (
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// connectionLostMessages are fragments of the errors gRPC reports when a
+// connection goes away underneath a call
+var connectionLostMessages = []string{
+	"goaway",
+	"transport is closing",
+	"connection reset",
+	"rst_stream",
+	"broken pipe",
+	"error reading from server: eof",
+}
+
+// ConnectionLost reports whether a call failed because its connection went
+// away: the backend sent GOAWAY, as it does when shutting down, or the
+// connection was reset
+func ConnectionLost(err error) bool {
+	st, ok := status.FromError(err)
+	if !ok || (st.Code() != codes.Unavailable && st.Code() != codes.Internal) {
+		return false
+	}
+	msg := strings.ToLower(st.Message())
+	for _, fragment := range connectionLostMessages {
+		if strings.Contains(msg, fragment) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rotate closes the pooled connection to address dialed with opts, so the
+// next call dials a fresh one. Calls still running on the old connection
+// finish or fail on their own.
+func (p *ConnectionPool) Rotate(address string, opts Options) {
+	if conn, ok := p.connections.LoadAndDelete(opts.key(address)); ok {
+		log.Printf("Rotating connection to %s after it was lost", address)
+		conn.(*grpc.ClientConn).Close()
+	}
+}
@@ -0,0 +1,281 @@
+package pool
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/credentials"
+)
+
+// PhaseStats summarizes the durations of one connection setup phase
+type PhaseStats struct {
+	Count  int64   `json:"count"`
+	LastMs float64 `json:"last_ms"`
+	MeanMs float64 `json:"mean_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+func (s *PhaseStats) observe(d time.Duration) {
+	ms := float64(d) / float64(time.Millisecond)
+	s.Count++
+	s.LastMs = ms
+	s.MeanMs += (ms - s.MeanMs) / float64(s.Count)
+	if ms > s.MaxMs {
+		s.MaxMs = ms
+	}
+}
+
+// DialStats summarizes how long it takes to establish connections to a
+// backend, separating network time from application time
+type DialStats struct {
+	Connections  int64      `json:"connections"`
+	Failures     int64      `json:"failures"`
+	DNS          PhaseStats `json:"dns"`
+	Connect      PhaseStats `json:"connect"`
+	TLSHandshake PhaseStats `json:"tls_handshake"`
+}
+
+// dialTiming is the measured setup of a single connection; zero phases were
+// not performed
+type dialTiming struct {
+	dns, connect, handshake time.Duration
+	err                     error
+}
+
+// dialRecorder aggregates connection setup timings per backend
+type dialRecorder struct {
+	mu    sync.Mutex
+	stats map[string]*DialStats
+	debug bool
+}
+
+func (r *dialRecorder) record(backend string, t dialTiming) {
+	r.mu.Lock()
+	if r.stats == nil {
+		r.stats = make(map[string]*DialStats)
+	}
+	s := r.stats[backend]
+	if s == nil {
+		s = &DialStats{}
+		r.stats[backend] = s
+	}
+	if t.err != nil {
+		s.Failures++
+	} else {
+		s.Connections++
+	}
+	if t.dns > 0 {
+		s.DNS.observe(t.dns)
+	}
+	if t.connect > 0 {
+		s.Connect.observe(t.connect)
+	}
+	if t.handshake > 0 {
+		s.TLSHandshake.observe(t.handshake)
+	}
+	debug := r.debug
+	r.mu.Unlock()
+
+	if debug {
+		if t.err != nil {
+			log.Printf("Dial %s failed after dns=%s connect=%s tls=%s: %v", backend, t.dns, t.connect, t.handshake, t.err)
+		} else {
+			log.Printf("Dialed %s: dns=%s connect=%s tls=%s", backend, t.dns, t.connect, t.handshake)
+		}
+	}
+}
+
+// SetDebug enables logging the timing of every new connection
+func (p *ConnectionPool) SetDebug(enabled bool) {
+	p.timings.mu.Lock()
+	defer p.timings.mu.Unlock()
+	p.timings.debug = enabled
+}
+
+// DialStats returns connection setup statistics per backend address
+func (p *ConnectionPool) DialStats() map[string]DialStats {
+	p.timings.mu.Lock()
+	defer p.timings.mu.Unlock()
+
+	stats := make(map[string]DialStats, len(p.timings.stats))
+	for backend, s := range p.timings.stats {
+		stats[backend] = *s
+	}
+	return stats
+}
+
+// timedConn carries the measured setup of a gRPC connection from the dialer
+// to the TLS handshake
+type timedConn struct {
+	net.Conn
+	timing dialTiming
+}
+
+// timedDialer connects to a gRPC backend, recording DNS and TCP connect
+// durations. Without a proxy the backend is resolved here so the two can be
+// told apart; through a proxy the whole tunnel setup counts as connect time.
+// Secured connections are recorded by timedCredentials after the handshake.
+func (p *ConnectionPool) timedDialer(backend string, secure bool, proxy dialFunc) dialFunc {
+	return func(ctx context.Context, address string) (net.Conn, error) {
+		if err := p.circuit.allow(address); err != nil {
+			return nil, err
+		}
+		var timing dialTiming
+		conn, err := p.dialTimed(ctx, address, proxy, &timing)
+		p.circuit.record(ctx, address, err)
+		if err != nil {
+			timing.err = err
+			p.timings.record(backend, timing)
+			return nil, err
+		}
+		if !secure {
+			p.timings.record(backend, timing)
+			return conn, nil
+		}
+		return &timedConn{Conn: conn, timing: timing}, nil
+	}
+}
+
+func (p *ConnectionPool) dialTimed(ctx context.Context, address string, proxy dialFunc, timing *dialTiming) (net.Conn, error) {
+	if proxy != nil {
+		start := time.Now()
+		conn, err := proxy(ctx, address)
+		timing.connect = time.Since(start)
+		return conn, err
+	}
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	ips, err := net.DefaultResolver.LookupHost(ctx, host)
+	timing.dns = time.Since(start)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	start = time.Now()
+	defer func() { timing.connect = time.Since(start) }()
+	return p.dialAddresses(ctx, d.DialContext, "tcp", address, ips, port)
+}
+
+// timedCredentials records the TLS handshake of connections from timedDialer
+type timedCredentials struct {
+	credentials.TransportCredentials
+	pool    *ConnectionPool
+	backend string
+}
+
+func (c *timedCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	var timing dialTiming
+	if tc, ok := conn.(*timedConn); ok {
+		timing = tc.timing
+		conn = tc.Conn
+	}
+
+	start := time.Now()
+	secure, info, err := c.TransportCredentials.ClientHandshake(ctx, authority, conn)
+	timing.handshake = time.Since(start)
+	timing.err = err
+	c.pool.timings.record(c.backend, timing)
+	return secure, info, err
+}
+
+func (c *timedCredentials) Clone() credentials.TransportCredentials {
+	return &timedCredentials{
+		TransportCredentials: c.TransportCredentials.Clone(),
+		pool:                 c.pool,
+		backend:              c.backend,
+	}
+}
+
+// timedTransport traces HTTP requests and records the setup of every new
+// connection they open
+type timedTransport struct {
+	*http.Transport
+	pool *ConnectionPool
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var (
+		timing                                 dialTiming
+		dnsStart, connectStart, handshakeStart time.Time
+		served                                 net.Addr
+		mu                                     sync.Mutex
+	)
+	backend := req.URL.Host
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			served = info.Conn.RemoteAddr()
+			mu.Unlock()
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			mu.Lock()
+			dnsStart = time.Now()
+			mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			mu.Lock()
+			timing.dns = time.Since(dnsStart)
+			timing.err = info.Err
+			mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			mu.Lock()
+			connectStart = time.Now()
+			mu.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			mu.Lock()
+			timing.connect = time.Since(connectStart)
+			if err != nil {
+				timing.err = err
+			}
+			mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			mu.Lock()
+			handshakeStart = time.Now()
+			mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			mu.Lock()
+			timing.handshake = time.Since(handshakeStart)
+			if err != nil {
+				timing.err = err
+			}
+			mu.Unlock()
+		},
+	}
+
+	resp, err := t.Transport.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+
+	// Reused connections report no setup phases
+	mu.Lock()
+	defer mu.Unlock()
+	if !connectStart.IsZero() || !dnsStart.IsZero() {
+		t.pool.timings.record(backend, timing)
+	}
+	if served != nil {
+		failed := err != nil
+		if resp != nil {
+			switch resp.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				failed = true
+			}
+		}
+		t.pool.addresses.recordResult(served.String(), failed)
+	}
+	return resp, err
+}
@@ -0,0 +1,113 @@
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// WarmBackend is a pooled backend connection remembered across restarts
+type WarmBackend struct {
+	Address string  `json:"address"`
+	Options Options `json:"options"`
+	Healthy bool    `json:"healthy"` // ready or idle when saved
+}
+
+// warmState is the file written by SaveWarmState
+type warmState struct {
+	SavedAt  time.Time     `json:"saved_at"`
+	Backends []WarmBackend `json:"backends"`
+}
+
+// Snapshot lists the pooled gRPC connections and their last-known health
+func (p *ConnectionPool) Snapshot() []WarmBackend {
+	var backends []WarmBackend
+	p.connections.Range(func(key, value interface{}) bool {
+		dial, ok := p.dials.Load(key)
+		if !ok {
+			return true
+		}
+		backend := dial.(WarmBackend)
+		state := value.(*grpc.ClientConn).GetState()
+		backend.Healthy = state == connectivity.Ready || state == connectivity.Idle
+		backends = append(backends, backend)
+		return true
+	})
+	return backends
+}
+
+// SaveWarmState writes the snapshot to path, replacing it atomically
+func (p *ConnectionPool) SaveWarmState(path string) error {
+	data, err := json.MarshalIndent(warmState{SavedAt: time.Now(), Backends: p.Snapshot()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".warm-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Warm connects to the backends that were healthy when path was saved and
+// returns their addresses. A missing file is a cold start, not an error.
+func (p *ConnectionPool) Warm(ctx context.Context, path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var state warmState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid warm state %s: %w", path, err)
+	}
+
+	var warmed []string
+	for _, b := range state.Backends {
+		if !b.Healthy {
+			continue
+		}
+		conn, err := p.GetConnectionWithOptions(ctx, b.Address, b.Options)
+		if err != nil {
+			log.Printf("Failed to warm connection to %s: %v", b.Address, err)
+			continue
+		}
+		conn.Connect()
+		warmed = append(warmed, b.Address)
+	}
+	return warmed, nil
+}
+
+// PersistWarmState saves the warm state every interval until ctx is done
+func (p *ConnectionPool) PersistWarmState(ctx context.Context, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := p.SaveWarmState(path); err != nil {
+				log.Printf("Failed to save warm state: %v", err)
+			}
+		}
+	}
+}
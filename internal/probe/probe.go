@@ -0,0 +1,261 @@
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/metrics"
+)
+
+// Header marks synthetic requests so they can be told apart from real traffic
+const Header = "X-Synthetic-Probe"
+
+var (
+	probeRuns = metrics.NewCounterVec("gateway_probe_runs_total",
+		"Synthetic probe runs, by outcome",
+		"probe", "result")
+	probeDuration = metrics.NewHistogramVec("gateway_probe_duration_seconds",
+		"Time to serve synthetic probe requests",
+		metrics.DefaultBuckets, "probe")
+	probeAlerting = metrics.NewGaugeVec("gateway_probe_alerting",
+		"Synthetic probes whose alert is firing",
+		"probe")
+)
+
+type syntheticKey struct{}
+
+// Synthetic reports whether ctx belongs to a probe request. Unlike Header,
+// clients cannot set it, so probes are exempt from rate limits and budgets.
+func Synthetic(ctx context.Context) bool {
+	return ctx.Value(syntheticKey{}) != nil
+}
+
+// Result is the running state of a single probe check
+type Result struct {
+	Name                string    `json:"name"`
+	Total               int64     `json:"total"`
+	Successes           int64     `json:"successes"`
+	Failures            int64     `json:"failures"`
+	SuccessRatio        float64   `json:"success_ratio"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Alerting            bool      `json:"alerting"`
+	LastStatus          int       `json:"last_status"`
+	LastLatencyMs       float64   `json:"last_latency_ms"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastRun             time.Time `json:"last_run"`
+}
+
+// Prober periodically exercises routes through the gateway's own handler
+// chain, following the probes of the current configuration
+type Prober struct {
+	current func() *config.Config
+	handler http.Handler
+	client  *http.Client
+
+	mu      sync.RWMutex
+	cfg     *config.Probes // probes of the last run, nil when none are configured
+	results map[string]*Result
+}
+
+// New creates a prober sending synthetic requests to handler for the probes
+// of the configuration returned by current
+func New(current func() *config.Config, handler http.Handler) *Prober {
+	return &Prober{
+		current: current,
+		handler: handler,
+		results: make(map[string]*Result),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run probes every check each interval until ctx is cancelled. The checks
+// of a round run concurrently; configuration changes apply from the next
+// round.
+func (p *Prober) Run(ctx context.Context) {
+	interval := time.Minute
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if cfg := p.sync(); cfg != nil {
+			if d, _ := time.ParseDuration(cfg.Interval); d > 0 && d != interval {
+				interval = d
+				ticker.Reset(interval)
+			}
+			var wg sync.WaitGroup
+			for _, check := range cfg.Checks {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					p.probe(ctx, cfg, check)
+				}()
+			}
+			wg.Wait()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync adopts the probes of the current configuration, keeping the results
+// of checks that remain
+func (p *Prober) sync() *config.Probes {
+	cfg := p.current().Probes
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cfg = cfg
+	keep := make(map[string]bool)
+	if cfg != nil {
+		for _, check := range cfg.Checks {
+			keep[check.Name] = true
+			if p.results[check.Name] == nil {
+				p.results[check.Name] = &Result{Name: check.Name}
+			}
+		}
+	}
+	for name, result := range p.results {
+		if !keep[name] {
+			if result.Alerting {
+				probeAlerting.With(name).Dec()
+			}
+			delete(p.results, name)
+		}
+	}
+	return cfg
+}
+
+// probe executes one check and records its outcome
+func (p *Prober) probe(ctx context.Context, cfg *config.Probes, check config.ProbeCheck) {
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, syntheticKey{}, true), 30*time.Second)
+	defer cancel()
+
+	req := httptest.NewRequest(check.Method, check.Path, strings.NewReader(check.Body)).WithContext(ctx)
+	req.RemoteAddr = "127.0.0.1:0"
+	for key, value := range check.Headers {
+		req.Header.Set(key, value)
+	}
+	req.Header.Set(Header, check.Name)
+
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	p.handler.ServeHTTP(recorder, req)
+	latency := time.Since(start)
+
+	// Compare against expectations
+	var failure string
+	if recorder.Code != check.ExpectStatus {
+		failure = fmt.Sprintf("expected status %d, got %d", check.ExpectStatus, recorder.Code)
+	} else if check.MaxLatency != "" {
+		maxLatency, _ := time.ParseDuration(check.MaxLatency)
+		if latency > maxLatency {
+			failure = fmt.Sprintf("latency %s exceeded %s", latency, maxLatency)
+		}
+	}
+
+	probeDuration.With(check.Name).Observe(latency.Seconds())
+	outcome := "success"
+	if failure != "" {
+		outcome = "failure"
+	}
+	probeRuns.With(check.Name, outcome).Inc()
+	p.record(cfg, check.Name, recorder.Code, latency, failure)
+}
+
+// record updates a check's result and raises or clears its alert
+func (p *Prober) record(cfg *config.Probes, name string, status int, latency time.Duration, failure string) {
+	p.mu.Lock()
+	result := p.results[name]
+	if result == nil {
+		// Removed by a newer configuration while running
+		p.mu.Unlock()
+		return
+	}
+	result.Total++
+	result.LastStatus = status
+	result.LastLatencyMs = float64(latency.Microseconds()) / 1000
+	result.LastError = failure
+	result.LastRun = time.Now()
+
+	var transition string
+	if failure == "" {
+		result.Successes++
+		result.ConsecutiveFailures = 0
+		if result.Alerting {
+			result.Alerting = false
+			transition = "resolved"
+			probeAlerting.With(name).Dec()
+		}
+	} else {
+		result.Failures++
+		result.ConsecutiveFailures++
+		if !result.Alerting && result.ConsecutiveFailures >= cfg.AlertAfter {
+			result.Alerting = true
+			transition = "firing"
+			probeAlerting.With(name).Inc()
+		}
+	}
+	result.SuccessRatio = float64(result.Successes) / float64(result.Total)
+	snapshot := *result
+	p.mu.Unlock()
+
+	if transition != "" {
+		p.alert(cfg, transition, snapshot)
+	}
+}
+
+// alert logs an alert transition and notifies the webhook if configured
+func (p *Prober) alert(cfg *config.Probes, state string, result Result) {
+	log.Printf("Probe %s alert %s: %s", result.Name, state, result.LastError)
+	if cfg.AlertWebhook == "" {
+		return
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"state":  state,
+		"probe":  result,
+		"sentAt": time.Now(),
+	})
+	resp, err := p.client.Post(cfg.AlertWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to send probe alert: %v", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+// Results returns a snapshot of every check's result
+func (p *Prober) Results() []Result {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := make([]Result, 0, len(p.results))
+	if p.cfg == nil {
+		return results
+	}
+	for _, check := range p.cfg.Checks {
+		if result := p.results[check.Name]; result != nil {
+			results = append(results, *result)
+		}
+	}
+	return results
+}
+
+// Handler serves probe results as JSON
+func (p *Prober) Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.Results())
+}
@@ -0,0 +1,172 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Mask replaces redacted values
+const Mask = "[REDACTED]"
+
+// Redactor masks configured field names and JSONPath locations in structured data
+type Redactor struct {
+	fields map[string]bool
+	paths  [][]string
+}
+
+// New creates a redactor for field names (case-insensitive, any depth) and
+// JSONPath expressions such as $.user.ssn or $.cards[*].number
+func New(fields []string, paths []string) (*Redactor, error) {
+	r := &Redactor{fields: make(map[string]bool, len(fields))}
+	for _, f := range fields {
+		r.fields[strings.ToLower(f)] = true
+	}
+	for _, p := range paths {
+		segments, err := ParsePath(p)
+		if err != nil {
+			return nil, err
+		}
+		r.paths = append(r.paths, segments)
+	}
+	return r, nil
+}
+
+// Merge returns a redactor applying the rules of both r and other
+func (r *Redactor) Merge(other *Redactor) *Redactor {
+	merged := &Redactor{fields: make(map[string]bool)}
+	for _, src := range []*Redactor{r, other} {
+		if src == nil {
+			continue
+		}
+		for f := range src.fields {
+			merged.fields[f] = true
+		}
+		merged.paths = append(merged.paths, src.paths...)
+	}
+	return merged
+}
+
+// Field reports whether a field name must be redacted
+func (r *Redactor) Field(name string) bool {
+	return r != nil && r.fields[strings.ToLower(name)]
+}
+
+// Value returns value, or the mask when field is redacted
+func (r *Redactor) Value(field, value string) string {
+	if r.Field(field) && value != "" {
+		return Mask
+	}
+	return value
+}
+
+// JSON masks redacted fields of a JSON document; non-JSON input is returned unchanged
+func (r *Redactor) JSON(body []byte) []byte {
+	if r == nil || (len(r.fields) == 0 && len(r.paths) == 0) || len(body) == 0 {
+		return body
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return body
+	}
+
+	doc = r.walk(doc)
+	for _, path := range r.paths {
+		doc = maskPath(doc, path)
+	}
+
+	redacted, err := json.Marshal(doc)
+	if err != nil {
+		return body
+	}
+	return redacted
+}
+
+func (r *Redactor) walk(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if r.Field(key) {
+				val[key] = Mask
+			} else {
+				val[key] = r.walk(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.walk(child)
+		}
+	}
+	return v
+}
+
+// ParsePath splits a JSONPath expression into segments; "*" matches any key or index
+func ParsePath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid JSONPath %q: must start with $", path)
+	}
+
+	rest := strings.ReplaceAll(path[1:], "[", ".[")
+	var segments []string
+	for _, part := range strings.Split(rest, ".") {
+		if part == "" {
+			continue
+		}
+		if strings.HasPrefix(part, "[") {
+			if !strings.HasSuffix(part, "]") {
+				return nil, fmt.Errorf("invalid JSONPath %q: unterminated index", path)
+			}
+			part = strings.Trim(part[1:len(part)-1], `'"`)
+		}
+		segments = append(segments, part)
+	}
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("invalid JSONPath %q: no fields selected", path)
+	}
+	return segments, nil
+}
+
+// maskPath replaces every value matched by path with the mask
+func maskPath(v interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return Mask
+	}
+
+	segment, rest := path[0], path[1:]
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if segment == "*" || segment == key {
+				val[key] = maskPath(child, rest)
+			}
+		}
+	case []interface{}:
+		for i, child := range val {
+			if segment == "*" || segment == strconv.Itoa(i) {
+				val[i] = maskPath(child, rest)
+			}
+		}
+	}
+	return v
+}
+
+// defaultRedactor holds the process-wide rules applied wherever bodies are logged
+var defaultRedactor atomic.Pointer[Redactor]
+
+// SetDefault installs the process-wide redaction rules
+func SetDefault(r *Redactor) {
+	defaultRedactor.Store(r)
+}
+
+// Default returns the process-wide redactor, which may be nil
+func Default() *Redactor {
+	return defaultRedactor.Load()
+}
+
+// Body redacts a body with the process-wide rules before it is logged or returned
+func Body(body []byte) []byte {
+	return Default().JSON(body)
+}
@@ -0,0 +1,35 @@
+package requestinfo
+
+import (
+	"context"
+	"net/http"
+)
+
+type infoKey struct{}
+
+// Info carries routing decisions made for a request so that middleware
+// wrapping the router can observe them
+type Info struct {
+	Route     string
+	Backend   string
+	Consumer  string
+	RequestID string
+
+	// AccessLogRate is the access-log sampling rate of the matched route
+	AccessLogRate *float64
+}
+
+// From returns the request info attached to ctx, or nil
+func From(ctx context.Context) *Info {
+	info, _ := ctx.Value(infoKey{}).(*Info)
+	return info
+}
+
+// Ensure returns the request with request info attached, creating it if needed
+func Ensure(r *http.Request) (*http.Request, *Info) {
+	if info := From(r.Context()); info != nil {
+		return r, info
+	}
+	info := &Info{}
+	return r.WithContext(context.WithValue(r.Context(), infoKey{}, info)), info
+}
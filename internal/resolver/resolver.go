@@ -0,0 +1,223 @@
+// Package resolver re-resolves backends declared by DNS name so scaling
+// behind the name is picked up without a restart.
+package resolver
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Scheme prefixes backends resolved from A and AAAA records, as in
+	// dns:///orders.internal:8080
+	Scheme = "dns:///"
+	// SRVScheme prefixes backends expanded from SRV records, as in
+	// dns+srv:///_http._tcp.orders.internal
+	SRVScheme = "dns+srv:///"
+
+	// DefaultInterval is how often names are resolved again by default
+	DefaultInterval = 30 * time.Second
+
+	lookupTimeout = 5 * time.Second
+)
+
+// IsTarget reports whether a backend address is a DNS name to resolve
+func IsTarget(address string) bool {
+	return strings.HasPrefix(address, Scheme) || strings.HasPrefix(address, SRVScheme)
+}
+
+// Host returns the DNS name an A/AAAA target resolves, which backends
+// reached by IP address still expect as Host and TLS server name
+func Host(address string) string {
+	if rest, ok := strings.CutPrefix(address, Scheme); ok {
+		host, _, _ := net.SplitHostPort(rest)
+		return host
+	}
+	return ""
+}
+
+// Resolver periodically resolves the names backends declare
+type Resolver struct {
+	onChange func()
+	lookup   *net.Resolver
+
+	interval time.Duration
+	names    map[string]*name // by backend address
+	mu       sync.Mutex
+}
+
+// name is a watched backend address and its last resolution
+type name struct {
+	address   string
+	cancel    context.CancelFunc
+	addresses []string
+	lastErr   string
+}
+
+// New creates a resolver; onChange is called whenever a name resolves to
+// different addresses
+func New(onChange func()) *Resolver {
+	return &Resolver{onChange: onChange, lookup: net.DefaultResolver, interval: DefaultInterval, names: make(map[string]*name)}
+}
+
+// Watch resolves the names backends declare every interval, stopping those no
+// longer declared. Names new to the resolver are resolved before it returns.
+func (r *Resolver) Watch(addresses []string, interval time.Duration) error {
+	for _, address := range addresses {
+		if err := validate(address); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	if interval > 0 {
+		r.interval = interval
+	}
+	for address, n := range r.names {
+		if !slices.Contains(addresses, address) {
+			n.cancel()
+			delete(r.names, address)
+		}
+	}
+	var added []*name
+	var contexts []context.Context
+	for _, address := range addresses {
+		if _, ok := r.names[address]; ok {
+			continue
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		n := &name{address: address, cancel: cancel}
+		r.names[address] = n
+		added = append(added, n)
+		contexts = append(contexts, ctx)
+	}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i, n := range added {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.refresh(contexts[i], n)
+		}()
+	}
+	wg.Wait()
+
+	for i, n := range added {
+		go r.run(contexts[i], n)
+	}
+	return nil
+}
+
+// Resolve returns the host:port pairs a backend address last resolved to
+func (r *Resolver) Resolve(address string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n := r.names[address]; n != nil {
+		return n.addresses
+	}
+	return nil
+}
+
+// run resolves a name every interval until ctx is cancelled
+func (r *Resolver) run(ctx context.Context, n *name) {
+	for {
+		r.mu.Lock()
+		interval := r.interval
+		r.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+		if r.refresh(ctx, n) {
+			r.onChange()
+		}
+	}
+}
+
+// refresh resolves a name and reports whether its addresses changed. Failed
+// lookups keep the previous addresses, so a DNS outage does not empty a
+// backend pool, and are logged once until they recover.
+func (r *Resolver) refresh(ctx context.Context, n *name) bool {
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+
+	addresses, err := r.resolve(ctx, n.address)
+	if ctx.Err() != nil && err != nil {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if err.Error() != n.lastErr {
+			log.Printf("Failed to resolve backend %s: %v", n.address, err)
+		}
+		n.lastErr = err.Error()
+		return false
+	}
+	n.lastErr = ""
+	if reflect.DeepEqual(addresses, n.addresses) {
+		return false
+	}
+	n.addresses = addresses
+	return true
+}
+
+// resolve looks up the addresses of a backend address, sorted. SRV records
+// of the lowest priority are used, as clients are meant to try them first.
+func (r *Resolver) resolve(ctx context.Context, address string) ([]string, error) {
+	if rest, ok := strings.CutPrefix(address, SRVScheme); ok {
+		_, records, err := r.lookup.LookupSRV(ctx, "", "", rest)
+		if err != nil {
+			return nil, err
+		}
+		var addresses []string
+		for _, srv := range records {
+			if srv.Priority != records[0].Priority {
+				continue
+			}
+			target := strings.TrimSuffix(srv.Target, ".")
+			addresses = append(addresses, net.JoinHostPort(target, strconv.Itoa(int(srv.Port))))
+		}
+		slices.Sort(addresses)
+		return addresses, nil
+	}
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(address, Scheme))
+	ips, err := r.lookup.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addresses := make([]string, len(ips))
+	for i, ip := range ips {
+		addresses[i] = net.JoinHostPort(ip, port)
+	}
+	slices.Sort(addresses)
+	return addresses, nil
+}
+
+// validate checks the syntax of a backend address
+func validate(address string) error {
+	if rest, ok := strings.CutPrefix(address, SRVScheme); ok {
+		if rest == "" {
+			return fmt.Errorf("invalid dns backend %q: want %s_service._proto.name", address, SRVScheme)
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(strings.TrimPrefix(address, Scheme))
+	if err != nil || host == "" || port == "" {
+		return fmt.Errorf("invalid dns backend %q: want %shost:port", address, Scheme)
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package rollout
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// ErrCanaryInProgress is returned when a config is applied during another canary
+var ErrCanaryInProgress = errors.New("a config canary is already in progress")
+
+// Switcher serves requests through the active routing handler and swaps in new
+// handlers, optionally after a canary probation period
+type Switcher struct {
+	active atomic.Value // http.Handler
+	canary atomic.Pointer[canary]
+	mu     sync.Mutex // serializes starting and finishing canaries
+}
+
+// canary is a candidate handler receiving a share of traffic on probation
+type canary struct {
+	handler   http.Handler
+	policy    *config.ConfigCanary
+	baseline  outcomes
+	candidate outcomes
+	done      chan struct{}
+}
+
+// outcomes counts requests and server errors
+type outcomes struct {
+	total  atomic.Int64
+	errors atomic.Int64
+}
+
+func (o *outcomes) rate() (float64, int64) {
+	total := o.total.Load()
+	if total == 0 {
+		return 0, 0
+	}
+	return float64(o.errors.Load()) / float64(total), total
+}
+
+// NewSwitcher creates a switcher serving handler
+func NewSwitcher(handler http.Handler) *Switcher {
+	s := &Switcher{}
+	s.active.Store(handler)
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Switcher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c := s.canary.Load()
+	active := s.active.Load().(http.Handler)
+	if c == nil {
+		active.ServeHTTP(w, r)
+		return
+	}
+
+	// Split traffic between the active and candidate handlers
+	handler, counts := active, &c.baseline
+	if rand.Float64()*100 < c.policy.Percent {
+		handler, counts = c.handler, &c.candidate
+	}
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	handler.ServeHTTP(sw, r)
+
+	counts.total.Add(1)
+	if sw.status >= http.StatusInternalServerError {
+		counts.errors.Add(1)
+	}
+}
+
+// Apply switches to handler; with a canary policy the handler first receives a
+// share of traffic and is rolled back if its error rate spikes, or if it has
+// not served enough requests to be judged by the end of its probation. The
+// returned channel receives nil on promotion or the rollback reason. Nothing
+// is applied while a canary is in progress, as its promotion would replace
+// the handler.
+func (s *Switcher) Apply(handler http.Handler, policy *config.ConfigCanary) (<-chan error, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.canary.Load() != nil {
+		return nil, ErrCanaryInProgress
+	}
+
+	result := make(chan error, 1)
+	if policy == nil || policy.Percent <= 0 {
+		s.active.Store(handler)
+		result <- nil
+		return result, nil
+	}
+
+	c := &canary{handler: handler, policy: policy, done: make(chan struct{})}
+	s.canary.Store(c)
+	go s.watch(c, result)
+
+	log.Printf("Config canary started: %.1f%% of traffic for %s", policy.Percent, policy.Probation)
+	return result, nil
+}
+
+// Abort rolls back an in-progress canary
+func (s *Switcher) Abort() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.canary.Load()
+	if c == nil {
+		return false
+	}
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	return true
+}
+
+// watch evaluates a canary until it is promoted or rolled back
+func (s *Switcher) watch(c *canary, result chan<- error) {
+	probation, _ := time.ParseDuration(c.policy.Probation)
+	deadline := time.NewTimer(probation)
+	defer deadline.Stop()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	finish := func(err error) {
+		s.mu.Lock()
+		if err == nil {
+			s.active.Store(c.handler)
+		}
+		s.canary.Store(nil)
+		s.mu.Unlock()
+
+		if err == nil {
+			log.Printf("Config canary promoted")
+		} else {
+			log.Printf("Config canary rolled back: %v", err)
+		}
+		result <- err
+	}
+
+	for {
+		select {
+		case <-c.done:
+			finish(errors.New("aborted"))
+			return
+		case <-ticker.C:
+			if err := c.evaluate(); err != nil {
+				finish(err)
+				return
+			}
+		case <-deadline.C:
+			err := c.evaluate()
+			if _, total := c.candidate.rate(); err == nil && total < int64(c.policy.MinRequests) {
+				err = fmt.Errorf("candidate served %d of the %d requests needed to judge it", total, c.policy.MinRequests)
+			}
+			finish(err)
+			return
+		}
+	}
+}
+
+// evaluate returns an error if the candidate's error rate spiked past the baseline
+func (c *canary) evaluate() error {
+	candidateRate, candidateTotal := c.candidate.rate()
+	if candidateTotal < int64(c.policy.MinRequests) {
+		return nil
+	}
+	baselineRate, _ := c.baseline.rate()
+	if candidateRate > baselineRate+c.policy.MaxErrorRateIncrease {
+		return &SpikeError{Candidate: candidateRate, Baseline: baselineRate}
+	}
+	return nil
+}
+
+// SpikeError reports a canary error rate exceeding the baseline tolerance
+type SpikeError struct {
+	Candidate float64
+	Baseline  float64
+}
+
+func (e *SpikeError) Error() string {
+	return fmt.Sprintf("candidate error rate %.2f%% exceeded baseline %.2f%%", e.Candidate*100, e.Baseline*100)
+}
+
+// statusWriter captures the response status
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	if !sw.wroteHeader {
+		sw.wroteHeader = true
+		sw.status = code
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
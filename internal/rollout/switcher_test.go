@@ -0,0 +1,108 @@
+package rollout
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// named answers with its name in a header
+func named(name string, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Handler", name)
+		w.WriteHeader(status)
+	})
+}
+
+func serve(s *Switcher) string {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w.Header().Get("X-Handler")
+}
+
+func TestApplyWithoutCanary(t *testing.T) {
+	s := NewSwitcher(named("old", http.StatusOK))
+	result, err := s.Apply(named("new", http.StatusOK), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("result = %v", err)
+	}
+	if got := serve(s); got != "new" {
+		t.Errorf("served by %s, want new", got)
+	}
+}
+
+func TestCanary(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int // of the candidate
+		requests int // served during probation
+		wantErr  bool
+		want     string // serving afterwards
+	}{
+		{name: "promoted", status: http.StatusOK, requests: 20, want: "new"},
+		{name: "error spike", status: http.StatusInternalServerError, requests: 20, wantErr: true, want: "old"},
+		{name: "unexercised", status: http.StatusOK, requests: 2, wantErr: true, want: "old"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSwitcher(named("old", http.StatusOK))
+			policy := &config.ConfigCanary{Percent: 100, Probation: "200ms", MaxErrorRateIncrease: 0.05, MinRequests: 10}
+			result, err := s.Apply(named("new", tt.status), policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range tt.requests {
+				serve(s)
+			}
+
+			select {
+			case err := <-result:
+				if (err != nil) != tt.wantErr {
+					t.Errorf("result = %v, want error %v", err, tt.wantErr)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("canary not finished")
+			}
+			if got := serve(s); got != tt.want {
+				t.Errorf("served by %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyDuringCanary(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *config.ConfigCanary
+	}{
+		{name: "canary", policy: &config.ConfigCanary{Percent: 10, Probation: "1m"}},
+		{name: "direct", policy: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSwitcher(named("old", http.StatusOK))
+			result, err := s.Apply(named("candidate", http.StatusOK), &config.ConfigCanary{Percent: 100, Probation: "1m"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Apply(named("other", http.StatusOK), tt.policy); !errors.Is(err, ErrCanaryInProgress) {
+				t.Errorf("Apply during a canary err = %v, want ErrCanaryInProgress", err)
+			}
+
+			s.Abort()
+			if err := <-result; err == nil {
+				t.Error("aborted canary promoted")
+			}
+			if got := serve(s); got != "old" {
+				t.Errorf("served by %s after the abort, want old", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package router
+
+import (
+	"net/http"
+	"os"
+
+	"dynamic-gateway/internal/config"
+)
+
+// applyAuth rewrites the inbound Authorization header according to the route's mode
+func applyAuth(r *http.Request, auth *config.AuthPassthrough) *http.Request {
+	if auth == nil || auth.Mode == "" || auth.Mode == "passthrough" {
+		return r
+	}
+
+	value := r.Header.Get("Authorization")
+	r = r.Clone(r.Context())
+	r.Header.Del("Authorization")
+
+	switch auth.Mode {
+	case "replace":
+		credential := auth.Credential
+		if credential == "" {
+			credential = os.Getenv(auth.CredentialEnv)
+		}
+		if credential != "" {
+			r.Header.Set("Authorization", credential)
+		}
+	case "move":
+		// A client-sent destination header must not pass for the moved credential
+		r.Header.Del(auth.Header)
+		if value != "" {
+			r.Header.Set(auth.Header, value)
+		}
+	}
+	return r
+}
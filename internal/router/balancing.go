@@ -0,0 +1,29 @@
+package router
+
+import (
+	"dynamic-gateway/internal/balancer"
+)
+
+// beginRequest starts load tracking for balancers that account for in-flight requests
+func beginRequest(b balancer.Balancer, backend string) (done func()) {
+	if t, ok := b.(balancer.LoadTracker); ok {
+		return t.Begin(backend)
+	}
+	return func() {}
+}
+
+// recordFailure reports a failed request to balancers that learn from failures
+func recordFailure(b balancer.Balancer, backend string) {
+	if t, ok := b.(balancer.FailureTracker); ok {
+		t.Failed(backend)
+	}
+}
+
+// keyed binds balancers that pick backends by key, such as consistent hashing,
+// to a request's key; requests without one are balanced as usual
+func keyed(b balancer.Balancer, key string) balancer.Balancer {
+	if k, ok := b.(balancer.Keyed); ok && key != "" {
+		return k.ForKey(key)
+	}
+	return b
+}
@@ -0,0 +1,69 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+
+	"dynamic-gateway/internal/apikey"
+	"dynamic-gateway/internal/breaker"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/converter"
+	"dynamic-gateway/internal/journal"
+	"dynamic-gateway/internal/middleware"
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/schema"
+	"dynamic-gateway/internal/storage"
+	"dynamic-gateway/internal/tracing"
+)
+
+// Deps are shared by the handlers of every configuration
+type Deps struct {
+	Pool        *pool.ConnectionPool
+	Descriptors *schema.Store
+	Store       storage.Store
+	Journal     *journal.Journal // nil without a journal
+	Breakers    *breaker.Set
+	Tracer      *tracing.Tracer // nil without tracing
+	APIKeys     *apikey.Keys    // nil without api_keys
+}
+
+// Validate checks cfg before it is served and loads the descriptor sets it
+// names into descriptors
+func Validate(cfg *config.Config, descriptors *schema.Store) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := converter.ValidateConfig(cfg); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := middleware.ValidateConfig(cfg); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return schema.LoadDescriptorSets(descriptors, cfg)
+}
+
+// Build creates the middleware chain and routers for cfg. gRPC-Web requests
+// on the HTTP listener are served by the gRPC router.
+func Build(cfg *config.Config, deps Deps) (http.Handler, *HTTPHandler, *GRPCHandler, error) {
+	middlewareDeps := middleware.Dependencies{APIKeys: deps.APIKeys}
+	handler, err := NewHTTPHandler(cfg, deps.Pool, deps.Descriptors, deps.Store, deps.Journal, deps.Breakers, deps.Tracer, middlewareDeps)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	grpcHandler, err := NewGRPCHandler(cfg, deps.Pool, deps.Descriptors, deps.Breakers, deps.Tracer)
+	if err != nil {
+		handler.Close()
+		return nil, nil, nil, err
+	}
+	pipeline := cfg.Middleware
+	if len(pipeline) == 0 {
+		pipeline = middleware.DefaultPipeline
+	}
+	chain, err := middleware.Chain(cfg, middlewareDeps, pipeline, GRPCWeb(grpcHandler, handler))
+	if err != nil {
+		handler.Close()
+		grpcHandler.Close()
+		return nil, nil, nil, err
+	}
+	return chain, handler, grpcHandler, nil
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/balancer"
+	"dynamic-gateway/internal/breaker"
+)
+
+// recordCall reports the outcome of a call to a backend's circuit and failures
+// to its balancer, unless the client cancelled the call
+func recordCall(ctx context.Context, breakers *breaker.Set, b balancer.Balancer, backend string, err error) {
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return
+	}
+	failed := backendFailed(err)
+	breakers.Record(backend, !failed)
+	if failed {
+		recordFailure(b, backend)
+	}
+}
+
+// backendFailed reports whether an error counts against a backend: it could
+// not be reached or did not answer in time
+func backendFailed(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,83 @@
+package router
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dynamic-gateway/internal/budget"
+	"dynamic-gateway/internal/config"
+)
+
+// costWriter charges the route cost when the response status is written and
+// reports the remaining budget in response headers
+type costWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	tracker     *budget.Tracker
+	consumer    string
+	route       *config.HTTPRoute
+	wroteHeader bool
+}
+
+func (cw *costWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	cost := routeCost(cw.route)
+	if cw.route.CostHeader != "" {
+		if value := cw.Header().Get(cw.route.CostHeader); value != "" {
+			if parsed, err := strconv.ParseInt(value, 10, 64); err == nil && parsed >= 0 {
+				cost = parsed
+			}
+			cw.Header().Del(cw.route.CostHeader)
+		}
+	}
+
+	// Gateway-side failures are not charged
+	var remaining int64
+	var resetAt time.Time
+	var err error
+	if code < http.StatusInternalServerError {
+		remaining, resetAt, err = cw.tracker.Charge(cw.ctx, cw.consumer, cost)
+	} else {
+		remaining, resetAt, err = cw.tracker.Remaining(cw.ctx, cw.consumer)
+	}
+	if err != nil {
+		log.Printf("Failed to charge cost budget for %s: %v", cw.consumer, err)
+	} else {
+		setBudgetHeaders(cw.Header(), cw.tracker.Limit(), remaining, resetAt)
+	}
+
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *costWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *costWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// routeCost returns the static cost of a route
+func routeCost(route *config.HTTPRoute) int64 {
+	if route.Cost > 0 {
+		return route.Cost
+	}
+	return 1
+}
+
+// setBudgetHeaders reports the consumer budget state
+func setBudgetHeaders(h http.Header, limit, remaining int64, resetAt time.Time) {
+	h.Set("X-Budget-Limit", strconv.FormatInt(limit, 10))
+	h.Set("X-Budget-Remaining", strconv.FormatInt(remaining, 10))
+	h.Set("X-Budget-Reset", strconv.FormatInt(int64(time.Until(resetAt).Seconds()+0.5), 10))
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Limits for routes that configure no decompression limits
+const (
+	defaultMaxDecompressedSize = 10 * 1024 * 1024
+	defaultMaxCompressionRatio = 100
+)
+
+// ratioFloor is the decompressed size below which the compression ratio is
+// not checked; small bodies may compress well without threatening memory
+const ratioFloor = 64 * 1024
+
+var (
+	errDecompressionLimit  = errors.New("decompressed request body exceeds the route's limits")
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+// decompressRequest decodes a gzip or deflate request body in memory so it can
+// be transcoded. Decoding stops as soon as the body grows beyond the route's
+// size limit, or beyond its ratio limit relative to the bytes read so far.
+func decompressRequest(r *http.Request, limits *config.Decompression) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return nil
+	}
+
+	maxSize, maxRatio := int64(defaultMaxDecompressedSize), float64(defaultMaxCompressionRatio)
+	if limits != nil {
+		if limits.MaxSize > 0 {
+			maxSize = limits.MaxSize
+		}
+		if limits.MaxRatio > 0 {
+			maxRatio = limits.MaxRatio
+		}
+	}
+
+	compressed := &countingReader{r: r.Body}
+	var decoder io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		decoder, err = gzip.NewReader(compressed)
+	case "deflate":
+		decoder, err = zlib.NewReader(compressed)
+	default:
+		return fmt.Errorf("%w %q", errUnsupportedEncoding, encoding)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s body: %w", encoding, err)
+	}
+	defer decoder.Close()
+
+	var body bytes.Buffer
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := decoder.Read(chunk)
+		body.Write(chunk[:n])
+		size := int64(body.Len())
+		if size > maxSize || (size > ratioFloor && float64(size) > maxRatio*float64(compressed.n)) {
+			return errDecompressionLimit
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s body: %w", encoding, err)
+		}
+	}
+
+	r.Body = io.NopCloser(&body)
+	r.ContentLength = int64(body.Len())
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	return nil
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
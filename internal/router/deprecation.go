@@ -0,0 +1,101 @@
+package router
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+)
+
+// deprecationLogInterval limits how often a consumer is logged per route
+const deprecationLogInterval = time.Hour
+
+// deprecationMaxConsumers caps the consumers remembered across routes, so
+// clients calling from many addresses cannot grow the tracker without bound
+const deprecationMaxConsumers = 10000
+
+// deprecationTracker logs consumers still calling deprecated routes
+type deprecationTracker struct {
+	lastLogged map[string]time.Time
+	pruned     time.Time
+	mu         sync.Mutex
+}
+
+func newDeprecationTracker() *deprecationTracker {
+	return &deprecationTracker{lastLogged: make(map[string]time.Time)}
+}
+
+// apply sets deprecation headers and reports whether the request may proceed
+func (d *deprecationTracker) apply(w http.ResponseWriter, r *http.Request, route *config.HTTPRoute) bool {
+	dep := route.Deprecation
+	if dep == nil {
+		return true
+	}
+
+	now := time.Now()
+	if dep.Since != "" {
+		since, _ := time.Parse(time.RFC3339, dep.Since)
+		if now.Before(since) {
+			return true
+		}
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", since.Unix()))
+	} else {
+		w.Header().Set("Deprecation", "true")
+	}
+
+	var sunset time.Time
+	if dep.Sunset != "" {
+		sunset, _ = time.Parse(time.RFC3339, dep.Sunset)
+		w.Header().Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+	if dep.Link != "" {
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"deprecation\"", dep.Link))
+	}
+
+	d.logConsumer(r, route, now)
+
+	if dep.EnforceSunset && !sunset.IsZero() && now.After(sunset) {
+		http.Error(w, "this API has been retired", http.StatusGone)
+		return false
+	}
+	return true
+}
+
+// logConsumer records a deprecated call at most once per interval per consumer
+func (d *deprecationTracker) logConsumer(r *http.Request, route *config.HTTPRoute, now time.Time) {
+	consumer := identity.FromRequest(r, "")
+	key := route.Path + "|" + consumer
+
+	d.mu.Lock()
+	last, ok := d.lastLogged[key]
+	if ok && now.Sub(last) < deprecationLogInterval {
+		d.mu.Unlock()
+		return
+	}
+	d.prune(now)
+	d.lastLogged[key] = now
+	d.mu.Unlock()
+
+	log.Printf("Deprecated route %s called by consumer %s", route.Path, consumer)
+}
+
+// prune forgets consumers not logged within the interval, once an interval,
+// and everything when the cap is still reached. Forgotten consumers are
+// logged again on their next call. d.mu must be held.
+func (d *deprecationTracker) prune(now time.Time) {
+	if now.Sub(d.pruned) >= deprecationLogInterval {
+		for key, last := range d.lastLogged {
+			if now.Sub(last) >= deprecationLogInterval {
+				delete(d.lastLogged, key)
+			}
+		}
+		d.pruned = now
+	}
+	if len(d.lastLogged) >= deprecationMaxConsumers {
+		clear(d.lastLogged)
+	}
+}
@@ -0,0 +1,160 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Explanation describes how the gateway routes a request, without middleware
+// or backends taking part
+type Explanation struct {
+	Status   int               `json:"status"`             // 200 when a route or the default backend matches
+	Route    string            `json:"route,omitempty"`    // route id, e.g. "GET /users"; "default" for the default backend
+	Allow    []string          `json:"allow,omitempty"`    // methods of the routes whose path matched, on 405
+	Version  string            `json:"version,omitempty"`  // pinned API version
+	Pool     string            `json:"pool,omitempty"`     // named pool chosen by pool_selector
+	Policies map[string]string `json:"policies,omitempty"` // effective route policies
+	Rewrites Rewrites          `json:"rewrites"`
+}
+
+// Rewrites are the changes made to a request before it is sent upstream
+type Rewrites struct {
+	Path         string            `json:"path"`
+	Headers      map[string]string `json:"headers,omitempty"` // set or replaced headers
+	Removed      []string          `json:"removed,omitempty"` // deleted headers
+	UpstreamHost string            `json:"upstream_host,omitempty"`
+}
+
+// Explain matches r against the routes of cfg and reports the route, its
+// policies and the rewrites applied. Traffic splits are random, so requests
+// they would move to a named pool report no pool.
+func Explain(cfg *config.Config, r *http.Request) Explanation {
+	var route *config.HTTPRoute
+	var id string
+	i, allowed := matchRoute(cfg.HTTPRoutes, r.URL.Path, r.Method)
+	switch {
+	case i >= 0:
+		route = &cfg.HTTPRoutes[i]
+		id = routeID(route)
+	case len(allowed) > 0:
+		return Explanation{Status: http.StatusMethodNotAllowed, Allow: allowed}
+	case cfg.DefaultBackend != nil:
+		route = &config.HTTPRoute{
+			Path:          "/",
+			LoadBalancing: cfg.DefaultBackend.LoadBalancing,
+			Timeout:       cfg.DefaultBackend.Timeout,
+		}
+		id = "default"
+	default:
+		return Explanation{Status: http.StatusNotFound}
+	}
+
+	e := Explanation{Status: http.StatusOK, Route: id, Policies: routePolicies(route)}
+
+	// Same order as serveRoute: strip_path, version, then pool selector,
+	// then auth
+	upstream := stripPath(r, route)
+	if version := resolveVersion(cfg.APIVersioning, versionProxies(cfg), r); version != "" {
+		if v, ok := route.Versions[version]; ok {
+			e.Version = version
+			upstream = applyVersion(upstream, v)
+		}
+	}
+	if e.Version == "" && route.PoolSelector != "" {
+		pools := make(map[string]bool)
+		for name := range route.Pools {
+			pools[name] = true
+		}
+		e.Pool = newPoolSelector(route.PoolSelector, pools).selectPool(httpAttributes(upstream, ""))
+	}
+	upstream = applyAuth(upstream, route.Auth)
+
+	e.Rewrites = Rewrites{Path: upstream.URL.Path, UpstreamHost: route.UpstreamHost}
+	for key, values := range upstream.Header {
+		if value := strings.Join(values, ","); value != strings.Join(r.Header.Values(key), ",") {
+			if e.Rewrites.Headers == nil {
+				e.Rewrites.Headers = make(map[string]string)
+			}
+			e.Rewrites.Headers[key] = value
+		}
+	}
+	for key := range r.Header {
+		if _, ok := upstream.Header[key]; !ok {
+			e.Rewrites.Removed = append(e.Rewrites.Removed, key)
+		}
+	}
+	slices.Sort(e.Rewrites.Removed)
+	return e
+}
+
+// routePolicies summarizes the policies of a route as strings
+func routePolicies(route *config.HTTPRoute) map[string]string {
+	policies := map[string]string{
+		"target_protocol": route.TargetProtocol,
+		"load_balancing":  route.LoadBalancing,
+	}
+	if policies["target_protocol"] == "" {
+		policies["target_protocol"] = "http"
+	}
+	if policies["load_balancing"] == "" {
+		policies["load_balancing"] = "round_robin"
+	}
+	if route.Timeout != "" {
+		policies["timeout"] = route.Timeout
+	}
+	if route.StripPath {
+		policies["strip_path"] = "true"
+	}
+	if route.Auth != nil && route.Auth.Mode != "" {
+		policies["auth"] = route.Auth.Mode
+	}
+	if cc := route.CallCredentials; cc != nil {
+		policies["call_credentials"] = cc.Type
+	}
+	if len(route.Middleware) > 0 {
+		names := make([]string, len(route.Middleware))
+		for i, m := range route.Middleware {
+			names[i] = m.Name
+		}
+		policies["middleware"] = strings.Join(names, ",")
+	}
+	if len(route.Regions) > 0 {
+		policies["regions"] = strings.Join(route.Regions, ",")
+	}
+	if route.Retry != nil {
+		policies["retry"] = strconv.Itoa(route.Retry.Attempts)
+	}
+	if route.Deprecation != nil {
+		policies["deprecation"] = "true"
+	}
+	if route.Mock != nil {
+		policies["mock"] = "true"
+	}
+	if route.Mirror != nil {
+		policies["mirror"] = route.Mirror.Backend
+	}
+	if len(route.Schedules) > 0 {
+		names := make([]string, len(route.Schedules))
+		for i, s := range route.Schedules {
+			names[i] = s.Name
+		}
+		policies["schedules"] = strings.Join(names, ",")
+	}
+	if p := route.StreamPagination; p != nil {
+		policies["stream_pagination"] = strconv.Itoa(p.PageSize)
+	}
+	if e := route.StreamExport; e != nil {
+		policies["stream_export"] = e.Format
+	}
+	if l := route.RateLimit; l != nil {
+		policies["rate_limit"] = strconv.FormatFloat(l.RequestsPerSecond, 'g', -1, 64) + "/s " + l.Algorithm + " " + l.Mode
+	}
+	if route.MaxResponseSize > 0 {
+		policies["max_response_size"] = strconv.FormatInt(route.MaxResponseSize, 10)
+	}
+	return policies
+}
@@ -0,0 +1,133 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/balancer"
+	"dynamic-gateway/internal/breaker"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/pool"
+)
+
+// callPolicy is a parsed config.CallPolicy. The zero value waits for ready
+// backends and never fails over, as calls did before policies existed.
+type callPolicy struct {
+	failFast       bool
+	failover       int
+	attemptTimeout time.Duration
+}
+
+func newCallPolicy(p *config.CallPolicy) callPolicy {
+	if p == nil {
+		return callPolicy{}
+	}
+	timeout, _ := time.ParseDuration(p.AttemptTimeout)
+	return callPolicy{failFast: p.FailFast, failover: p.Failover, attemptTimeout: timeout}
+}
+
+// option returns the call option choosing between waiting and failing fast
+func (p callPolicy) option() grpc.CallOption {
+	return grpc.WaitForReady(!p.failFast)
+}
+
+// attempt bounds one attempt of a unary call by the attempt timeout
+func (p callPolicy) attempt(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.attemptTimeout > 0 {
+		return context.WithTimeout(ctx, p.attemptTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// perAttempt reports whether unary calls must be made one attempt at a time
+// rather than relayed as streams
+func (p callPolicy) perAttempt() bool {
+	return p.failover > 0 || p.attemptTimeout > 0
+}
+
+// failoverTo returns the backend to retry a failed attempt on after the given
+// number of failovers, or "" when the call must not fail over. Attempts the
+// pool refused to dial reached no backend, so they fail over regardless.
+func (p callPolicy) failoverTo(ctx context.Context, err error, failovers int, next func() string) string {
+	if dialRefused(ctx, err) {
+		return next()
+	}
+	if failovers >= p.failover || !p.retryable(ctx, err) {
+		return ""
+	}
+	return next()
+}
+
+// retryable reports whether a failed attempt may move on to another backend:
+// the backend was unavailable, or the attempt ran out of time while the call
+// itself still has some
+func (p callPolicy) retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable:
+		return true
+	case codes.DeadlineExceeded:
+		return p.attemptTimeout > 0
+	}
+	return false
+}
+
+// dialRefused reports whether an attempt failed because the pool refused to
+// dial its backend after repeated dial failures
+func dialRefused(ctx context.Context, err error) bool {
+	return ctx.Err() == nil && errors.Is(err, pool.ErrDialCircuitOpen)
+}
+
+// connectError converts a failure to get a backend connection to an
+// unavailable status, keeping refused dials recognizable to dialRefused
+func connectError(err error) error {
+	if errors.Is(err, pool.ErrDialCircuitOpen) {
+		return err
+	}
+	return status.Errorf(codes.Unavailable, "failed to connect to backend: %v", err)
+}
+
+// failover returns a function yielding the pool's backends other than first,
+// in balancer order, and "" once none remain
+func failover(b balancer.Balancer, regions map[string]string, region, first string, breakers *breaker.Set) func() string {
+	tried := map[string]bool{first: true}
+	return func() string {
+		for {
+			addr := b.NextFrom(func(addr string) bool {
+				return !tried[addr] && (region == "" || regions[addr] == region)
+			})
+			if addr == "" {
+				return ""
+			}
+			// Tried or refused, it is not offered again
+			tried[addr] = true
+			if breakers.Allow(addr) {
+				return addr
+			}
+		}
+	}
+}
+
+// nextBackend returns a function yielding the other backends of a route's
+// pool that convert requests themselves, with their dial options for tenant
+// and the release of the load recorded on them, for calls that fail over
+func (h *HTTPHandler) nextBackend(route *config.HTTPRoute, poolKey, region, tenant, backendAddr string) func() (string, pool.Options, func()) {
+	next := failover(h.balancers[poolKey], h.regions[poolKey], region, backendAddr, h.breakers)
+	return func() (string, pool.Options, func()) {
+		for addr := next(); addr != ""; addr = next() {
+			if h.federated[poolKey][addr] {
+				continue
+			}
+			done := beginRequest(h.balancers[poolKey], addr)
+			return addr, tenantDial(h.config.Tenancy, dialOptions(h.backends[poolKey][addr], route.UpstreamHost), tenant), done
+		}
+		return "", pool.Options{}, nil
+	}
+}
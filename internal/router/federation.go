@@ -0,0 +1,20 @@
+package router
+
+import (
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/federation"
+)
+
+// defaultFederation is used when federated backends are declared without a federation block
+var defaultFederation = federation.Default
+
+// federatedBackends returns the set of backend addresses that are peer gateways
+func federatedBackends(backends []config.Backend) map[string]bool {
+	federated := make(map[string]bool)
+	for _, b := range backends {
+		if b.Federated {
+			federated[b.Address] = true
+		}
+	}
+	return federated
+}
@@ -2,55 +2,155 @@ package router
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"sync"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/known/structpb"
 
 	"dynamic-gateway/internal/balancer"
+	"dynamic-gateway/internal/breaker"
+	"dynamic-gateway/internal/callcreds"
+	"dynamic-gateway/internal/cluster"
 	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/converter"
+	"dynamic-gateway/internal/federation"
+	"dynamic-gateway/internal/identity"
 	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/schema"
+	"dynamic-gateway/internal/tracing"
 )
 
 // GRPCHandler handles gRPC requests
 type GRPCHandler struct {
 	config         *config.Config
 	connectionPool *pool.ConnectionPool
-	balancers      map[string]*balancer.RoundRobinBalancer
-	converter      *ProtocolConverter
+	balancers      map[string]balancer.Balancer
+	metadata       map[string]*metadataTemplate
+	federated      map[string]map[string]bool
+	regions        map[string]map[string]string
+	backends       map[string]map[string]config.Backend
+	descriptors    *schema.Store
+	converters     *converter.Registry
+	selectors      map[string]*poolSelector
+	callCreds      map[string]credentials.PerRPCCredentials
+	retries        map[string]*retryPolicy
+	jwt            map[string]*tokenAuth
+	breakers       *breaker.Set
+	tracer         *tracing.Tracer
 	mu             sync.RWMutex
 }
 
-// NewGRPCHandler creates a new gRPC handler
-func NewGRPCHandler(cfg *config.Config, pool *pool.ConnectionPool) *GRPCHandler {
+// NewGRPCHandler creates a new gRPC handler. It fails when a service's
+// balancer or call credentials cannot be built.
+func NewGRPCHandler(cfg *config.Config, pool *pool.ConnectionPool, descriptors *schema.Store, breakers *breaker.Set, tracer *tracing.Tracer) (*GRPCHandler, error) {
 	handler := &GRPCHandler{
 		config:         cfg,
 		connectionPool: pool,
-		balancers:      make(map[string]*balancer.RoundRobinBalancer),
-		converter:      NewProtocolConverter(pool),
+		balancers:      make(map[string]balancer.Balancer),
+		metadata:       make(map[string]*metadataTemplate),
+		federated:      make(map[string]map[string]bool),
+		regions:        make(map[string]map[string]string),
+		backends:       make(map[string]map[string]config.Backend),
+		descriptors:    descriptors,
+		converters:     converter.NewRegistry(converter.Dependencies{Pool: pool, Descriptors: descriptors}),
+		selectors:      make(map[string]*poolSelector),
+		callCreds:      make(map[string]credentials.PerRPCCredentials),
+		retries:        make(map[string]*retryPolicy),
+		jwt:            make(map[string]*tokenAuth),
+		breakers:       breakers,
+		tracer:         tracer,
 	}
 
 	// Initialize balancers for each service
 	for _, svc := range cfg.GRPCServices {
-		backends := make([]string, len(svc.Backends))
-		for i, b := range svc.Backends {
-			backends[i] = b.Address
+		if err := handler.addPool(svc.ServiceName, &svc, svc.Backends); err != nil {
+			handler.Close()
+			return nil, fmt.Errorf("service %s: %w", svc.ServiceName, err)
+		}
+		handler.metadata[svc.ServiceName] = newMetadataTemplate(svc.Metadata)
+
+		pools := make(map[string]bool)
+		for name, backends := range svc.Pools {
+			if err := handler.addPool(namedPoolKey(svc.ServiceName, name), &svc, backends); err != nil {
+				handler.Close()
+				return nil, fmt.Errorf("service %s: %w", svc.ServiceName, err)
+			}
+			pools[name] = true
+		}
+		handler.selectors[svc.ServiceName] = newPoolSelector(svc.PoolSelector, pools)
+		if svc.RetryAttempts > 0 {
+			handler.retries[svc.ServiceName] = serviceRetryPolicy(svc.RetryAttempts)
+		}
+		if svc.JWT != nil {
+			handler.jwt[svc.ServiceName] = newJWTAuth(svc.JWT)
+		}
+
+		if svc.CallCredentials != nil {
+			creds, err := callcreds.New(context.Background(), svc.CallCredentials)
+			if err != nil {
+				handler.Close()
+				return nil, fmt.Errorf("failed to set up call credentials for service %s: %w", svc.ServiceName, err)
+			}
+			handler.callCreds[svc.ServiceName] = creds
 		}
-		handler.balancers[svc.ServiceName] = balancer.NewRoundRobinBalancer(backends)
 	}
 
-	return handler
+	return handler, nil
+}
+
+// addPool registers a balancer for a backend pool
+func (h *GRPCHandler) addPool(key string, svc *config.GRPCService, pool []config.Backend) error {
+	backends := make([]string, len(pool))
+	for i, b := range pool {
+		backends[i] = b.Address
+	}
+	backends = balancer.Subset(backends, svc.SubsetSize, cluster.Identity(h.config.Cluster))
+	b, err := balancer.New(svc.LoadBalancing, backends, backendWeights(pool))
+	if err != nil {
+		return err
+	}
+	h.balancers[key] = b
+	h.federated[key] = federatedBackends(pool)
+	h.regions[key] = backendRegions(pool)
+	h.backends[key] = backendConfigs(pool)
+	return nil
 }
 
 // HandleGRPCRequest handles incoming gRPC requests
-func (h *GRPCHandler) HandleGRPCRequest(ctx context.Context, serviceName, methodName string, req proto.Message) (proto.Message, error) {
+func (h *GRPCHandler) HandleGRPCRequest(ctx context.Context, serviceName, methodName string, req proto.Message) (resp proto.Message, err error) {
+	ctx, span := h.startSpan(ctx, serviceName, methodName)
+	ctx, serviceConfig, pool, backendAddr, err := h.selectBackend(ctx, serviceName, methodName)
+	defer func() { endGRPCSpan(span, backendAddr, err) }()
+	if err != nil {
+		return nil, err
+	}
+	done := trackGRPC(serviceName, methodName, backendAddr)
+	defer func() { done(status.Code(err)) }()
+	defer beginRequest(h.balancers[pool], backendAddr)()
+	ctx, cancel := serviceDeadline(ctx, serviceConfig)
+	defer cancel()
+
+	// Route based on target protocol
+	target := serviceTarget(serviceConfig)
+	if target == converter.GRPC {
+		// gRPC → gRPC
+		return h.routeGRPCToGRPC(ctx, serviceName, methodName, req, backendAddr, pool, serviceConfig)
+	}
+
+	// gRPC → HTTP or any other registered conversion
+	return h.routeGRPCConverted(ctx, serviceName, methodName, req, backendAddr, pool, serviceConfig, target)
+}
+
+// selectBackend finds a service's configuration, authenticates a call and
+// picks the pool and backend for it from its incoming metadata. It returns
+// the context of the authenticated call.
+func (h *GRPCHandler) selectBackend(ctx context.Context, serviceName, methodName string) (context.Context, *config.GRPCService, string, string, error) {
 	// Find service configuration
 	var serviceConfig *config.GRPCService
 	for i := range h.config.GRPCServices {
@@ -61,83 +161,262 @@ func (h *GRPCHandler) HandleGRPCRequest(ctx context.Context, serviceName, method
 	}
 
 	if serviceConfig == nil {
-		return nil, status.Errorf(codes.NotFound, "service %s not found", serviceName)
+		return ctx, nil, "", "", status.Errorf(codes.NotFound, "service %s not found", serviceName)
+	}
+
+	// Reject metadata floods some backends cannot handle
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	if err := checkHeaderLimits(incoming, headerLimits(h.config.HeaderLimits, serviceConfig.HeaderLimits)); err != nil {
+		return ctx, nil, "", "", status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	// Require a valid bearer JWT
+	if auth := h.jwt[serviceName]; auth != nil {
+		var err error
+		if ctx, err = auth.authenticateGRPC(ctx); err != nil {
+			return ctx, nil, "", "", err
+		}
+		incoming, _ = metadata.FromIncomingContext(ctx)
+	}
+
+	// Describe the client certificate in place of any description sent by
+	// the client, which only services trusting the proxy in front pass on
+	forwardCert := h.config.ServerTLS != nil && h.config.ServerTLS.ForwardClientCert
+	if forwardCert || (!serviceConfig.TrustClientCert && len(incoming.Get(identity.ForwardedClientCertHeader)) > 0) {
+		incoming = incoming.Copy()
+		if incoming == nil {
+			incoming = metadata.MD{}
+		}
+		incoming.Delete(identity.ForwardedClientCertHeader)
+		if xfcc := identity.ForwardedClientCert(peerTLS(ctx)); forwardCert && xfcc != "" {
+			incoming.Set(identity.ForwardedClientCertHeader, xfcc)
+		}
+		ctx = metadata.NewIncomingContext(ctx, incoming)
+	}
+
+	// Select a named pool from incoming metadata, or by traffic split
+	pool := serviceName
+	name := h.selectors[serviceName].selectPool(grpcAttributes(ctx, incoming, serviceName, methodName))
+	if name == "" {
+		name = splitPool(serviceConfig.TrafficSplit)
+	}
+	if name != "" {
+		pool = namedPoolKey(serviceName, name)
 	}
 
 	// Get next backend
-	balancer := h.balancers[serviceName]
+	balancer := h.balancers[pool]
 	if balancer == nil {
-		return nil, status.Errorf(codes.Internal, "no balancer for service %s", serviceName)
+		return ctx, nil, "", "", status.Errorf(codes.Internal, "no balancer for service %s", serviceName)
 	}
 
-	backendAddr := balancer.Next()
+	balancer = keyed(balancer, grpcHashKey(ctx, serviceConfig.HashKey, incoming))
+
+	// Enforce data residency
+	region := h.dataRegion(ctx, incoming)
+	backendAddr := nextAvailable(balancer, h.regions[pool], region, h.breakers)
+	if backendAddr == "" && region != "" {
+		return ctx, nil, "", "", status.Errorf(codes.PermissionDenied, "no backends for service %s in data region %s", serviceName, region)
+	}
 	if backendAddr == "" {
-		return nil, status.Errorf(codes.Unavailable, "no backends available for service %s", serviceName)
+		return ctx, nil, "", "", status.Errorf(codes.Unavailable, "no backends available for service %s", serviceName)
 	}
+	grpcPicks.With(serviceName, backendAddr).Inc()
+	return ctx, serviceConfig, pool, backendAddr, nil
+}
 
-	// Route based on target protocol
-	if serviceConfig.IsGRPC {
-		// gRPC → gRPC
-		return h.routeGRPCToGRPC(ctx, serviceName, methodName, req, backendAddr, serviceConfig)
-	} else {
-		// gRPC → HTTP
-		return h.routeGRPCToHTTP(ctx, serviceName, methodName, req, backendAddr)
+// dataRegion returns the data region a call asks for
+func (h *GRPCHandler) dataRegion(ctx context.Context, incoming metadata.MD) string {
+	return dataRegion(ctx, h.config.DataResidency, func(key string) string {
+		if values := incoming.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	})
+}
+
+// nextBackend returns a function yielding the other backends of a call's
+// pool, for calls that fail over
+func (h *GRPCHandler) nextBackend(ctx context.Context, pool, backendAddr string) func() string {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	return failover(h.balancers[pool], h.regions[pool], h.dataRegion(ctx, incoming), backendAddr, h.breakers)
+}
+
+// serviceTarget returns the protocol spoken by a service's backends
+func serviceTarget(svc *config.GRPCService) converter.Protocol {
+	if svc.TargetProtocol != "" {
+		return converter.Protocol(svc.TargetProtocol)
 	}
+	if svc.IsGRPC {
+		return converter.GRPC
+	}
+	return converter.HTTP
 }
 
 // routeGRPCToGRPC routes gRPC request to gRPC backend
-func (h *GRPCHandler) routeGRPCToGRPC(ctx context.Context, serviceName, methodName string, req proto.Message, backendAddr string, svcConfig *config.GRPCService) (proto.Message, error) {
-	// Get connection
-	conn, err := h.connectionPool.GetConnection(ctx, backendAddr, false, false)
-	if err != nil {
-		return nil, status.Errorf(codes.Unavailable, "failed to connect to backend: %v", err)
+func (h *GRPCHandler) routeGRPCToGRPC(ctx context.Context, serviceName, methodName string, req proto.Message, backendAddr, pool string, svcConfig *config.GRPCService) (proto.Message, error) {
+	resp := converter.NewResponse(h.descriptors, serviceName, methodName)
+	if err := h.invoke(ctx, serviceName, methodName, backendAddr, pool, svcConfig, req, resp); err != nil {
+		log.Printf("gRPC invocation failed for /%s/%s: %v", serviceName, methodName, err)
+		return nil, err
 	}
+	return resp, nil
+}
 
-	// Forward metadata
-	md, _ := metadata.FromIncomingContext(ctx)
-	ctx = metadata.NewOutgoingContext(ctx, md)
-
-	// Invoke method
+// invoke makes a unary call, failing over to other backends of the pool as
+// the service's call policy allows and retrying as its retry_attempts allow.
+// Idempotent calls whose connection was lost are retried on a new one.
+func (h *GRPCHandler) invoke(ctx context.Context, serviceName, methodName, backendAddr, pool string, svcConfig *config.GRPCService, req, resp any, opts ...grpc.CallOption) error {
 	fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
+	policy := newCallPolicy(svcConfig.CallPolicy)
+	retry := h.retries[serviceName]
+	retry.record()
+	next := h.nextBackend(ctx, pool, backendAddr)
+	opts = append(h.callOptions(serviceName, svcConfig), opts...)
+	failovers, retries := 0, 0
+	reconnected := false
+	for {
+		err := h.invokeBackend(ctx, serviceName, methodName, backendAddr, pool, policy, req, resp, opts)
+		recordCall(ctx, h.breakers, h.balancers[pool], backendAddr, err)
+		if err == nil {
+			return nil
+		}
+		// A backend shutting down sends GOAWAY; idempotent calls go again
+		// once on a new connection
+		if h.connectionLost(ctx, err, pool, backendAddr) && !reconnected && h.idempotent(svcConfig, serviceName, methodName) {
+			log.Printf("Retrying %s on a new connection to %s after: %v", fullMethod, backendAddr, err)
+			reconnected = true
+			continue
+		}
+		if addr := policy.failoverTo(ctx, err, failovers, next); addr != "" {
+			log.Printf("Failing over %s from %s to %s: %v", fullMethod, backendAddr, addr, err)
+			defer beginRequest(h.balancers[pool], addr)()
+			backendAddr = addr
+			if !dialRefused(ctx, err) {
+				failovers++
+			}
+			continue
+		}
+		if !retry.retryableError(ctx, err) || !retry.retry(ctx, retries) {
+			return err
+		}
+		retries++
+		log.Printf("Retrying %s on %s after: %v", fullMethod, backendAddr, err)
+	}
+}
 
-	var resp structpb.Struct
-	err = conn.Invoke(
-		ctx,
-		fullMethod,
-		req,
-		&resp,
-		grpc.WaitForReady(true),
-		grpc.MaxCallRecvMsgSize(svcConfig.MaxCallRecvMsgSize),
-	)
-
+// invokeBackend makes one attempt of a unary call
+func (h *GRPCHandler) invokeBackend(ctx context.Context, serviceName, methodName, backendAddr, pool string, policy callPolicy, req, resp any, opts []grpc.CallOption) error {
+	conn, err := h.connectionPool.GetConnectionWithOptions(ctx, backendAddr, h.dial(ctx, pool, backendAddr))
 	if err != nil {
-		log.Printf("gRPC invocation failed for %s: %v", fullMethod, err)
-		return nil, err
+		return connectError(err)
 	}
+	ctx, cancel := policy.attempt(h.outgoingContext(ctx, serviceName, methodName, backendAddr, pool))
+	defer cancel()
+	return conn.Invoke(ctx, fmt.Sprintf("/%s/%s", serviceName, methodName), req, resp, opts...)
+}
 
-	return &resp, nil
+// openStream opens a stream to a backend, failing over to other backends of
+// the pool while they are unavailable as the service's call policy allows. It
+// returns the backend that accepted the stream.
+func (h *GRPCHandler) openStream(ctx context.Context, serviceName, methodName, backendAddr, pool string, svcConfig *config.GRPCService) (grpc.ClientStream, string, error) {
+	fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
+	policy := newCallPolicy(svcConfig.CallPolicy)
+	next := h.nextBackend(ctx, pool, backendAddr)
+	desc := &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}
+	opts := append(h.callOptions(serviceName, svcConfig), grpc.ForceCodecV2(frameCodec{}))
+	failovers, reconnected := 0, false
+	for {
+		conn, err := h.connectionPool.GetConnectionWithOptions(ctx, backendAddr, h.dial(ctx, pool, backendAddr))
+		if err != nil {
+			err = connectError(err)
+		} else {
+			var stream grpc.ClientStream
+			stream, err = conn.NewStream(h.outgoingContext(ctx, serviceName, methodName, backendAddr, pool), desc, fullMethod, opts...)
+			recordCall(ctx, h.breakers, h.balancers[pool], backendAddr, err)
+			if err == nil {
+				return stream, backendAddr, nil
+			}
+			// Nothing was sent on a stream that failed to open, so it can
+			// be opened again on a new connection
+			if h.connectionLost(ctx, err, pool, backendAddr) && !reconnected {
+				log.Printf("Reopening %s on a new connection to %s after: %v", fullMethod, backendAddr, err)
+				reconnected = true
+				continue
+			}
+		}
+		addr := policy.failoverTo(ctx, err, failovers, next)
+		if addr == "" {
+			return nil, "", err
+		}
+		log.Printf("Failing over %s from %s to %s: %v", fullMethod, backendAddr, addr, err)
+		backendAddr = addr
+		if !dialRefused(ctx, err) {
+			failovers++
+		}
+	}
 }
 
-// routeGRPCToHTTP routes gRPC request to HTTP backend
-func (h *GRPCHandler) routeGRPCToHTTP(ctx context.Context, serviceName, methodName string, req proto.Message, backendURL string) (proto.Message, error) {
-	// Convert gRPC to HTTP
-	responseBytes, err := h.converter.GRPCToHTTP(ctx, serviceName, methodName, req, backendURL)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, "protocol conversion failed: %v", err)
+// outgoingContext forwards incoming metadata to a backend with the service's
+// metadata defaults and, for federated backends, the consumer identity
+func (h *GRPCHandler) outgoingContext(ctx context.Context, serviceName, methodName, backendAddr, pool string) context.Context {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	md := incoming.Copy()
+	if md == nil {
+		md = metadata.MD{}
+	}
+	h.metadata[serviceName].apply(md, grpcAttributes(ctx, incoming, serviceName, methodName))
+	if h.federated[pool][backendAddr] {
+		fed := h.config.Federation
+		if fed == nil {
+			fed = defaultFederation
+		}
+		federation.SetMetadata(fed, md, identity.Consumer(ctx))
 	}
+	return metadata.NewOutgoingContext(ctx, md)
+}
 
-	// Convert response back to protobuf
-	var responseData map[string]interface{}
-	if err := json.Unmarshal(responseBytes, &responseData); err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to unmarshal response: %v", err)
+// callOptions returns the options for calls to a service's backends
+func (h *GRPCHandler) callOptions(serviceName string, svcConfig *config.GRPCService) []grpc.CallOption {
+	maxSize := svcConfig.MaxCallRecvMsgSize
+	if maxSize == 0 {
+		maxSize = h.config.MaxCallRecvMsgSize
+	}
+	callOpts := []grpc.CallOption{
+		newCallPolicy(svcConfig.CallPolicy).option(),
+		grpc.MaxCallRecvMsgSize(maxSize),
+	}
+	if creds := h.callCreds[serviceName]; creds != nil {
+		callOpts = append(callOpts, grpc.PerRPCCredentials(creds))
 	}
+	return callOpts
+}
 
-	responseStruct, err := structpb.NewStruct(responseData)
+// routeGRPCConverted routes a gRPC request to a backend speaking another protocol
+func (h *GRPCHandler) routeGRPCConverted(ctx context.Context, serviceName, methodName string, req proto.Message, backendURL, pool string, svcConfig *config.GRPCService, target converter.Protocol) (proto.Message, error) {
+	conv, ok := h.converters.Get(converter.GRPC, target)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "no converter for grpc to %s", target)
+	}
+
+	maxSize := svcConfig.MaxCallRecvMsgSize
+	if maxSize == 0 {
+		maxSize = h.config.MaxCallRecvMsgSize
+	}
+
+	resp, err := conv.Convert(ctx, &converter.Request{
+		Service:         serviceName,
+		Method:          methodName,
+		Backend:         backendURL,
+		Dial:            h.dial(ctx, pool, backendURL),
+		Message:         req,
+		MaxResponseSize: maxSize,
+	})
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to create response struct: %v", err)
+		return nil, status.Errorf(codes.Internal, "protocol conversion failed: %v", err)
 	}
 
-	return responseStruct, nil
+	return resp.Message, nil
 }
 
 // RegisterService registers the dynamic service
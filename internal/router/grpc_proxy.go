@@ -0,0 +1,253 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/mem"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/converter"
+	"dynamic-gateway/internal/streams"
+)
+
+// frame is a gRPC message passed through the gateway without decoding
+type frame struct {
+	payload []byte
+}
+
+// frameCodec passes frames through untouched and encodes everything else,
+// such as the reflection service's messages, as protobuf
+type frameCodec struct{}
+
+func (frameCodec) Marshal(v any) (mem.BufferSlice, error) {
+	if f, ok := v.(*frame); ok {
+		return mem.BufferSlice{mem.SliceBuffer(f.payload)}, nil
+	}
+	return encoding.GetCodecV2("proto").Marshal(v)
+}
+
+func (frameCodec) Unmarshal(data mem.BufferSlice, v any) error {
+	if f, ok := v.(*frame); ok {
+		f.payload = data.Materialize()
+		return nil
+	}
+	return encoding.GetCodecV2("proto").Unmarshal(data, v)
+}
+
+func (frameCodec) Name() string {
+	return "proto"
+}
+
+// StreamProxyOptions returns server options that send calls for services not
+// registered on the server to the handler returned by current, so calls of
+// every streaming kind reach the backends of the active configuration
+func StreamProxyOptions(current func() *GRPCHandler) []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ForceServerCodecV2(frameCodec{}),
+		grpc.UnknownServiceHandler(func(srv any, stream grpc.ServerStream) error {
+			return current().HandleStream(srv, stream)
+		}),
+	}
+}
+
+// HandleStream proxies a call of any kind to a backend of its service. Calls
+// to gRPC backends are relayed frame by frame in both directions; other
+// targets go through the protocol converters and must be unary.
+func (h *GRPCHandler) HandleStream(srv any, stream grpc.ServerStream) (err error) {
+	fullMethod, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "method missing from stream context")
+	}
+	serviceName, methodName, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	if !ok {
+		return status.Errorf(codes.Unimplemented, "malformed method name %s", fullMethod)
+	}
+
+	ctx, span := h.startSpan(stream.Context(), serviceName, methodName)
+	ctx, serviceConfig, pool, backendAddr, err := h.selectBackend(ctx, serviceName, methodName)
+	defer func() { endGRPCSpan(span, backendAddr, err) }()
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return status.Errorf(codes.Unimplemented, "unknown service %s", serviceName)
+		}
+		return err
+	}
+	done := trackGRPC(serviceName, methodName, backendAddr)
+	defer func() { done(status.Code(err)) }()
+
+	// Calls not known to be unary hold a stream of the service
+	var open *streams.Stream
+	if !h.unary(serviceName, methodName) {
+		var ok bool
+		if open, ok = serviceStreams.Open(serviceName, grpcClient(ctx), serviceConfig.MaxStreams, serviceConfig.MaxStreamsPerClient); !ok {
+			return status.Errorf(codes.ResourceExhausted, "too many streams open for service %s", serviceName)
+		}
+		defer open.Close()
+	}
+	defer beginRequest(h.balancers[pool], backendAddr)()
+
+	// Cancelling the backend stream when the client side fails tears down both
+	ctx, cancel := serviceDeadline(ctx, serviceConfig)
+	defer cancel()
+
+	target := serviceTarget(serviceConfig)
+	if target != converter.GRPC {
+		return h.convertStream(ctx, stream, serviceName, methodName, backendAddr, pool, serviceConfig, target)
+	}
+
+	// Unary calls are replayed whole when they may be attempted again
+	replayable := newCallPolicy(serviceConfig.CallPolicy).perAttempt() || h.retries[serviceName] != nil ||
+		h.idempotent(serviceConfig, serviceName, methodName)
+	if replayable && h.unary(serviceName, methodName) {
+		return h.proxyUnary(ctx, stream, serviceName, methodName, backendAddr, pool, serviceConfig)
+	}
+
+	backend, addr, err := h.openStream(ctx, serviceName, methodName, backendAddr, pool, serviceConfig)
+	if err != nil {
+		return err
+	}
+	if addr != backendAddr {
+		defer beginRequest(h.balancers[pool], addr)()
+	}
+
+	toBackend := forwardToBackend(open, stream, backend)
+	toClient := forwardToClient(open, backend, stream)
+	for {
+		select {
+		case err := <-toBackend:
+			if errors.Is(err, io.EOF) {
+				// The client finished sending; keep relaying responses
+				backend.CloseSend()
+				toBackend = nil
+				continue
+			}
+			cancel()
+			return status.Errorf(codes.Canceled, "failed to relay request: %v", err)
+		case err := <-toClient:
+			stream.SetTrailer(backend.Trailer())
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// forwardToBackend relays client messages to the backend until the client
+// closes its side, in a goroutine of open
+func forwardToBackend(open *streams.Stream, client grpc.ServerStream, backend grpc.ClientStream) <-chan error {
+	done := make(chan error, 1)
+	open.Go(func() {
+		msg := &frame{}
+		for {
+			if err := client.RecvMsg(msg); err != nil {
+				done <- err
+				return
+			}
+			if err := backend.SendMsg(msg); err != nil {
+				// The backend's status is reported by the other direction
+				done <- io.EOF
+				return
+			}
+		}
+	})
+	return done
+}
+
+// forwardToClient relays the backend's headers and messages to the client
+// and ends with the backend's status, io.EOF for OK, in a goroutine of open
+func forwardToClient(open *streams.Stream, backend grpc.ClientStream, client grpc.ServerStream) <-chan error {
+	done := make(chan error, 1)
+	open.Go(func() {
+		header, err := backend.Header()
+		if err != nil {
+			done <- backend.RecvMsg(&frame{})
+			return
+		}
+		if err := client.SendHeader(header); err != nil {
+			done <- err
+			return
+		}
+		msg := &frame{}
+		for {
+			if err := backend.RecvMsg(msg); err != nil {
+				done <- err
+				return
+			}
+			if err := client.SendMsg(msg); err != nil {
+				done <- err
+				return
+			}
+		}
+	})
+	return done
+}
+
+// unary reports whether a method is known to be unary
+func (h *GRPCHandler) unary(serviceName, methodName string) bool {
+	if h.descriptors == nil {
+		return false
+	}
+	method, ok := h.descriptors.FindMethod(serviceName, methodName)
+	return ok && !method.IsStreamingClient() && !method.IsStreamingServer()
+}
+
+// proxyUnary relays a unary call as a single request and response, so the
+// call can be attempted again
+func (h *GRPCHandler) proxyUnary(ctx context.Context, stream grpc.ServerStream, serviceName, methodName, backendAddr, pool string, serviceConfig *config.GRPCService) error {
+	req, resp := &frame{}, &frame{}
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	var header, trailer metadata.MD
+	err := h.invoke(ctx, serviceName, methodName, backendAddr, pool, serviceConfig, req, resp,
+		grpc.ForceCodecV2(frameCodec{}), grpc.Header(&header), grpc.Trailer(&trailer))
+	stream.SetTrailer(trailer)
+	if err != nil {
+		return err
+	}
+	if err := stream.SendHeader(header); err != nil {
+		return err
+	}
+	return stream.SendMsg(resp)
+}
+
+// convertStream serves a unary call to a backend speaking another protocol
+func (h *GRPCHandler) convertStream(ctx context.Context, stream grpc.ServerStream, serviceName, methodName, backendAddr, pool string, serviceConfig *config.GRPCService, target converter.Protocol) error {
+	if h.descriptors != nil {
+		if method, ok := h.descriptors.FindMethod(serviceName, methodName); ok && (method.IsStreamingClient() || method.IsStreamingServer()) {
+			return status.Errorf(codes.Unimplemented, "streaming calls cannot be converted to %s", target)
+		}
+	}
+
+	req, _, err := converter.NewMessages(h.descriptors, serviceName, methodName, nil)
+	if err != nil {
+		return status.Error(codes.Unimplemented, err.Error())
+	}
+	msg := &frame{}
+	if err := stream.RecvMsg(msg); err != nil {
+		return err
+	}
+	if err := proto.Unmarshal(msg.payload, req); err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to decode request: %v", err)
+	}
+
+	resp, err := h.routeGRPCConverted(ctx, serviceName, methodName, req, backendAddr, pool, serviceConfig, target)
+	if err != nil {
+		return err
+	}
+	payload, err := proto.Marshal(resp)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode response: %v", err)
+	}
+	return stream.SendMsg(&frame{payload: payload})
+}
@@ -0,0 +1,292 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/converter"
+)
+
+// gRPC-Web frame flags
+const (
+	grpcWebDataFrame    = 0x00
+	grpcWebTrailerFrame = 0x80
+)
+
+// grpcWebSkippedHeaders are HTTP headers not forwarded as gRPC metadata
+var grpcWebSkippedHeaders = map[string]bool{
+	"Accept-Encoding":      true,
+	"Connection":           true,
+	"Content-Length":       true,
+	"Content-Type":         true,
+	"Grpc-Accept-Encoding": true,
+	"Grpc-Encoding":        true,
+	"Grpc-Timeout":         true,
+	"Host":                 true,
+	"Keep-Alive":           true,
+	"Te":                   true,
+	"Transfer-Encoding":    true,
+	"Upgrade":              true,
+}
+
+// GRPCWeb serves gRPC-Web requests, in both the binary and base64 text
+// encodings, with the gRPC handler so browsers can call grpc_services on the
+// HTTP listener without a separate proxy; other requests go to next
+func GRPCWeb(h *GRPCHandler, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc-web") {
+			h.serveGRPCWeb(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveGRPCWeb relays a gRPC-Web call to a backend of its service. Request
+// messages are read from the body before responses are streamed back, as
+// gRPC-Web clients send the whole request up front.
+func (h *GRPCHandler) serveGRPCWeb(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	text := strings.HasPrefix(contentType, "application/grpc-web-text")
+	out := &grpcWebWriter{w: w, text: text, controller: http.NewResponseController(w)}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Access-Control-Expose-Headers", "grpc-status, grpc-message")
+
+	serviceName, methodName, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if !ok || serviceName == "" || methodName == "" {
+		out.finish(status.Errorf(codes.Unimplemented, "malformed method name %s", r.URL.Path), nil)
+		return
+	}
+
+	// Present the request headers as a gRPC server would see them
+	md := metadata.MD{}
+	for name, values := range r.Header {
+		if !grpcWebSkippedHeaders[name] {
+			md.Append(name, values...)
+		}
+	}
+	ctx := metadata.NewIncomingContext(r.Context(), md)
+	if r.TLS != nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{AuthInfo: credentials.TLSInfo{State: *r.TLS}})
+	}
+	if timeout, ok := parseGRPCTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ctx, span := h.startSpan(ctx, serviceName, methodName)
+	ctx, serviceConfig, pool, backendAddr, err := h.selectBackend(ctx, serviceName, methodName)
+	defer func() { endGRPCSpan(span, backendAddr, status.Error(out.code, "")) }()
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			err = status.Errorf(codes.Unimplemented, "unknown service %s", serviceName)
+		}
+		out.finish(err, nil)
+		return
+	}
+	done := trackGRPC(serviceName, methodName, backendAddr)
+	defer func() { done(out.code) }()
+	defer beginRequest(h.balancers[pool], backendAddr)()
+	ctx, cancel := serviceDeadline(ctx, serviceConfig)
+	defer cancel()
+	if serviceTarget(serviceConfig) != converter.GRPC {
+		out.finish(status.Errorf(codes.Unimplemented, "gRPC-Web requires a gRPC backend for %s", serviceName), nil)
+		return
+	}
+
+	stream, addr, err := h.openStream(ctx, serviceName, methodName, backendAddr, pool, serviceConfig)
+	if err != nil {
+		out.finish(err, nil)
+		return
+	}
+	if addr != backendAddr {
+		defer beginRequest(h.balancers[pool], addr)()
+	}
+
+	var body io.Reader = r.Body
+	if text {
+		body = base64.NewDecoder(base64.StdEncoding, r.Body)
+	}
+	for {
+		payload, err := readGRPCWebFrame(body, h.config.MaxCallRecvMsgSize)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			out.finish(status.Errorf(codes.InvalidArgument, "invalid gRPC-Web request: %v", err), nil)
+			return
+		}
+		if err := stream.SendMsg(&frame{payload: payload}); err != nil {
+			// The backend's status is read below
+			break
+		}
+	}
+	stream.CloseSend()
+
+	// Server streams outlast the listener's write timeout
+	out.controller.SetWriteDeadline(time.Time{})
+
+	header, err := stream.Header()
+	if err == nil {
+		setGRPCWebHeaders(w.Header(), header)
+	}
+	for err == nil {
+		msg := &frame{}
+		if err = stream.RecvMsg(msg); err == nil {
+			err = out.write(grpcWebDataFrame, msg.payload)
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	out.finish(err, stream.Trailer())
+}
+
+// grpcWebWriter frames responses, base64 encoding each frame for the text
+// encoding
+type grpcWebWriter struct {
+	w          http.ResponseWriter
+	text       bool
+	controller *http.ResponseController
+	code       codes.Code // status the call finished with
+}
+
+func (g *grpcWebWriter) write(flag byte, payload []byte) error {
+	data := make([]byte, 5+len(payload))
+	data[0] = flag
+	binary.BigEndian.PutUint32(data[1:5], uint32(len(payload)))
+	copy(data[5:], payload)
+	if g.text {
+		data = []byte(base64.StdEncoding.EncodeToString(data))
+	}
+	if _, err := g.w.Write(data); err != nil {
+		return err
+	}
+	g.controller.Flush()
+	return nil
+}
+
+// finish ends the response with a trailer frame carrying the call status
+func (g *grpcWebWriter) finish(err error, trailer metadata.MD) {
+	st := status.Convert(err)
+	g.code = st.Code()
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "grpc-status: %d\r\n", st.Code())
+	if st.Message() != "" {
+		fmt.Fprintf(&buf, "grpc-message: %s\r\n", encodeGRPCMessage(st.Message()))
+	}
+	keys := make([]string, 0, len(trailer))
+	for key := range trailer {
+		if key != "content-type" && !strings.HasPrefix(key, ":") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range trailer[key] {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, metadataValue(key, value))
+		}
+	}
+	g.write(grpcWebTrailerFrame, buf.Bytes())
+}
+
+// setGRPCWebHeaders copies backend response metadata onto HTTP headers
+func setGRPCWebHeaders(h http.Header, md metadata.MD) {
+	for key, values := range md {
+		if key == "content-type" || strings.HasPrefix(key, ":") {
+			continue
+		}
+		for _, value := range values {
+			h.Add(key, metadataValue(key, value))
+		}
+	}
+}
+
+// metadataValue encodes binary metadata as base64, as gRPC does on the wire
+func metadataValue(key, value string) string {
+	if strings.HasSuffix(key, "-bin") {
+		return base64.StdEncoding.EncodeToString([]byte(value))
+	}
+	return value
+}
+
+// readGRPCWebFrame reads one length-prefixed message, returning io.EOF at the
+// end of the body
+func readGRPCWebFrame(r io.Reader, maxSize int) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated frame header")
+		}
+		return nil, err
+	}
+	if prefix[0]&0x01 != 0 {
+		return nil, fmt.Errorf("compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if maxSize > 0 && int64(length) > int64(maxSize) {
+		return nil, fmt.Errorf("message of %d bytes exceeds the %d byte limit", length, maxSize)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("truncated message: %w", err)
+	}
+	return payload, nil
+}
+
+// parseGRPCTimeout parses a grpc-timeout header such as "10S" or "250m"
+func parseGRPCTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+	unit, ok := units[value[len(value)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// encodeGRPCMessage percent-encodes a status message as the gRPC protocol
+// requires
+func encodeGRPCMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c >= 0x20 && c <= 0x7e && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package router
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"dynamic-gateway/internal/identity"
+)
+
+// httpHashKey returns the request attribute a route's hash_key names for
+// consistent hashing: a header, a cookie, the client certificate or, by
+// default, the client IP
+func httpHashKey(key string, r *http.Request) string {
+	attribute, name, _ := strings.Cut(key, ":")
+	switch attribute {
+	case "client_cert":
+		return identity.FromCertificate(r.TLS)
+	case "header":
+		return r.Header.Get(name)
+	case "cookie":
+		if cookie, err := r.Cookie(name); err == nil {
+			return cookie.Value
+		}
+		return ""
+	}
+	return identity.ClientIP(r)
+}
+
+// grpcHashKey returns the call attribute a service's hash_key names for
+// consistent hashing: a metadata key, the client certificate or, by default,
+// the client IP
+func grpcHashKey(ctx context.Context, key string, incoming metadata.MD) string {
+	attribute, name, _ := strings.Cut(key, ":")
+	switch attribute {
+	case "client_cert":
+		return identity.FromCertificate(peerTLS(ctx))
+	case "metadata", "header":
+		if values := incoming.Get(name); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			return host
+		}
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// grpcClient identifies the client of a call by its authenticated consumer,
+// or else its IP
+func grpcClient(ctx context.Context) string {
+	if consumer := identity.Consumer(ctx); consumer != "" {
+		return consumer
+	}
+	return grpcHashKey(ctx, "", nil)
+}
+
+// peerTLS returns the TLS connection state of a call's client, nil for
+// plaintext connections
+func peerTLS(ctx context.Context) *tls.ConnectionState {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			return &info.State
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package router
+
+import (
+	"fmt"
+
+	"dynamic-gateway/internal/config"
+)
+
+// headerLimits returns a route's or service's header limits, falling back to
+// the global ones
+func headerLimits(global, own *config.HeaderLimits) *config.HeaderLimits {
+	if own != nil {
+		return own
+	}
+	return global
+}
+
+// checkHeaderLimits reports request headers or metadata exceeding limits;
+// each value of a repeated header counts as a field
+func checkHeaderLimits(header map[string][]string, limits *config.HeaderLimits) error {
+	if limits == nil {
+		return nil
+	}
+	count, size := 0, 0
+	for name, values := range header {
+		for _, value := range values {
+			count++
+			size += len(name) + len(value)
+		}
+	}
+	if limits.MaxCount > 0 && count > limits.MaxCount {
+		return fmt.Errorf("%d header fields exceed the limit of %d", count, limits.MaxCount)
+	}
+	if limits.MaxSize > 0 && size > limits.MaxSize {
+		return fmt.Errorf("%d bytes of headers exceed the limit of %d", size, limits.MaxSize)
+	}
+	return nil
+}
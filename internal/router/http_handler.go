@@ -3,89 +3,477 @@ package router
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/netip"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
 	"dynamic-gateway/internal/balancer"
+	"dynamic-gateway/internal/breaker"
+	"dynamic-gateway/internal/budget"
+	"dynamic-gateway/internal/callcreds"
+	"dynamic-gateway/internal/cluster"
 	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/converter"
+	"dynamic-gateway/internal/federation"
+	"dynamic-gateway/internal/identity"
+	"dynamic-gateway/internal/journal"
+	"dynamic-gateway/internal/middleware"
 	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/probe"
+	"dynamic-gateway/internal/requestinfo"
+	"dynamic-gateway/internal/schema"
+	"dynamic-gateway/internal/storage"
+	"dynamic-gateway/internal/tracing"
 )
 
 // HTTPHandler handles HTTP requests
 type HTTPHandler struct {
 	config         *config.Config
 	connectionPool *pool.ConnectionPool
-	balancers      map[string]*balancer.RoundRobinBalancer
-	converter      *ProtocolConverter
+	balancers      map[string]balancer.Balancer
+	metadata       map[string]*metadataTemplate
+	federated      map[string]map[string]bool
+	regions        map[string]map[string]string
+	backends       map[string]map[string]config.Backend
+	converters     *converter.Registry
+	budgets        *budget.Tracker
+	budgetProxies  []netip.Prefix
+	versionProxies []netip.Prefix
+	deprecations   *deprecationTracker
+	sniffer        *protocolSniffer
+	journal        *journal.Journal
+	errorBudgets   map[string]*errorBudget
+	selectors      map[string]*poolSelector
+	pipelines      map[string]http.Handler
+	retries        map[string]*retryPolicy
+	tokenAuth      map[string]*tokenAuth
+	callCreds      map[string]oauth2.TokenSource
+	rateLimits     map[string]*rateLimiter
+	mocks          map[string]*mockResponder
+	schedules      map[string][]*routeSchedule
+	mirrors        chan struct{} // copies of requests in flight to shadow backends
+	breakers       *breaker.Set
+	tracer         *tracing.Tracer
+	fallback       *config.HTTPRoute
+	unmatched      *unmatchedCounters
+	descriptors    *schema.Store
+	middlewareDeps middleware.Dependencies
 	mu             sync.RWMutex
 }
 
-// NewHTTPHandler creates a new HTTP handler
-func NewHTTPHandler(cfg *config.Config, pool *pool.ConnectionPool) *HTTPHandler {
+// NewHTTPHandler creates a new HTTP handler. It fails when a route's
+// balancer, credentials or middleware cannot be built, so no route is served
+// with part of its policies missing.
+func NewHTTPHandler(cfg *config.Config, pool *pool.ConnectionPool, descriptors *schema.Store, store storage.Store, journal *journal.Journal, breakers *breaker.Set, tracer *tracing.Tracer, middlewareDeps middleware.Dependencies) (*HTTPHandler, error) {
 	handler := &HTTPHandler{
 		config:         cfg,
 		connectionPool: pool,
-		balancers:      make(map[string]*balancer.RoundRobinBalancer),
-		converter:      NewProtocolConverter(pool),
+		balancers:      make(map[string]balancer.Balancer),
+		metadata:       make(map[string]*metadataTemplate),
+		federated:      make(map[string]map[string]bool),
+		regions:        make(map[string]map[string]string),
+		backends:       make(map[string]map[string]config.Backend),
+		converters:     converter.NewRegistry(converter.Dependencies{Pool: pool, Descriptors: descriptors}),
+		deprecations:   newDeprecationTracker(),
+		sniffer:        newProtocolSniffer(pool),
+		journal:        journal,
+		errorBudgets:   make(map[string]*errorBudget),
+		selectors:      make(map[string]*poolSelector),
+		pipelines:      make(map[string]http.Handler),
+		retries:        make(map[string]*retryPolicy),
+		tokenAuth:      make(map[string]*tokenAuth),
+		callCreds:      make(map[string]oauth2.TokenSource),
+		rateLimits:     make(map[string]*rateLimiter),
+		mocks:          make(map[string]*mockResponder),
+		schedules:      make(map[string][]*routeSchedule),
+		mirrors:        make(chan struct{}, maxMirrorsInFlight),
+		breakers:       breakers,
+		tracer:         tracer,
+		unmatched:      &unmatchedCounters{},
+		descriptors:    descriptors,
+		middlewareDeps: middlewareDeps,
+	}
+
+	if cfg.CostBudget != nil {
+		window, _ := time.ParseDuration(cfg.CostBudget.Window)
+		handler.budgets = budget.NewTracker(store, cfg.CostBudget.Limit, window)
+		handler.budgetProxies = parsePrefixes(cfg.CostBudget.TrustedProxies)
 	}
+	handler.versionProxies = versionProxies(cfg)
 
 	// Initialize balancers for each route
-	for i, route := range cfg.HTTPRoutes {
-		backends := make([]string, len(route.Backends))
-		for j, b := range route.Backends {
-			backends[j] = b.Address
+	for i := range cfg.HTTPRoutes {
+		if err := handler.addRoute(fmt.Sprintf("route_%d", i), &cfg.HTTPRoutes[i]); err != nil {
+			handler.Close()
+			return nil, fmt.Errorf("route %s: %w", cfg.HTTPRoutes[i].Path, err)
+		}
+	}
+	if d := cfg.DefaultBackend; d != nil {
+		handler.fallback = &config.HTTPRoute{
+			Path:          "/",
+			Backends:      d.Backends,
+			LoadBalancing: d.LoadBalancing,
+			Timeout:       d.Timeout,
+		}
+		if err := handler.addRoute(defaultRouteKey, handler.fallback); err != nil {
+			handler.Close()
+			return nil, fmt.Errorf("default backend: %w", err)
 		}
-		routeKey := fmt.Sprintf("route_%d", i)
-		handler.balancers[routeKey] = balancer.NewRoundRobinBalancer(backends)
 	}
 
-	return handler
+	return handler, nil
+}
+
+// addRoute registers the backend pools, policies and middleware of a route
+func (h *HTTPHandler) addRoute(routeKey string, route *config.HTTPRoute) error {
+	if err := h.addPool(routeKey, route, route.Backends); err != nil {
+		return err
+	}
+	h.metadata[routeKey] = newMetadataTemplate(route.Metadata)
+	h.retries[routeKey] = newRetryPolicy(route.Retry)
+	if route.JWT != nil {
+		h.tokenAuth[routeKey] = newJWTAuth(route.JWT)
+	}
+	if route.Introspection != nil {
+		h.tokenAuth[routeKey] = newIntrospectionAuth(route.Introspection)
+	}
+	if route.CallCredentials != nil {
+		source, err := callcreds.TokenSource(context.Background(), route.CallCredentials)
+		if err != nil {
+			return fmt.Errorf("failed to set up call credentials: %w", err)
+		}
+		h.callCreds[routeKey] = source
+	}
+	if route.RateLimit != nil {
+		h.rateLimits[routeKey] = newRateLimiter(route.RateLimit)
+	}
+	if route.SLO != nil {
+		h.errorBudgets[routeKey] = newErrorBudget(route.SLO)
+	}
+	if route.Mock != nil {
+		h.mocks[routeKey] = newMockResponder(route.Mock)
+	}
+
+	for name, version := range route.Versions {
+		if err := h.addPool(poolKey(routeKey, name), route, version.Backends); err != nil {
+			return err
+		}
+	}
+
+	if len(route.Schedules) > 0 {
+		h.schedules[routeKey] = newRouteSchedules(route.Schedules)
+		for _, s := range route.Schedules {
+			if len(s.Backends) == 0 {
+				continue
+			}
+			if err := h.addPool(schedulePoolKey(routeKey, s.Name), route, s.Backends); err != nil {
+				return err
+			}
+		}
+	}
+
+	pools := make(map[string]bool)
+	for name, backends := range route.Pools {
+		if err := h.addPool(namedPoolKey(routeKey, name), route, backends); err != nil {
+			return err
+		}
+		pools[name] = true
+	}
+	h.selectors[routeKey] = newPoolSelector(route.PoolSelector, pools)
+
+	// Route middleware runs once the route is matched
+	if len(route.Middleware) > 0 {
+		pipeline, err := middleware.Chain(h.config, h.middlewareDeps, route.Middleware, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.serveRoute(w, r, route, routeKey)
+		}))
+		if err != nil {
+			return err
+		}
+		h.pipelines[routeKey] = pipeline
+	}
+	return nil
+}
+
+// addPool registers a balancer for a backend pool
+func (h *HTTPHandler) addPool(key string, route *config.HTTPRoute, pool []config.Backend) error {
+	backends := make([]string, len(pool))
+	for i, b := range pool {
+		backends[i] = b.Address
+	}
+	backends = balancer.Subset(backends, route.SubsetSize, cluster.Identity(h.config.Cluster))
+	b, err := balancer.New(route.LoadBalancing, backends, backendWeights(pool))
+	if err != nil {
+		return err
+	}
+	h.balancers[key] = b
+	h.federated[key] = federatedBackends(pool)
+	h.regions[key] = backendRegions(pool)
+	h.backends[key] = backendConfigs(pool)
+	return nil
 }
 
 // ServeHTTP implements http.Handler
 func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Find matching route
-	route, routeKey := h.findRoute(r.URL.Path, r.Method)
-	if route == nil {
+	route, routeKey, allowed := h.findRoute(r.URL.Path, r.Method)
+	switch {
+	case route != nil:
+	case len(allowed) > 0:
+		h.unmatched.methodNotAllowed.Add(1)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	case h.fallback != nil:
+		h.unmatched.defaultBackend.Add(1)
+		route, routeKey = h.fallback, defaultRouteKey
+	default:
+		h.unmatched.notFound.Add(1)
 		http.Error(w, "route not found", http.StatusNotFound)
 		return
 	}
 
+	r, info := requestinfo.Ensure(r)
+	info.Route = route.Path
+	info.Consumer = identity.FromRequest(r, "")
+	if route.Sampling != nil && route.Sampling.AccessLog != nil {
+		info.AccessLogRate = route.Sampling.AccessLog
+	}
+	span := startHTTPSpan(h.tracer, r, route.Path, h.config.TracingRate(route))
+
+	inFlight := httpInFlight.With(route.Path)
+	inFlight.Inc()
+	mw := &metricsWriter{ResponseWriter: w}
+	w = mw
+	defer func(start time.Time) {
+		inFlight.Dec()
+		observeHTTP(route.Path, r.Method, info.Backend, mw.status, time.Since(start))
+		endHTTPSpan(span, info.Backend, mw.status)
+	}(time.Now())
+
+	if pipeline := h.pipelines[routeKey]; pipeline != nil {
+		pipeline.ServeHTTP(w, r)
+		return
+	}
+	h.serveRoute(w, r, route, routeKey)
+}
+
+// serveRoute handles a request matched to route
+func (h *HTTPHandler) serveRoute(w http.ResponseWriter, r *http.Request, route *config.HTTPRoute, routeKey string) {
+	info := requestinfo.From(r.Context())
+
+	// Reject header floods some backends cannot handle
+	if err := checkHeaderLimits(r.Header, headerLimits(h.config.HeaderLimits, route.HeaderLimits)); err != nil {
+		http.Error(w, err.Error(), http.StatusRequestHeaderFieldsTooLarge)
+		return
+	}
+
+	// Require a valid bearer token
+	if auth := h.tokenAuth[routeKey]; auth != nil {
+		var ok bool
+		if r, ok = auth.authenticateHTTP(w, r); !ok {
+			return
+		}
+		info.Consumer = identity.FromRequest(r, "")
+	}
+
+	// Journal request metadata
+	if h.journal != nil {
+		var record func()
+		w, r, record = startJournal(h.journal, w, r, info, route.JournalBodies)
+		defer record()
+	}
+
+	// Enforce request and response media types
+	if !acceptsContentType(r, route.Consumes) {
+		w.Header().Set("Accept", strings.Join(route.Consumes, ", "))
+		http.Error(w, "unsupported content type", http.StatusUnsupportedMediaType)
+		return
+	}
+	accept, ok := negotiate(r, route.Produces)
+	if !ok {
+		http.Error(w, fmt.Sprintf("route produces %s", strings.Join(route.Produces, ", ")), http.StatusNotAcceptable)
+		return
+	}
+
+	// Apply deprecation lifecycle
+	if !h.deprecations.apply(w, r, route) {
+		return
+	}
+
+	// Shed load when the route's error budget is burning critically
+	if budget := h.errorBudgets[routeKey]; budget != nil {
+		if !budget.admit(w) {
+			return
+		}
+		w = &sloWriter{ResponseWriter: w, budget: budget}
+	}
+
+	// Enforce consumer cost budget; clients could spread their costs over
+	// made-up consumers, so only trusted upstreams may name one. Synthetic
+	// probes cost nothing.
+	if h.budgets != nil && !probe.Synthetic(r.Context()) {
+		consumer := identity.FromTrustedRequest(r, h.config.CostBudget.ConsumerHeader, h.budgetProxies)
+		remaining, resetAt, err := h.budgets.Remaining(r.Context(), consumer)
+		if err != nil {
+			log.Printf("Failed to read cost budget for %s: %v", consumer, err)
+		} else if remaining < routeCost(route) {
+			setBudgetHeaders(w.Header(), h.budgets.Limit(), remaining, resetAt)
+			http.Error(w, "cost budget exceeded", http.StatusTooManyRequests)
+			return
+		}
+		w = &costWriter{ResponseWriter: w, ctx: r.Context(), tracker: h.budgets, consumer: consumer, route: route}
+	}
+
+	// Enforce data residency
+	var region string
+	if h.config.DataResidency != nil {
+		region = dataRegion(r.Context(), h.config.DataResidency, r.Header.Get)
+		if !regionAllowed(route.Regions, region) {
+			http.Error(w, fmt.Sprintf("route does not serve data region %s", region), http.StatusForbidden)
+			return
+		}
+	}
+
+	// Throttle the route's requests
+	if !h.rateLimits[routeKey].admit(w, r) {
+		return
+	}
+
+	// Apply the schedule whose time window is open
+	now := time.Now()
+	schedule := activeSchedule(h.schedules[routeKey], now)
+	if schedule != nil && !schedule.admit(w, r, now) {
+		return
+	}
+
+	// Answer mocked routes with their example responses instead of backends
+	if mock := h.mocks[routeKey]; mock != nil {
+		mock.serve(w, r)
+		return
+	}
+
+	// Forward strip_path routes without their prefix
+	r = stripPath(r, route)
+
+	// Select the scheduled backends, or the consumer's pinned API version
+	pool := routeKey
+	if schedule != nil && schedule.backends {
+		pool = schedulePoolKey(routeKey, schedule.name)
+	} else if version := resolveVersion(h.config.APIVersioning, h.versionProxies, r); version != "" {
+		if v, ok := route.Versions[version]; ok {
+			pool = poolKey(routeKey, version)
+			r = applyVersion(r, v)
+			w.Header().Set("X-API-Version", version)
+		}
+	}
+
+	// Select a named pool from request attributes, or by traffic split
+	if pool == routeKey {
+		name := h.selectors[routeKey].selectPool(httpAttributes(r, ""))
+		if name == "" {
+			name = splitPool(route.TrafficSplit)
+		}
+		if name != "" {
+			pool = namedPoolKey(routeKey, name)
+		}
+	}
+
+	// Apply backend authentication mode
+	r = applyAuth(r, route.Auth)
+	if source := h.callCreds[routeKey]; source != nil {
+		token, err := source.Token()
+		if err != nil {
+			log.Printf("Failed to obtain access token for route %s: %v", route.Path, err)
+			http.Error(w, "failed to obtain upstream credentials", http.StatusBadGateway)
+			return
+		}
+		r.Header.Set("Authorization", token.Type()+" "+token.AccessToken)
+	}
+
+	// Describe the client certificate in place of any description sent by
+	// the client, which only routes trusting the proxy in front pass on
+	forwardCert := h.config.ServerTLS != nil && h.config.ServerTLS.ForwardClientCert
+	if forwardCert || !route.TrustClientCert {
+		r.Header.Del(identity.ForwardedClientCertHeader)
+	}
+	if forwardCert {
+		if xfcc := identity.ForwardedClientCert(r.TLS); xfcc != "" {
+			r.Header.Set(identity.ForwardedClientCertHeader, xfcc)
+		}
+	}
+
 	// Get next backend
-	balancer := h.balancers[routeKey]
+	balancer := h.balancers[pool]
 	if balancer == nil {
 		http.Error(w, "no balancer configured", http.StatusInternalServerError)
 		return
 	}
 
-	backendAddr := balancer.Next()
+	balancer = keyed(balancer, httpHashKey(route.HashKey, r))
+
+	backendAddr := nextAvailable(balancer, h.regions[pool], region, h.breakers)
+	if backendAddr == "" && region != "" {
+		http.Error(w, fmt.Sprintf("no backends available in data region %s", region), http.StatusForbidden)
+		return
+	}
 	if backendAddr == "" {
 		http.Error(w, "no backends available", http.StatusServiceUnavailable)
 		return
 	}
+	info.Backend = backendAddr
+	httpPicks.With(route.Path, backendAddr).Inc()
+	defer beginRequest(balancer, backendAddr)()
+	tenant := h.tenant(r)
+	dial := tenantDial(h.config.Tenancy, dialOptions(h.backends[pool][backendAddr], route.UpstreamHost), tenant)
 
-	// Route based on target protocol
-	if route.TargetProtocol == "grpc" {
-		// HTTP → gRPC
-		h.routeHTTPToGRPC(w, r, route, backendAddr)
-	} else {
+	// Route based on target protocol; federated gateways receive the
+	// request untransformed and convert it themselves
+	federated := h.federated[pool][backendAddr]
+	protocol := route.TargetProtocol
+	if protocol == "auto" && !federated {
+		protocol = h.sniffer.detect(r.Context(), backendAddr)
+		if protocol == "grpc" {
+			backendAddr = grpcTarget(backendAddr)
+		} else {
+			backendAddr = httpTarget(backendAddr)
+		}
+	}
+	if protocol == string(converter.GRPCStream) && !federated {
+		// WebSocket ↔ gRPC stream
+		h.routeWebSocket(w, r, route, routeKey, backendAddr, dial)
+		return
+	}
+	if protocol == "" || protocol == "http" || federated {
 		// HTTP → HTTP
-		h.routeHTTPToHTTP(w, r, route, backendAddr)
+		next := h.nextBackend(route, pool, region, tenant, info.Backend)
+		h.routeHTTPToHTTP(w, r, route, routeKey, pool, backendAddr, dial, next, federated)
+	} else {
+		// HTTP → gRPC or any other registered conversion
+		next := h.nextBackend(route, pool, region, tenant, info.Backend)
+		h.routeHTTPConverted(w, r, route, routeKey, pool, backendAddr, dial, next, accept, converter.Protocol(protocol))
 	}
 }
 
-// routeHTTPToHTTP forwards HTTP request to HTTP backend
-func (h *HTTPHandler) routeHTTPToHTTP(w http.ResponseWriter, r *http.Request, route *config.HTTPRoute, backendAddr string) {
+// routeHTTPToHTTP forwards HTTP request to HTTP backend, moving on to the
+// backends next yields while the pool refuses to dial them
+func (h *HTTPHandler) routeHTTPToHTTP(w http.ResponseWriter, r *http.Request, route *config.HTTPRoute, routeKey, poolKey, backendAddr string, dial pool.Options, next func() (string, pool.Options, func()), federated bool) {
 	// Build target URL
-	targetURL := backendAddr + r.URL.Path
+	requestURI := r.URL.Path
 	if r.URL.RawQuery != "" {
-		targetURL += "?" + r.URL.RawQuery
+		requestURI += "?" + r.URL.RawQuery
 	}
+	targetURL := backendAddr + requestURI
 
 	// Read body
 	bodyBytes, err := io.ReadAll(r.Body)
@@ -94,28 +482,145 @@ func (h *HTTPHandler) routeHTTPToHTTP(w http.ResponseWriter, r *http.Request, ro
 		return
 	}
 	defer r.Body.Close()
+	h.mirrorRequest(route.Mirror, r, bodyBytes)
 
-	// Create proxy request
-	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, bytes.NewReader(bodyBytes))
+	// Create proxy request; every attempt gets its own
+	newProxyRequest := func(ctx context.Context) (*http.Request, error) {
+		proxyReq, err := http.NewRequestWithContext(ctx, r.Method, targetURL, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return nil, err
+		}
+		// Follow mode resends the body on 307 and 308 redirects
+		proxyReq.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+		}
+
+		// Copy headers
+		for key, values := range r.Header {
+			for _, value := range values {
+				proxyReq.Header.Add(key, value)
+			}
+		}
+		if federated {
+			federation.SetHeaders(h.federation(), proxyReq.Header, r.Header, identity.Consumer(r.Context()))
+		}
+		if dial.Authority != "" {
+			proxyReq.Host = dial.Authority
+		}
+
+		// Byte ranges address the encoded representation; keep the transport from
+		// requesting gzip and transparently decoding the partial body
+		if proxyReq.Header.Get("Range") != "" && proxyReq.Header.Get("Accept-Encoding") == "" {
+			proxyReq.Header.Set("Accept-Encoding", "identity")
+		}
+		return proxyReq, nil
+	}
+
+	// Set timeout; it covers every attempt
+	ctx, cancel := context.WithTimeout(r.Context(), routeTimeout(route, r))
+	defer cancel()
+	client, err := h.connectionPool.HTTPClient(dial, 0)
 	if err != nil {
-		http.Error(w, "failed to create proxy request", http.StatusInternalServerError)
+		log.Printf("HTTP proxy error: %v", err)
+		http.Error(w, "backend request failed", http.StatusBadGateway)
 		return
 	}
+	client.CheckRedirect = checkRedirect(route.Redirects)
 
-	// Copy headers
-	for key, values := range r.Header {
-		for _, value := range values {
-			proxyReq.Header.Add(key, value)
+	// Execute request, retrying failures as the route's retry policy allows
+	info := requestinfo.From(r.Context())
+	retry := h.retries[routeKey]
+	retry.record()
+
+	// moveOn switches the request to the next backend of the pool, reporting
+	// false when none is left
+	var release []func()
+	defer func() {
+		for _, done := range release {
+			done()
+		}
+	}()
+	moveOn := func(cause error) (bool, error) {
+		addr, addrDial, done := next()
+		if addr == "" {
+			return false, nil
+		}
+		release = append(release, done)
+		log.Printf("Failing over %s %s from %s to %s: %v", r.Method, r.URL.Path, info.Backend, addr, cause)
+		addrClient, err := h.connectionPool.HTTPClient(addrDial, 0)
+		if err != nil {
+			return false, err
+		}
+		client = addrClient
+		client.CheckRedirect = checkRedirect(route.Redirects)
+		info.Backend, backendAddr, dial, federated = addr, addr, addrDial, false
+		if route.TargetProtocol == "auto" {
+			backendAddr = httpTarget(addr)
 		}
+		targetURL = backendAddr + requestURI
+		return true, nil
 	}
 
-	// Set timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+	var proxyReq *http.Request
+	var resp *http.Response
+	// Failed attempts are cancelled as soon as they are given up; the last
+	// one lives until its response has been relayed
+	cancelAttempt := context.CancelFunc(func() {})
+	defer func() { cancelAttempt() }()
+	for retries := 0; ; retries++ {
+		cancelAttempt()
+		var attemptCtx context.Context
+		attemptCtx, cancelAttempt = retry.attempt(ctx)
+		proxyReq, err = newProxyRequest(attemptCtx)
+		if err != nil {
+			http.Error(w, "failed to create proxy request", http.StatusInternalServerError)
+			return
+		}
+		resp, err = client.Do(proxyReq)
+		if r.Context().Err() == nil {
+			succeeded := err == nil && resp.StatusCode < 500
+			h.breakers.Record(info.Backend, succeeded)
+			if !succeeded {
+				recordFailure(h.balancers[poolKey], info.Backend)
+			}
+		}
+		// Nothing was sent to a backend the pool refused to dial, so the
+		// request moves on without using up a retry
+		if err != nil && dialRefused(ctx, err) {
+			moved, moveErr := moveOn(err)
+			if moveErr != nil {
+				err = moveErr
+				break
+			}
+			if moved {
+				retries--
+				continue
+			}
+		}
+		if err == nil && !retry.retryableStatus(r, resp.StatusCode) {
+			break
+		}
+		if err != nil && !retry.retryableTransport(ctx, r) {
+			break
+		}
+		if !retry.retry(ctx, retries) {
+			break
+		}
+		cause := err
+		if err == nil {
+			cause = fmt.Errorf("status %d", resp.StatusCode)
+			resp.Body.Close()
+		}
+		// Retries go to another backend when the pool has one left
+		moved, moveErr := moveOn(cause)
+		if moveErr != nil {
+			err = moveErr
+			break
+		}
+		if !moved {
+			log.Printf("Retrying %s %s on %s after: %v", r.Method, r.URL.Path, backendAddr, cause)
+		}
 	}
-
-	// Execute request
-	resp, err := client.Do(proxyReq)
 	if err != nil {
 		log.Printf("HTTP proxy error: %v", err)
 		http.Error(w, "backend request failed", http.StatusBadGateway)
@@ -123,86 +628,364 @@ func (h *HTTPHandler) routeHTTPToHTTP(w http.ResponseWriter, r *http.Request, ro
 	}
 	defer resp.Body.Close()
 
+	// Keep backend hostnames out of redirects
+	rewriteLocation(resp, route.Redirects, strippedPrefix(route), proxyReq.URL.Host, proxyReq.Host)
+
 	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
+	copyHeaders := func() {
+		for key, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
 		}
 	}
 
+	// Validator-only responses such as 304 are relayed without a body
+	if !bodyAllowed(r.Method, resp.StatusCode) {
+		copyHeaders()
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+
+	// Enforce response size limit
+	body, ok := limitResponse(w, route, resp)
+	if !ok {
+		return
+	}
+
+	copyHeaders()
+
 	// Copy status code
 	w.WriteHeader(resp.StatusCode)
 
 	// Copy response body
-	if _, err := io.Copy(w, resp.Body); err != nil {
+	if _, err := io.Copy(w, body); err != nil {
 		log.Printf("Failed to copy response: %v", err)
 	}
 }
 
-// routeHTTPToGRPC converts HTTP request to gRPC call
-func (h *HTTPHandler) routeHTTPToGRPC(w http.ResponseWriter, r *http.Request, route *config.HTTPRoute, backendAddr string) {
-	// Extract service and method from path
-	// Expected format: /grpc/{service}/{method}
-	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-	if len(pathParts) < 3 {
-		http.Error(w, "invalid path format, expected /grpc/{service}/{method}", http.StatusBadRequest)
+// routeHTTPConverted converts an HTTP request to the route's target protocol
+func (h *HTTPHandler) routeHTTPConverted(w http.ResponseWriter, r *http.Request, route *config.HTTPRoute, routeKey, poolKey, backendAddr string, dial pool.Options, next func() (string, pool.Options, func()), accept string, target converter.Protocol) {
+	conv, ok := h.converters.Get(converter.HTTP, target)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no converter for http to %s", target), http.StatusInternalServerError)
+		return
+	}
+
+	// Compressed bodies are decoded for transcoding, within the route's limits
+	if err := decompressRequest(r, route.Decompression); err != nil {
+		switch {
+		case errors.Is(err, errDecompressionLimit):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		case errors.Is(err, errUnsupportedEncoding):
+			http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		default:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
 		return
 	}
 
-	serviceName := pathParts[1]
-	methodName := pathParts[2]
+	// Map the request onto a method through its google.api.http binding, or
+	// the /{prefix}/{service}/{method} convention
+	var serviceName, methodName string
+	binding, params, ok := h.httpBinding(r, target)
+	if ok {
+		serviceName = string(binding.Method.Parent().FullName())
+		methodName = string(binding.Method.Name())
+	} else {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(pathParts) < 3 {
+			http.Error(w, fmt.Sprintf("invalid path format, expected /%s/{service}/{method}", target), http.StatusBadRequest)
+			return
+		}
+		serviceName = pathParts[1]
+		methodName = pathParts[2]
+	}
 
-	// Convert HTTP to gRPC
-	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	// Convert HTTP to target protocol; server streams last as long as the
+	// client allows
+	streaming := h.serverStreaming(binding, serviceName, methodName)
+	var page *converter.Page
+	if streaming && route.StreamPagination != nil {
+		// Pages are unary responses bound by the route timeout
+		var err error
+		if page, err = streamPage(r, route.StreamPagination); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		streaming = false
+	}
+	var table *converter.Table
+	var disposition string
+	if streaming && route.StreamExport != nil {
+		table, disposition = streamTable(r, route.StreamExport)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), routeTimeout(route, r))
+	if streaming {
+		ctx, cancel = clientDeadline(r.Context(), r)
+	}
 	defer cancel()
 
-	responseBytes, err := h.converter.HTTPToGRPC(ctx, serviceName, methodName, r, backendAddr)
+	// Attach route metadata
+	if tmpl := h.metadata[routeKey]; tmpl != nil {
+		ctx = metadata.NewOutgoingContext(ctx, tmpl.render(httpAttributes(r, serviceName)))
+	}
+
+	policy := newCallPolicy(route.CallPolicy)
+	callOpts := []grpc.CallOption{policy.option()}
+
+	// Keep the body for further attempts
+	retry := h.retries[routeKey]
+	retry.record()
+	idempotent := target == converter.GRPC && idempotentRequest(h.descriptors, r, serviceName, methodName)
+	var body []byte
+	if policy.failover > 0 || retry != nil || idempotent {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			http.Error(w, "failed to read request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var resp *converter.Response
+	var err error
+	current := requestinfo.From(r.Context()).Backend
+	failovers, retries := 0, 0
+	reconnected := false
+	var release []func()
+	defer func() {
+		for _, done := range release {
+			done()
+		}
+	}()
+	// Failed attempts are cancelled as soon as they are given up
+	cancelAttempt := context.CancelFunc(func() {})
+	defer func() { cancelAttempt() }()
+	for {
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		cancelAttempt()
+		attemptCtx := ctx
+		if !streaming {
+			var cancelCall, cancelTry context.CancelFunc
+			attemptCtx, cancelCall = policy.attempt(ctx)
+			attemptCtx, cancelTry = retry.attempt(attemptCtx)
+			cancelAttempt = func() {
+				cancelTry()
+				cancelCall()
+			}
+		}
+		resp, err = conv.Convert(attemptCtx, &converter.Request{
+			Service:         serviceName,
+			Method:          methodName,
+			Backend:         backendAddr,
+			Dial:            dial,
+			HTTP:            r,
+			Accept:          accept,
+			Binding:         binding,
+			PathParams:      params,
+			CallOptions:     callOpts,
+			MaxResponseSize: int(route.MaxResponseSize),
+			Page:            page,
+			Table:           table,
+		})
+		recordCall(ctx, h.breakers, h.balancers[poolKey], current, err)
+		if err == nil {
+			break
+		}
+		if h.connectionLost(ctx, err, backendAddr, dial) && idempotent && !reconnected {
+			log.Printf("Retrying /%s/%s on a new connection to %s after: %v", serviceName, methodName, backendAddr, err)
+			reconnected = true
+			continue
+		}
+		if (failovers < policy.failover && policy.retryable(ctx, err)) || dialRefused(ctx, err) {
+			if addr, addrDial, done := next(); addr != "" {
+				release = append(release, done)
+				log.Printf("Failing over /%s/%s from %s to %s: %v", serviceName, methodName, current, addr, err)
+				current, backendAddr, dial = addr, addr, addrDial
+				if route.TargetProtocol == "auto" {
+					backendAddr = grpcTarget(addr)
+				}
+				if !dialRefused(ctx, err) {
+					failovers++
+				}
+				continue
+			}
+		}
+		if !retry.retryableError(ctx, err) || !retry.retry(ctx, retries) {
+			break
+		}
+		retries++
+		log.Printf("Retrying /%s/%s on %s after: %v", serviceName, methodName, backendAddr, err)
+	}
 	if err != nil {
-		log.Printf("HTTP to gRPC conversion failed: %v", err)
+		log.Printf("HTTP to %s conversion failed: %v", target, err)
+		if tooLarge(err) {
+			http.Error(w, "backend response too large", http.StatusBadGateway)
+			return
+		}
 		http.Error(w, fmt.Sprintf("protocol conversion failed: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if resp.Stream != nil {
+		if table != nil {
+			w.Header().Set("Content-Disposition", disposition)
+		}
+		writeStream(w, resp)
+		return
+	}
+	if err := checkTranscodedSize(route, resp.Body); err != nil {
+		log.Printf("HTTP to %s response rejected: %v", target, err)
+		http.Error(w, "backend response too large", http.StatusBadGateway)
+		return
+	}
 
 	// Write response
-	w.Header().Set("Content-Type", "application/json")
+	contentType := resp.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	// Let clients and CDNs revalidate transcoded responses cheaply
+	etag := entityTag(resp.Body)
+	w.Header().Set("ETag", etag)
+	if notModified(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write(resp.Body)
+}
+
+// serverStreaming reports whether the called gRPC method streams responses
+func (h *HTTPHandler) serverStreaming(binding *schema.HTTPBinding, serviceName, methodName string) bool {
+	if binding != nil {
+		return binding.Method.IsStreamingServer()
+	}
+	if h.descriptors == nil {
+		return false
+	}
+	method, ok := h.descriptors.FindMethod(serviceName, methodName)
+	return ok && method.IsStreamingServer()
+}
+
+// writeStream relays a streamed response, flushing each chunk as it arrives.
+// The server write timeout does not apply to streams.
+func writeStream(w http.ResponseWriter, resp *converter.Response) {
+	controller := http.NewResponseController(w)
+	controller.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", resp.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
 	w.WriteHeader(http.StatusOK)
-	w.Write(responseBytes)
+	for {
+		chunk, err := resp.Stream.Next()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Printf("Streaming response failed: %v", err)
+			return
+		}
+		if _, err := w.Write(chunk); err != nil {
+			return
+		}
+		controller.Flush()
+	}
+}
+
+// federation returns the federation settings, defaulting when not configured
+func (h *HTTPHandler) federation() *config.Federation {
+	if h.config.Federation != nil {
+		return h.config.Federation
+	}
+	return defaultFederation
 }
 
-// findRoute finds a matching route for the given path and method
-func (h *HTTPHandler) findRoute(path, method string) (*config.HTTPRoute, string) {
+// httpBinding finds the google.api.http binding for a request to a gRPC backend
+func (h *HTTPHandler) httpBinding(r *http.Request, target converter.Protocol) (*schema.HTTPBinding, map[string]string, bool) {
+	if target != converter.GRPC || h.descriptors == nil {
+		return nil, nil, false
+	}
+	return h.descriptors.MatchHTTP(r.Method, r.URL.EscapedPath())
+}
+
+// findRoute finds a matching route for the given path and method. When no
+// route matches, it returns the methods of the routes whose path matched.
+func (h *HTTPHandler) findRoute(path, method string) (*config.HTTPRoute, string, []string) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	for i, route := range h.config.HTTPRoutes {
+	i, allowed := matchRoute(h.config.HTTPRoutes, path, method)
+	if i < 0 {
+		return nil, "", allowed
+	}
+	route := h.config.HTTPRoutes[i]
+	return &route, fmt.Sprintf("route_%d", i), nil
+}
+
+// matchRoute returns the index of the first route matching path and method,
+// or -1 and the methods of the routes whose path matched
+func matchRoute(routes []config.HTTPRoute, path, method string) (int, []string) {
+	var allowed []string
+	for i, route := range routes {
 		// Check path match
-		if !h.pathMatches(path, route.Path) {
+		if !pathMatches(path, route.Path) {
 			continue
 		}
 
 		// Check method match
-		if len(route.Methods) > 0 {
-			methodMatch := false
+		if len(route.Methods) > 0 && !slices.Contains(route.Methods, method) {
 			for _, m := range route.Methods {
-				if m == method {
-					methodMatch = true
-					break
+				if !slices.Contains(allowed, m) {
+					allowed = append(allowed, m)
 				}
 			}
-			if !methodMatch {
-				continue
-			}
+			continue
 		}
 
-		routeKey := fmt.Sprintf("route_%d", i)
-		return &route, routeKey
+		return i, nil
 	}
 
-	return nil, ""
+	return -1, allowed
+}
+
+// strippedPrefix returns the path prefix removed from requests to a
+// strip_path route, or "" when the route forwards paths unchanged. Only HTTP
+// backends have their paths stripped; gRPC routes derive the method from it.
+func strippedPrefix(route *config.HTTPRoute) string {
+	if !route.StripPath || (route.TargetProtocol != "" && route.TargetProtocol != "http") {
+		return ""
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(route.Path, "*"), "/")
+}
+
+// stripPath removes the route prefix from the request path
+func stripPath(r *http.Request, route *config.HTTPRoute) *http.Request {
+	prefix := strippedPrefix(route)
+	if prefix == "" || !strings.HasPrefix(r.URL.Path, prefix) {
+		return r
+	}
+	r = r.Clone(r.Context())
+	r.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, prefix), "/")
+	r.URL.RawPath = ""
+	return r
+}
+
+// routeID names a route by its methods and path, telling apart routes that
+// share a path
+func routeID(route *config.HTTPRoute) string {
+	if len(route.Methods) == 0 {
+		return route.Path
+	}
+	return strings.Join(route.Methods, ",") + " " + route.Path
 }
 
 // pathMatches checks if request path matches route path pattern
-func (h *HTTPHandler) pathMatches(requestPath, routePath string) bool {
+func pathMatches(requestPath, routePath string) bool {
 	// Simple prefix matching (can be enhanced with parameter matching)
 	if strings.HasSuffix(routePath, "*") {
 		prefix := strings.TrimSuffix(routePath, "*")
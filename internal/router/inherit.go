@@ -0,0 +1,95 @@
+package router
+
+import (
+	"fmt"
+
+	"dynamic-gateway/internal/config"
+)
+
+// routeIDs maps balancer keys to identifiers that survive route re-ordering,
+// so state can be matched between configurations
+func routeIDs(cfg *config.Config) map[string]string {
+	ids := make(map[string]string)
+	for i, route := range cfg.HTTPRoutes {
+		routeKey := fmt.Sprintf("route_%d", i)
+		id := routeID(&route)
+		ids[routeKey] = id
+		for name := range route.Versions {
+			ids[poolKey(routeKey, name)] = poolKey(id, name)
+		}
+		for name := range route.Pools {
+			ids[namedPoolKey(routeKey, name)] = namedPoolKey(id, name)
+		}
+		for _, s := range route.Schedules {
+			ids[schedulePoolKey(routeKey, s.Name)] = schedulePoolKey(id, s.Name)
+		}
+	}
+	if cfg.DefaultBackend != nil {
+		ids[defaultRouteKey] = defaultRouteKey
+	}
+	return ids
+}
+
+// Inherit carries balancer positions, error budgets, rate limits, cached
+// protocol detection and unmatched request counts over from the handler being
+// replaced, for routes that still exist
+func (h *HTTPHandler) Inherit(prev *HTTPHandler) {
+	prevKeys := make(map[string]string)
+	for key, id := range routeIDs(prev.config) {
+		prevKeys[id] = key
+	}
+
+	for key, id := range routeIDs(h.config) {
+		old, ok := prevKeys[id]
+		if !ok {
+			continue
+		}
+		if b, pb := h.balancers[key], prev.balancers[old]; b != nil && pb != nil {
+			b.Restore(pb.State())
+		}
+		if eb, peb := h.errorBudgets[key], prev.errorBudgets[old]; eb != nil && peb != nil {
+			eb.inherit(peb)
+		}
+		h.rateLimits[key].inherit(prev.rateLimits[old])
+		for _, s := range h.schedules[key] {
+			for _, ps := range prev.schedules[old] {
+				if s.name == ps.name {
+					s.limiter.inherit(ps.limiter)
+				}
+			}
+		}
+	}
+
+	h.sniffer = prev.sniffer
+	h.deprecations = prev.deprecations
+	h.unmatched = prev.unmatched
+}
+
+// Inherit carries balancer positions over from the handler being replaced
+func (h *GRPCHandler) Inherit(prev *GRPCHandler) {
+	for name, b := range h.balancers {
+		if pb := prev.balancers[name]; pb != nil {
+			b.Restore(pb.State())
+		}
+	}
+}
+
+// Close stops what the handler runs in the background, once it has been
+// replaced and no longer serves requests
+func (h *HTTPHandler) Close() {
+	for _, auth := range h.tokenAuth {
+		if auth != nil {
+			auth.Close()
+		}
+	}
+}
+
+// Close stops what the handler runs in the background, once it has been
+// replaced and no longer serves requests
+func (h *GRPCHandler) Close() {
+	for _, auth := range h.jwt {
+		if auth != nil {
+			auth.Close()
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"dynamic-gateway/internal/journal"
+	"dynamic-gateway/internal/requestinfo"
+)
+
+// maxJournalBody caps the bytes of each body captured for the journal
+const maxJournalBody = 64 * 1024
+
+// journalWriter captures the response status and, optionally, body
+type journalWriter struct {
+	http.ResponseWriter
+	status int
+	body   *limitedBuffer
+}
+
+func (jw *journalWriter) WriteHeader(code int) {
+	if jw.status == 0 {
+		jw.status = code
+	}
+	jw.ResponseWriter.WriteHeader(code)
+}
+
+func (jw *journalWriter) Write(b []byte) (int, error) {
+	if jw.status == 0 {
+		jw.status = http.StatusOK
+	}
+	if jw.body != nil {
+		jw.body.Write(b)
+	}
+	return jw.ResponseWriter.Write(b)
+}
+
+func (jw *journalWriter) Unwrap() http.ResponseWriter {
+	return jw.ResponseWriter
+}
+
+// limitedBuffer keeps at most maxJournalBody bytes
+type limitedBuffer struct {
+	bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxJournalBody - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// startJournal wraps the request and response so the journal can record them
+// once the request completes; the returned function must be deferred
+func startJournal(j *journal.Journal, w http.ResponseWriter, r *http.Request, info *requestinfo.Info, captureBodies bool) (http.ResponseWriter, *http.Request, func()) {
+	start := time.Now()
+	jw := &journalWriter{ResponseWriter: w}
+
+	var requestBody *limitedBuffer
+	if captureBodies {
+		requestBody = &limitedBuffer{}
+		jw.body = &limitedBuffer{}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.TeeReader(r.Body, requestBody), r.Body}
+	}
+
+	method, path := r.Method, r.URL.Path
+	return jw, r, func() {
+		entry := journal.Entry{
+			Time:      start.UTC(),
+			Consumer:  info.Consumer,
+			Route:     info.Route,
+			Method:    method,
+			Path:      path,
+			Backend:   info.Backend,
+			Status:    jw.status,
+			LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if captureBodies {
+			entry.RequestBody = requestBody.Bytes()
+			entry.ResponseBody = jw.body.Bytes()
+		}
+		j.Record(entry)
+	}
+}
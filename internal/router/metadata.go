@@ -0,0 +1,217 @@
+package router
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+
+	"google.golang.org/grpc/metadata"
+
+	"dynamic-gateway/internal/identity"
+)
+
+// requestAttributes exposes request properties to metadata templates
+type requestAttributes struct {
+	Method     string
+	Path       string
+	Host       string
+	RemoteAddr string
+	Service    string
+	ClientCert string // identity of the verified client certificate, if any
+	header     func(string) string
+	query      func(string) string
+	claim      func(string) string // of the verified bearer token, if any
+}
+
+// funcs returns the template functions bound to these attributes
+func (a requestAttributes) funcs() template.FuncMap {
+	return template.FuncMap{
+		"header":  orEmpty(a.header),
+		"query":   orEmpty(a.query),
+		"claim":   orEmpty(a.claim),
+		"segment": a.segment,
+	}
+}
+
+// orEmpty substitutes a lookup returning "" for an unavailable attribute
+func orEmpty(lookup func(string) string) func(string) string {
+	if lookup == nil {
+		return func(string) string { return "" }
+	}
+	return lookup
+}
+
+// segment returns the i-th path segment, counting from zero
+func (a requestAttributes) segment(i int) string {
+	parts := strings.Split(strings.Trim(a.Path, "/"), "/")
+	if i < 0 || i >= len(parts) {
+		return ""
+	}
+	return parts[i]
+}
+
+// templateFuncs are placeholders used when parsing request templates
+var templateFuncs = requestAttributes{}.funcs()
+
+// httpAttributes builds template attributes from an HTTP request. The query
+// string is parsed on first use.
+func httpAttributes(r *http.Request, service string) requestAttributes {
+	var query url.Values
+	return requestAttributes{
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Service:    service,
+		ClientCert: identity.FromCertificate(r.TLS),
+		header:     r.Header.Get,
+		query: func(key string) string {
+			if query == nil {
+				query = r.URL.Query()
+			}
+			return query.Get(key)
+		},
+		claim: verifiedClaims(r.Context()),
+	}
+}
+
+// grpcAttributes builds template attributes from incoming gRPC metadata and
+// the call's connection
+func grpcAttributes(ctx context.Context, md metadata.MD, service, method string) requestAttributes {
+	header := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	return requestAttributes{
+		Method:     method,
+		Path:       "/" + service + "/" + method,
+		Host:       header(":authority"),
+		Service:    service,
+		ClientCert: identity.FromCertificate(peerTLS(ctx)),
+		header:     header,
+		claim:      verifiedClaims(ctx),
+	}
+}
+
+// verifiedClaims returns a lookup of the claims of the bearer token verified
+// by jwt, introspection or the id_token middleware; tokens the gateway has not
+// verified are never read. Nested claims are addressed with dots.
+func verifiedClaims(ctx context.Context) func(string) string {
+	claims := identity.Claims(ctx)
+	return func(path string) string {
+		value, _ := claimValue(claims, path)
+		return value
+	}
+}
+
+// requestTemplate is a template rendered over request attributes. Each
+// rendering binds the request's functions to a clone of the parsed template;
+// clones are pooled rather than made per request.
+type requestTemplate struct {
+	parsed *template.Template
+	clones sync.Pool
+}
+
+// parseRequestTemplate parses text using the request template functions
+func parseRequestTemplate(name, text string) (*requestTemplate, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &requestTemplate{parsed: tmpl}, nil
+}
+
+// render executes the template over attrs
+func (t *requestTemplate) render(attrs requestAttributes) (string, error) {
+	tmpl, _ := t.clones.Get().(*template.Template)
+	if tmpl == nil {
+		var err error
+		if tmpl, err = t.parsed.Clone(); err != nil {
+			return "", err
+		}
+	}
+	defer func() {
+		// Drop the request's functions before the clone is reused
+		tmpl.Funcs(templateFuncs)
+		t.clones.Put(tmpl)
+	}()
+	tmpl.Funcs(attrs.funcs())
+
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, attrs); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// metadataTemplate renders configured metadata for upstream gRPC calls
+type metadataTemplate struct {
+	static    metadata.MD
+	templates map[string]*requestTemplate
+}
+
+// newMetadataTemplate pre-builds static values and parses templated ones
+func newMetadataTemplate(values map[string]string) *metadataTemplate {
+	if len(values) == 0 {
+		return nil
+	}
+
+	t := &metadataTemplate{
+		static:    metadata.MD{},
+		templates: make(map[string]*requestTemplate),
+	}
+	for key, value := range values {
+		key = strings.ToLower(key)
+		if !strings.Contains(value, "{{") {
+			t.static.Append(key, value)
+			continue
+		}
+
+		tmpl, err := parseRequestTemplate(key, value)
+		if err != nil {
+			log.Printf("Skipping metadata %s: %v", key, err)
+			continue
+		}
+		t.templates[key] = tmpl
+	}
+	return t
+}
+
+// apply adds the rendered metadata to md, overriding incoming values
+func (t *metadataTemplate) apply(md metadata.MD, attrs requestAttributes) {
+	if t == nil {
+		return
+	}
+
+	for key, values := range t.static {
+		md.Set(key, values...)
+	}
+
+	for key, tmpl := range t.templates {
+		value, err := tmpl.render(attrs)
+		if err != nil {
+			log.Printf("Failed to render metadata %s: %v", key, err)
+			continue
+		}
+		if value != "" {
+			md.Set(key, value)
+		}
+	}
+}
+
+// render returns the metadata for a request. Metadata without templates is
+// shared between requests and must not be modified.
+func (t *metadataTemplate) render(attrs requestAttributes) metadata.MD {
+	if len(t.templates) == 0 {
+		return t.static
+	}
+	md := metadata.MD{}
+	t.apply(md, attrs)
+	return md
+}
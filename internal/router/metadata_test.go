@@ -0,0 +1,40 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetadataTemplateRender(t *testing.T) {
+	tmpl := newMetadataTemplate(map[string]string{
+		"X-Tenant": "acme",
+		"x-user":   `{{ header "X-User" }}`,
+		"x-order":  `{{ segment 1 }}`,
+	})
+	r := httptest.NewRequest(http.MethodGet, "/orders/o-1", nil)
+	r.Header.Set("X-User", "alice")
+
+	// Twice, so the second rendering reuses a pooled clone
+	for range 2 {
+		md := tmpl.render(httpAttributes(r, "orders.v1.Orders"))
+		for key, want := range map[string]string{"x-tenant": "acme", "x-user": "alice", "x-order": "o-1"} {
+			if got := md.Get(key); len(got) != 1 || got[0] != want {
+				t.Errorf("%s = %q, want %q", key, got, want)
+			}
+		}
+	}
+}
+
+func BenchmarkMetadataTemplateRender(b *testing.B) {
+	tmpl := newMetadataTemplate(map[string]string{
+		"x-tenant": "acme",
+		"x-user":   `{{ header "X-User" }}`,
+	})
+	r := httptest.NewRequest(http.MethodGet, "/orders/o-1", nil)
+	r.Header.Set("X-User", "alice")
+	b.ReportAllocs()
+	for b.Loop() {
+		tmpl.render(httpAttributes(r, "orders.v1.Orders"))
+	}
+}
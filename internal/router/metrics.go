@@ -0,0 +1,133 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"dynamic-gateway/internal/history"
+	"dynamic-gateway/internal/metrics"
+	"dynamic-gateway/internal/streams"
+
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("gateway_http_requests_total",
+		"HTTP requests served by matched routes, by response status class",
+		"route", "method", "backend", "status")
+	httpDuration = metrics.NewHistogramVec("gateway_http_request_duration_seconds",
+		"Time to serve HTTP requests matched to a route",
+		metrics.DefaultBuckets, "route", "method", "backend")
+	httpInFlight = metrics.NewGaugeVec("gateway_http_requests_in_flight",
+		"HTTP requests being served, by route",
+		"route")
+	httpPicks = metrics.NewCounterVec("gateway_http_balancer_picks_total",
+		"Backends picked by the balancers of HTTP routes",
+		"route", "backend")
+
+	grpcRequests = metrics.NewCounterVec("gateway_grpc_requests_total",
+		"gRPC calls served, by status code",
+		"service", "method", "backend", "code")
+	grpcDuration = metrics.NewHistogramVec("gateway_grpc_request_duration_seconds",
+		"Time to serve gRPC calls",
+		metrics.DefaultBuckets, "service", "method", "backend")
+	grpcInFlight = metrics.NewGaugeVec("gateway_grpc_requests_in_flight",
+		"gRPC calls being served, by service",
+		"service")
+	grpcPicks = metrics.NewCounterVec("gateway_grpc_balancer_picks_total",
+		"Backends picked by the balancers of gRPC services",
+		"service", "backend")
+)
+
+// Streams open on HTTP routes and gRPC services, kept across configuration
+// reloads like the metrics
+var routeStreams, serviceStreams = streams.NewSet(), streams.NewSet()
+
+// Streams returns the WebSocket streams open on HTTP routes and the streaming
+// calls relayed for gRPC services
+func Streams() (routes, services *streams.Set) {
+	return routeStreams, serviceStreams
+}
+
+// Request histories of routes and services, recorded once set
+var routeHistory, serviceHistory *history.History
+
+// UseHistory records the requests of HTTP routes in routes and the calls of
+// gRPC services in services
+func UseHistory(routes, services *history.History) {
+	routeHistory, serviceHistory = routes, services
+}
+
+// metricsWriter captures the response status for request metrics
+type metricsWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (mw *metricsWriter) WriteHeader(code int) {
+	if mw.status == 0 {
+		mw.status = code
+	}
+	mw.ResponseWriter.WriteHeader(code)
+}
+
+func (mw *metricsWriter) Write(b []byte) (int, error) {
+	if mw.status == 0 {
+		mw.status = http.StatusOK
+	}
+	return mw.ResponseWriter.Write(b)
+}
+
+func (mw *metricsWriter) Unwrap() http.ResponseWriter {
+	return mw.ResponseWriter
+}
+
+// observeHTTP records a served HTTP request; backend is empty for requests
+// answered before one was picked
+func observeHTTP(route, method, backend string, status int, elapsed time.Duration) {
+	method = metricMethod(method)
+	if status == 0 {
+		// Upgraded connections are hijacked without a status being written
+		status = http.StatusSwitchingProtocols
+	}
+	class := strconv.Itoa(status/100) + "xx"
+	httpRequests.With(route, method, backend, class).Inc()
+	httpDuration.With(route, method, backend).Observe(elapsed.Seconds())
+	routeHistory.Record(route, time.Now().Add(-elapsed), elapsed, status >= 500)
+}
+
+// metricMethod bounds the methods clients can put into metric labels
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// trackGRPC counts a call to a backend in flight until the returned function
+// records its outcome
+func trackGRPC(service, method, backend string) func(code codes.Code) {
+	start := time.Now()
+	inFlight := grpcInFlight.With(service)
+	inFlight.Inc()
+	return func(code codes.Code) {
+		inFlight.Dec()
+		grpcRequests.With(service, method, backend, code.String()).Inc()
+		elapsed := time.Since(start)
+		grpcDuration.With(service, method, backend).Observe(elapsed.Seconds())
+		serviceHistory.Record(service, start, elapsed, serverError(code))
+	}
+}
+
+// serverError reports whether a call failing with code is the fault of the
+// gateway or its backend rather than of the caller
+func serverError(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package router
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/pool"
+)
+
+// maxMirrorsInFlight bounds the copies waiting on shadow backends; requests
+// beyond it are not mirrored, so a slow shadow cannot exhaust the gateway
+const maxMirrorsInFlight = 256
+
+// mirrorRequest sends a copy of a request to the route's shadow backend in
+// the background, for the sampled share of requests. The copy is marked with
+// X-Shadow-Request so shadows can skip side effects; its response is
+// discarded.
+func (h *HTTPHandler) mirrorRequest(m *config.Mirror, r *http.Request, body []byte) {
+	if m == nil || rand.Float64()*100 >= m.Percentage {
+		return
+	}
+	select {
+	case h.mirrors <- struct{}{}:
+	default:
+		return
+	}
+
+	target := strings.TrimSuffix(m.Backend, "/") + r.URL.Path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	header := r.Header.Clone()
+	timeout, _ := time.ParseDuration(m.Timeout)
+	go func() {
+		defer func() { <-h.mirrors }()
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, r.Method, target, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Failed to mirror %s %s: %v", r.Method, r.URL.Path, err)
+			return
+		}
+		req.Header = header
+		req.Header.Set("X-Shadow-Request", "true")
+		client, err := h.connectionPool.HTTPClient(pool.Options{}, 0)
+		if err != nil {
+			log.Printf("Failed to mirror %s %s: %v", r.Method, r.URL.Path, err)
+			return
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("Failed to mirror %s %s to %s: %v", r.Method, r.URL.Path, m.Backend, err)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+}
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// mockResponder answers a mocked route's requests with its example responses
+type mockResponder struct {
+	responses []config.MockResponse
+	min, max  time.Duration
+	normal    bool
+}
+
+func newMockResponder(m *config.Mock) *mockResponder {
+	mock := &mockResponder{responses: m.Responses}
+	if l := m.Latency; l != nil {
+		mock.min, _ = time.ParseDuration(l.Min)
+		mock.max, _ = time.ParseDuration(l.Max)
+		mock.normal = l.Distribution == "normal"
+	}
+	return mock
+}
+
+// serve waits out a simulated latency and writes the first response matching
+// the request
+func (m *mockResponder) serve(w http.ResponseWriter, r *http.Request) {
+	if latency := m.latency(); latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for _, resp := range m.responses {
+		if !mockMatches(resp.Match, r) {
+			continue
+		}
+		writeExample(w, resp.Status, resp.Headers, resp.Body)
+		return
+	}
+	http.Error(w, "no mock response matches the request", http.StatusNotFound)
+}
+
+// writeExample writes a configured response; a JSON string body is sent as
+// text, any other JSON as application/json
+func writeExample(w http.ResponseWriter, status int, headers map[string]string, raw json.RawMessage) {
+	body := []byte(raw)
+	contentType := "application/json"
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		body, contentType = []byte(text), "text/plain; charset=utf-8"
+	}
+	if len(body) > 0 {
+		w.Header().Set("Content-Type", contentType)
+	}
+	for name, value := range headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// latency draws a latency from the configured distribution
+func (m *mockResponder) latency() time.Duration {
+	spread := m.max - m.min
+	if spread <= 0 {
+		return m.min
+	}
+	if m.normal {
+		// Six standard deviations span min to max; outliers are clamped
+		sample := float64(m.min+spread/2) + rand.NormFloat64()*float64(spread)/6
+		return time.Duration(min(max(sample, float64(m.min)), float64(m.max)))
+	}
+	return m.min + time.Duration(rand.Int63n(int64(spread)+1))
+}
+
+// mockMatches reports whether a request has everything match asks for
+func mockMatches(match *config.MockMatch, r *http.Request) bool {
+	if match == nil {
+		return true
+	}
+	if len(match.Methods) > 0 && !slices.Contains(match.Methods, r.Method) {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(match.Path, "*"); ok {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			return false
+		}
+	} else if match.Path != "" && r.URL.Path != match.Path {
+		return false
+	}
+	for name, value := range match.Headers {
+		if r.Header.Get(name) != value {
+			return false
+		}
+	}
+	query := r.URL.Query()
+	for name, value := range match.Query {
+		if query.Get(name) != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package router
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// acceptsContentType reports whether the request body's media type is one the
+// route consumes; requests without a body are always accepted
+func acceptsContentType(r *http.Request, consumes []string) bool {
+	if len(consumes) == 0 || (r.ContentLength == 0 && len(r.TransferEncoding) == 0) {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	for _, allowed := range consumes {
+		if mediaMatches(allowed, mediaType) {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiate picks the first of the route's producible media types with the
+// highest quality in the Accept header. An empty result with ok true means no
+// preference was expressed or the route does not restrict response types.
+func negotiate(r *http.Request, produces []string) (string, bool) {
+	header := r.Header.Get("Accept")
+	if len(produces) == 0 {
+		return "", true
+	}
+	if header == "" {
+		return produces[0], true
+	}
+
+	ranges := parseAccept(header)
+	best, bestQ := "", 0.0
+	for _, candidate := range produces {
+		q := quality(ranges, candidate)
+		if q > bestQ {
+			best, bestQ = candidate, q
+		}
+	}
+	return best, bestQ > 0
+}
+
+// mediaRange is one entry of an Accept header
+type mediaRange struct {
+	pattern string
+	q       float64
+}
+
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, mediaRange{pattern: mediaType, q: q})
+	}
+
+	// The most specific matching range determines the quality
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return specificity(ranges[i].pattern) > specificity(ranges[j].pattern)
+	})
+	return ranges
+}
+
+func quality(ranges []mediaRange, mediaType string) float64 {
+	for _, r := range ranges {
+		if mediaMatches(r.pattern, mediaType) {
+			return r.q
+		}
+	}
+	return 0
+}
+
+func specificity(pattern string) int {
+	switch {
+	case pattern == "*/*":
+		return 0
+	case strings.HasSuffix(pattern, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// mediaMatches reports whether mediaType falls within pattern, which may use
+// type/* or */* wildcards
+func mediaMatches(pattern, mediaType string) bool {
+	pattern, mediaType = strings.ToLower(pattern), strings.ToLower(mediaType)
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/converter"
+)
+
+// Query parameters of paginated streaming routes; they name no request field
+// and are ignored by transcoding
+const (
+	pageTokenParam = "page_token"
+	pageSizeParam  = "page_size"
+)
+
+var errInvalidPageToken = errors.New("invalid page_token")
+
+// streamPage returns the page of a server stream a request asks for. The
+// gateway keeps no state between pages: tokens carry the offset to continue
+// from and a digest of the request, and each page calls the method again,
+// skipping the messages already returned.
+func streamPage(r *http.Request, p *config.StreamPagination) (*converter.Page, error) {
+	size := p.PageSize
+	if text := r.URL.Query().Get(pageSizeParam); text != "" {
+		n, err := strconv.Atoi(text)
+		if err != nil || n < 1 {
+			return nil, errors.New("invalid page_size")
+		}
+		size = min(n, p.MaxPageSize)
+	}
+
+	digest, err := pageDigest(r)
+	if err != nil {
+		return nil, err
+	}
+	offset := 0
+	if token := r.URL.Query().Get(pageTokenParam); token != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return nil, errInvalidPageToken
+		}
+		offsetText, tokenDigest, ok := strings.Cut(string(raw), ".")
+		if offset, err = strconv.Atoi(offsetText); !ok || err != nil || offset < 0 {
+			return nil, errInvalidPageToken
+		}
+		// A token only continues the request it was issued for
+		if tokenDigest != digest {
+			return nil, errInvalidPageToken
+		}
+	}
+
+	next := base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset+size) + "." + digest))
+	return &converter.Page{Offset: offset, Size: size, NextToken: next}, nil
+}
+
+// pageDigest identifies a request by its method, path, body and query
+// parameters other than the paging ones; the body is left readable
+func pageDigest(r *http.Request) (string, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return "", errors.New("failed to read request body")
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	query := r.URL.Query()
+	query.Del(pageTokenParam)
+	query.Del(pageSizeParam)
+
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "?" + query.Encode() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
@@ -0,0 +1,180 @@
+package router
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/probe"
+)
+
+// rateLimiter throttles a route's requests, rejecting those over the limit
+// or holding them until they may proceed
+type rateLimiter struct {
+	cfg     config.RateLimit
+	limit   limiter
+	delay   bool
+	maxWait time.Duration
+}
+
+// limiter admits requests by some algorithm
+type limiter interface {
+	// take admits a request, or returns how long until one may be admitted
+	take(now time.Time) time.Duration
+}
+
+func newRateLimiter(cfg *config.RateLimit) *rateLimiter {
+	if cfg == nil {
+		return nil
+	}
+	// Validated with the configuration
+	window, _ := time.ParseDuration(cfg.Window)
+	maxWait, _ := time.ParseDuration(cfg.MaxWait)
+	perWindow := int(math.Ceil(cfg.RequestsPerSecond * window.Seconds()))
+
+	l := &rateLimiter{cfg: *cfg, delay: cfg.Mode == "delay", maxWait: maxWait}
+	switch cfg.Algorithm {
+	case "fixed_window":
+		l.limit = &fixedWindow{limit: perWindow, window: window}
+	case "sliding_window":
+		l.limit = &slidingWindow{limit: perWindow, window: window}
+	default:
+		l.limit = newTokenBucket(cfg.RequestsPerSecond, cfg.Burst)
+	}
+	return l
+}
+
+// inherit shares the counters of a previous limiter with the same settings,
+// so a reload does not hand every client a fresh allowance
+func (l *rateLimiter) inherit(prev *rateLimiter) {
+	if l != nil && prev != nil && l.cfg == prev.cfg {
+		l.limit = prev.limit
+	}
+}
+
+// admit reports whether a request may proceed, answering 429 with a
+// Retry-After header otherwise. Synthetic probes are always admitted. Delayed requests wait for their turn while
+// it comes within maxWait; a client going away meanwhile ends the wait.
+func (l *rateLimiter) admit(w http.ResponseWriter, r *http.Request) bool {
+	if l == nil || probe.Synthetic(r.Context()) {
+		return true
+	}
+	deadline := time.Now().Add(l.maxWait)
+	for {
+		now := time.Now()
+		wait := l.limit.take(now)
+		if wait == 0 {
+			return true
+		}
+		if !l.delay || now.Add(wait).After(deadline) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return false
+		}
+
+		// Others may take the request's turn, so it is tried again
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// tokenBucket admits requests at rate per second with bursts of up to burst
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// take consumes a token, or returns how long until one is available
+func (b *tokenBucket) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.last.IsZero() {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		// Rounded up, as a zero wait would admit the request
+		return time.Duration(math.Ceil((1 - b.tokens) / b.rate * float64(time.Second)))
+	}
+	b.tokens--
+	return 0
+}
+
+// fixedWindow admits up to limit requests in each window, counted from the
+// window's start, so bursts of twice the limit may straddle two windows
+type fixedWindow struct {
+	limit  int
+	window time.Duration
+	start  time.Time
+	count  int
+	mu     sync.Mutex
+}
+
+func (f *fixedWindow) take(now time.Time) time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if now.Sub(f.start) >= f.window {
+		f.start, f.count = now.Truncate(f.window), 0
+	}
+	if f.count < f.limit {
+		f.count++
+		return 0
+	}
+	return f.start.Add(f.window).Sub(now)
+}
+
+// slidingWindow admits up to limit requests in any window, estimating the
+// requests of the window ending now from those of the current fixed window
+// and the share of the previous one it overlaps
+type slidingWindow struct {
+	limit    int
+	window   time.Duration
+	start    time.Time
+	previous int
+	count    int
+	mu       sync.Mutex
+}
+
+func (s *slidingWindow) take(now time.Time) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch elapsed := now.Sub(s.start); {
+	case elapsed >= 2*s.window:
+		s.start, s.previous, s.count = now.Truncate(s.window), 0, 0
+	case elapsed >= s.window:
+		s.start, s.previous, s.count = s.start.Add(s.window), s.count, 0
+	}
+	overlap := 1 - float64(now.Sub(s.start))/float64(s.window)
+	if float64(s.previous)*overlap+float64(s.count) < float64(s.limit) {
+		s.count++
+		return 0
+	}
+
+	// Wait until enough of the previous window slides out, moving on to the
+	// next fixed window when the current one is full
+	start, previous, count := s.start, s.previous, s.count
+	if count >= s.limit {
+		start, previous, count = start.Add(s.window), count, 0
+	}
+	share := 1 - float64(s.limit-count)/float64(previous)
+	at := start.Add(time.Duration(share * float64(s.window)))
+	return max(at.Sub(now), 0) + time.Millisecond
+}
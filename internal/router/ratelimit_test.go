@@ -0,0 +1,134 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+func TestLimiters(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name  string
+		limit limiter
+		at    []time.Duration // since start
+		want  []bool          // admitted
+	}{
+		{
+			name:  "token bucket burst",
+			limit: newTokenBucket(1, 3),
+			at:    []time.Duration{0, 0, 0, 0},
+			want:  []bool{true, true, true, false},
+		},
+		{
+			name:  "token bucket refill",
+			limit: newTokenBucket(2, 1),
+			at:    []time.Duration{0, 0, 500 * time.Millisecond, 600 * time.Millisecond},
+			want:  []bool{true, false, true, false},
+		},
+		{
+			name:  "fixed window",
+			limit: &fixedWindow{limit: 2, window: time.Second},
+			at:    []time.Duration{0, 100 * time.Millisecond, 900 * time.Millisecond, time.Second},
+			want:  []bool{true, true, false, true},
+		},
+		{
+			name:  "sliding window",
+			limit: &slidingWindow{limit: 2, window: time.Second},
+			// Half of the previous window's two requests still count at 1.5s
+			at:   []time.Duration{0, 100 * time.Millisecond, time.Second, 1500 * time.Millisecond, 1500 * time.Millisecond},
+			want: []bool{true, true, false, true, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, at := range tt.at {
+				wait := tt.limit.take(start.Add(at))
+				if admitted := wait == 0; admitted != tt.want[i] {
+					t.Errorf("request %d at %v admitted %v (wait %v), want %v", i, at, admitted, wait, tt.want[i])
+				}
+				if wait < 0 {
+					t.Errorf("request %d at %v waits %v", i, at, wait)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterAdmit(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        config.RateLimit
+		wantStatus int // of the second request
+	}{
+		{
+			name:       "reject",
+			cfg:        config.RateLimit{RequestsPerSecond: 1, Burst: 1, MaxWait: "1s"},
+			wantStatus: http.StatusTooManyRequests,
+		},
+		{
+			name:       "delay within max wait",
+			cfg:        config.RateLimit{RequestsPerSecond: 50, Burst: 1, Mode: "delay", MaxWait: "1s"},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "delay beyond max wait",
+			cfg:        config.RateLimit{RequestsPerSecond: 1, Burst: 1, Mode: "delay", MaxWait: "10ms"},
+			wantStatus: http.StatusTooManyRequests,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(&tt.cfg)
+			for i := range 2 {
+				w := httptest.NewRecorder()
+				if l.admit(w, httptest.NewRequest(http.MethodGet, "/", nil)) {
+					w.WriteHeader(http.StatusOK)
+				}
+				want := http.StatusOK
+				if i == 1 {
+					want = tt.wantStatus
+				}
+				if w.Code != want {
+					t.Fatalf("request %d answered %d, want %d", i, w.Code, want)
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+					t.Error("429 without Retry-After")
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterInherit(t *testing.T) {
+	prevCfg := config.RateLimit{RequestsPerSecond: 1, Burst: 1, MaxWait: "1s"}
+	tests := []struct {
+		name     string
+		cfg      config.RateLimit
+		wantCode int // of the first request after the reload
+	}{
+		{name: "same settings keep the exhausted bucket", cfg: prevCfg, wantCode: http.StatusTooManyRequests},
+		{name: "changed settings start afresh", cfg: config.RateLimit{RequestsPerSecond: 2, Burst: 1, MaxWait: "1s"}, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := newRateLimiter(&prevCfg)
+			if !prev.admit(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)) {
+				t.Fatal("first request rejected")
+			}
+
+			l := newRateLimiter(&tt.cfg)
+			l.inherit(prev)
+			w := httptest.NewRecorder()
+			if l.admit(w, httptest.NewRequest(http.MethodGet, "/", nil)) {
+				w.WriteHeader(http.StatusOK)
+			}
+			if w.Code != tt.wantCode {
+				t.Errorf("answered %d, want %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"slices"
+
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/schema"
+)
+
+// connectionLost rotates a backend's connection when a call failed because
+// the connection went away, and reports whether it did
+func (h *GRPCHandler) connectionLost(ctx context.Context, err error, poolKey, backendAddr string) bool {
+	if ctx.Err() != nil || !pool.ConnectionLost(err) {
+		return false
+	}
+	h.connectionPool.Rotate(backendAddr, h.dial(ctx, poolKey, backendAddr))
+	return true
+}
+
+// connectionLost rotates a backend's connection when a converted request
+// failed because the connection went away, and reports whether it did
+func (h *HTTPHandler) connectionLost(ctx context.Context, err error, backendAddr string, dial pool.Options) bool {
+	if ctx.Err() != nil || !pool.ConnectionLost(err) {
+		return false
+	}
+	h.connectionPool.Rotate(backendAddr, dial)
+	return true
+}
+
+// idempotent reports whether a call may be sent again after its connection
+// was lost: the service lists it in idempotent_methods, or its descriptor
+// declares an idempotency level
+func (h *GRPCHandler) idempotent(svcConfig *config.GRPCService, serviceName, methodName string) bool {
+	return slices.Contains(svcConfig.IdempotentMethods, methodName) || idempotentMethod(h.descriptors, serviceName, methodName)
+}
+
+// idempotentRequest reports whether a request converted to a gRPC call may be
+// sent again after its connection was lost: its HTTP method is idempotent, or
+// the gRPC method's descriptor declares an idempotency level
+func idempotentRequest(descriptors *schema.Store, r *http.Request, serviceName, methodName string) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return idempotentMethod(descriptors, serviceName, methodName)
+}
+
+func idempotentMethod(descriptors *schema.Store, serviceName, methodName string) bool {
+	if descriptors == nil {
+		return false
+	}
+	method, ok := descriptors.FindMethod(serviceName, methodName)
+	if !ok {
+		return false
+	}
+	opts, _ := method.Options().(*descriptorpb.MethodOptions)
+	return opts.GetIdempotencyLevel() != descriptorpb.MethodOptions_IDEMPOTENCY_UNKNOWN
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+)
+
+// checkRedirect decides whether the upstream client follows a redirect. Only
+// follow mode follows, and only to the same host within the hop limit; other
+// redirects are returned to the caller.
+func checkRedirect(policy *config.RedirectPolicy) func(*http.Request, []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if policy == nil || policy.Mode != "follow" {
+			return http.ErrUseLastResponse
+		}
+		if req.URL.Host != via[0].URL.Host {
+			return http.ErrUseLastResponse
+		}
+		if len(via) > policy.MaxHops {
+			return fmt.Errorf("stopped after %d redirects", policy.MaxHops)
+		}
+		return nil
+	}
+}
+
+// rewriteLocation turns a redirect to the backend into a gateway-relative
+// one so internal hostnames never reach clients. On strip_path routes the
+// backend's paths lack the route prefix, which is put back. Redirects to
+// other hosts are left alone.
+func rewriteLocation(resp *http.Response, policy *config.RedirectPolicy, prefix string, backendHosts ...string) {
+	if policy != nil && policy.Mode == "passthrough" {
+		return
+	}
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return
+	}
+	if u.Host == "" {
+		if prefix != "" && u.Scheme == "" && strings.HasPrefix(u.Path, "/") {
+			resp.Header.Set("Location", withPrefix(prefix, u).String())
+		}
+		return
+	}
+	for _, host := range backendHosts {
+		if host != "" && u.Host == host {
+			rewritten := withPrefix(prefix, &url.URL{Path: u.Path, RawPath: u.RawPath, RawQuery: u.RawQuery, Fragment: u.Fragment})
+			if rewritten.Path == "" {
+				rewritten.Path = "/"
+			}
+			resp.Header.Set("Location", rewritten.String())
+			return
+		}
+	}
+}
+
+// withPrefix returns u with prefix put in front of its path
+func withPrefix(prefix string, u *url.URL) *url.URL {
+	if prefix == "" {
+		return u
+	}
+	prefixed := *u
+	prefixed.Path = prefix + "/" + strings.TrimPrefix(u.Path, "/")
+	if u.RawPath != "" {
+		prefixed.RawPath = prefix + "/" + strings.TrimPrefix(u.RawPath, "/")
+	}
+	return &prefixed
+}
@@ -0,0 +1,68 @@
+package router
+
+import (
+	"context"
+
+	"dynamic-gateway/internal/balancer"
+	"dynamic-gateway/internal/breaker"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+)
+
+// backendRegions maps backend addresses to their data regions
+func backendRegions(backends []config.Backend) map[string]string {
+	regions := make(map[string]string)
+	for _, b := range backends {
+		if b.Region != "" {
+			regions[b.Address] = b.Region
+		}
+	}
+	return regions
+}
+
+// dataRegion returns the data region a request asks for: the configured claim
+// of its verified bearer token, or else the header read by get. Requests
+// without a verified token carrying the claim ask for none.
+func dataRegion(ctx context.Context, cfg *config.DataResidency, get func(string) string) string {
+	if cfg == nil {
+		return ""
+	}
+	if cfg.Claim != "" {
+		region, _ := claimValue(identity.Claims(ctx), cfg.Claim)
+		return region
+	}
+	return get(cfg.Header)
+}
+
+// regionAllowed reports whether a route may serve data of region
+func regionAllowed(allowed []string, region string) bool {
+	if region == "" || len(allowed) == 0 {
+		return true
+	}
+	for _, r := range allowed {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
+
+// nextAvailable returns the next backend storing data in region whose circuit
+// admits a request. It returns "" when no backend is eligible or every
+// eligible backend's circuit is open. Only the balancer's picks are asked of
+// the circuits, which admit one trial request at a time when half-open.
+func nextAvailable(b balancer.Balancer, regions map[string]string, region string, breakers *breaker.Set) string {
+	var refused map[string]bool
+	for {
+		addr := b.NextFrom(func(addr string) bool {
+			return !refused[addr] && (region == "" || regions[addr] == region)
+		})
+		if addr == "" || breakers.Allow(addr) {
+			return addr
+		}
+		if refused == nil {
+			refused = make(map[string]bool)
+		}
+		refused[addr] = true
+	}
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"dynamic-gateway/internal/balancer"
+	"dynamic-gateway/internal/breaker"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+)
+
+func TestDataRegion(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    *config.DataResidency
+		header string
+		claims map[string]any
+		want   string
+	}{
+		{name: "disabled", header: "eu", want: ""},
+		{name: "header", cfg: &config.DataResidency{Header: "X-Data-Region"}, header: "eu", want: "eu"},
+		{
+			name:   "claim",
+			cfg:    &config.DataResidency{Header: "X-Data-Region", Claim: "region"},
+			claims: map[string]any{"region": "us"},
+			want:   "us",
+		},
+		{
+			name:   "nested claim",
+			cfg:    &config.DataResidency{Header: "X-Data-Region", Claim: "org.region"},
+			claims: map[string]any{"org": map[string]any{"region": "eu"}},
+			want:   "eu",
+		},
+		{
+			name:   "claim ignores header",
+			cfg:    &config.DataResidency{Header: "X-Data-Region", Claim: "region"},
+			header: "us",
+			claims: map[string]any{"region": "eu"},
+			want:   "eu",
+		},
+		{
+			name:   "claim without token",
+			cfg:    &config.DataResidency{Header: "X-Data-Region", Claim: "region"},
+			header: "us",
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.claims != nil {
+				ctx = identity.WithClaims(ctx, tt.claims)
+			}
+			header := http.Header{}
+			header.Set("X-Data-Region", tt.header)
+			if got := dataRegion(ctx, tt.cfg, header.Get); got != tt.want {
+				t.Errorf("dataRegion = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionAllowed(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		region  string
+		want    bool
+	}{
+		{name: "no region", allowed: []string{"eu"}, want: true},
+		{name: "unrestricted", region: "us", want: true},
+		{name: "allowed", allowed: []string{"eu", "us"}, region: "us", want: true},
+		{name: "refused", allowed: []string{"eu"}, region: "us", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := regionAllowed(tt.allowed, tt.region); got != tt.want {
+				t.Errorf("regionAllowed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextAvailable(t *testing.T) {
+	backends := []config.Backend{
+		{Address: "eu-1", Region: "eu"},
+		{Address: "eu-2", Region: "eu"},
+		{Address: "us-1", Region: "us"},
+		{Address: "any"},
+	}
+	tests := []struct {
+		name   string
+		region string
+		failed []string
+		want   map[string]bool
+	}{
+		{name: "any region", want: map[string]bool{"eu-1": true, "eu-2": true, "us-1": true, "any": true}},
+		{name: "in region", region: "eu", want: map[string]bool{"eu-1": true, "eu-2": true}},
+		{name: "open circuits skipped", region: "eu", failed: []string{"eu-1"}, want: map[string]bool{"eu-2": true}},
+		{name: "every circuit open", region: "us", failed: []string{"us-1"}, want: map[string]bool{"": true}},
+		{name: "no backend in region", region: "ap", want: map[string]bool{"": true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs := make([]string, len(backends))
+			for i, b := range backends {
+				addrs[i] = b.Address
+			}
+			breakers := breaker.NewSet(&config.CircuitBreaker{ConsecutiveFailures: 1, Window: "1m", OpenDuration: "1m"})
+			for _, addr := range tt.failed {
+				breakers.Record(addr, false)
+			}
+			b := balancer.NewRoundRobinBalancer(addrs)
+			for range 8 {
+				if got := nextAvailable(b, backendRegions(backends), tt.region, breakers); !tt.want[got] {
+					t.Fatalf("nextAvailable = %q, want one of %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
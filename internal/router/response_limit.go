@@ -0,0 +1,86 @@
+package router
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/config"
+)
+
+// truncatedHeader marks responses cut at the route's max_response_size
+const truncatedHeader = "X-Gateway-Truncated"
+
+// limitResponse enforces the route's maximum response size on a backend
+// response. It returns the body to copy to the client, or false when the
+// response was rejected and a 502 has already been written.
+func limitResponse(w http.ResponseWriter, route *config.HTTPRoute, resp *http.Response) (io.Reader, bool) {
+	limit := route.MaxResponseSize
+	if limit <= 0 {
+		return resp.Body, true
+	}
+
+	// Partial content must match its Content-Range and a cut compressed body
+	// cannot be decoded, so neither is ever truncated
+	if route.ResponseSizePolicy == "truncate" && resp.StatusCode != http.StatusPartialContent && !encoded(resp) {
+		if resp.ContentLength < 0 || resp.ContentLength > limit {
+			resp.Header.Del("Content-Length")
+			w.Header().Set(truncatedHeader, strconv.FormatInt(limit, 10))
+		}
+		return io.LimitReader(resp.Body, limit), true
+	}
+
+	// Abort: reject declared oversize bodies up front, otherwise buffer up to the limit
+	if resp.ContentLength > limit {
+		http.Error(w, "backend response too large", http.StatusBadGateway)
+		return nil, false
+	}
+	if resp.ContentLength >= 0 {
+		return resp.Body, true
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		http.Error(w, "failed to read backend response", http.StatusBadGateway)
+		return nil, false
+	}
+	if int64(len(body)) > limit {
+		http.Error(w, "backend response too large", http.StatusBadGateway)
+		return nil, false
+	}
+	return bytes.NewReader(body), true
+}
+
+// encoded reports whether a response body has a content coding such as gzip
+func encoded(resp *http.Response) bool {
+	coding := resp.Header.Get("Content-Encoding")
+	return coding != "" && !strings.EqualFold(coding, "identity")
+}
+
+// tooLarge reports whether err, however deeply wrapped, is the gRPC
+// ResourceExhausted status of a response over the size limit
+func tooLarge(err error) bool {
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return false
+	}
+	st, _ := status.FromError(grpcErr.(error))
+	return st.Code() == codes.ResourceExhausted
+}
+
+// checkTranscodedSize enforces the route limit on a transcoded response.
+// Transcoded JSON cannot be truncated meaningfully, so oversize responses
+// are always rejected.
+func checkTranscodedSize(route *config.HTTPRoute, body []byte) error {
+	if route.MaxResponseSize > 0 && int64(len(body)) > route.MaxResponseSize {
+		return fmt.Errorf("response of %d bytes exceeds limit of %d", len(body), route.MaxResponseSize)
+	}
+	return nil
+}
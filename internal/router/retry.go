@@ -0,0 +1,174 @@
+package router
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/config"
+)
+
+// retryReserve caps the retries a budget saves up while requests succeed
+const retryReserve = 10
+
+// retryPolicy is a parsed config.RetryPolicy with the budget its route or
+// service draws on. A nil policy never retries.
+type retryPolicy struct {
+	attempts int
+	statuses map[int]bool
+	codes    map[codes.Code]bool
+	perTry   time.Duration
+	base     time.Duration
+	max      time.Duration
+	budget   *retryBudget
+
+	nonIdempotent bool
+}
+
+func newRetryPolicy(cfg *config.RetryPolicy) *retryPolicy {
+	if cfg == nil || cfg.Attempts == 0 {
+		return nil
+	}
+	p := &retryPolicy{
+		attempts: cfg.Attempts,
+		statuses: make(map[int]bool),
+		codes:    make(map[codes.Code]bool),
+		budget:   &retryBudget{ratio: cfg.Budget, tokens: retryReserve},
+
+		nonIdempotent: cfg.NonIdempotent,
+	}
+	for _, code := range cfg.StatusCodes {
+		p.statuses[code] = true
+	}
+	for _, name := range cfg.GRPCCodes {
+		var code codes.Code
+		if code.UnmarshalJSON([]byte(strconv.Quote(name))) == nil {
+			p.codes[code] = true
+		}
+	}
+	p.perTry, _ = time.ParseDuration(cfg.PerTryTimeout)
+	p.base, _ = time.ParseDuration(cfg.BaseInterval)
+	p.max, _ = time.ParseDuration(cfg.MaxInterval)
+	return p
+}
+
+// serviceRetryPolicy returns the policy for a service's retry_attempts
+func serviceRetryPolicy(attempts int) *retryPolicy {
+	cfg := &config.RetryPolicy{Attempts: attempts}
+	cfg.SetDefaults()
+	return newRetryPolicy(cfg)
+}
+
+// record counts a request towards the retry budget
+func (p *retryPolicy) record() {
+	if p != nil {
+		p.budget.deposit()
+	}
+}
+
+// attempt bounds one attempt by the per-try timeout
+func (p *retryPolicy) attempt(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p != nil && p.perTry > 0 {
+		return context.WithTimeout(ctx, p.perTry)
+	}
+	return context.WithCancel(ctx)
+}
+
+// retryableStatus reports whether an HTTP response status is retried. The
+// backend answered, so it may have acted on the request, and methods that are
+// not idempotent are retried only when the policy says so.
+func (p *retryPolicy) retryableStatus(r *http.Request, code int) bool {
+	return p != nil && p.statuses[code] && (p.nonIdempotent || idempotent(r))
+}
+
+// retryableError reports whether a failed gRPC attempt is retried: its code
+// is retried, or the attempt ran out of time while the request still has some
+func (p *retryPolicy) retryableError(ctx context.Context, err error) bool {
+	if p == nil || ctx.Err() != nil {
+		return false
+	}
+	code := status.Code(err)
+	if code == codes.DeadlineExceeded {
+		return p.perTry > 0
+	}
+	return p.codes[code]
+}
+
+// retryableTransport reports whether an HTTP attempt that got no response is
+// retried, which it is unless the request itself has run out of time. The
+// backend may have processed a request before failing to answer, so methods
+// that are not idempotent are retried only when the policy says so.
+func (p *retryPolicy) retryableTransport(ctx context.Context, r *http.Request) bool {
+	return p != nil && ctx.Err() == nil && (p.nonIdempotent || idempotent(r))
+}
+
+// idempotent reports whether r may be sent twice, by its method or an
+// idempotency key, as net/http decides for its own retries
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != "" || r.Header.Get("X-Idempotency-Key") != ""
+}
+
+// retry reports whether a request may be retried after the given number of
+// retries, once the backoff has passed
+func (p *retryPolicy) retry(ctx context.Context, retries int) bool {
+	if p == nil || retries >= p.attempts || !p.budget.withdraw() {
+		return false
+	}
+	timer := time.NewTimer(p.backoff(retries))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// backoff returns a random wait of up to the base interval doubled for each
+// earlier retry, capped at the maximum interval
+func (p *retryPolicy) backoff(retries int) time.Duration {
+	ceiling := p.max
+	if retries < 32 {
+		if d := p.base << retries; d > 0 && d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// retryBudget earns a fraction of a retry for every request and spends one
+// for every retry, so retries add at most that fraction to a backend's load
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	tokens float64
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+b.ratio, retryReserve)
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
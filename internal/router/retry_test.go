@@ -0,0 +1,190 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/config"
+)
+
+func TestNewRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        *config.RetryPolicy
+		wantNil    bool
+		statuses   map[int]bool
+		grpcCodes  map[codes.Code]bool
+		wantPerTry time.Duration
+	}{
+		{name: "unset", wantNil: true},
+		{name: "no attempts", cfg: &config.RetryPolicy{StatusCodes: []int{503}}, wantNil: true},
+		{
+			name:       "parsed",
+			cfg:        &config.RetryPolicy{Attempts: 2, StatusCodes: []int{503}, GRPCCodes: []string{"UNAVAILABLE", "RESOURCE_EXHAUSTED", "BOGUS"}, PerTryTimeout: "1s"},
+			statuses:   map[int]bool{503: true, 502: false},
+			grpcCodes:  map[codes.Code]bool{codes.Unavailable: true, codes.ResourceExhausted: true, codes.Internal: false},
+			wantPerTry: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newRetryPolicy(tt.cfg)
+			if (p == nil) != tt.wantNil {
+				t.Fatalf("policy = %v, want nil %v", p, tt.wantNil)
+			}
+			if p == nil {
+				return
+			}
+			r, _ := http.NewRequest(http.MethodGet, "http://gateway/orders", nil)
+			for code, want := range tt.statuses {
+				if got := p.retryableStatus(r, code); got != want {
+					t.Errorf("retryableStatus(%d) = %v, want %v", code, got, want)
+				}
+			}
+			for code, want := range tt.grpcCodes {
+				if got := p.codes[code]; got != want {
+					t.Errorf("code %v retried = %v, want %v", code, got, want)
+				}
+			}
+			if p.perTry != tt.wantPerTry {
+				t.Errorf("per try timeout = %v, want %v", p.perTry, tt.wantPerTry)
+			}
+		})
+	}
+}
+
+func TestRetryableError(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name   string
+		perTry string
+		ctx    context.Context
+		err    error
+		want   bool
+	}{
+		{name: "retried code", err: status.Error(codes.Unavailable, "down"), want: true},
+		{name: "other code", err: status.Error(codes.InvalidArgument, "bad"), want: false},
+		{name: "not a status", err: errors.New("boom"), want: false},
+		{name: "attempt timed out", perTry: "1s", err: status.Error(codes.DeadlineExceeded, "slow"), want: true},
+		{name: "request timed out", err: status.Error(codes.DeadlineExceeded, "slow"), want: false},
+		{name: "request canceled", ctx: canceled, err: status.Error(codes.Unavailable, "down"), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.RetryPolicy{Attempts: 1, PerTryTimeout: tt.perTry}
+			cfg.SetDefaults()
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			if got := newRetryPolicy(cfg).retryableError(ctx, tt.err); got != tt.want {
+				t.Errorf("retryableError = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryableIdempotency(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		header        string
+		nonIdempotent bool
+		want          bool
+	}{
+		{name: "get", method: http.MethodGet, want: true},
+		{name: "put", method: http.MethodPut, want: true},
+		{name: "post", method: http.MethodPost, want: false},
+		{name: "post with idempotency key", method: http.MethodPost, header: "Idempotency-Key", want: true},
+		{name: "patch with legacy idempotency key", method: http.MethodPatch, header: "X-Idempotency-Key", want: true},
+		{name: "post allowed by policy", method: http.MethodPost, nonIdempotent: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(tt.method, "http://gateway/orders", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, "key-1")
+			}
+			p := newRetryPolicy(&config.RetryPolicy{Attempts: 1, StatusCodes: []int{503}, NonIdempotent: tt.nonIdempotent})
+			if got := p.retryableTransport(context.Background(), r); got != tt.want {
+				t.Errorf("retryableTransport = %v, want %v", got, tt.want)
+			}
+			if got := p.retryableStatus(r, 503); got != tt.want {
+				t.Errorf("retryableStatus = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := &retryPolicy{base: 10 * time.Millisecond, max: 50 * time.Millisecond}
+	tests := []struct {
+		retries int
+		ceiling time.Duration
+	}{
+		{retries: 0, ceiling: 10 * time.Millisecond},
+		{retries: 1, ceiling: 20 * time.Millisecond},
+		{retries: 2, ceiling: 40 * time.Millisecond},
+		{retries: 3, ceiling: 50 * time.Millisecond},
+		{retries: 40, ceiling: 50 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			if d := p.backoff(tt.retries); d < 0 || d > tt.ceiling {
+				t.Fatalf("backoff(%d) = %v, want at most %v", tt.retries, d, tt.ceiling)
+			}
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	tests := []struct {
+		name     string
+		ratio    float64
+		requests int
+		want     int // retries allowed after draining the reserve
+	}{
+		{name: "no requests", ratio: 0.2, requests: 0, want: 0},
+		{name: "fraction of requests", ratio: 0.25, requests: 20, want: 5},
+		{name: "capped by the reserve", ratio: 0.5, requests: 100, want: retryReserve},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &retryBudget{ratio: tt.ratio, tokens: retryReserve}
+			for b.withdraw() {
+			}
+			for range tt.requests {
+				b.deposit()
+			}
+			got := 0
+			for b.withdraw() {
+				got++
+			}
+			if got != tt.want {
+				t.Errorf("retries allowed = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	p := newRetryPolicy(&config.RetryPolicy{Attempts: 2, Budget: 1})
+	var retries int
+	for p.retry(context.Background(), retries) {
+		retries++
+	}
+	if retries != 2 {
+		t.Errorf("retried %d times, want 2", retries)
+	}
+	var nilPolicy *retryPolicy
+	if nilPolicy.retry(context.Background(), 0) || nilPolicy.retryableStatus(&http.Request{Method: http.MethodGet}, 503) {
+		t.Error("nil policy retried")
+	}
+}
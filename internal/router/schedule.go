@@ -0,0 +1,64 @@
+package router
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// routeSchedule changes how a route is served while its window is open
+type routeSchedule struct {
+	name        string
+	window      *config.Window
+	backends    bool // the schedule has its own backend pool
+	maintenance *config.Maintenance
+	limiter     *rateLimiter
+}
+
+func newRouteSchedules(schedules []config.RouteSchedule) []*routeSchedule {
+	compiled := make([]*routeSchedule, 0, len(schedules))
+	for _, s := range schedules {
+		// Validated with the configuration
+		window, _ := config.ParseWindow(s.Window, s.Timezone)
+		schedule := &routeSchedule{
+			name:        s.Name,
+			window:      window,
+			backends:    len(s.Backends) > 0,
+			maintenance: s.Maintenance,
+			limiter:     newRateLimiter(s.RateLimit),
+		}
+		compiled = append(compiled, schedule)
+	}
+	return compiled
+}
+
+// schedulePoolKey returns the balancer key of a schedule's backend pool
+func schedulePoolKey(routeKey, name string) string {
+	return poolKey(routeKey, "schedules/"+name)
+}
+
+// activeSchedule returns the first schedule whose window contains now
+func activeSchedule(schedules []*routeSchedule, now time.Time) *routeSchedule {
+	for _, s := range schedules {
+		if s.window != nil && s.window.Contains(now) {
+			return s
+		}
+	}
+	return nil
+}
+
+// admit serves the maintenance response or throttles the request; it
+// returns false when the request has been answered
+func (s *routeSchedule) admit(w http.ResponseWriter, r *http.Request, now time.Time) bool {
+	if m := s.maintenance; m != nil {
+		if end, ok := s.window.End(now); ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(end.Sub(now).Seconds()))))
+		}
+		writeExample(w, m.Status, m.Headers, m.Body)
+		return false
+	}
+	return s.limiter.admit(w, r)
+}
@@ -0,0 +1,34 @@
+package router
+
+import (
+	"dynamic-gateway/internal/balancer"
+)
+
+// balancerScores collects the scores of latency-aware balancers, naming each
+// pool by ids where it has an entry
+func balancerScores(balancers map[string]balancer.Balancer, ids map[string]string) map[string][]balancer.Score {
+	scores := make(map[string][]balancer.Score)
+	for key, b := range balancers {
+		s, ok := b.(balancer.Scorer)
+		if !ok {
+			continue
+		}
+		if id, ok := ids[key]; ok {
+			key = id
+		}
+		scores[key] = s.Scores()
+	}
+	return scores
+}
+
+// BalancerScores returns the backend scores of route pools using
+// latency-aware balancing, keyed by route
+func (h *HTTPHandler) BalancerScores() map[string][]balancer.Score {
+	return balancerScores(h.balancers, routeIDs(h.config))
+}
+
+// BalancerScores returns the backend scores of service pools using
+// latency-aware balancing, keyed by service
+func (h *GRPCHandler) BalancerScores() map[string][]balancer.Score {
+	return balancerScores(h.balancers, nil)
+}
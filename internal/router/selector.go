@@ -0,0 +1,63 @@
+package router
+
+import (
+	"log"
+	"math/rand"
+	"strings"
+)
+
+// poolSelector picks a named backend pool by rendering a template over
+// request attributes, e.g. shard-{{header "X-Shard"}}
+type poolSelector struct {
+	tmpl  *requestTemplate
+	pools map[string]bool
+}
+
+// newPoolSelector parses a route's pool selector expression
+func newPoolSelector(expr string, pools map[string]bool) *poolSelector {
+	if expr == "" {
+		return nil
+	}
+	tmpl, err := parseRequestTemplate("pool_selector", expr)
+	if err != nil {
+		log.Printf("Skipping pool selector %q: %v", expr, err)
+		return nil
+	}
+	return &poolSelector{tmpl: tmpl, pools: pools}
+}
+
+// selectPool returns the named pool for the request, or "" for the route's
+// default backends when the expression yields no known pool
+func (s *poolSelector) selectPool(attrs requestAttributes) string {
+	if s == nil {
+		return ""
+	}
+
+	value, err := s.tmpl.render(attrs)
+	if err != nil {
+		log.Printf("Failed to evaluate pool selector: %v", err)
+		return ""
+	}
+	if name := strings.TrimSpace(value); s.pools[name] {
+		return name
+	}
+	return ""
+}
+
+// splitPool picks a named pool for the percentage of requests a traffic split
+// sends to it, or "" for the route's default backends
+func splitPool(split map[string]int) string {
+	n := rand.Intn(100)
+	for name, percent := range split {
+		if n < percent {
+			return name
+		}
+		n -= percent
+	}
+	return ""
+}
+
+// namedPoolKey returns the balancer key of a route's named pool
+func namedPoolKey(routeKey, name string) string {
+	return poolKey(routeKey, "pools/"+name)
+}
@@ -0,0 +1,190 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// sloBuckets is the number of buckets an error budget window is split into;
+// windows are at least a minute, so buckets are at least a second wide
+const sloBuckets = 60
+
+// errorBudget tracks a route's error rate over a sliding window
+type errorBudget struct {
+	slo     *config.SLO
+	width   time.Duration
+	buckets [sloBuckets]sloBucket
+	mu      sync.Mutex
+}
+
+type sloBucket struct {
+	start  time.Time
+	total  int64
+	errors int64
+}
+
+// SLOStatus reports the error budget state of a route
+type SLOStatus struct {
+	Route     string  `json:"route"`
+	Target    float64 `json:"target"`
+	Requests  int64   `json:"requests"`
+	Errors    int64   `json:"errors"`
+	BurnRate  float64 `json:"burn_rate"`
+	Remaining float64 `json:"budget_remaining"` // fraction of the window's error budget left
+	ShedRatio float64 `json:"shed_ratio"`
+}
+
+func newErrorBudget(slo *config.SLO) *errorBudget {
+	window, _ := time.ParseDuration(slo.Window)
+	return &errorBudget{slo: slo, width: max(window/sloBuckets, time.Second)}
+}
+
+// inherit copies the request history of a previous budget with the same window
+func (b *errorBudget) inherit(prev *errorBudget) {
+	if prev.width != b.width {
+		return
+	}
+	prev.mu.Lock()
+	buckets := prev.buckets
+	prev.mu.Unlock()
+
+	b.mu.Lock()
+	b.buckets = buckets
+	b.mu.Unlock()
+}
+
+// record counts a completed request
+func (b *errorBudget) record(failed bool) {
+	now := time.Now().Truncate(b.width)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bucket := &b.buckets[(now.UnixNano()/int64(b.width))%sloBuckets]
+	if !bucket.start.Equal(now) {
+		*bucket = sloBucket{start: now}
+	}
+	bucket.total++
+	if failed {
+		bucket.errors++
+	}
+}
+
+// totals sums the buckets still inside the window
+func (b *errorBudget) totals() (total, errors int64) {
+	cutoff := time.Now().Add(-b.width * sloBuckets)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, bucket := range b.buckets {
+		if bucket.start.After(cutoff) {
+			total += bucket.total
+			errors += bucket.errors
+		}
+	}
+	return total, errors
+}
+
+// burnRate returns how fast the error budget is being consumed; 1 means
+// exactly on target for the window. Windows with fewer than min_requests
+// requests report 0 so a handful of early failures cannot trigger shedding.
+func (b *errorBudget) burnRate() float64 {
+	total, errors := b.totals()
+	if total == 0 || total < b.slo.MinRequests {
+		return 0
+	}
+	return (float64(errors) / float64(total)) / (1 - b.slo.Target)
+}
+
+// shedRatio returns the fraction of requests to reject, ramping linearly from
+// zero at the critical burn rate to the maximum at twice that rate
+func (b *errorBudget) shedRatio() float64 {
+	if !b.slo.Throttle {
+		return 0
+	}
+	burn := b.burnRate()
+	if burn < b.slo.CriticalBurnRate {
+		return 0
+	}
+	ratio := (burn - b.slo.CriticalBurnRate) / b.slo.CriticalBurnRate
+	if ratio > 1 {
+		ratio = 1
+	}
+	// Always shed a little once critical so recovery starts immediately
+	return b.slo.MaxShedRatio * (0.1 + 0.9*ratio)
+}
+
+// admit reports whether a request may proceed, answering 429 otherwise
+func (b *errorBudget) admit(w http.ResponseWriter) bool {
+	if shed := b.shedRatio(); shed > 0 && rand.Float64() < shed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(b.width.Seconds()+0.5)))
+		http.Error(w, "route is shedding load to protect its error budget", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+func (b *errorBudget) status(route string) SLOStatus {
+	total, errors := b.totals()
+	burn := b.burnRate()
+	remaining := 1.0
+	if total > 0 {
+		remaining = 1 - float64(errors)/(float64(total)*(1-b.slo.Target))
+	}
+	return SLOStatus{
+		Route:     route,
+		Target:    b.slo.Target,
+		Requests:  total,
+		Errors:    errors,
+		BurnRate:  burn,
+		Remaining: remaining,
+		ShedRatio: b.shedRatio(),
+	}
+}
+
+// sloWriter records the response outcome against a route's error budget
+type sloWriter struct {
+	http.ResponseWriter
+	budget      *errorBudget
+	wroteHeader bool
+}
+
+func (sw *sloWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+	sw.budget.record(code >= http.StatusInternalServerError)
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *sloWriter) Write(b []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *sloWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// SLOHandler serves the error budget state of every route with an SLO
+func (h *HTTPHandler) SLOHandler(w http.ResponseWriter, r *http.Request) {
+	statuses := []SLOStatus{}
+	for i, route := range h.config.HTTPRoutes {
+		if budget := h.errorBudgets[fmt.Sprintf("route_%d", i)]; budget != nil {
+			statuses = append(statuses, budget.status(route.Path))
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(statuses)
+}
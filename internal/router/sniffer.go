@@ -0,0 +1,157 @@
+package router
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/pool"
+)
+
+const (
+	sniffTTL     = 5 * time.Minute
+	sniffTimeout = 2 * time.Second
+	// sniffRetry is how long a backend no probe reached is assumed to speak
+	// http before it is probed again
+	sniffRetry = 5 * time.Second
+)
+
+// protocolSniffer detects whether "auto" backends speak gRPC or HTTP
+type protocolSniffer struct {
+	connectionPool *pool.ConnectionPool
+	client         *http.Client
+	cache          map[string]sniffResult
+	probing        map[string]chan struct{} // closed when the probe of a backend ends
+	mu             sync.Mutex
+}
+
+type sniffResult struct {
+	protocol  string
+	expiresAt time.Time
+}
+
+func newProtocolSniffer(pool *pool.ConnectionPool) *protocolSniffer {
+	return &protocolSniffer{
+		connectionPool: pool,
+		client:         &http.Client{Timeout: sniffTimeout},
+		cache:          make(map[string]sniffResult),
+		probing:        make(map[string]chan struct{}),
+	}
+}
+
+// detect returns "grpc" or "http" for a backend, probing when the cached
+// result expired. Requests arriving while a backend is probed wait for that
+// probe rather than starting their own.
+func (s *protocolSniffer) detect(ctx context.Context, backendAddr string) string {
+	for {
+		s.mu.Lock()
+		result, ok := s.cache[backendAddr]
+		if ok && time.Now().Before(result.expiresAt) {
+			s.mu.Unlock()
+			return result.protocol
+		}
+		done, probing := s.probing[backendAddr]
+		if !probing {
+			done = make(chan struct{})
+			s.probing[backendAddr] = done
+		}
+		s.mu.Unlock()
+
+		if !probing {
+			return s.probe(ctx, backendAddr, result, ok, done)
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			if ok {
+				return result.protocol
+			}
+			return "http"
+		}
+	}
+}
+
+// probe detects a backend's protocol and caches it, closing done once the
+// result is cached. A backend no probe reached is assumed to speak http for
+// a short while only, so a backend starting up is detected once it is up.
+func (s *protocolSniffer) probe(ctx context.Context, backendAddr string, previous sniffResult, known bool, done chan struct{}) string {
+	// The probe outlives the request starting it, as others may wait for it
+	ctx = context.WithoutCancel(ctx)
+
+	protocol, ttl := "http", sniffTTL
+	if s.probeGRPC(ctx, backendAddr) {
+		protocol = "grpc"
+	} else if !s.probeHTTP(ctx, backendAddr) {
+		log.Printf("Protocol probe failed for %s, assuming http", backendAddr)
+		ttl = sniffRetry
+	}
+
+	if !known || previous.protocol != protocol {
+		log.Printf("Detected %s protocol for backend %s", protocol, backendAddr)
+	}
+
+	s.mu.Lock()
+	s.cache[backendAddr] = sniffResult{protocol: protocol, expiresAt: time.Now().Add(ttl)}
+	delete(s.probing, backendAddr)
+	s.mu.Unlock()
+	close(done)
+
+	return protocol
+}
+
+// probeGRPC calls the standard health service; any gRPC status other than a
+// transport failure means the backend speaks gRPC
+func (s *protocolSniffer) probeGRPC(ctx context.Context, backendAddr string) bool {
+	ctx, cancel := context.WithTimeout(ctx, sniffTimeout)
+	defer cancel()
+
+	conn, err := s.connectionPool.GetConnection(ctx, grpcTarget(backendAddr), false, false)
+	if err != nil {
+		return false
+	}
+
+	_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	switch status.Code(err) {
+	case codes.OK, codes.Unimplemented, codes.NotFound, codes.PermissionDenied, codes.Unauthenticated:
+		return true
+	default:
+		return false
+	}
+}
+
+// probeHTTP sends an OPTIONS request and reports whether an HTTP server answered
+func (s *protocolSniffer) probeHTTP(ctx context.Context, backendAddr string) bool {
+	req, err := http.NewRequestWithContext(ctx, http.MethodOptions, httpTarget(backendAddr), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return true
+}
+
+// grpcTarget strips any URL scheme from a backend address
+func grpcTarget(addr string) string {
+	addr = strings.TrimPrefix(addr, "http://")
+	addr = strings.TrimPrefix(addr, "https://")
+	return strings.TrimSuffix(addr, "/")
+}
+
+// httpTarget ensures a backend address has a URL scheme
+func httpTarget(addr string) string {
+	if strings.HasPrefix(addr, "http://") || strings.HasPrefix(addr, "https://") {
+		return addr
+	}
+	return "http://" + addr
+}
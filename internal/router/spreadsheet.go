@@ -0,0 +1,50 @@
+package router
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/converter"
+)
+
+// exportMedia maps stream_export formats to media types and file extensions
+var exportMedia = map[string]struct{ mediaType, extension string }{
+	"csv":  {converter.MediaCSV, ".csv"},
+	"xlsx": {converter.MediaXLSX, ".xlsx"},
+}
+
+// streamTable returns the table a server stream is exported as, in the
+// route's format unless the Accept header prefers the other one, and the
+// Content-Disposition of the download
+func streamTable(r *http.Request, e *config.StreamExport) (*converter.Table, string) {
+	format := e.Format
+	other := "xlsx"
+	if format == "xlsx" {
+		other = "csv"
+	}
+	if r.Header.Get("Accept") != "" {
+		if best, ok := negotiate(r, []string{exportMedia[format].mediaType, exportMedia[other].mediaType}); ok && best == exportMedia[other].mediaType {
+			format = other
+		}
+	}
+
+	table := &converter.Table{Format: exportMedia[format].mediaType, Header: !e.NoHeader}
+	for _, column := range e.Columns {
+		header := column.Header
+		if header == "" {
+			header = column.Field
+		}
+		table.Columns = append(table.Columns, converter.TableColumn{Header: header, Path: strings.Split(column.Field, ".")})
+	}
+
+	filename := e.Filename
+	if filename == "" {
+		filename = "export"
+	}
+	if !strings.HasSuffix(filename, exportMedia[format].extension) {
+		filename = strings.TrimSuffix(filename, exportMedia[other].extension) + exportMedia[format].extension
+	}
+	return table, mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
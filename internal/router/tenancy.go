@@ -0,0 +1,47 @@
+package router
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/pool"
+)
+
+// tenantDial adds the client certificate of tenant to the options for
+// dialing a TLS backend. Connections are pooled per certificate, so tenants
+// never share a connection authenticated as another tenant.
+func tenantDial(tenancy *config.Tenancy, opts pool.Options, tenant string) pool.Options {
+	if tenancy == nil || !opts.TLS || tenant == "" {
+		return opts
+	}
+	if t, ok := tenancy.Tenants[tenant]; ok && t.ClientCertFile != "" {
+		opts.CertFile, opts.KeyFile = t.ClientCertFile, t.ClientKeyFile
+	}
+	return opts
+}
+
+// tenant returns the tenant named by an HTTP request in multi-tenant mode
+func (h *HTTPHandler) tenant(r *http.Request) string {
+	if h.config.Tenancy == nil {
+		return ""
+	}
+	return r.Header.Get(h.config.Tenancy.Header)
+}
+
+// dial returns the options for dialing a backend of a call's pool as the
+// call's tenant
+func (h *GRPCHandler) dial(ctx context.Context, pool, backendAddr string) pool.Options {
+	opts := dialOptions(h.backends[pool][backendAddr], "")
+	if h.config.Tenancy == nil {
+		return opts
+	}
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	var tenant string
+	if values := incoming.Get(h.config.Tenancy.Header); len(values) > 0 {
+		tenant = values[0]
+	}
+	return tenantDial(h.config.Tenancy, opts, tenant)
+}
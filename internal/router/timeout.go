@@ -0,0 +1,43 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// defaultTimeout bounds HTTP route requests that configure no timeout
+const defaultTimeout = 30 * time.Second
+
+// routeTimeout returns the time a request may take: the route's timeout,
+// shortened by a grpc-timeout header sent by the client
+func routeTimeout(route *config.HTTPRoute, r *http.Request) time.Duration {
+	timeout := defaultTimeout
+	if d, err := time.ParseDuration(route.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	if d, ok := parseGRPCTimeout(r.Header.Get("Grpc-Timeout")); ok && d < timeout {
+		timeout = d
+	}
+	return timeout
+}
+
+// clientDeadline applies a grpc-timeout header to ctx; calls without a
+// route timeout, such as streams, still honour the client's deadline
+func clientDeadline(ctx context.Context, r *http.Request) (context.Context, context.CancelFunc) {
+	if d, ok := parseGRPCTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
+
+// serviceDeadline applies a service's timeout to a call. Deadlines sent by
+// gRPC clients are already on ctx and win when earlier.
+func serviceDeadline(ctx context.Context, svc *config.GRPCService) (context.Context, context.CancelFunc) {
+	if d, err := time.ParseDuration(svc.Timeout); err == nil && d > 0 {
+		return context.WithTimeout(ctx, d)
+	}
+	return context.WithCancel(ctx)
+}
@@ -0,0 +1,213 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+	"dynamic-gateway/internal/idtoken"
+)
+
+// tokenAuth verifies the bearer tokens of a route or service, JWTs or opaque
+// tokens introspected, and forwards the configured claims of valid ones
+type tokenAuth struct {
+	provider idtoken.Provider
+	header   string
+	claims   map[string]string // header name to claim path
+}
+
+func newJWTAuth(cfg *config.JWTAuth) *tokenAuth {
+	if cfg == nil {
+		return nil
+	}
+	refresh, _ := time.ParseDuration(cfg.RefreshInterval)
+	return &tokenAuth{
+		provider: idtoken.NewJWT(cfg.Issuer, cfg.Audiences, cfg.JWKSURL, refresh),
+		header:   cfg.Header,
+		claims:   cfg.ForwardClaims,
+	}
+}
+
+func newIntrospectionAuth(cfg *config.TokenIntrospection) *tokenAuth {
+	if cfg == nil {
+		return nil
+	}
+	secret := cfg.ClientSecret
+	if secret == "" {
+		secret = os.Getenv(cfg.ClientSecretEnv)
+	}
+	ttl, _ := time.ParseDuration(cfg.CacheTTL)
+	return &tokenAuth{
+		provider: idtoken.NewIntrospection(cfg.URL, cfg.ClientID, secret, cfg.Audiences, cfg.RequiredScopes, ttl),
+		header:   cfg.Header,
+		claims:   cfg.ForwardClaims,
+	}
+}
+
+// Close releases what the provider keeps running in the background
+func (a *tokenAuth) Close() {
+	if c, ok := a.provider.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// token extracts the token from a header value, which carries a bearer
+// token when read from Authorization
+func (a *tokenAuth) token(value string) string {
+	if strings.EqualFold(a.header, "Authorization") {
+		scheme, token, ok := strings.Cut(value, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return ""
+		}
+		return strings.TrimSpace(token)
+	}
+	return value
+}
+
+// verify returns the claims of a valid token
+func (a *tokenAuth) verify(ctx context.Context, token string) (idtoken.Claims, error) {
+	if token == "" {
+		return nil, errMissingToken
+	}
+	return a.provider.Verify(ctx, token)
+}
+
+var errMissingToken = status.Error(codes.Unauthenticated, "bearer token required")
+
+// authenticateHTTP rejects requests without a valid token with 401 and
+// returns the others with the consumer keyed by the token's subject, or its
+// client for tokens without one, and the
+// forwarded claims set, replacing any the client sent
+func (a *tokenAuth) authenticateHTTP(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	claims, err := a.verify(r.Context(), a.token(r.Header.Get(a.header)))
+	if err == errMissingToken {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "bearer token required", http.StatusUnauthorized)
+		return r, false
+	}
+	if errors.Is(err, idtoken.ErrUnavailable) {
+		log.Printf("Failed to verify token: %v", err)
+		http.Error(w, "failed to verify token", http.StatusServiceUnavailable)
+		return r, false
+	}
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid token: "+err.Error(), http.StatusUnauthorized)
+		return r, false
+	}
+
+	for name, claim := range a.claims {
+		r.Header.Del(name)
+		if value, ok := claimValue(claims, claim); ok {
+			r.Header.Set(name, value)
+		}
+	}
+	ctx := identity.WithClaims(r.Context(), claims)
+	if consumer := consumer(claims); consumer != "" {
+		ctx = identity.WithConsumer(ctx, consumer)
+	}
+	return r.WithContext(ctx), true
+}
+
+// authenticateGRPC fails calls without a valid token with UNAUTHENTICATED
+// and returns a context whose incoming metadata, forwarded to backends,
+// carries the forwarded claims instead of any the client sent
+func (a *tokenAuth) authenticateGRPC(ctx context.Context) (context.Context, error) {
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	var value string
+	if values := incoming.Get(a.header); len(values) > 0 {
+		value = values[0]
+	}
+	claims, err := a.verify(ctx, a.token(value))
+	if err == errMissingToken {
+		return ctx, err
+	}
+	if errors.Is(err, idtoken.ErrUnavailable) {
+		return ctx, status.Error(codes.Unavailable, "failed to verify token")
+	}
+	if err != nil {
+		return ctx, status.Errorf(codes.Unauthenticated, "invalid token: %v", err)
+	}
+
+	md := incoming.Copy()
+	if md == nil {
+		md = metadata.MD{}
+	}
+	for name, claim := range a.claims {
+		md.Delete(name)
+		if value, ok := claimValue(claims, claim); ok {
+			md.Set(name, value)
+		}
+	}
+	ctx = identity.WithClaims(metadata.NewIncomingContext(ctx, md), claims)
+	if consumer := consumer(claims); consumer != "" {
+		ctx = identity.WithConsumer(ctx, consumer)
+	}
+	return ctx, nil
+}
+
+// consumer names the holder of a token: its subject, or the client it was
+// issued to for tokens of the client credentials grant, which may have none
+func consumer(claims idtoken.Claims) string {
+	if sub := claims.Subject(); sub != "" {
+		return sub
+	}
+	client, _ := claims["client_id"].(string)
+	return client
+}
+
+// claimValue formats the claim at a dot-separated path for a header: lists
+// are joined with commas and objects written as JSON
+func claimValue(claims idtoken.Claims, path string) (string, bool) {
+	var value any = map[string]any(claims)
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[key]; !ok {
+			return "", false
+		}
+	}
+
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case string:
+		text = v
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		text = strconv.FormatBool(v)
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			} else {
+				data, _ := json.Marshal(item)
+				items = append(items, string(data))
+			}
+		}
+		text = strings.Join(items, ",")
+	default:
+		data, _ := json.Marshal(v)
+		text = string(data)
+	}
+	// Header values cannot span lines
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(text), true
+}
@@ -0,0 +1,95 @@
+package router
+
+import (
+	"context"
+	"net/http"
+
+	"dynamic-gateway/internal/tracing"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// startTrace makes the gateway the root of a W3C trace for requests arriving
+// without trace context: a traceparent header is added whose sampled flag is
+// set for a fraction rate of requests, so backends record the traces the
+// gateway samples. Incoming trace context is forwarded untouched.
+func startTrace(r *http.Request, rate float64) {
+	if r.Header.Get("Traceparent") != "" {
+		return
+	}
+	r.Header.Set("Traceparent", tracing.Root(rate).Traceparent())
+}
+
+// startHTTPSpan starts the gateway's span of an HTTP request, continuing the
+// trace of its traceparent header, and points the header at the span so
+// backends record theirs as its children. Headers become gRPC metadata on
+// converted routes, so gRPC backends receive it too. Without a tracer only
+// traces are started, as by startTrace.
+func startHTTPSpan(tracer *tracing.Tracer, r *http.Request, route string, rate float64) *tracing.Span {
+	if tracer == nil {
+		startTrace(r, rate)
+		return nil
+	}
+	parent, _ := tracing.Parse(r.Header.Get("Traceparent"))
+	span := tracer.Start(r.Method+" "+route, tracing.KindServer, parent, rate)
+	r.Header.Set("Traceparent", span.Context().Traceparent())
+	span.SetAttribute("http.request.method", r.Method)
+	span.SetAttribute("http.route", route)
+	span.SetAttribute("url.path", r.URL.Path)
+	return span
+}
+
+// endHTTPSpan completes the span of an HTTP request with its outcome
+func endHTTPSpan(span *tracing.Span, backend string, code int) {
+	if code == 0 {
+		code = http.StatusSwitchingProtocols
+	}
+	span.SetAttribute("http.response.status_code", code)
+	if backend != "" {
+		span.SetAttribute("gateway.backend", backend)
+	}
+	if code >= http.StatusInternalServerError {
+		span.SetError(http.StatusText(code))
+	}
+	span.End()
+}
+
+// startSpan starts the gateway's span of a gRPC call, continuing the trace
+// of its traceparent metadata, and returns a context whose incoming metadata
+// points at the span. That metadata is forwarded to gRPC backends and becomes
+// headers of converted calls, so HTTP backends receive it too.
+func (h *GRPCHandler) startSpan(ctx context.Context, serviceName, methodName string) (context.Context, *tracing.Span) {
+	if h.tracer == nil {
+		return ctx, nil
+	}
+	incoming, _ := metadata.FromIncomingContext(ctx)
+	var parent tracing.SpanContext
+	if values := incoming.Get(tracing.Header); len(values) > 0 {
+		parent, _ = tracing.Parse(values[0])
+	}
+	span := h.tracer.Start(serviceName+"/"+methodName, tracing.KindServer, parent, h.config.TracingRate(nil))
+	span.SetAttribute("rpc.system", "grpc")
+	span.SetAttribute("rpc.service", serviceName)
+	span.SetAttribute("rpc.method", methodName)
+
+	md := incoming.Copy()
+	if md == nil {
+		md = metadata.MD{}
+	}
+	md.Set(tracing.Header, span.Context().Traceparent())
+	return metadata.NewIncomingContext(ctx, md), span
+}
+
+// endGRPCSpan completes the span of a gRPC call with its outcome
+func endGRPCSpan(span *tracing.Span, backend string, err error) {
+	st := status.Convert(err)
+	span.SetAttribute("rpc.grpc.status_code", int(st.Code()))
+	if backend != "" {
+		span.SetAttribute("gateway.backend", backend)
+	}
+	if err != nil {
+		span.SetError(st.Message())
+	}
+	span.End()
+}
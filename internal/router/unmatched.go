@@ -0,0 +1,40 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// defaultRouteKey is the balancer key of the default backend
+const defaultRouteKey = "route_default"
+
+// unmatchedCounters counts requests that matched no route
+type unmatchedCounters struct {
+	notFound         atomic.Uint64
+	methodNotAllowed atomic.Uint64
+	defaultBackend   atomic.Uint64
+}
+
+// UnmatchedStats reports how requests that matched no route were answered
+type UnmatchedStats struct {
+	NotFound         uint64 `json:"not_found"`          // no route path matched
+	MethodNotAllowed uint64 `json:"method_not_allowed"` // a path matched but none of its methods
+	DefaultBackend   uint64 `json:"default_backend"`    // sent to the default backend
+}
+
+// UnmatchedStats returns the counts of requests that matched no route since
+// the gateway started
+func (h *HTTPHandler) UnmatchedStats() UnmatchedStats {
+	return UnmatchedStats{
+		NotFound:         h.unmatched.notFound.Load(),
+		MethodNotAllowed: h.unmatched.methodNotAllowed.Load(),
+		DefaultBackend:   h.unmatched.defaultBackend.Load(),
+	}
+}
+
+// UnmatchedHandler serves the counts of requests that matched no route
+func (h *HTTPHandler) UnmatchedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.UnmatchedStats())
+}
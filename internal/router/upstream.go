@@ -0,0 +1,34 @@
+package router
+
+import (
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/pool"
+)
+
+// backendConfigs maps backend addresses to their configuration
+func backendConfigs(backends []config.Backend) map[string]config.Backend {
+	configs := make(map[string]config.Backend, len(backends))
+	for _, b := range backends {
+		configs[b.Address] = b
+	}
+	return configs
+}
+
+// backendWeights maps backend addresses to their weights
+func backendWeights(backends []config.Backend) map[string]int {
+	weights := make(map[string]int, len(backends))
+	for _, b := range backends {
+		weights[b.Address] = b.Weight
+	}
+	return weights
+}
+
+// dialOptions returns the connection settings for a backend; the backend's
+// host overrides the route-level upstream host
+func dialOptions(b config.Backend, upstreamHost string) pool.Options {
+	opts := pool.BackendOptions(b)
+	if opts.Authority == "" {
+		opts.Authority = upstreamHost
+	}
+	return opts
+}
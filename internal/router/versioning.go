@@ -0,0 +1,65 @@
+package router
+
+import (
+	"net/http"
+	"net/netip"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+)
+
+// poolKey returns the balancer key of a named backend pool within a route
+func poolKey(routeKey, pool string) string {
+	if pool == "" {
+		return routeKey
+	}
+	return routeKey + "/" + pool
+}
+
+// resolveVersion returns the API version the request's consumer is pinned to.
+// The consumer is the authenticated one; only requests from trusted proxies
+// may name it in the consumer header.
+func resolveVersion(cfg *config.APIVersioning, trusted []netip.Prefix, r *http.Request) string {
+	if cfg == nil {
+		return ""
+	}
+
+	consumer := identity.FromTrustedRequest(r, cfg.ConsumerHeader, trusted)
+	if version, ok := cfg.ConsumerPins[consumer]; ok {
+		return version
+	}
+	return cfg.DefaultVersion
+}
+
+// applyVersion rewrites the request for a version-specific pool
+func applyVersion(r *http.Request, version config.RouteVersion) *http.Request {
+	r = r.Clone(r.Context())
+	if version.PathPrefix != "" {
+		r.URL.Path = version.PathPrefix + r.URL.Path
+		r.URL.RawPath = ""
+	}
+	for key, value := range version.SetHeaders {
+		r.Header.Set(key, value)
+	}
+	return r
+}
+
+// versionProxies returns the proxies trusted to name the consumer in cfg's
+// version header
+func versionProxies(cfg *config.Config) []netip.Prefix {
+	if cfg.APIVersioning == nil {
+		return nil
+	}
+	return parsePrefixes(cfg.APIVersioning.TrustedProxies)
+}
+
+// parsePrefixes parses validated CIDRs
+func parsePrefixes(cidrs []string) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, cidr := range cidrs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/identity"
+)
+
+func TestResolveVersion(t *testing.T) {
+	cfg := &config.APIVersioning{
+		DefaultVersion: "v2",
+		ConsumerHeader: "X-Consumer",
+		TrustedProxies: []string{"10.0.0.0/8"},
+		ConsumerPins:   map[string]string{"alice": "v1"},
+	}
+	tests := []struct {
+		name     string
+		remote   string
+		consumer string // authenticated
+		header   string
+		want     string
+	}{
+		{name: "default", remote: "192.0.2.1:1234", want: "v2"},
+		{name: "authenticated consumer", remote: "192.0.2.1:1234", consumer: "alice", want: "v1"},
+		{name: "header from a client", remote: "192.0.2.1:1234", header: "alice", want: "v2"},
+		{name: "header from a trusted proxy", remote: "10.1.2.3:1234", header: "alice", want: "v1"},
+		{name: "authenticated consumer wins over the header", remote: "10.1.2.3:1234", consumer: "bob", header: "alice", want: "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.consumer != "" {
+				r = r.WithContext(identity.WithConsumer(r.Context(), tt.consumer))
+			}
+			if tt.header != "" {
+				r.Header.Set("X-Consumer", tt.header)
+			}
+			if got := resolveVersion(cfg, parsePrefixes(cfg.TrustedProxies), r); got != tt.want {
+				t.Errorf("version = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/converter"
+	"dynamic-gateway/internal/identity"
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/streams"
+)
+
+// WebSocket subprotocols choosing how responses are framed. Requests are
+// decoded by frame type: text frames carry JSON, binary frames protobuf.
+const (
+	wsProtocolJSON  = "grpc-ws+json" // default: text frames of {"result":...}
+	wsProtocolProto = "grpc-ws+proto"
+)
+
+// wsMessage is a WebSocket frame payload and whether it was sent as binary
+type wsMessage struct {
+	payload []byte
+	binary  bool
+}
+
+var wsCodec = websocket.Codec{
+	Marshal: func(v any) ([]byte, byte, error) {
+		msg := v.(wsMessage)
+		if msg.binary {
+			return msg.payload, websocket.BinaryFrame, nil
+		}
+		return msg.payload, websocket.TextFrame, nil
+	},
+	Unmarshal: func(data []byte, payloadType byte, v any) error {
+		msg := v.(*wsMessage)
+		msg.payload = data
+		msg.binary = payloadType == websocket.BinaryFrame
+		return nil
+	},
+}
+
+// wsSkippedHeaders are handshake headers not forwarded as gRPC metadata
+var wsSkippedHeaders = map[string]bool{
+	"Connection": true,
+	"Upgrade":    true,
+	"Host":       true,
+}
+
+// routeWebSocket bridges a WebSocket on /{prefix}/{service}/{method} to a
+// bidirectional gRPC stream. Every client message is sent on the stream and an
+// empty message closes the sending side; every response becomes a message.
+// The call's status is sent as a final {"error":...} text message unless it
+// is OK, and the connection closes when the call ends.
+func (h *HTTPHandler) routeWebSocket(w http.ResponseWriter, r *http.Request, route *config.HTTPRoute, routeKey, backendAddr string, dial pool.Options) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return
+	}
+	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) < 3 {
+		http.Error(w, "invalid path format, expected /{prefix}/{service}/{method}", http.StatusBadRequest)
+		return
+	}
+	serviceName, methodName := pathParts[1], pathParts[2]
+
+	open, ok := routeStreams.Open(routeID(route), identity.FromRequest(r, ""), route.MaxStreams, route.MaxStreamsPerClient)
+	if !ok {
+		http.Error(w, "too many streams open for route", http.StatusServiceUnavailable)
+		return
+	}
+	defer open.Close()
+
+	conn, err := h.connectionPool.GetConnectionWithOptions(r.Context(), grpcTarget(backendAddr), dial)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to connect to backend: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	// Forward request headers with route metadata taking precedence
+	md := metadata.MD{}
+	for name, values := range r.Header {
+		if !wsSkippedHeaders[name] && !strings.HasPrefix(name, "Sec-Websocket-") {
+			md.Append(name, values...)
+		}
+	}
+	if tmpl := h.metadata[routeKey]; tmpl != nil {
+		tmpl.apply(md, httpAttributes(r, serviceName))
+	}
+
+	callOpts := []grpc.CallOption{newCallPolicy(route.CallPolicy).option(), grpc.ForceCodecV2(frameCodec{})}
+	if route.MaxResponseSize > 0 {
+		callOpts = append(callOpts, grpc.MaxCallRecvMsgSize(int(route.MaxResponseSize)))
+	}
+
+	server := websocket.Server{
+		Handshake: func(cfg *websocket.Config, req *http.Request) error {
+			return wsHandshake(h.config, cfg, req)
+		},
+		Handler: func(ws *websocket.Conn) {
+			// The server's read and write timeouts do not apply to streams
+			ws.SetDeadline(time.Time{})
+			defer ws.Close()
+
+			ctx := metadata.NewOutgoingContext(r.Context(), md)
+			binary := len(ws.Config().Protocol) > 0 && ws.Config().Protocol[0] == wsProtocolProto
+			err := h.bridgeWebSocket(ctx, open, ws, conn, serviceName, methodName, binary, callOpts)
+			if err != nil {
+				wsCodec.Send(ws, wsMessage{payload: wsError(err)})
+			}
+		},
+	}
+	server.ServeHTTP(hijacker{w}, r)
+}
+
+// bridgeWebSocket relays messages between the socket and the backend stream
+// until the backend ends the call or the client disconnects; client messages
+// are read in a goroutine of open
+func (h *HTTPHandler) bridgeWebSocket(ctx context.Context, open *streams.Stream, ws *websocket.Conn, conn *grpc.ClientConn, serviceName, methodName string, binary bool, callOpts []grpc.CallOption) error {
+	fullMethod := fmt.Sprintf("/%s/%s", serviceName, methodName)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, fullMethod, callOpts...)
+	if err != nil {
+		return err
+	}
+
+	// Client → backend; a read error means the client went away, which
+	// cancels the call
+	open.Go(func() {
+		for {
+			var msg wsMessage
+			if err := wsCodec.Receive(ws, &msg); err != nil {
+				if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+					log.Printf("WebSocket read for %s failed: %v", fullMethod, err)
+				}
+				cancel()
+				return
+			}
+			if len(msg.payload) == 0 {
+				stream.CloseSend()
+				continue
+			}
+			payload := msg.payload
+			if !msg.binary {
+				request, _, err := converter.NewMessages(h.descriptors, serviceName, methodName, msg.payload)
+				if err == nil {
+					payload, err = proto.Marshal(request)
+				}
+				if err != nil {
+					wsCodec.Send(ws, wsMessage{payload: wsError(status.Error(codes.InvalidArgument, err.Error()))})
+					continue
+				}
+			}
+			if err := stream.SendMsg(&frame{payload: payload}); err != nil {
+				// The call's status is reported by the receiving side
+				return
+			}
+		}
+	})
+
+	// Backend → client
+	for {
+		msg := &frame{}
+		if err := stream.RecvMsg(msg); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		out := wsMessage{payload: msg.payload, binary: true}
+		if !binary {
+			response := converter.NewResponse(h.descriptors, serviceName, methodName)
+			if err := proto.Unmarshal(msg.payload, response); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			body, err := converter.MarshalMessage(response)
+			if err != nil {
+				return err
+			}
+			out = wsMessage{payload: []byte(fmt.Sprintf(`{"result":%s}`, body))}
+		}
+		if err := wsCodec.Send(ws, out); err != nil {
+			return nil
+		}
+	}
+}
+
+// wsHandshake selects the response framing and rejects cross-origin browser
+// connections that the CORS settings would not allow
+func wsHandshake(cfg *config.Config, ws *websocket.Config, r *http.Request) error {
+	if origin := r.Header.Get("Origin"); origin != "" && !cfg.AllowAllOrigin {
+		u, err := url.Parse(origin)
+		allowed := err == nil && u.Host == r.Host
+		for _, o := range cfg.AllowedOrigins {
+			allowed = allowed || o == origin
+		}
+		if !allowed {
+			return fmt.Errorf("origin %s not allowed", origin)
+		}
+	}
+
+	offered := ws.Protocol
+	ws.Protocol = nil
+	for _, p := range offered {
+		if p == wsProtocolJSON || p == wsProtocolProto {
+			ws.Protocol = []string{p}
+			break
+		}
+	}
+	return nil
+}
+
+// wsError encodes a call status as a JSON error message
+func wsError(err error) []byte {
+	st := status.Convert(err)
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]any{"code": int(st.Code()), "message": st.Message()},
+	})
+	return body
+}
+
+// hijacker exposes the connection of a wrapped ResponseWriter, since the
+// WebSocket server asserts http.Hijacker directly
+type hijacker struct {
+	http.ResponseWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(h.ResponseWriter).Hijack()
+}
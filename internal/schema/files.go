@@ -0,0 +1,38 @@
+package schema
+
+import (
+	"fmt"
+	"os"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"dynamic-gateway/internal/config"
+)
+
+// LoadDescriptorSets registers the proto_descriptor_set files configured on
+// gRPC services, as produced by `protoc --include_imports --descriptor_set_out`
+// or `buf build -o`, and checks that each defines its service
+func LoadDescriptorSets(store *Store, cfg *config.Config) error {
+	for _, svc := range cfg.GRPCServices {
+		if svc.ProtoDescriptorSet == "" {
+			continue
+		}
+
+		data, err := os.ReadFile(svc.ProtoDescriptorSet)
+		if err != nil {
+			return fmt.Errorf("failed to read descriptor set for service %s: %w", svc.ServiceName, err)
+		}
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(data, set); err != nil {
+			return fmt.Errorf("failed to decode descriptor set %s: %w", svc.ProtoDescriptorSet, err)
+		}
+		if err := store.Update("file:"+svc.ProtoDescriptorSet, set); err != nil {
+			return err
+		}
+		if len(store.Methods(svc.ServiceName)) == 0 {
+			return fmt.Errorf("descriptor set %s does not define service %s", svc.ProtoDescriptorSet, svc.ServiceName)
+		}
+	}
+	return nil
+}
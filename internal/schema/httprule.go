@@ -0,0 +1,268 @@
+package schema
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// HTTPBinding maps an HTTP method and path template onto a gRPC method, as
+// declared by a google.api.http annotation
+type HTTPBinding struct {
+	Method       protoreflect.MethodDescriptor
+	HTTPMethod   string
+	Pattern      string
+	Body         string // "*" for the whole request message, a field path, or empty
+	ResponseBody string // response field returned instead of the whole message
+
+	template *pathTemplate
+}
+
+// MatchHTTP finds the binding for an HTTP request and returns the values of
+// its path variables keyed by field path
+func (s *Store) MatchHTTP(method, path string) (*HTTPBinding, map[string]string, bool) {
+	s.mu.RLock()
+	bindings := s.bindings
+	s.mu.RUnlock()
+
+	for _, b := range bindings {
+		if b.HTTPMethod != method {
+			continue
+		}
+		if params, ok := b.template.match(path); ok {
+			return b, params, true
+		}
+	}
+	return nil, nil, false
+}
+
+// httpBindings collects the google.api.http bindings of every method in
+// files, most specific templates first
+func httpBindings(files *protoregistry.Files) []*HTTPBinding {
+	var bindings []*HTTPBinding
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			methods := fd.Services().Get(i).Methods()
+			for j := 0; j < methods.Len(); j++ {
+				bindings = append(bindings, methodBindings(methods.Get(j))...)
+			}
+		}
+		return true
+	})
+
+	sort.SliceStable(bindings, func(i, j int) bool {
+		return bindings[i].template.literals > bindings[j].template.literals
+	})
+	return bindings
+}
+
+// methodBindings returns the bindings declared on a method. Options are
+// decoded again so the extension resolves however the descriptor was loaded.
+func methodBindings(method protoreflect.MethodDescriptor) []*HTTPBinding {
+	opts, ok := method.Options().(*descriptorpb.MethodOptions)
+	if !ok || opts == nil {
+		return nil
+	}
+	data, err := proto.Marshal(opts)
+	if err != nil {
+		return nil
+	}
+	decoded := &descriptorpb.MethodOptions{}
+	if err := (proto.UnmarshalOptions{Resolver: protoregistry.GlobalTypes}).Unmarshal(data, decoded); err != nil {
+		return nil
+	}
+	rule, ok := proto.GetExtension(decoded, annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil
+	}
+
+	var bindings []*HTTPBinding
+	for _, r := range append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...) {
+		httpMethod, pattern := rulePattern(r)
+		if pattern == "" {
+			continue
+		}
+		template, err := parseTemplate(pattern)
+		if err != nil {
+			continue
+		}
+		bindings = append(bindings, &HTTPBinding{
+			Method:       method,
+			HTTPMethod:   httpMethod,
+			Pattern:      pattern,
+			Body:         r.GetBody(),
+			ResponseBody: r.GetResponseBody(),
+			template:     template,
+		})
+	}
+	return bindings
+}
+
+// rulePattern returns the HTTP method and path template of a rule
+func rulePattern(rule *annotations.HttpRule) (string, string) {
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return "GET", p.Get
+	case *annotations.HttpRule_Put:
+		return "PUT", p.Put
+	case *annotations.HttpRule_Post:
+		return "POST", p.Post
+	case *annotations.HttpRule_Delete:
+		return "DELETE", p.Delete
+	case *annotations.HttpRule_Patch:
+		return "PATCH", p.Patch
+	case *annotations.HttpRule_Custom:
+		return p.Custom.GetKind(), p.Custom.GetPath()
+	}
+	return "", ""
+}
+
+// templateSegment is one path segment of a template
+type templateSegment struct {
+	literal  string // empty for wildcards
+	deep     bool   // "**" matches the remaining segments
+	variable string // field path captured by this segment, if any
+}
+
+// pathTemplate is a parsed google.api.http path template such as
+// /v1/{name=shelves/*/books/*}:publish
+type pathTemplate struct {
+	segments []templateSegment
+	verb     string
+	literals int
+}
+
+// parseTemplate parses the template syntax of google/api/http.proto
+func parseTemplate(pattern string) (*pathTemplate, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("template %q must start with /", pattern)
+	}
+	rest := pattern[1:]
+
+	// The verb follows the last colon outside a variable
+	t := &pathTemplate{}
+	if i := strings.LastIndex(rest, ":"); i >= 0 && i > strings.LastIndex(rest, "}") {
+		t.verb = rest[i+1:]
+		rest = rest[:i]
+	}
+
+	for len(rest) > 0 {
+		var segment string
+		if strings.HasPrefix(rest, "{") {
+			end := strings.Index(rest, "}")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated variable in %q", pattern)
+			}
+			segment, rest = rest[1:end], rest[end+1:]
+
+			field, sub, ok := strings.Cut(segment, "=")
+			if !ok {
+				sub = "*"
+			}
+			for _, s := range strings.Split(sub, "/") {
+				t.add(s, field)
+			}
+		} else {
+			segment, rest, _ = strings.Cut(rest, "/")
+			t.add(segment, "")
+			continue
+		}
+		rest = strings.TrimPrefix(rest, "/")
+	}
+
+	for i, s := range t.segments {
+		if s.deep && i != len(t.segments)-1 {
+			return nil, fmt.Errorf("** must be the last segment of %q", pattern)
+		}
+	}
+	return t, nil
+}
+
+func (t *pathTemplate) add(segment, variable string) {
+	switch segment {
+	case "*":
+		t.segments = append(t.segments, templateSegment{variable: variable})
+	case "**":
+		t.segments = append(t.segments, templateSegment{deep: true, variable: variable})
+	default:
+		t.segments = append(t.segments, templateSegment{literal: segment, variable: variable})
+		t.literals++
+	}
+}
+
+// match matches an escaped URL path against the template
+func (t *pathTemplate) match(path string) (map[string]string, bool) {
+	path = strings.TrimPrefix(path, "/")
+	if t.verb != "" {
+		var ok bool
+		if path, ok = strings.CutSuffix(path, ":"+t.verb); !ok {
+			return nil, false
+		}
+	}
+
+	parts := strings.Split(path, "/")
+	captured := make(map[string][]string)
+	for i, s := range t.segments {
+		if s.deep {
+			if s.variable != "" {
+				captured[s.variable] = append(captured[s.variable], parts[i:]...)
+			}
+			parts = parts[:i]
+			break
+		}
+		if i >= len(parts) || parts[i] == "" {
+			return nil, false
+		}
+		if s.literal != "" && parts[i] != s.literal {
+			return nil, false
+		}
+		if s.variable != "" {
+			captured[s.variable] = append(captured[s.variable], parts[i])
+		}
+	}
+	if !t.endsDeep() && len(parts) != len(t.segments) {
+		return nil, false
+	}
+
+	// Single-segment variables are fully unescaped; multi-segment ones keep
+	// escaped slashes so segment boundaries stay unambiguous
+	params := make(map[string]string, len(captured))
+	for field, values := range captured {
+		multi := t.multiSegment(field)
+		for i, v := range values {
+			if multi {
+				v = strings.NewReplacer("%2F", "%252F", "%2f", "%252f").Replace(v)
+			}
+			if unescaped, err := url.PathUnescape(v); err == nil {
+				values[i] = unescaped
+			}
+		}
+		params[field] = strings.Join(values, "/")
+	}
+	return params, true
+}
+
+// multiSegment reports whether a variable may span several path segments
+func (t *pathTemplate) multiSegment(variable string) bool {
+	count := 0
+	for _, s := range t.segments {
+		if s.variable == variable {
+			count++
+			if s.deep {
+				return true
+			}
+		}
+	}
+	return count > 1
+}
+
+func (t *pathTemplate) endsDeep() bool {
+	return len(t.segments) > 0 && t.segments[len(t.segments)-1].deep
+}
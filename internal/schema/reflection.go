@@ -0,0 +1,354 @@
+package schema
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"dynamic-gateway/internal/callcreds"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/pool"
+)
+
+// ErrNotReflected is returned when invalidating the descriptors of a service
+// without reflection enabled
+var ErrNotReflected = errors.New("service does not use reflection")
+
+// refetchInterval spaces the fetches of a service's descriptors prompted by
+// calls to methods they lack
+const refetchInterval = 10 * time.Second
+
+// Reflector discovers descriptors of gRPC services with reflection enabled by
+// calling their backends' server reflection service. Descriptors are cached
+// per backend until their TTL expires; the store keeps serving the last ones
+// fetched while backends fail to answer.
+type Reflector struct {
+	store  *Store
+	pool   *pool.ConnectionPool
+	config func() *config.Config
+
+	mu        sync.Mutex
+	cache     map[reflectedKey]reflected
+	refetched map[string]time.Time // by service
+	refetch   sync.Mutex           // held while fetching for a missing method
+}
+
+// reflectedKey identifies the descriptors of a service served by a backend
+type reflectedKey struct {
+	service, backend string
+}
+
+type reflected struct {
+	set     *descriptorpb.FileDescriptorSet
+	expires time.Time
+}
+
+// NewReflector creates a reflector for the services of the active configuration
+func NewReflector(store *Store, pool *pool.ConnectionPool, cfg func() *config.Config) *Reflector {
+	return &Reflector{
+		store:     store,
+		pool:      pool,
+		config:    cfg,
+		cache:     make(map[reflectedKey]reflected),
+		refetched: make(map[string]time.Time),
+	}
+}
+
+// Refresh resolves every reflected service whose cached descriptors have
+// expired from the first backend that answers and updates the store.
+// Failures are logged so one unreachable service does not hold back the
+// others.
+func (r *Reflector) Refresh(ctx context.Context) {
+	for _, svc := range r.config().GRPCServices {
+		if svc.Reflection {
+			if err := r.refreshService(ctx, &svc); err != nil {
+				log.Printf("Failed to reflect service %s: %v", svc.ServiceName, err)
+			}
+		}
+	}
+}
+
+// refreshService updates the store with the service's descriptors when they
+// were fetched again and changed
+func (r *Reflector) refreshService(ctx context.Context, svc *config.GRPCService) error {
+	set, fetched, err := r.resolve(ctx, svc)
+	if err != nil || !fetched {
+		return err
+	}
+	current := r.store.source("reflection:" + svc.ServiceName)
+	if current != nil && proto.Equal(current, set) {
+		return nil
+	}
+	if err := r.store.Update("reflection:"+svc.ServiceName, set); err != nil {
+		return err
+	}
+	if current != nil {
+		log.Printf("Descriptors of %s changed", svc.ServiceName)
+	}
+	return nil
+}
+
+// Start refreshes descriptors as their TTLs expire until ctx is cancelled.
+// Services whose backends all failed are tried again after the configured
+// interval.
+func (r *Reflector) Start(ctx context.Context) {
+	go func() {
+		for {
+			interval, _ := time.ParseDuration(r.config().ReflectionInterval)
+			if interval <= 0 {
+				return
+			}
+			wait := interval
+			r.mu.Lock()
+			for _, entry := range r.cache {
+				wait = min(wait, max(time.Until(entry.expires), time.Second))
+			}
+			r.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+				r.Refresh(ctx)
+			}
+		}
+	}()
+}
+
+// Invalidate drops the cached descriptors of a service, or of every
+// reflected service when service is empty, and fetches them again
+func (r *Reflector) Invalidate(ctx context.Context, service string) error {
+	var errs []error
+	found := false
+	for _, svc := range r.config().GRPCServices {
+		if !svc.Reflection || (service != "" && svc.ServiceName != service) {
+			continue
+		}
+		found = true
+		r.forget(svc.ServiceName)
+		if err := r.refreshService(ctx, &svc); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", svc.ServiceName, err))
+		}
+	}
+	if service != "" && !found {
+		return fmt.Errorf("%s: %w", service, ErrNotReflected)
+	}
+	return errors.Join(errs...)
+}
+
+// MethodMissing fetches a reflected service's descriptors again when it is
+// called with a method they lack, as its backends may have been deployed
+// with new ones. It reports whether the store may have changed. Fetches are
+// spaced by refetchInterval, so calls to methods that do not exist cost one
+// fetch at most that often.
+func (r *Reflector) MethodMissing(serviceName string) bool {
+	var svc *config.GRPCService
+	for _, s := range r.config().GRPCServices {
+		if s.Reflection && s.ServiceName == serviceName {
+			svc = &s
+			break
+		}
+	}
+	if svc == nil {
+		return false
+	}
+
+	// Calls arriving during a fetch wait for it and look again
+	r.refetch.Lock()
+	defer r.refetch.Unlock()
+	r.mu.Lock()
+	recent := time.Since(r.refetched[serviceName]) < refetchInterval
+	if !recent {
+		r.refetched[serviceName] = time.Now()
+	}
+	r.mu.Unlock()
+	if recent {
+		return true
+	}
+
+	r.forget(serviceName)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := r.refreshService(ctx, svc); err != nil {
+		log.Printf("Failed to reflect service %s: %v", serviceName, err)
+		return false
+	}
+	return true
+}
+
+// forget drops the cached descriptors of a service
+func (r *Reflector) forget(service string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.cache {
+		if key.service == service {
+			delete(r.cache, key)
+		}
+	}
+}
+
+// resolve returns the service's descriptors cached for one of its backends,
+// or fetches them from the first backend that answers, reporting whether
+// they were fetched
+func (r *Reflector) resolve(ctx context.Context, svc *config.GRPCService) (*descriptorpb.FileDescriptorSet, bool, error) {
+	now := time.Now()
+	r.mu.Lock()
+	for _, b := range svc.Backends {
+		if entry, ok := r.cache[reflectedKey{svc.ServiceName, b.Address}]; ok && now.Before(entry.expires) {
+			r.mu.Unlock()
+			return entry.set, false, nil
+		}
+	}
+	r.mu.Unlock()
+
+	var callOpts []grpc.CallOption
+	if svc.CallCredentials != nil {
+		creds, err := callcreds.New(ctx, svc.CallCredentials)
+		if err != nil {
+			return nil, false, err
+		}
+		callOpts = append(callOpts, grpc.PerRPCCredentials(creds))
+	}
+
+	ttl, _ := time.ParseDuration(svc.ReflectionTTL)
+	if ttl <= 0 {
+		ttl, _ = time.ParseDuration(r.config().ReflectionInterval)
+	}
+	var lastErr error = fmt.Errorf("no backends")
+	for _, b := range svc.Backends {
+		conn, err := r.pool.GetConnectionWithOptions(ctx, b.Address, pool.BackendOptions(b))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		callCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		set, err := reflectFiles(callCtx, conn, svc.ServiceName, callOpts)
+		cancel()
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", b.Address, err)
+			continue
+		}
+		if ttl > 0 {
+			r.mu.Lock()
+			r.cache[reflectedKey{svc.ServiceName, b.Address}] = reflected{set: set, expires: time.Now().Add(ttl)}
+			r.mu.Unlock()
+		}
+		return set, true, nil
+	}
+	return nil, false, lastErr
+}
+
+// fileRequester asks a reflection stream for the files defining a symbol or
+// with a file name
+type fileRequester func(symbol, filename string) ([][]byte, error)
+
+// reflectFiles walks the imports of the file defining service, preferring the
+// v1 reflection API and falling back to v1alpha for older servers
+func reflectFiles(ctx context.Context, conn *grpc.ClientConn, service string, opts []grpc.CallOption) (*descriptorpb.FileDescriptorSet, error) {
+	stream, err := reflectionv1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	request := v1Requester(stream)
+	first, err := request(service, "")
+	if status.Code(err) == codes.Unimplemented {
+		alpha, err := reflectionv1alpha.NewServerReflectionClient(conn).ServerReflectionInfo(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		request = v1alphaRequester(alpha)
+		first, err = request(service, "")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	pending := first
+	for len(pending) > 0 {
+		data := pending[0]
+		pending = pending[1:]
+
+		file := &descriptorpb.FileDescriptorProto{}
+		if err := proto.Unmarshal(data, file); err != nil {
+			return nil, fmt.Errorf("failed to decode file descriptor: %w", err)
+		}
+		if seen[file.GetName()] {
+			continue
+		}
+		seen[file.GetName()] = true
+		set.File = append(set.File, file)
+
+		// Servers may omit dependencies they already sent on this stream
+		for _, dep := range file.GetDependency() {
+			if seen[dep] {
+				continue
+			}
+			files, err := request("", dep)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", dep, err)
+			}
+			pending = append(pending, files...)
+		}
+	}
+	return set, nil
+}
+
+func v1Requester(stream grpc.BidiStreamingClient[reflectionv1.ServerReflectionRequest, reflectionv1.ServerReflectionResponse]) fileRequester {
+	return func(symbol, filename string) ([][]byte, error) {
+		req := &reflectionv1.ServerReflectionRequest{}
+		if symbol != "" {
+			req.MessageRequest = &reflectionv1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol}
+		} else {
+			req.MessageRequest = &reflectionv1.ServerReflectionRequest_FileByFilename{FileByFilename: filename}
+		}
+		// A failed send surfaces the stream status on Recv
+		if err := stream.Send(req); err != nil && err != io.EOF {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+		}
+		return resp.GetFileDescriptorResponse().GetFileDescriptorProto(), nil
+	}
+}
+
+func v1alphaRequester(stream grpc.BidiStreamingClient[reflectionv1alpha.ServerReflectionRequest, reflectionv1alpha.ServerReflectionResponse]) fileRequester {
+	return func(symbol, filename string) ([][]byte, error) {
+		req := &reflectionv1alpha.ServerReflectionRequest{}
+		if symbol != "" {
+			req.MessageRequest = &reflectionv1alpha.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: symbol}
+		} else {
+			req.MessageRequest = &reflectionv1alpha.ServerReflectionRequest_FileByFilename{FileByFilename: filename}
+		}
+		// A failed send surfaces the stream status on Recv
+		if err := stream.Send(req); err != nil && err != io.EOF {
+			return nil, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			return nil, err
+		}
+		if e := resp.GetErrorResponse(); e != nil {
+			return nil, status.Error(codes.Code(e.GetErrorCode()), e.GetErrorMessage())
+		}
+		return resp.GetFileDescriptorResponse().GetFileDescriptorProto(), nil
+	}
+}
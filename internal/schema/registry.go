@@ -0,0 +1,253 @@
+package schema
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"dynamic-gateway/internal/cluster"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/storage"
+)
+
+const defaultBufURL = "https://buf.build"
+
+// Fetcher retrieves a descriptor set for a module version from a registry
+type Fetcher interface {
+	Fetch(ctx context.Context, module config.SchemaModule) (*descriptorpb.FileDescriptorSet, error)
+}
+
+// Registry periodically syncs descriptors from a schema registry into a Store.
+// In cluster mode only the leader polls the registry; followers load the
+// descriptor sets it publishes to shared storage.
+type Registry struct {
+	fetcher  Fetcher
+	store    *Store
+	modules  []config.SchemaModule
+	interval time.Duration
+	elector  cluster.Elector
+	shared   storage.Store
+}
+
+// NewRegistry creates a registry syncer for the given configuration
+func NewRegistry(cfg *config.SchemaRegistry, store *Store, elector cluster.Elector, shared storage.Store) *Registry {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	var fetcher Fetcher
+	if cfg.Type == "buf" {
+		url := cfg.URL
+		if url == "" {
+			url = defaultBufURL
+		}
+		fetcher = &bufFetcher{baseURL: strings.TrimSuffix(url, "/"), token: cfg.Token, client: client}
+	} else {
+		fetcher = &httpFetcher{baseURL: strings.TrimSuffix(cfg.URL, "/"), token: cfg.Token, client: client}
+	}
+
+	interval, _ := time.ParseDuration(cfg.RefreshInterval)
+
+	return &Registry{
+		fetcher:  fetcher,
+		store:    store,
+		modules:  cfg.Modules,
+		interval: interval,
+		elector:  elector,
+		shared:   shared,
+	}
+}
+
+// Refresh fetches every configured module and updates the store
+func (r *Registry) Refresh(ctx context.Context) error {
+	for _, m := range r.modules {
+		set, err := r.fetcher.Fetch(ctx, m)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s@%s: %w", m.Module, m.Version, err)
+		}
+		if err := r.store.Update("registry:"+m.Module, set); err != nil {
+			return err
+		}
+
+		data, err := proto.Marshal(set)
+		if err != nil {
+			return err
+		}
+		if err := r.shared.Set(ctx, sharedKey(m), data, 0); err != nil {
+			log.Printf("Failed to publish descriptors for %s: %v", m.Module, err)
+		}
+	}
+	return nil
+}
+
+// loadShared updates the store from descriptor sets published by the leader
+func (r *Registry) loadShared(ctx context.Context) error {
+	for _, m := range r.modules {
+		data, err := r.shared.Get(ctx, sharedKey(m))
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		set := &descriptorpb.FileDescriptorSet{}
+		if err := proto.Unmarshal(data, set); err != nil {
+			return fmt.Errorf("failed to decode shared descriptors for %s: %w", m.Module, err)
+		}
+		if err := r.store.Update("registry:"+m.Module, set); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sharedKey(m config.SchemaModule) string {
+	return "schema:" + m.Module + "@" + m.Version
+}
+
+// Start refreshes descriptors on the configured interval until ctx is cancelled
+func (r *Registry) Start(ctx context.Context) {
+	if r.interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				sync := r.Refresh
+				if !r.elector.IsLeader() {
+					sync = r.loadShared
+				}
+				if err := sync(ctx); err != nil {
+					log.Printf("Schema registry refresh failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// bufFetcher fetches descriptors from the Buf Schema Registry Connect API
+type bufFetcher struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func (f *bufFetcher) Fetch(ctx context.Context, module config.SchemaModule) (*descriptorpb.FileDescriptorSet, error) {
+	// Module format: [remote/]owner/module
+	parts := strings.Split(strings.Trim(module.Module, "/"), "/")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid buf module %q, expected owner/module", module.Module)
+	}
+
+	name := map[string]string{
+		"owner":  parts[len(parts)-2],
+		"module": parts[len(parts)-1],
+	}
+	if module.Version != "" {
+		name["ref"] = module.Version
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceRef": map[string]interface{}{"name": name},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	url := f.baseURL + "/buf.registry.module.v1.FileDescriptorSetService/GetFileDescriptorSet"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Connect-Protocol-Version", "1")
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+
+	respBody, err := doRequest(f.client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		FileDescriptorSet json.RawMessage `json:"fileDescriptorSet"`
+	}
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(resp.FileDescriptorSet, set); err != nil {
+		return nil, fmt.Errorf("failed to decode descriptor set: %w", err)
+	}
+	return set, nil
+}
+
+// httpFetcher fetches binary descriptor sets from {url}/{module}/{version}
+type httpFetcher struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+func (f *httpFetcher) Fetch(ctx context.Context, module config.SchemaModule) (*descriptorpb.FileDescriptorSet, error) {
+	url := f.baseURL + "/" + strings.Trim(module.Module, "/")
+	if module.Version != "" {
+		url += "/" + module.Version
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/x-protobuf")
+	if f.token != "" {
+		req.Header.Set("Authorization", "Bearer "+f.token)
+	}
+
+	respBody, err := doRequest(f.client, req)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(respBody, set); err != nil {
+		return nil, fmt.Errorf("failed to decode descriptor set: %w", err)
+	}
+	return set, nil
+}
+
+// doRequest executes req and returns the body of a successful response
+func doRequest(client *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registry returned status %d: %s", resp.StatusCode, string(body))
+	}
+	return body, nil
+}
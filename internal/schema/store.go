@@ -0,0 +1,148 @@
+package schema
+
+import (
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// Store holds proto descriptors used for typed transcoding
+type Store struct {
+	sources  map[string]*descriptorpb.FileDescriptorSet
+	files    *protoregistry.Files
+	bindings []*HTTPBinding
+	missing  func(serviceName string) bool
+	mu       sync.RWMutex
+}
+
+// NewStore creates an empty descriptor store
+func NewStore() *Store {
+	return &Store{
+		sources: make(map[string]*descriptorpb.FileDescriptorSet),
+		files:   new(protoregistry.Files),
+	}
+}
+
+// Update replaces the descriptors registered under source and rebuilds the registry
+func (s *Store) Update(source string, set *descriptorpb.FileDescriptorSet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sources := make(map[string]*descriptorpb.FileDescriptorSet, len(s.sources)+1)
+	for name, existing := range s.sources {
+		sources[name] = existing
+	}
+	sources[source] = set
+
+	files, err := buildFiles(sources)
+	if err != nil {
+		return fmt.Errorf("failed to register descriptors from %s: %w", source, err)
+	}
+
+	s.sources = sources
+	s.files = files
+	s.bindings = httpBindings(files)
+	return nil
+}
+
+// source returns the descriptors registered under source
+func (s *Store) source(source string) *descriptorpb.FileDescriptorSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.sources[source]
+}
+
+// OnMissing sets a function called when a method is not found, which
+// reports whether the service's descriptors may have been updated since
+func (s *Store) OnMissing(missing func(serviceName string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.missing = missing
+}
+
+// FindMethod resolves a method descriptor by fully-qualified service and
+// method name, looking again once the missing function has updated the
+// service's descriptors
+func (s *Store) FindMethod(serviceName, methodName string) (protoreflect.MethodDescriptor, bool) {
+	s.mu.RLock()
+	files, missing := s.files, s.missing
+	s.mu.RUnlock()
+
+	if method, ok := findMethod(files, serviceName, methodName); ok || missing == nil || !missing(serviceName) {
+		return method, ok
+	}
+	s.mu.RLock()
+	files = s.files
+	s.mu.RUnlock()
+	return findMethod(files, serviceName, methodName)
+}
+
+func findMethod(files *protoregistry.Files, serviceName, methodName string) (protoreflect.MethodDescriptor, bool) {
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil, false
+	}
+	svc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, false
+	}
+	method := svc.Methods().ByName(protoreflect.Name(methodName))
+	return method, method != nil
+}
+
+// Services returns the names of all registered services
+func (s *Store) Services() []string {
+	s.mu.RLock()
+	files := s.files
+	s.mu.RUnlock()
+
+	var services []string
+	files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		for i := 0; i < fd.Services().Len(); i++ {
+			services = append(services, string(fd.Services().Get(i).FullName()))
+		}
+		return true
+	})
+	return services
+}
+
+// Methods returns the method names of a registered service
+func (s *Store) Methods(serviceName string) []string {
+	s.mu.RLock()
+	files := s.files
+	s.mu.RUnlock()
+
+	desc, err := files.FindDescriptorByName(protoreflect.FullName(serviceName))
+	if err != nil {
+		return nil
+	}
+	svc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil
+	}
+	methods := make([]string, svc.Methods().Len())
+	for i := range methods {
+		methods[i] = string(svc.Methods().Get(i).Name())
+	}
+	return methods
+}
+
+// buildFiles merges descriptor sets into a single registry, skipping duplicate files
+func buildFiles(sources map[string]*descriptorpb.FileDescriptorSet) (*protoregistry.Files, error) {
+	merged := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	for _, set := range sources {
+		for _, file := range set.GetFile() {
+			if seen[file.GetName()] {
+				continue
+			}
+			seen[file.GetName()] = true
+			merged.File = append(merged.File, file)
+		}
+	}
+	return protodesc.NewFiles(merged)
+}
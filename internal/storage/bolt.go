@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("gateway")
+
+// boltSweepInterval is how often expired keys are deleted from the file
+const boltSweepInterval = time.Minute
+
+// BoltStore is a file-backed Store for single-node deployments that survive
+// restarts. Expired keys are deleted in the background.
+type BoltStore struct {
+	db   *bolt.DB
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBoltStore opens (or creates) the bolt database at path
+func NewBoltStore(path string) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create bolt bucket: %w", err)
+	}
+
+	s := &BoltStore{db: db, stop: make(chan struct{}), done: make(chan struct{})}
+	go s.sweepExpired()
+	return s, nil
+}
+
+func (s *BoltStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v, ok := decodeBoltValue(tx.Bucket(boltBucket).Get([]byte(key)), time.Now())
+		if !ok {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+func (s *BoltStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Put([]byte(key), encodeBoltValue(value, expiry(ttl)))
+	})
+}
+
+func (s *BoltStore) Delete(ctx context.Context, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	var current int64
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		raw := bucket.Get([]byte(key))
+
+		expiresAt := expiry(ttl)
+		if v, ok := decodeBoltValue(raw, time.Now()); ok {
+			parsed, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				return err
+			}
+			current = parsed
+			expiresAt = boltExpiry(raw)
+		}
+
+		current += delta
+		return bucket.Put([]byte(key), encodeBoltValue([]byte(strconv.FormatInt(current, 10)), expiresAt))
+	})
+	return current, err
+}
+
+func (s *BoltStore) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	now := time.Now()
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(boltBucket).Cursor()
+		for k, raw := c.Seek([]byte(prefix)); k != nil && strings.HasPrefix(string(k), prefix); k, raw = c.Next() {
+			if v, ok := decodeBoltValue(raw, now); ok {
+				result[string(k)] = append([]byte(nil), v...)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (s *BoltStore) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.db.Close()
+}
+
+// sweepExpired deletes expired keys every boltSweepInterval until the store
+// is closed
+func (s *BoltStore) sweepExpired() {
+	defer close(s.done)
+	ticker := time.NewTicker(boltSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.sweep(time.Now()); err != nil {
+				log.Printf("Failed to delete expired keys from bolt store: %v", err)
+			}
+		}
+	}
+}
+
+// sweep deletes the keys expired at now
+func (s *BoltStore) sweep(now time.Time) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltBucket)
+		var expired [][]byte
+		err := bucket.ForEach(func(k, raw []byte) error {
+			if _, ok := decodeBoltValue(raw, now); !ok {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range expired {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// encodeBoltValue prefixes value with its expiry in unix nanoseconds (0 for none)
+func encodeBoltValue(value []byte, expiresAt time.Time) []byte {
+	buf := make([]byte, 8+len(value))
+	if !expiresAt.IsZero() {
+		binary.BigEndian.PutUint64(buf, uint64(expiresAt.UnixNano()))
+	}
+	copy(buf[8:], value)
+	return buf
+}
+
+// decodeBoltValue returns the value if present and not expired
+func decodeBoltValue(raw []byte, now time.Time) ([]byte, bool) {
+	if len(raw) < 8 {
+		return nil, false
+	}
+	if expiresAt := boltExpiry(raw); !expiresAt.IsZero() && now.After(expiresAt) {
+		return nil, false
+	}
+	return raw[8:], true
+}
+
+func boltExpiry(raw []byte) time.Time {
+	nanos := binary.BigEndian.Uint64(raw[:8])
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(nanos))
+}
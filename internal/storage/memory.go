@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process Store for single-node deployments
+type MemoryStore struct {
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries:   make(map[string]memoryEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.lookup(key, time.Now())
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), entry.value...), nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[key] = memoryEntry{value: append([]byte(nil), value...), expiresAt: expiry(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *MemoryStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.lookup(key, now)
+	if !ok {
+		entry = memoryEntry{expiresAt: expiry(ttl)}
+	}
+
+	var current int64
+	if len(entry.value) > 0 {
+		parsed, err := strconv.ParseInt(string(entry.value), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		current = parsed
+	}
+
+	current += delta
+	entry.value = []byte(strconv.FormatInt(current, 10))
+	s.entries[key] = entry
+	return current, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	result := make(map[string][]byte)
+	for key, entry := range s.entries {
+		if strings.HasPrefix(key, prefix) && !entry.expired(now) {
+			result[key] = append([]byte(nil), entry.value...)
+		}
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// lookup returns a live entry, sweeping expired entries at most once a minute
+func (s *MemoryStore) lookup(key string, now time.Time) (memoryEntry, bool) {
+	if now.Sub(s.lastSweep) > time.Minute {
+		for k, e := range s.entries {
+			if e.expired(now) {
+				delete(s.entries, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	entry, ok := s.entries[key]
+	if !ok || entry.expired(now) {
+		return memoryEntry{}, false
+	}
+	return entry, true
+}
+
+// expiry converts a ttl to an absolute expiry time
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
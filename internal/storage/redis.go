@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"dynamic-gateway/internal/config"
+)
+
+// incrByScript increments a key and sets its expiry only when it is created
+var incrByScript = redis.NewScript(`
+local value = redis.call("INCRBY", KEYS[1], ARGV[1])
+if value == tonumber(ARGV[1]) and tonumber(ARGV[2]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// RedisStore is a Store shared by all gateway replicas for HA deployments
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore creates a Redis-backed store
+func NewRedisStore(cfg *config.Storage) *RedisStore {
+	return &RedisStore{
+		client: redis.NewClient(&redis.Options{
+			Addr:     cfg.Address,
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		}),
+		prefix: cfg.Prefix,
+	}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.prefix+key).Err()
+}
+
+func (s *RedisStore) IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error) {
+	return incrByScript.Run(ctx, s.client, []string{s.prefix + key}, delta, ttl.Milliseconds()).Int64()
+}
+
+func (s *RedisStore) List(ctx context.Context, prefix string) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	iter := s.client.Scan(ctx, 0, s.prefix+prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		value, err := s.client.Get(ctx, iter.Val()).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result[iter.Val()[len(s.prefix):]] = value
+	}
+	return result, iter.Err()
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
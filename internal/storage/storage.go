@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// ErrNotFound is returned when a key does not exist or has expired
+var ErrNotFound = errors.New("key not found")
+
+// Store is the persistence layer shared by all stateful gateway features
+type Store interface {
+	// Get returns the value stored at key
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value at key; a zero ttl never expires
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes key
+	Delete(ctx context.Context, key string) error
+	// IncrBy atomically adds delta to the integer at key, applying ttl when the key is created
+	IncrBy(ctx context.Context, key string, delta int64, ttl time.Duration) (int64, error)
+	// List returns all live keys and values with the given prefix
+	List(ctx context.Context, prefix string) (map[string][]byte, error)
+	// Close releases resources held by the store
+	Close() error
+}
+
+// New creates the store selected by configuration, defaulting to memory
+func New(cfg *config.Storage) (Store, error) {
+	if cfg == nil {
+		return NewMemoryStore(), nil
+	}
+
+	switch cfg.Type {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "bolt":
+		return NewBoltStore(cfg.Path)
+	case "redis":
+		return NewRedisStore(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown storage type %q", cfg.Type)
+	}
+}
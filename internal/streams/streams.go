@@ -0,0 +1,153 @@
+// Package streams counts the long-lived streams open per route and the
+// goroutines relaying them, and caps the streams a route and each of its
+// clients may hold open, so a client opening thousands of streams cannot
+// exhaust the process or starve other clients of the route.
+package streams
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Set counts the streams of routes or services by name
+type Set struct {
+	mu       sync.Mutex
+	counters map[string]*counter
+}
+
+type counter struct {
+	streams    atomic.Int64
+	goroutines atomic.Int64
+	rejected   atomic.Uint64
+	limit      atomic.Int64 // the limit last applied
+
+	mu      sync.Mutex
+	clients map[string]int // open streams of clients that have any
+}
+
+// Stats are the counts of a name's streams
+type Stats struct {
+	Name       string `json:"name"`
+	Streams    int64  `json:"streams"`
+	Goroutines int64  `json:"goroutines"` // serving and relaying the streams
+	Limit      int    `json:"limit"`      // 0 for unlimited
+	Rejected   uint64 `json:"rejected"`   // streams refused over the limit
+}
+
+// NewSet creates an empty set
+func NewSet() *Set {
+	return &Set{counters: make(map[string]*counter)}
+}
+
+func (s *Set) counter(name string) *counter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counters[name]
+	if c == nil {
+		c = &counter{clients: make(map[string]int)}
+		s.counters[name] = c
+	}
+	return c
+}
+
+// Open admits a stream of client on name unless limit streams are already
+// open on name, or clientLimit of client's; 0 for unlimited. The goroutine
+// serving the stream counts against it until the stream is closed.
+func (s *Set) Open(name, client string, limit, clientLimit int) (*Stream, bool) {
+	c := s.counter(name)
+	c.limit.Store(int64(limit))
+	if !c.openClient(client, clientLimit) {
+		c.rejected.Add(1)
+		return nil, false
+	}
+	if n := c.streams.Add(1); limit > 0 && n > int64(limit) {
+		c.streams.Add(-1)
+		c.closeClient(client)
+		c.rejected.Add(1)
+		return nil, false
+	}
+	c.goroutines.Add(1)
+	return &Stream{counter: c, client: client}, true
+}
+
+// openClient counts a stream of client unless it has limit open already
+func (c *counter) openClient(client string, limit int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if limit > 0 && c.clients[client] >= limit {
+		return false
+	}
+	c.clients[client]++
+	return true
+}
+
+func (c *counter) closeClient(client string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.clients[client]--; c.clients[client] <= 0 {
+		delete(c.clients, client)
+	}
+}
+
+// Stats returns the counts of every name, sorted
+func (s *Set) Stats() []Stats {
+	s.mu.Lock()
+	names := make([]string, 0, len(s.counters))
+	for name := range s.counters {
+		names = append(names, name)
+	}
+	counters := make(map[string]*counter, len(s.counters))
+	for name, c := range s.counters {
+		counters[name] = c
+	}
+	s.mu.Unlock()
+
+	sort.Strings(names)
+	stats := make([]Stats, len(names))
+	for i, name := range names {
+		c := counters[name]
+		stats[i] = Stats{
+			Name:       name,
+			Streams:    c.streams.Load(),
+			Goroutines: c.goroutines.Load(),
+			Limit:      int(c.limit.Load()),
+			Rejected:   c.rejected.Load(),
+		}
+	}
+	return stats
+}
+
+// Stream is an open stream
+type Stream struct {
+	counter *counter
+	client  string
+	once    sync.Once
+}
+
+// Go runs fn in a goroutine counted against the stream's route. A nil
+// stream runs it uncounted.
+func (st *Stream) Go(fn func()) {
+	if st == nil {
+		go fn()
+		return
+	}
+	st.counter.goroutines.Add(1)
+	go func() {
+		defer st.counter.goroutines.Add(-1)
+		fn()
+	}()
+}
+
+// Close releases the stream's place; goroutines it started are counted until
+// they return
+func (st *Stream) Close() {
+	if st == nil {
+		return
+	}
+	st.once.Do(func() {
+		st.counter.streams.Add(-1)
+		st.counter.goroutines.Add(-1)
+		st.counter.closeClient(st.client)
+	})
+}
@@ -0,0 +1,86 @@
+package streams
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name        string
+		limit       int
+		clientLimit int
+		clients     []string // opening a stream each, in order
+		want        []bool
+	}{
+		{name: "unlimited", clients: []string{"a", "a", "b"}, want: []bool{true, true, true}},
+		{name: "route limit", limit: 2, clients: []string{"a", "b", "c"}, want: []bool{true, true, false}},
+		{
+			name:        "client limit",
+			clientLimit: 2,
+			clients:     []string{"a", "a", "a", "b"},
+			want:        []bool{true, true, false, true},
+		},
+		{
+			name:        "refused by the route leaves the client's count",
+			limit:       2,
+			clientLimit: 2,
+			clients:     []string{"a", "b", "a", "b"},
+			want:        []bool{true, true, false, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSet()
+			var open []*Stream
+			rejected := 0
+			for i, client := range tt.clients {
+				st, ok := s.Open("route", client, tt.limit, tt.clientLimit)
+				if ok != tt.want[i] {
+					t.Fatalf("stream %d of %s admitted %v, want %v", i, client, ok, tt.want[i])
+				}
+				if ok {
+					open = append(open, st)
+				} else {
+					rejected++
+				}
+			}
+			stats := s.Stats()[0]
+			if stats.Streams != int64(len(open)) || stats.Goroutines != int64(len(open)) || stats.Rejected != uint64(rejected) {
+				t.Errorf("stats = %+v, want %d streams and %d rejected", stats, len(open), rejected)
+			}
+
+			for _, st := range open {
+				st.Close()
+				st.Close()
+			}
+			if stats := s.Stats()[0]; stats.Streams != 0 || stats.Goroutines != 0 {
+				t.Errorf("stats after closing = %+v, want none open", stats)
+			}
+			if n := len(s.counter("route").clients); n != 0 {
+				t.Errorf("%d clients remembered after closing", n)
+			}
+		})
+	}
+}
+
+func TestStreamGo(t *testing.T) {
+	s := NewSet()
+	st, _ := s.Open("route", "a", 0, 0)
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	st.Go(func() {
+		defer wg.Done()
+		<-release
+	})
+	if got := s.Stats()[0].Goroutines; got != 2 {
+		t.Errorf("goroutines = %d, want 2", got)
+	}
+	st.Close()
+	if got := s.Stats()[0].Goroutines; got != 1 {
+		t.Errorf("goroutines after Close = %d, want the relay still running", got)
+	}
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,289 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dynamic-gateway/internal/buildinfo"
+	"dynamic-gateway/internal/config"
+)
+
+// queueSize bounds the spans waiting for export; requests never wait for the
+// collector, so spans beyond it are dropped
+const queueSize = 4096
+
+// exporter batches ended spans and posts them to a collector's OTLP/HTTP
+// traces endpoint in the JSON encoding
+type exporter struct {
+	url       string
+	headers   map[string]string
+	client    *http.Client
+	resource  []keyValue
+	batchSize int
+	interval  time.Duration
+
+	spans   chan endedSpan
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+	lastErr string
+}
+
+type endedSpan struct {
+	span *Span
+	end  time.Time
+}
+
+func newExporter(cfg *config.Tracing) (*exporter, error) {
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing timeout %q", cfg.Timeout)
+	}
+	interval, err := time.ParseDuration(cfg.FlushInterval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tracing flush interval %q", cfg.FlushInterval)
+	}
+
+	url := strings.TrimSuffix(cfg.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	resource := []keyValue{stringValue("service.name", cfg.ServiceName), stringValue("service.version", buildinfo.Get().Version)}
+	keys := make([]string, 0, len(cfg.Attributes))
+	for key := range cfg.Attributes {
+		if key != "service.name" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		resource = append(resource, stringValue(key, cfg.Attributes[key]))
+	}
+
+	e := &exporter{
+		url:       url,
+		headers:   cfg.Headers,
+		client:    &http.Client{Timeout: timeout},
+		resource:  resource,
+		batchSize: cfg.BatchSize,
+		interval:  interval,
+		spans:     make(chan endedSpan, queueSize),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// enqueue queues an ended span, dropping it when the queue is full or the
+// exporter closed
+func (e *exporter) enqueue(s *Span, end time.Time) {
+	select {
+	case <-e.stop:
+		return
+	default:
+	}
+	select {
+	case e.spans <- endedSpan{s, end}:
+	default:
+		if e.dropped.Add(1) == 1 {
+			log.Printf("Dropping spans: the export queue to %s is full", e.url)
+		}
+	}
+}
+
+// close exports the queued spans and stops the exporter
+func (e *exporter) close() error {
+	e.once.Do(func() { close(e.stop) })
+	<-e.done
+	return nil
+}
+
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]endedSpan, 0, e.batchSize)
+	flush := func() {
+		if len(batch) > 0 {
+			e.export(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case s := <-e.spans:
+			if batch = append(batch, s); len(batch) >= e.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case s := <-e.spans:
+					if batch = append(batch, s); len(batch) >= e.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// export posts a batch of spans; failures are logged once until exports
+// succeed again
+func (e *exporter) export(batch []endedSpan) {
+	spans := make([]otlpSpan, len(batch))
+	for i, s := range batch {
+		spans[i] = encodeSpan(s.span, s.end)
+	}
+	body, err := json.Marshal(otlpRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: e.resource},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: "dynamic-gateway", Version: buildinfo.Get().Version}, Spans: spans}},
+	}}})
+	if err != nil {
+		log.Printf("Failed to encode spans: %v", err)
+		return
+	}
+
+	err = e.post(body)
+	if err == nil {
+		if e.lastErr != "" {
+			log.Printf("Exporting spans to %s again", e.url)
+		}
+		e.lastErr = ""
+		e.dropped.Store(0)
+		return
+	}
+	if err.Error() != e.lastErr {
+		log.Printf("Failed to export %d spans to %s: %v", len(batch), e.url, err)
+	}
+	e.lastErr = err.Error()
+}
+
+func (e *exporter) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON encoding of ExportTraceServiceRequest
+type otlpRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              Kind       `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	Status            spanStatus `json:"status"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code,omitempty"` // 2 for errors, unset otherwise
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"` // int64 values are strings in JSON
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+func stringValue(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+func encodeSpan(s *Span, end time.Time) otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+	}
+	if s.parent != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, a := range s.attributes {
+		kv := keyValue{Key: a.key}
+		switch v := a.value.(type) {
+		case string:
+			kv.Value.StringValue = &v
+		case int64:
+			text := strconv.FormatInt(v, 10)
+			kv.Value.IntValue = &text
+		case bool:
+			kv.Value.BoolValue = &v
+		}
+		span.Attributes = append(span.Attributes, kv)
+	}
+	if s.failed {
+		span.Status = spanStatus{Code: 2, Message: s.message}
+	}
+	return span
+}
@@ -0,0 +1,203 @@
+// Package tracing records OpenTelemetry spans of the requests the gateway
+// serves and exports them to a collector over OTLP/HTTP. Trace context is
+// carried in W3C traceparent headers, and in gRPC metadata of the same name.
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Header is the W3C trace context header, also used as gRPC metadata key
+const Header = "traceparent"
+
+// SpanContext identifies a span across process boundaries
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Parse decodes a traceparent header; it reports false for headers that
+// are absent or malformed, or carry all-zero IDs
+func Parse(traceparent string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return sc, false
+	}
+	// Version 00 has exactly four fields; later versions may append more
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.valid()
+}
+
+// Traceparent encodes the span context as a version 00 traceparent header
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+func (sc SpanContext) valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Root returns the context of a new trace started by the gateway, sampled for
+// a fraction rate of traces
+func Root(rate float64) SpanContext {
+	var sc SpanContext
+	rand.Read(sc.TraceID[:])
+	rand.Read(sc.SpanID[:])
+	sc.Sampled = rate >= 1 || mathrand.Float64() < rate
+	return sc
+}
+
+// Kind is the role of a span in a request, as numbered by OTLP
+type Kind int
+
+const (
+	KindServer Kind = 2
+	KindClient Kind = 3
+)
+
+// Tracer starts spans and exports those sampled
+type Tracer struct {
+	exporter *exporter
+}
+
+// New creates a tracer exporting to the configured collector
+func New(cfg *config.Tracing) (*Tracer, error) {
+	exporter, err := newExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Tracer{exporter: exporter}, nil
+}
+
+// Close exports the spans still queued
+func (t *Tracer) Close() error {
+	if t == nil {
+		return nil
+	}
+	return t.exporter.close()
+}
+
+// Start begins a span continuing parent, or a new trace sampled for a
+// fraction rate of traces when parent is not valid. Spans of unsampled
+// traces are not recorded, and a nil tracer records none.
+func (t *Tracer) Start(name string, kind Kind, parent SpanContext, rate float64) *Span {
+	if t == nil {
+		return nil
+	}
+	s := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent.valid() {
+		s.context = parent
+		s.parent = parent.SpanID
+		rand.Read(s.context.SpanID[:])
+	} else {
+		s.context = Root(rate)
+	}
+	return s
+}
+
+// Span is an operation within a trace
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  [8]byte
+	name    string
+	kind    Kind
+	start   time.Time
+
+	mu         sync.Mutex
+	attributes []attribute
+	failed     bool
+	message    string
+	ended      bool
+}
+
+type attribute struct {
+	key   string
+	value any // string, int64 or bool
+}
+
+// Context returns the span's context, for propagation to backends; the nil
+// span has the zero context
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// Recording reports whether the span will be exported
+func (s *Span) Recording() bool {
+	return s != nil && s.context.Sampled
+}
+
+// SetAttribute annotates the span; values are strings, ints, int64s or bools
+func (s *Span) SetAttribute(key string, value any) {
+	if !s.Recording() {
+		return
+	}
+	switch v := value.(type) {
+	case int:
+		value = int64(v)
+	case string, int64, bool:
+	default:
+		value = fmt.Sprint(v)
+	}
+	s.mu.Lock()
+	s.attributes = append(s.attributes, attribute{key, value})
+	s.mu.Unlock()
+}
+
+// SetError marks the span failed
+func (s *Span) SetError(message string) {
+	if !s.Recording() {
+		return
+	}
+	s.mu.Lock()
+	s.failed, s.message = true, message
+	s.mu.Unlock()
+}
+
+// End completes the span and queues it for export; later calls do nothing
+func (s *Span) End() {
+	if !s.Recording() {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.mu.Unlock()
+	s.tracer.exporter.enqueue(s, time.Now())
+}
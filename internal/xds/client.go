@@ -0,0 +1,173 @@
+package xds
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"sort"
+	"time"
+
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"dynamic-gateway/internal/config"
+)
+
+// Resource type URLs of the xDS subset the gateway consumes
+const (
+	routeType    = "type.googleapis.com/envoy.config.route.v3.RouteConfiguration"
+	clusterType  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	endpointType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+)
+
+// UpdateFunc receives the complete route table whenever the control plane changes it
+type UpdateFunc func(routes []config.HTTPRoute)
+
+// Client subscribes to route, cluster and endpoint resources over ADS
+type Client struct {
+	cfg      *config.XDS
+	node     *corev3.Node
+	onUpdate UpdateFunc
+}
+
+// NewClient creates an xDS client identifying itself as nodeID
+func NewClient(cfg *config.XDS, nodeID string, onUpdate UpdateFunc) *Client {
+	if cfg.NodeID != "" {
+		nodeID = cfg.NodeID
+	}
+	return &Client{
+		cfg:      cfg,
+		node:     &corev3.Node{Id: nodeID, Cluster: cfg.Cluster, UserAgentName: "dynamic-gateway"},
+		onUpdate: onUpdate,
+	}
+}
+
+// Run keeps an ADS stream open until ctx is cancelled, reconnecting with backoff
+func (c *Client) Run(ctx context.Context) {
+	backoff := time.Second
+	for {
+		err := c.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("xDS stream to %s failed: %v", c.cfg.Server, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// stream runs a single ADS session
+func (c *Client) stream(ctx context.Context) error {
+	creds := insecure.NewCredentials()
+	if c.cfg.TLS {
+		creds = credentials.NewTLS(&tls.Config{})
+	}
+	conn, err := grpc.NewClient(c.cfg.Server, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := discoveryv3.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(ctx)
+	if err != nil {
+		return err
+	}
+
+	state := newState()
+	subscribed := map[string][]string{routeType: c.cfg.RouteConfigs}
+	if err := c.send(stream, routeType, c.cfg.RouteConfigs, "", "", nil); err != nil {
+		return err
+	}
+
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+
+		// Apply the response, NACKing resources that fail to decode
+		var detail *status.Status
+		if err := state.apply(resp); err != nil {
+			log.Printf("Rejecting xDS %s version %s: %v", resp.GetTypeUrl(), resp.GetVersionInfo(), err)
+			detail = &status.Status{Code: 3, Message: err.Error()}
+		}
+		version := resp.GetVersionInfo()
+		if detail != nil {
+			version = state.versions[resp.GetTypeUrl()]
+		} else {
+			state.versions[resp.GetTypeUrl()] = version
+		}
+		if err := c.send(stream, resp.GetTypeUrl(), subscribed[resp.GetTypeUrl()], version, resp.GetNonce(), detail); err != nil {
+			return err
+		}
+
+		// Follow references from routes to clusters to endpoints
+		for _, next := range []struct {
+			typeURL string
+			names   []string
+		}{
+			{clusterType, state.clusterNames()},
+			{endpointType, state.endpointNames()},
+		} {
+			if !equal(subscribed[next.typeURL], next.names) {
+				subscribed[next.typeURL] = next.names
+				if err := c.send(stream, next.typeURL, next.names, state.versions[next.typeURL], "", nil); err != nil {
+					return err
+				}
+			}
+		}
+
+		if routes, ok := state.routes(); ok {
+			c.onUpdate(routes)
+		}
+	}
+}
+
+// send writes a discovery request, which also serves as ACK or NACK
+func (c *Client) send(stream discoveryv3.AggregatedDiscoveryService_StreamAggregatedResourcesClient, typeURL string, names []string, version, nonce string, detail *status.Status) error {
+	return stream.Send(&discoveryv3.DiscoveryRequest{
+		Node:          c.node,
+		TypeUrl:       typeURL,
+		ResourceNames: names,
+		VersionInfo:   version,
+		ResponseNonce: nonce,
+		ErrorDetail:   detail,
+	})
+}
+
+// equal reports whether two sorted name lists match
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedKeys returns the keys of a set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
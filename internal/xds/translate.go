@@ -0,0 +1,295 @@
+package xds
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+
+	clusterv3 "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corev3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointv3 "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	routev3 "github.com/envoyproxy/go-control-plane/envoy/config/route/v3"
+	discoveryv3 "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+
+	"dynamic-gateway/internal/config"
+)
+
+// state holds the latest resources received from the control plane
+type state struct {
+	routeConfigs map[string]*routev3.RouteConfiguration
+	clusters     map[string]*clusterv3.Cluster
+	endpoints    map[string]*endpointv3.ClusterLoadAssignment
+	versions     map[string]string
+}
+
+func newState() *state {
+	return &state{
+		routeConfigs: make(map[string]*routev3.RouteConfiguration),
+		clusters:     make(map[string]*clusterv3.Cluster),
+		endpoints:    make(map[string]*endpointv3.ClusterLoadAssignment),
+		versions:     make(map[string]string),
+	}
+}
+
+// apply decodes a discovery response into the state. Cluster responses carry
+// the full set; route and endpoint responses update the named resources.
+func (s *state) apply(resp *discoveryv3.DiscoveryResponse) error {
+	switch resp.GetTypeUrl() {
+	case routeType:
+		decoded := make(map[string]*routev3.RouteConfiguration)
+		for _, res := range resp.GetResources() {
+			rc := &routev3.RouteConfiguration{}
+			if err := res.UnmarshalTo(rc); err != nil {
+				return fmt.Errorf("failed to decode route configuration: %w", err)
+			}
+			decoded[rc.GetName()] = rc
+		}
+		for name, rc := range decoded {
+			s.routeConfigs[name] = rc
+		}
+	case clusterType:
+		decoded := make(map[string]*clusterv3.Cluster)
+		for _, res := range resp.GetResources() {
+			c := &clusterv3.Cluster{}
+			if err := res.UnmarshalTo(c); err != nil {
+				return fmt.Errorf("failed to decode cluster: %w", err)
+			}
+			decoded[c.GetName()] = c
+		}
+		s.clusters = decoded
+	case endpointType:
+		decoded := make(map[string]*endpointv3.ClusterLoadAssignment)
+		for _, res := range resp.GetResources() {
+			cla := &endpointv3.ClusterLoadAssignment{}
+			if err := res.UnmarshalTo(cla); err != nil {
+				return fmt.Errorf("failed to decode cluster load assignment: %w", err)
+			}
+			decoded[cla.GetClusterName()] = cla
+		}
+		for name, cla := range decoded {
+			s.endpoints[name] = cla
+		}
+	default:
+		return fmt.Errorf("unsupported resource type %s", resp.GetTypeUrl())
+	}
+	return nil
+}
+
+// clusterNames returns the clusters referenced by routes
+func (s *state) clusterNames() []string {
+	names := make(map[string]bool)
+	for _, rc := range s.routeConfigs {
+		for _, vh := range rc.GetVirtualHosts() {
+			for _, r := range vh.GetRoutes() {
+				for _, name := range routeClusters(r) {
+					names[name] = true
+				}
+			}
+		}
+	}
+	return sortedKeys(names)
+}
+
+// endpointNames returns the EDS service names of EDS clusters
+func (s *state) endpointNames() []string {
+	names := make(map[string]bool)
+	for _, c := range s.clusters {
+		if c.GetType() == clusterv3.Cluster_EDS {
+			names[edsName(c)] = true
+		}
+	}
+	return sortedKeys(names)
+}
+
+// routes translates the state into gateway routes; ok is false until every
+// referenced cluster and its endpoints have been received
+func (s *state) routes() ([]config.HTTPRoute, bool) {
+	if len(s.routeConfigs) == 0 {
+		return nil, false
+	}
+
+	var routes []config.HTTPRoute
+	for _, name := range sortedRouteConfigs(s.routeConfigs) {
+		// Virtual host domains are not matched; all routes share the listener
+		for _, vh := range s.routeConfigs[name].GetVirtualHosts() {
+			for _, r := range vh.GetRoutes() {
+				route, ok := translateRoute(r)
+				if !ok {
+					continue
+				}
+
+				// The first cluster with endpoints serves the route; further
+				// weighted clusters become pools sharing out its traffic
+				weights, total := clusterWeights(r)
+				for _, clusterName := range routeClusters(r) {
+					c, ok := s.clusters[clusterName]
+					if !ok {
+						return nil, false
+					}
+					assignment := c.GetLoadAssignment()
+					if c.GetType() == clusterv3.Cluster_EDS {
+						if assignment, ok = s.endpoints[edsName(c)]; !ok {
+							return nil, false
+						}
+					}
+					clusterBackends := backends(c, assignment, route.TargetProtocol == "grpc")
+					switch {
+					case len(clusterBackends) == 0:
+						log.Printf("Skipping xDS cluster %s of route %s: no healthy endpoints", clusterName, route.Path)
+					case len(route.Backends) == 0:
+						route.Backends = clusterBackends
+						route.LoadBalancing = loadBalancing(c, clusterBackends)
+					case total > 0:
+						if route.Pools == nil {
+							route.Pools = make(map[string][]config.Backend)
+							route.TrafficSplit = make(map[string]int)
+						}
+						route.Pools[clusterName] = clusterBackends
+						route.TrafficSplit[clusterName] = weights[clusterName] * 100 / total
+					}
+				}
+
+				if len(route.Backends) == 0 {
+					log.Printf("Skipping xDS route %s: no healthy endpoints", route.Path)
+					continue
+				}
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes, true
+}
+
+// translateRoute maps an Envoy route's match and action onto a gateway route
+func translateRoute(r *routev3.Route) (config.HTTPRoute, bool) {
+	var route config.HTTPRoute
+
+	match := r.GetMatch()
+	switch {
+	case match.GetPrefix() != "":
+		route.Path = match.GetPrefix()
+	case match.GetPath() != "":
+		route.Path = match.GetPath()
+	default:
+		log.Printf("Skipping xDS route %s: only prefix and path matches are supported", r.GetName())
+		return route, false
+	}
+	if match.GetGrpc() != nil {
+		route.TargetProtocol = "grpc"
+	}
+	for _, h := range match.GetHeaders() {
+		if h.GetName() == ":method" && h.GetStringMatch().GetExact() != "" {
+			route.Methods = append(route.Methods, h.GetStringMatch().GetExact())
+		}
+	}
+
+	action := r.GetRoute()
+	if action == nil {
+		log.Printf("Skipping xDS route %s: only forwarding routes are supported", r.GetName())
+		return route, false
+	}
+	if timeout := action.GetTimeout(); timeout != nil && timeout.AsDuration() > 0 {
+		route.Timeout = timeout.AsDuration().String()
+	}
+	return route, true
+}
+
+// routeClusters returns the clusters a route forwards to
+func routeClusters(r *routev3.Route) []string {
+	action := r.GetRoute()
+	if action == nil {
+		return nil
+	}
+	if name := action.GetCluster(); name != "" {
+		return []string{name}
+	}
+	var names []string
+	for _, wc := range action.GetWeightedClusters().GetClusters() {
+		names = append(names, wc.GetName())
+	}
+	return names
+}
+
+// clusterWeights returns the weights of a route's weighted clusters and their
+// total, which is 0 for routes to a single cluster
+func clusterWeights(r *routev3.Route) (map[string]int, int) {
+	clusters := r.GetRoute().GetWeightedClusters().GetClusters()
+	weights := make(map[string]int, len(clusters))
+	total := 0
+	for _, wc := range clusters {
+		weights[wc.GetName()] += int(wc.GetWeight().GetValue())
+		total += int(wc.GetWeight().GetValue())
+	}
+	return weights, total
+}
+
+// loadBalancing maps a cluster's load balancing policy onto the gateway's
+// nearest equivalent. Round robin honours endpoint weights, as in Envoy.
+func loadBalancing(c *clusterv3.Cluster, backends []config.Backend) string {
+	switch c.GetLbPolicy() {
+	case clusterv3.Cluster_LEAST_REQUEST:
+		return "p2c"
+	case clusterv3.Cluster_RING_HASH, clusterv3.Cluster_MAGLEV:
+		return "consistent_hash"
+	}
+	for _, b := range backends {
+		if b.Weight > 0 {
+			return "weighted_round_robin"
+		}
+	}
+	return ""
+}
+
+// backends converts healthy endpoints of a cluster into gateway backends
+func backends(c *clusterv3.Cluster, assignment *endpointv3.ClusterLoadAssignment, grpcTarget bool) []config.Backend {
+	useTLS := c.GetTransportSocket() != nil
+
+	var result []config.Backend
+	for _, locality := range assignment.GetEndpoints() {
+		for _, lb := range locality.GetLbEndpoints() {
+			switch lb.GetHealthStatus() {
+			case corev3.HealthStatus_UNKNOWN, corev3.HealthStatus_HEALTHY:
+			default:
+				continue
+			}
+
+			socket := lb.GetEndpoint().GetAddress().GetSocketAddress()
+			if socket == nil {
+				continue
+			}
+			address := net.JoinHostPort(socket.GetAddress(), strconv.Itoa(int(socket.GetPortValue())))
+
+			backend := config.Backend{
+				Address: address,
+				Weight:  int(lb.GetLoadBalancingWeight().GetValue()),
+				Region:  locality.GetLocality().GetRegion(),
+			}
+			if grpcTarget {
+				backend.TLS = useTLS
+			} else if useTLS {
+				backend.Address = "https://" + address
+			} else {
+				backend.Address = "http://" + address
+			}
+			result = append(result, backend)
+		}
+	}
+	return result
+}
+
+// edsName returns the EDS resource name of a cluster
+func edsName(c *clusterv3.Cluster) string {
+	if name := c.GetEdsClusterConfig().GetServiceName(); name != "" {
+		return name
+	}
+	return c.GetName()
+}
+
+func sortedRouteConfigs(configs map[string]*routev3.RouteConfiguration) []string {
+	names := make(map[string]bool, len(configs))
+	for name := range configs {
+		names[name] = true
+	}
+	return sortedKeys(names)
+}
@@ -0,0 +1,37 @@
+package gatewaytest
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// NewHTTPBackend starts a stub HTTP backend and returns its base URL
+func NewHTTPBackend(t testing.TB, handler http.Handler) string {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// NewGRPCBackend starts a stub gRPC backend and returns its address;
+// register is called to install the services under test
+func NewGRPCBackend(t testing.TB, register func(*grpc.Server)) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	server := grpc.NewServer()
+	register(server)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	return lis.Addr().String()
+}
@@ -0,0 +1,149 @@
+package gatewaytest
+
+import (
+	"dynamic-gateway/internal/config"
+)
+
+// Aliases so callers outside this module can build configurations
+type (
+	Config      = config.Config
+	HTTPRoute   = config.HTTPRoute
+	GRPCService = config.GRPCService
+	Backend     = config.Backend
+)
+
+// Aliases of the policies routes and services are configured with
+type (
+	AuthPassthrough    = config.AuthPassthrough
+	CallCredentials    = config.CallCredentials
+	CallPolicy         = config.CallPolicy
+	Decompression      = config.Decompression
+	Deprecation        = config.Deprecation
+	ExportColumn       = config.ExportColumn
+	GRPCDialOptions    = config.GRPCDialOptions
+	HeaderLimits       = config.HeaderLimits
+	JWTAuth            = config.JWTAuth
+	Maintenance        = config.Maintenance
+	Middleware         = config.Middleware
+	Mirror             = config.Mirror
+	Mock               = config.Mock
+	MockLatency        = config.MockLatency
+	MockMatch          = config.MockMatch
+	MockResponse       = config.MockResponse
+	RateLimit          = config.RateLimit
+	RedirectPolicy     = config.RedirectPolicy
+	RetryPolicy        = config.RetryPolicy
+	RouteDocs          = config.RouteDocs
+	RouteSchedule      = config.RouteSchedule
+	RouteVersion       = config.RouteVersion
+	SLO                = config.SLO
+	Sampling           = config.Sampling
+	StreamExport       = config.StreamExport
+	StreamPagination   = config.StreamPagination
+	TokenIntrospection = config.TokenIntrospection
+)
+
+// Aliases of the gateway-wide settings of a Config
+type (
+	APIKeys          = config.APIKeys
+	APIVersioning    = config.APIVersioning
+	AccessLog        = config.AccessLog
+	Admin            = config.Admin
+	AdminHistory     = config.AdminHistory
+	AdminOIDC        = config.AdminOIDC
+	AdminTLS         = config.AdminTLS
+	AdminToken       = config.AdminToken
+	Catalog          = config.Catalog
+	CircuitBreaker   = config.CircuitBreaker
+	Cluster          = config.Cluster
+	ConfigCanary     = config.ConfigCanary
+	CostBudget       = config.CostBudget
+	DNS              = config.DNS
+	DataResidency    = config.DataResidency
+	DefaultBackend   = config.DefaultBackend
+	Docker           = config.Docker
+	ErrorReporting   = config.ErrorReporting
+	Federation       = config.Federation
+	FlowControl      = config.FlowControl
+	FlowWindows      = config.FlowWindows
+	GatewayAPI       = config.GatewayAPI
+	Journal          = config.Journal
+	OutlierDetection = config.OutlierDetection
+	ProbeCheck       = config.ProbeCheck
+	Probes           = config.Probes
+	Redaction        = config.Redaction
+	SchemaModule     = config.SchemaModule
+	SchemaRegistry   = config.SchemaRegistry
+	ServerTLS        = config.ServerTLS
+	Storage          = config.Storage
+	Tenancy          = config.Tenancy
+	Tenant           = config.Tenant
+	Tracing          = config.Tracing
+	WarmState        = config.WarmState
+	XDS              = config.XDS
+)
+
+// ConfigBuilder builds gateway configurations programmatically
+type ConfigBuilder struct {
+	cfg config.Config
+}
+
+// NewConfig creates a builder for an empty configuration with both servers enabled
+func NewConfig() *ConfigBuilder {
+	return &ConfigBuilder{cfg: config.Config{
+		// Ports satisfy validation; the test listeners use random ports
+		Host:          "127.0.0.1",
+		HTTPPort:      8080,
+		TLSPort:       9090,
+		RunHTTPServer: true,
+		RunTLSServer:  true,
+	}}
+}
+
+// HTTPRoute adds an HTTP route proxied to the given backend addresses
+func (b *ConfigBuilder) HTTPRoute(path string, backends ...string) *ConfigBuilder {
+	return b.Route(config.HTTPRoute{Path: path, Backends: toBackends(backends)})
+}
+
+// GRPCRoute adds an HTTP route transcoded to gRPC backends
+func (b *ConfigBuilder) GRPCRoute(path string, backends ...string) *ConfigBuilder {
+	return b.Route(config.HTTPRoute{Path: path, TargetProtocol: "grpc", Backends: toBackends(backends)})
+}
+
+// Route adds a fully specified HTTP route
+func (b *ConfigBuilder) Route(route config.HTTPRoute) *ConfigBuilder {
+	b.cfg.HTTPRoutes = append(b.cfg.HTTPRoutes, route)
+	return b
+}
+
+// GRPCService adds a gRPC service proxied to gRPC backends
+func (b *ConfigBuilder) GRPCService(name string, backends ...string) *ConfigBuilder {
+	return b.Service(config.GRPCService{ServiceName: name, IsGRPC: true, Backends: toBackends(backends)})
+}
+
+// Service adds a fully specified gRPC service
+func (b *ConfigBuilder) Service(svc config.GRPCService) *ConfigBuilder {
+	b.cfg.GRPCServices = append(b.cfg.GRPCServices, svc)
+	return b
+}
+
+// Modify applies an arbitrary change to the configuration
+func (b *ConfigBuilder) Modify(fn func(*config.Config)) *ConfigBuilder {
+	fn(&b.cfg)
+	return b
+}
+
+// Build returns the configuration with defaults applied
+func (b *ConfigBuilder) Build() *config.Config {
+	cfg := b.cfg
+	cfg.SetDefaults()
+	return &cfg
+}
+
+func toBackends(addresses []string) []config.Backend {
+	backends := make([]config.Backend, len(addresses))
+	for i, addr := range addresses {
+		backends[i] = config.Backend{Address: addr}
+	}
+	return backends
+}
@@ -0,0 +1,160 @@
+// Package gatewaytest runs the gateway in-process for integration tests.
+package gatewaytest
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"dynamic-gateway/internal/apikey"
+	"dynamic-gateway/internal/breaker"
+	"dynamic-gateway/internal/catalog"
+	"dynamic-gateway/internal/config"
+	"dynamic-gateway/internal/journal"
+	"dynamic-gateway/internal/middleware"
+	"dynamic-gateway/internal/pool"
+	"dynamic-gateway/internal/router"
+	"dynamic-gateway/internal/schema"
+	"dynamic-gateway/internal/storage"
+	"dynamic-gateway/internal/tracing"
+)
+
+// Gateway is a running in-process gateway
+type Gateway struct {
+	// URL is the base URL of the HTTP listener
+	URL string
+	// GRPCAddr is the address of the gRPC listener
+	GRPCAddr string
+
+	httpServer *httptest.Server
+	grpcServer *grpc.Server
+	pool       *pool.ConnectionPool
+	store      storage.Store
+	handlers   []interface{ Close() }
+}
+
+// Option customizes a test gateway
+type Option func(*options)
+
+type options struct {
+	descriptors []*descriptorpb.FileDescriptorSet
+}
+
+// WithDescriptors registers proto descriptors used for typed transcoding
+func WithDescriptors(set *descriptorpb.FileDescriptorSet) Option {
+	return func(o *options) {
+		o.descriptors = append(o.descriptors, set)
+	}
+}
+
+// Start runs the gateway for cfg and stops it when the test finishes
+func Start(t testing.TB, cfg *config.Config, opts ...Option) *Gateway {
+	t.Helper()
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	descriptors := schema.NewStore()
+	for i, set := range o.descriptors {
+		if err := descriptors.Update(fmt.Sprintf("gatewaytest/%d", i), set); err != nil {
+			t.Fatalf("failed to register descriptors: %v", err)
+		}
+	}
+	if err := router.Validate(cfg, descriptors); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &Gateway{
+		pool:  pool.NewConnectionPool(cfg.MaxCallRecvMsgSize),
+		store: storage.NewMemoryStore(),
+	}
+
+	// The handlers are built the way the gateway builds them, with the
+	// configured middleware pipeline, API keys, journal and tracer
+	deps := router.Deps{
+		Pool:        g.pool,
+		Descriptors: descriptors,
+		Store:       g.store,
+		Breakers:    breaker.NewSet(cfg.CircuitBreaker),
+	}
+	deps.Breakers.ConfigureOutliers(cfg.OutlierDetection)
+	if cfg.Journal != nil {
+		requestJournal, err := journal.New(cfg.Journal)
+		if err != nil {
+			t.Fatalf("failed to open journal: %v", err)
+		}
+		t.Cleanup(func() { requestJournal.Close() })
+		deps.Journal = requestJournal
+	}
+	if cfg.APIKeys != nil {
+		keys, err := apikey.New(cfg.APIKeys, g.store)
+		if err != nil {
+			t.Fatalf("failed to load API keys: %v", err)
+		}
+		t.Cleanup(keys.Close)
+		deps.APIKeys = keys
+	}
+	if cfg.Tracing != nil {
+		tracer, err := tracing.New(cfg.Tracing)
+		if err != nil {
+			t.Fatalf("failed to configure tracing: %v", err)
+		}
+		t.Cleanup(func() { tracer.Close() })
+		deps.Tracer = tracer
+	}
+	// Stopped before the journal and tracer they write to
+	t.Cleanup(g.Close)
+	chain, httpHandler, grpcHandler, err := router.Build(cfg, deps)
+	if err != nil {
+		t.Fatalf("invalid configuration: %v", err)
+	}
+	g.handlers = append(g.handlers, httpHandler, grpcHandler)
+
+	mux := http.NewServeMux()
+	mux.Handle("/", chain)
+	mux.HandleFunc("/catalog", catalog.Handler(func() *config.Config { return cfg }))
+	g.httpServer = httptest.NewServer(mux)
+	g.URL = g.httpServer.URL
+
+	if cfg.RunTLSServer {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		serverOpts := []grpc.ServerOption{
+			grpc.MaxRecvMsgSize(cfg.MaxCallRecvMsgSize),
+			grpc.MaxSendMsgSize(cfg.MaxCallSendMsgSize),
+			grpc.ChainUnaryInterceptor(middleware.RequestIDUnary, middleware.RecoveryUnary),
+			grpc.ChainStreamInterceptor(middleware.RequestIDStream, middleware.RecoveryStream),
+		}
+		serverOpts = append(serverOpts, router.StreamProxyOptions(func() *router.GRPCHandler { return grpcHandler })...)
+		g.grpcServer = grpc.NewServer(serverOpts...)
+		grpcHandler.RegisterService(g.grpcServer)
+		go g.grpcServer.Serve(lis)
+		g.GRPCAddr = lis.Addr().String()
+	}
+
+	return g
+}
+
+// Close stops the gateway; it is called automatically at test cleanup
+func (g *Gateway) Close() {
+	if g.httpServer != nil {
+		g.httpServer.Close()
+	}
+	if g.grpcServer != nil {
+		g.grpcServer.Stop()
+	}
+	for _, h := range g.handlers {
+		h.Close()
+	}
+	g.pool.CloseAll()
+	g.store.Close()
+}
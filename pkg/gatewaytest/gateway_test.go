@@ -0,0 +1,99 @@
+package gatewaytest
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"dynamic-gateway/internal/config"
+)
+
+func TestStartHTTP(t *testing.T) {
+	backend := NewHTTPBackend(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello from "+r.URL.Path)
+	}))
+
+	tests := []struct {
+		name          string
+		middleware    []config.Middleware
+		path          string
+		wantStatus    int
+		wantBody      string
+		wantRequestID bool
+	}{
+		{
+			name:          "default pipeline",
+			path:          "/api/users",
+			wantStatus:    http.StatusOK,
+			wantBody:      "hello from /api/users",
+			wantRequestID: true,
+		},
+		{
+			name:       "configured pipeline",
+			middleware: []config.Middleware{{Name: "recovery"}},
+			path:       "/api/users",
+			wantStatus: http.StatusOK,
+			wantBody:   "hello from /api/users",
+		},
+		{
+			name:          "unmatched path",
+			path:          "/other",
+			wantStatus:    http.StatusNotFound,
+			wantRequestID: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := NewConfig().
+				HTTPRoute("/api/*", backend).
+				Modify(func(cfg *config.Config) { cfg.Middleware = tt.middleware }).
+				Build()
+			g := Start(t, cfg)
+
+			resp, err := http.Get(g.URL + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantBody != "" && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+			if got := resp.Header.Get("X-Request-Id") != ""; got != tt.wantRequestID {
+				t.Errorf("request ID set = %v, want %v", got, tt.wantRequestID)
+			}
+		})
+	}
+}
+
+func TestStartGRPC(t *testing.T) {
+	backend := NewGRPCBackend(t, func(s *grpc.Server) {
+		healthpb.RegisterHealthServer(s, health.NewServer())
+	})
+	cfg := NewConfig().GRPCService("grpc.health.v1.Health", backend).Build()
+	g := Start(t, cfg)
+
+	conn, err := grpc.NewClient(g.GRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check through the gateway: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status = %v, want SERVING", resp.Status)
+	}
+}